@@ -0,0 +1,227 @@
+// Package cdc provides a change-data-capture feed: an ordered log of every
+// write applied to the database, readable as Go channels, over a client
+// connection, or as newline-delimited JSON files.
+package cdc
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+const DefaultRetention = 10000
+
+var (
+	ErrOffsetTruncated = errors.New("cdc: offset is older than the retained log")
+	ErrOffsetAhead     = errors.New("cdc: offset is past the end of the log")
+	ErrClosed          = errors.New("cdc: subscription closed")
+)
+
+type Event struct {
+	Offset    uint64    `json:"offset"`
+	Timestamp time.Time `json:"timestamp"`
+	DB        int       `json:"db"`
+	Key       string    `json:"key"`
+	Command   string    `json:"command"`
+	Args      []string  `json:"args"`
+}
+
+// RESP encodes the event as the array pushed to CDC SUBSCRIBE connections:
+// "cdc", offset, unix milliseconds, db, key, command, args.
+func (e Event) RESP() resp.Value {
+	args := make([]resp.Value, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = resp.NewBulkString([]byte(arg))
+	}
+	return resp.NewArray([]resp.Value{
+		resp.NewBulkString([]byte("cdc")),
+		resp.NewInteger(int64(e.Offset)),
+		resp.NewInteger(e.Timestamp.UnixMilli()),
+		resp.NewInteger(int64(e.DB)),
+		resp.NewBulkString([]byte(e.Key)),
+		resp.NewBulkString([]byte(e.Command)),
+		resp.NewArray(args),
+	})
+}
+
+// Feed keeps the most recent events in a ring so subscribers can resume from
+// an earlier offset. Offsets start at 1, or after the offset given to
+// ResumeAfter, and increase by one per event.
+type Feed struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	ring   []Event
+	first  uint64
+	next   uint64
+	closed bool
+}
+
+func NewFeed(retention int) *Feed {
+	if retention <= 0 {
+		retention = DefaultRetention
+	}
+	f := &Feed{
+		ring:  make([]Event, retention),
+		first: 1,
+		next:  1,
+	}
+	f.cond = sync.NewCond(&f.mu)
+	return f
+}
+
+func (f *Feed) Append(db int, key, command string, args []string) Event {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	ev := Event{
+		Offset:    f.next,
+		Timestamp: time.Now(),
+		DB:        db,
+		Key:       key,
+		Command:   command,
+		Args:      args,
+	}
+	f.ring[f.next%uint64(len(f.ring))] = ev
+	f.next++
+	if f.next-f.first > uint64(len(f.ring)) {
+		f.first = f.next - uint64(len(f.ring))
+	}
+	f.cond.Broadcast()
+	return ev
+}
+
+// ResumeAfter continues numbering after last, so a process that restarts
+// with a consumer that has already recorded events up to last (for example
+// LastFileOffset of a FileWriter's directory) does not reuse their offsets.
+// It never moves the feed backwards; events older than last+1 are dropped.
+func (f *Feed) ResumeAfter(last uint64) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if last+1 > f.next {
+		f.first = last + 1
+		f.next = last + 1
+	}
+}
+
+// Offset returns the offset of the most recent event, or 0 if none.
+func (f *Feed) Offset() uint64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.next - 1
+}
+
+func (f *Feed) Close() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.closed = true
+	f.cond.Broadcast()
+}
+
+type Subscription struct {
+	C <-chan Event
+
+	feed   *Feed
+	c      chan Event
+	done   chan struct{}
+	once   sync.Once
+	mu     sync.Mutex
+	err    error
+	cursor uint64
+}
+
+// Subscribe streams events starting at offset from. A from of 0 starts after
+// the most recent event; an offset past that returns ErrOffsetAhead. Events
+// are delivered in order and none are skipped; a subscriber that falls
+// behind the retained log is closed with ErrOffsetTruncated.
+func (f *Feed) Subscribe(from uint64) (*Subscription, error) {
+	f.mu.Lock()
+	if from == 0 {
+		from = f.next
+	}
+	if from < f.first {
+		f.mu.Unlock()
+		return nil, ErrOffsetTruncated
+	}
+	if from > f.next {
+		f.mu.Unlock()
+		return nil, ErrOffsetAhead
+	}
+	f.mu.Unlock()
+
+	c := make(chan Event, 64)
+	sub := &Subscription{
+		C:      c,
+		feed:   f,
+		c:      c,
+		done:   make(chan struct{}),
+		cursor: from,
+	}
+	go sub.run()
+	return sub, nil
+}
+
+func (s *Subscription) run() {
+	defer close(s.c)
+	for {
+		ev, err := s.feed.wait(s.cursor, s.done)
+		if err != nil {
+			s.setErr(err)
+			return
+		}
+		select {
+		case s.c <- ev:
+			s.cursor++
+		case <-s.done:
+			s.setErr(ErrClosed)
+			return
+		}
+	}
+}
+
+func (f *Feed) wait(offset uint64, done chan struct{}) (Event, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for offset >= f.next {
+		if f.closed {
+			return Event{}, ErrClosed
+		}
+		select {
+		case <-done:
+			return Event{}, ErrClosed
+		default:
+		}
+		f.cond.Wait()
+	}
+	if offset < f.first {
+		return Event{}, ErrOffsetTruncated
+	}
+	return f.ring[offset%uint64(len(f.ring))], nil
+}
+
+// Close stops delivery. The channel is closed once the subscription's
+// goroutine notices.
+func (s *Subscription) Close() {
+	s.once.Do(func() {
+		close(s.done)
+		s.feed.mu.Lock()
+		s.feed.cond.Broadcast()
+		s.feed.mu.Unlock()
+	})
+}
+
+// Err reports why the channel was closed.
+func (s *Subscription) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Subscription) setErr(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.err == nil {
+		s.err = err
+	}
+}
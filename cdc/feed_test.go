@@ -0,0 +1,100 @@
+package cdc
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func next(t *testing.T, sub *Subscription) Event {
+	t.Helper()
+	select {
+	case ev, ok := <-sub.C:
+		if !ok {
+			t.Fatalf("the subscription ended: %v", sub.Err())
+		}
+		return ev
+	case <-time.After(2 * time.Second):
+		t.Fatal("no event was delivered")
+	}
+	return Event{}
+}
+
+func TestFeedDeliversInOrder(t *testing.T) {
+	f := NewFeed(8)
+	if f.Offset() != 0 {
+		t.Fatalf("an empty feed is at offset %d", f.Offset())
+	}
+	f.Append(0, "a", "SET", []string{"a", "1"})
+	live, _ := f.Subscribe(0)
+	defer live.Close()
+	for i := 2; i < 20; i++ {
+		f.Append(0, "b", "INCR", []string{"b"})
+		if ev := next(t, live); ev.Offset != uint64(i) || ev.Command != "INCR" {
+			t.Fatalf("got %+v, want the INCR at offset %d", ev, i)
+		}
+	}
+}
+
+func TestFeedSubscriberFallsBehind(t *testing.T) {
+	f := NewFeed(8)
+	sub, _ := f.Subscribe(0)
+	// The subscription buffers at most 64 events, and the feed drops the
+	// rest before they are read.
+	for range 100 {
+		f.Append(0, "k", "INCR", []string{"k"})
+	}
+	var offsets []uint64
+	for ev := range sub.C {
+		offsets = append(offsets, ev.Offset)
+	}
+	if len(offsets) > 64 {
+		t.Fatalf("received %d events past a full buffer", len(offsets))
+	}
+	for i, offset := range offsets {
+		if offset != uint64(i+1) {
+			t.Fatalf("received offsets %v, want consecutive ones from 1", offsets)
+		}
+	}
+	if !errors.Is(sub.Err(), ErrOffsetTruncated) {
+		t.Fatalf("the subscription ended with %v, want ErrOffsetTruncated", sub.Err())
+	}
+}
+
+func TestFeedSubscribeTruncated(t *testing.T) {
+	f := NewFeed(2)
+	for range 5 {
+		f.Append(0, "k", "DEL", []string{"k"})
+	}
+	if _, err := f.Subscribe(3); !errors.Is(err, ErrOffsetTruncated) {
+		t.Fatalf("Subscribe(3) = %v, want ErrOffsetTruncated", err)
+	}
+	if _, err := f.Subscribe(7); !errors.Is(err, ErrOffsetAhead) {
+		t.Fatalf("Subscribe(7) = %v, want ErrOffsetAhead", err)
+	}
+	sub, err := f.Subscribe(4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ev := next(t, sub); ev.Offset != 4 {
+		t.Fatalf("got offset %d, want 4", ev.Offset)
+	}
+	sub.Close()
+	for range sub.C {
+	}
+	if !errors.Is(sub.Err(), ErrClosed) {
+		t.Fatalf("a closed subscription ended with %v", sub.Err())
+	}
+}
+
+func TestFeedClose(t *testing.T) {
+	f := NewFeed(0)
+	sub, _ := f.Subscribe(0)
+	f.Close()
+	if _, ok := <-sub.C; ok {
+		t.Fatal("a closed feed delivered an event")
+	}
+	if !errors.Is(sub.Err(), ErrClosed) {
+		t.Fatalf("the subscription ended with %v, want ErrClosed", sub.Err())
+	}
+}
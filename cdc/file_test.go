@@ -0,0 +1,122 @@
+package cdc
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestFileWriterRotatesAndResumes(t *testing.T) {
+	dir := t.TempDir()
+	w, err := NewFileWriter(dir, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := NewFeed(0)
+	for range 10 {
+		ev := f.Append(0, "key", "SET", []string{"key", "value"})
+		if err := w.Write(ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "cdc-*.ndjson"))
+	if len(names) < 2 {
+		t.Fatalf("wrote %d files, want the log rotated", len(names))
+	}
+	if filepath.Base(names[0]) != "cdc-00000000000000000001.ndjson" {
+		t.Fatalf("the first file is %s", names[0])
+	}
+	last, err := LastFileOffset(dir)
+	if err != nil || last != 10 {
+		t.Fatalf("LastFileOffset = %d, %v, want 10", last, err)
+	}
+
+	// A writer resuming after the last offset runs until the feed closes.
+	sub, err := f.Subscribe(last + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Append(0, "key", "DEL", []string{"key"})
+	f.Close()
+	w, _ = NewFileWriter(dir, 200)
+	if err := w.Run(sub); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if last, _ := LastFileOffset(dir); last != 11 {
+		t.Fatalf("LastFileOffset = %d after Run, want 11", last)
+	}
+}
+
+func TestFileWriterResumesAfterRestart(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFeed(0)
+	sub, _ := f.Subscribe(1)
+	for range 3 {
+		f.Append(0, "key", "INCR", []string{"key"})
+	}
+	f.Close()
+	w, _ := NewFileWriter(dir, 0)
+	if err := w.Run(sub); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	// The restarted process numbers its events after the ones on disk, and
+	// the writer picks up with the first of them.
+	last, err := LastFileOffset(dir)
+	if err != nil || last != 3 {
+		t.Fatalf("LastFileOffset = %d, %v, want 3", last, err)
+	}
+	f = NewFeed(0)
+	f.ResumeAfter(last)
+	if f.Offset() != 3 {
+		t.Fatalf("a resumed feed is at offset %d, want 3", f.Offset())
+	}
+	sub, err = f.Subscribe(last + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Append(0, "key", "DEL", []string{"key"})
+	f.Close()
+	w, _ = NewFileWriter(dir, 0)
+	if err := w.Run(sub); err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+
+	names, _ := filepath.Glob(filepath.Join(dir, "cdc-*.ndjson"))
+	var offsets []uint64
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+			var ev Event
+			if err := json.Unmarshal([]byte(line), &ev); err != nil {
+				t.Fatal(err)
+			}
+			offsets = append(offsets, ev.Offset)
+		}
+	}
+	if !slices.Equal(offsets, []uint64{1, 2, 3, 4}) {
+		t.Fatalf("the log holds offsets %v, want 1 through 4", offsets)
+	}
+}
+
+func TestLastFileOffsetEmpty(t *testing.T) {
+	dir := t.TempDir()
+	if last, err := LastFileOffset(dir); last != 0 || err != nil {
+		t.Fatalf("LastFileOffset of an empty dir = %d, %v", last, err)
+	}
+	// A partly written last line is skipped.
+	os.WriteFile(filepath.Join(dir, "cdc-00000000000000000001.ndjson"), []byte(`{"offset":1}`+"\n"+`{"offs`), 0644)
+	if last, err := LastFileOffset(dir); last != 1 || err != nil {
+		t.Fatalf("LastFileOffset = %d, %v, want 1", last, err)
+	}
+}
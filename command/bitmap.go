@@ -0,0 +1,640 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"math/bits"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// parseBitOffset parses a bit offset, optionally in the "#N" form BITFIELD
+// uses to mean N times the field width, and bounds it by the maximum string
+// size.
+func parseBitOffset(arg string, hashAllowed bool, width int64) (int64, bool) {
+	multiply := false
+	if hashAllowed && strings.HasPrefix(arg, "#") {
+		multiply = true
+		arg = arg[1:]
+	}
+	offset, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	if multiply {
+		if offset > math.MaxInt64/width || offset < math.MinInt64/width {
+			return 0, false
+		}
+		offset *= width
+	}
+	if offset < 0 || offset>>3 >= maxStringSize {
+		return 0, false
+	}
+	return offset, true
+}
+
+func SetBitCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'setbit' command")
+	}
+	key := string(args[0].Bulk)
+	offset, ok := parseBitOffset(string(args[1].Bulk), false, 0)
+	if !ok {
+		return resp.NewError("ERR bit offset is not an integer or out of range")
+	}
+	bit := string(args[2].Bulk)
+	if bit != "0" && bit != "1" {
+		return resp.NewError("ERR bit is not an integer or out of range")
+	}
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		str = database.NewString("")
+		db.Set(key, str, 0)
+	}
+
+	old := 0
+	byteIdx := int(offset >> 3)
+	mask := byte(1) << (7 - uint(offset&7))
+	str.Mutate(byteIdx+1, func(buf []byte) {
+		if buf[byteIdx]&mask != 0 {
+			old = 1
+		}
+		if bit == "1" {
+			buf[byteIdx] |= mask
+		} else {
+			buf[byteIdx] &^= mask
+		}
+	})
+	db.Notify(database.NotifyString, "setbit", key)
+	return resp.NewInteger(int64(old))
+}
+
+func GetBitCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'getbit' command")
+	}
+	offset, ok := parseBitOffset(string(args[1].Bulk), false, 0)
+	if !ok {
+		return resp.NewError("ERR bit offset is not an integer or out of range")
+	}
+
+	str, ok := lookupString(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	bit := 0
+	if str != nil {
+		str.View(func(buf []byte) {
+			byteIdx := offset >> 3
+			if byteIdx < int64(len(buf)) && buf[byteIdx]&(1<<(7-uint(offset&7))) != 0 {
+				bit = 1
+			}
+		})
+	}
+	return resp.NewInteger(int64(bit))
+}
+
+// parseBitRange parses the optional "start end [BYTE|BIT]" arguments of
+// BITCOUNT and BITPOS. isBit reports whether the offsets are in bits.
+func parseBitRange(args []resp.Value) (start, end int64, isBit bool, err error) {
+	start, err = strconv.ParseInt(string(args[0].Bulk), 10, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	if len(args) == 1 {
+		return start, 0, false, nil
+	}
+	end, err = strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return 0, 0, false, fmt.Errorf("ERR value is not an integer or out of range")
+	}
+	if len(args) == 3 {
+		switch strings.ToUpper(string(args[2].Bulk)) {
+		case "BYTE":
+		case "BIT":
+			isBit = true
+		default:
+			return 0, 0, false, fmt.Errorf("ERR syntax error")
+		}
+	} else if len(args) > 3 {
+		return 0, 0, false, fmt.Errorf("ERR syntax error")
+	}
+	return start, end, isBit, nil
+}
+
+// normalizeRange resolves negative offsets against total and clamps the range
+// to [0, total-1]. ok is false when the range is empty.
+func normalizeRange(start, end, total int64) (int64, int64, bool) {
+	if start < 0 {
+		start += total
+	}
+	if end < 0 {
+		end += total
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= total {
+		end = total - 1
+	}
+	return start, end, total > 0 && start <= end
+}
+
+func BitCountCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'bitcount' command")
+	}
+	if len(args) == 2 {
+		return resp.NewError("ERR syntax error")
+	}
+	var start, end int64
+	isBit, ranged := false, len(args) > 1
+	if ranged {
+		var err error
+		start, end, isBit, err = parseBitRange(args[1:])
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+
+	str, ok := lookupString(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return resp.NewInteger(0)
+	}
+
+	count := 0
+	str.View(func(buf []byte) {
+		total := int64(len(buf))
+		if isBit {
+			total *= 8
+		}
+		if !ranged {
+			start, end = 0, total-1
+		}
+		first, last, nonEmpty := normalizeRange(start, end, total)
+		if !nonEmpty {
+			return
+		}
+		if !isBit {
+			first, last = first*8, last*8+7
+		}
+		count = countBits(buf, first, last)
+	})
+	return resp.NewInteger(int64(count))
+}
+
+// countBits counts the set bits between bit offsets first and last inclusive.
+func countBits(buf []byte, first, last int64) int {
+	firstByte, lastByte := first>>3, last>>3
+	headMask := byte(0xff) >> uint(first&7)
+	tailMask := byte(0xff) << uint(7-last&7)
+	if firstByte == lastByte {
+		return bits.OnesCount8(buf[firstByte] & headMask & tailMask)
+	}
+	count := bits.OnesCount8(buf[firstByte]&headMask) + bits.OnesCount8(buf[lastByte]&tailMask)
+	for _, b := range buf[firstByte+1 : lastByte] {
+		count += bits.OnesCount8(b)
+	}
+	return count
+}
+
+func BitPosCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args) > 5 {
+		return resp.NewError("ERR wrong number of arguments for 'bitpos' command")
+	}
+	bit := string(args[1].Bulk)
+	if bit != "0" && bit != "1" {
+		return resp.NewError("ERR The bit argument must be 1 or 0.")
+	}
+	want := bit == "1"
+
+	var start, end int64
+	isBit := false
+	startGiven, endGiven := len(args) > 2, len(args) > 3
+	if startGiven {
+		var err error
+		start, end, isBit, err = parseBitRange(args[2:])
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+
+	str, ok := lookupString(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		if want {
+			return resp.NewInteger(-1)
+		}
+		return resp.NewInteger(0)
+	}
+
+	pos := int64(-1)
+	str.View(func(buf []byte) {
+		total := int64(len(buf))
+		if isBit {
+			total *= 8
+		}
+		if !endGiven {
+			end = total - 1
+		}
+		first, last, nonEmpty := normalizeRange(start, end, total)
+		if !nonEmpty {
+			return
+		}
+		if !isBit {
+			first, last = first*8, last*8+7
+		}
+		pos = findBit(buf, first, last, want)
+		if pos == -1 && !want && !endGiven {
+			pos = last + 1
+		}
+	})
+	return resp.NewInteger(pos)
+}
+
+// findBit returns the offset of the first bit equal to want between first
+// and last inclusive, or -1. Whole bytes that cannot match are skipped.
+func findBit(buf []byte, first, last int64, want bool) int64 {
+	skip := byte(0)
+	if !want {
+		skip = 0xff
+	}
+	for pos := first; pos <= last; {
+		if pos&7 == 0 && pos+7 <= last && buf[pos>>3] == skip {
+			pos += 8
+			continue
+		}
+		if (buf[pos>>3]&(1<<(7-uint(pos&7))) != 0) == want {
+			return pos
+		}
+		pos++
+	}
+	return -1
+}
+
+func BitOpCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'bitop' command")
+	}
+	op := strings.ToUpper(string(args[0].Bulk))
+	switch op {
+	case "AND", "OR", "XOR":
+	case "NOT":
+		if len(args) != 3 {
+			return resp.NewError("ERR BITOP NOT must be called with a single source key.")
+		}
+	default:
+		return resp.NewError("ERR syntax error")
+	}
+	destKey := string(args[1].Bulk)
+
+	sources := make([][]byte, 0, len(args)-2)
+	maxLen := 0
+	for _, arg := range args[2:] {
+		str, ok := lookupString(db, string(arg.Bulk))
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		var src []byte
+		if str != nil {
+			src = []byte(str.Get())
+		}
+		sources = append(sources, src)
+		if len(src) > maxLen {
+			maxLen = len(src)
+		}
+	}
+
+	result := make([]byte, maxLen)
+	for i := range result {
+		var out byte
+		for j, src := range sources {
+			var b byte
+			if i < len(src) {
+				b = src[i]
+			}
+			switch {
+			case op == "NOT":
+				out = ^b
+			case j == 0:
+				out = b
+			case op == "AND":
+				out &= b
+			case op == "OR":
+				out |= b
+			case op == "XOR":
+				out ^= b
+			}
+		}
+		result[i] = out
+	}
+
+	if maxLen == 0 {
+		if db.Delete(destKey) {
+			db.Notify(database.NotifyGeneric, "del", destKey)
+		}
+		return resp.NewInteger(0)
+	}
+	db.Set(destKey, database.NewString(string(result)), 0)
+	db.Notify(database.NotifyString, "set", destKey)
+	return resp.NewInteger(int64(maxLen))
+}
+
+const (
+	overflowWrap = iota
+	overflowSat
+	overflowFail
+)
+
+type bitfieldOp struct {
+	kind     string
+	signed   bool
+	width    int64
+	offset   int64
+	value    int64
+	overflow int
+}
+
+func BitFieldCommand(db *database.Database, args []resp.Value) resp.Value {
+	return bitfieldGeneric(db, args, false)
+}
+
+func BitFieldROCommand(db *database.Database, args []resp.Value) resp.Value {
+	return bitfieldGeneric(db, args, true)
+}
+
+// bitfieldGeneric implements BITFIELD and BITFIELD_RO. All operations are
+// parsed before any is executed, so a syntax error leaves the key untouched.
+func bitfieldGeneric(db *database.Database, args []resp.Value, readOnly bool) resp.Value {
+	name := "bitfield"
+	if readOnly {
+		name = "bitfield_ro"
+	}
+	if len(args) < 1 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	key := string(args[0].Bulk)
+
+	ops := make([]bitfieldOp, 0)
+	overflow := overflowWrap
+	writes := false
+	for i := 1; i < len(args); i++ {
+		sub := strings.ToUpper(string(args[i].Bulk))
+		remaining := len(args) - i - 1
+		switch {
+		case sub == "OVERFLOW" && remaining >= 1:
+			switch strings.ToUpper(string(args[i+1].Bulk)) {
+			case "WRAP":
+				overflow = overflowWrap
+			case "SAT":
+				overflow = overflowSat
+			case "FAIL":
+				overflow = overflowFail
+			default:
+				return resp.NewError("ERR Invalid OVERFLOW type specified")
+			}
+			i++
+			continue
+		case sub == "GET" && remaining >= 2:
+		case (sub == "SET" || sub == "INCRBY") && remaining >= 3:
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+
+		op := bitfieldOp{kind: sub, overflow: overflow}
+		var ok bool
+		op.signed, op.width, ok = parseBitfieldType(string(args[i+1].Bulk))
+		if !ok {
+			return resp.NewError("ERR Invalid bitfield type. Use something like i16 u8. Note that u64 is not supported but i64 is.")
+		}
+		op.offset, ok = parseBitOffset(string(args[i+2].Bulk), true, op.width)
+		if !ok {
+			return resp.NewError("ERR bit offset is not an integer or out of range")
+		}
+		i += 2
+		if sub != "GET" {
+			if readOnly {
+				return resp.NewError("ERR BITFIELD_RO only supports the GET subcommand")
+			}
+			value, err := strconv.ParseInt(string(args[i+1].Bulk), 10, 64)
+			if err != nil {
+				return resp.NewError("ERR value is not an integer or out of range")
+			}
+			op.value = value
+			writes = true
+			i++
+		}
+		ops = append(ops, op)
+	}
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		if !writes {
+			result := make([]resp.Value, len(ops))
+			for i := range result {
+				result[i] = resp.NewInteger(0)
+			}
+			return resp.NewArray(result)
+		}
+		str = database.NewString("")
+		db.Set(key, str, 0)
+	}
+
+	needed := 0
+	for _, op := range ops {
+		if op.kind != "GET" {
+			if n := int((op.offset + op.width - 1) >> 3); n+1 > needed {
+				needed = n + 1
+			}
+		}
+	}
+
+	result := make([]resp.Value, len(ops))
+	changed := false
+	run := func(buf []byte) {
+		for i, op := range ops {
+			result[i] = op.apply(buf, &changed)
+		}
+	}
+	if writes {
+		str.Mutate(needed, run)
+	} else {
+		str.View(run)
+	}
+	if changed {
+		db.Notify(database.NotifyString, "setbit", key)
+	}
+	return resp.NewArray(result)
+}
+
+func parseBitfieldType(s string) (signed bool, width int64, ok bool) {
+	if len(s) < 2 {
+		return false, 0, false
+	}
+	switch s[0] {
+	case 'i', 'I':
+		signed = true
+	case 'u', 'U':
+	default:
+		return false, 0, false
+	}
+	width, err := strconv.ParseInt(s[1:], 10, 64)
+	if err != nil || width < 1 || (signed && width > 64) || (!signed && width > 63) {
+		return false, 0, false
+	}
+	return signed, width, true
+}
+
+func (op bitfieldOp) apply(buf []byte, changed *bool) resp.Value {
+	old := getBitfield(buf, op.offset, op.width)
+	if op.signed {
+		old = signExtend(old, op.width)
+	}
+	if op.kind == "GET" {
+		return resp.NewInteger(int64(old))
+	}
+
+	var newVal uint64
+	var overflow bool
+	if op.signed {
+		base, incr := op.value, int64(0)
+		if op.kind == "INCRBY" {
+			base, incr = int64(old), op.value
+		}
+		var v int64
+		v, overflow = signedBitfieldAdd(base, incr, op.width, op.overflow)
+		newVal = uint64(v)
+	} else {
+		base, incr := uint64(op.value), int64(0)
+		if op.kind == "INCRBY" {
+			base, incr = old, op.value
+		}
+		newVal, overflow = unsignedBitfieldAdd(base, incr, op.width, op.overflow)
+	}
+	if overflow && op.overflow == overflowFail {
+		return resp.NewNullBulkString()
+	}
+
+	setBitfield(buf, op.offset, op.width, newVal)
+	*changed = true
+	if op.kind == "SET" {
+		return resp.NewInteger(int64(old))
+	}
+	return resp.NewInteger(int64(newVal))
+}
+
+func getBitfield(buf []byte, offset, width int64) uint64 {
+	var value uint64
+	for j := int64(0); j < width; j++ {
+		pos := offset + j
+		var bit uint64
+		if byteIdx := pos >> 3; byteIdx < int64(len(buf)) && buf[byteIdx]&(1<<(7-uint(pos&7))) != 0 {
+			bit = 1
+		}
+		value = value<<1 | bit
+	}
+	return value
+}
+
+func setBitfield(buf []byte, offset, width int64, value uint64) {
+	for j := int64(0); j < width; j++ {
+		pos := offset + j
+		mask := byte(1) << (7 - uint(pos&7))
+		if value&(uint64(1)<<uint(width-1-j)) != 0 {
+			buf[pos>>3] |= mask
+		} else {
+			buf[pos>>3] &^= mask
+		}
+	}
+}
+
+func signExtend(value uint64, width int64) uint64 {
+	if width < 64 && value&(uint64(1)<<uint(width-1)) != 0 {
+		value |= math.MaxUint64 << uint(width)
+	}
+	return value
+}
+
+// signedBitfieldAdd adds incr to value within a signed field of the given
+// width, applying the overflow policy. It mirrors Redis's
+// checkSignedBitfieldOverflow.
+func signedBitfieldAdd(value, incr, width int64, policy int) (int64, bool) {
+	max := int64(math.MaxInt64)
+	if width < 64 {
+		max = int64(1)<<uint(width-1) - 1
+	}
+	min := -max - 1
+	maxIncr := int64(uint64(max) - uint64(value))
+	minIncr := min - value
+
+	wrap := func() int64 {
+		c := uint64(value) + uint64(incr)
+		if width < 64 {
+			mask := uint64(math.MaxUint64) << uint(width)
+			if c&(uint64(1)<<uint(width-1)) != 0 {
+				c |= mask
+			} else {
+				c &^= mask
+			}
+		}
+		return int64(c)
+	}
+
+	switch {
+	case value > max || (width != 64 && incr > maxIncr) || (value >= 0 && incr > 0 && incr > maxIncr):
+		if policy == overflowSat {
+			return max, true
+		}
+		return wrap(), true
+	case value < min || (width != 64 && incr < minIncr) || (value < 0 && incr < 0 && incr < minIncr):
+		if policy == overflowSat {
+			return min, true
+		}
+		return wrap(), true
+	}
+	return value + incr, false
+}
+
+// unsignedBitfieldAdd is the unsigned counterpart of signedBitfieldAdd,
+// mirroring checkUnsignedBitfieldOverflow.
+func unsignedBitfieldAdd(value uint64, incr, width int64, policy int) (uint64, bool) {
+	max := uint64(1)<<uint(width) - 1
+	maxIncr := int64(max - value)
+	minIncr := -int64(value)
+
+	wrap := func() uint64 {
+		return (value + uint64(incr)) &^ (math.MaxUint64 << uint(width))
+	}
+
+	switch {
+	case value > max || (incr > 0 && incr > maxIncr):
+		if policy == overflowSat {
+			return max, true
+		}
+		return wrap(), true
+	case incr < 0 && incr < minIncr:
+		if policy == overflowSat {
+			return 0, true
+		}
+		return wrap(), true
+	}
+	return value + uint64(incr), false
+}
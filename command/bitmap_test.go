@@ -0,0 +1,96 @@
+package command
+
+import "testing"
+
+func TestSetBitAndGetBit(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "SETBIT", "k", "7", "1"), "0")
+	expectReply(t, run(p, "SETBIT", "k", "7", "0"), "1")
+	expectReply(t, run(p, "SETBIT", "k", "100", "1"), "0")
+	expectReply(t, run(p, "GETBIT", "k", "100"), "1")
+	expectReply(t, run(p, "GETBIT", "k", "101"), "0")
+	expectReply(t, run(p, "GETBIT", "k", "100000"), "0")
+	expectReply(t, run(p, "STRLEN", "k"), "13")
+
+	expectError(t, run(p, "SETBIT", "k", "-1", "1"), "SETBIT at a negative offset")
+	expectError(t, run(p, "SETBIT", "k", "4294967296", "1"), "SETBIT past 512MB")
+	expectError(t, run(p, "SETBIT", "k", "0", "2"), "SETBIT of 2")
+	run(p, "RPUSH", "list", "a")
+	expectError(t, run(p, "GETBIT", "list", "0"), "GETBIT of a list")
+}
+
+func TestBitCount(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "k", "foobar")
+	expectReply(t, run(p, "BITCOUNT", "k"), "26")
+	expectReply(t, run(p, "BITCOUNT", "k", "0", "0"), "4")
+	expectReply(t, run(p, "BITCOUNT", "k", "1", "1"), "6")
+	expectReply(t, run(p, "BITCOUNT", "k", "1", "1", "BYTE"), "6")
+	expectReply(t, run(p, "BITCOUNT", "k", "5", "30", "BIT"), "17")
+	expectReply(t, run(p, "BITCOUNT", "k", "-2", "-1"), "7")
+	expectReply(t, run(p, "BITCOUNT", "k", "4", "2"), "0")
+	expectReply(t, run(p, "BITCOUNT", "missing"), "0")
+	expectError(t, run(p, "BITCOUNT", "k", "0"), "BITCOUNT with only a start")
+	expectError(t, run(p, "BITCOUNT", "k", "0", "1", "WORD"), "BITCOUNT WORD")
+}
+
+func TestBitPos(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "k", "\xff\xf0\x00")
+	expectReply(t, run(p, "BITPOS", "k", "0"), "12")
+	run(p, "SET", "k", "\x00\xff\xf0")
+	expectReply(t, run(p, "BITPOS", "k", "1", "0"), "8")
+	expectReply(t, run(p, "BITPOS", "k", "1", "2"), "16")
+	expectReply(t, run(p, "BITPOS", "k", "1", "2", "-1", "BYTE"), "16")
+	expectReply(t, run(p, "BITPOS", "k", "1", "7", "15", "BIT"), "8")
+
+	// A clear bit is past the end of an all-ones string unless the range
+	// has an explicit end.
+	run(p, "SET", "ones", "\xff\xff")
+	expectReply(t, run(p, "BITPOS", "ones", "0"), "16")
+	expectReply(t, run(p, "BITPOS", "ones", "0", "0", "-1"), "-1")
+	expectReply(t, run(p, "BITPOS", "missing", "0"), "0")
+	expectReply(t, run(p, "BITPOS", "missing", "1"), "-1")
+	expectError(t, run(p, "BITPOS", "k", "2"), "BITPOS of 2")
+}
+
+func TestBitOp(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "a", "foobar")
+	run(p, "SET", "b", "abcdef")
+	expectReply(t, run(p, "BITOP", "AND", "dest", "a", "b"), "6")
+	expectReply(t, run(p, "GET", "dest"), "`bc`ab")
+	expectReply(t, run(p, "BITOP", "OR", "dest", "a", "b"), "6")
+	expectReply(t, run(p, "GET", "dest"), "goofev")
+
+	// Shorter sources are padded with zero bytes.
+	run(p, "SET", "short", "\xff")
+	expectReply(t, run(p, "BITOP", "XOR", "dest", "short", "a"), "6")
+	expectReply(t, run(p, "GETRANGE", "dest", "1", "-1"), "oobar")
+	expectReply(t, run(p, "BITOP", "NOT", "dest", "short"), "1")
+	expectReply(t, run(p, "GET", "dest"), "\x00")
+
+	// An empty result deletes the destination.
+	expectReply(t, run(p, "BITOP", "AND", "dest", "missing"), "0")
+	expectReply(t, run(p, "EXISTS", "dest"), "0")
+	expectError(t, run(p, "BITOP", "NOT", "dest", "a", "b"), "BITOP NOT of two keys")
+	expectError(t, run(p, "BITOP", "NAND", "dest", "a"), "BITOP NAND")
+}
+
+func TestBitField(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "BITFIELD", "k", "INCRBY", "i5", "100", "1", "GET", "u4", "0"), "1", "0")
+	expectReply(t, run(p, "BITFIELD", "k", "SET", "u8", "#1", "255", "GET", "u8", "8"), "0", "255")
+
+	for _, want := range [][]string{{"1", "1"}, {"2", "2"}, {"3", "3"}, {"0", "3"}} {
+		expectReply(t, run(p, "BITFIELD", "c", "INCRBY", "u2", "100", "1", "OVERFLOW", "SAT", "INCRBY", "u2", "102", "1"), want...)
+	}
+	expectReply(t, run(p, "BITFIELD", "f", "OVERFLOW", "FAIL", "INCRBY", "i4", "0", "8", "GET", "i4", "0"), "<nil>", "0")
+	expectReply(t, run(p, "BITFIELD", "f", "SET", "i8", "0", "-128", "GET", "i8", "0"), "0", "-128")
+	expectReply(t, run(p, "BITFIELD_RO", "f", "GET", "u8", "0"), "128")
+
+	expectError(t, run(p, "BITFIELD", "k", "GET", "u64", "0"), "BITFIELD u64")
+	expectError(t, run(p, "BITFIELD", "k", "GET", "i0", "0"), "BITFIELD i0")
+	expectError(t, run(p, "BITFIELD", "k", "OVERFLOW", "NONE"), "BITFIELD OVERFLOW NONE")
+	expectError(t, run(p, "BITFIELD_RO", "k", "SET", "u8", "0", "1"), "BITFIELD_RO SET")
+}
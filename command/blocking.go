@@ -0,0 +1,305 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// Wait tells the processor that a blocking command has nothing to serve yet.
+type Wait struct {
+	Keys    []string
+	Timeout time.Duration // zero waits forever
+	Reply   resp.Value    // sent when the wait ends without being served
+	Args    []resp.Value  // arguments to retry with, if not the original ones
+}
+
+// BlockingFunc attempts a blocking command without waiting. It returns a
+// Wait when the client has to block, and the reply otherwise. While the
+// client is blocked the function is retried, in arrival order, whenever one
+// of the keys is modified.
+type BlockingFunc func(db *database.Database, args []resp.Value) (resp.Value, *Wait)
+
+// RegisterBlocking registers a command that may block. A rewrite
+// registered for it applies to the reply it is eventually served.
+func (p *Processor) RegisterBlocking(cmd string, fn BlockingFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.blocking[strings.ToUpper(cmd)] = fn
+}
+
+func (p *Processor) processBlocking(s *Session, commandName string, args []resp.Value, fn BlockingFunc, rewrite ExpandFunc) resp.Value {
+	attempt := func() (resp.Value, *Wait) {
+		var wait *Wait
+		reply := p.apply(commandName, args, rewrite, func() resp.Value {
+			var reply resp.Value
+			reply, wait = fn(p.db, args)
+			return reply
+		})
+		return reply, wait
+	}
+
+	p.exec.Lock()
+	reply, wait := attempt()
+	if wait == nil {
+		p.db.ServeReady()
+		p.exec.Unlock()
+		return reply
+	}
+	if wait.Args != nil {
+		args = wait.Args
+	}
+	var served resp.Value
+	w := p.db.Block(wait.Keys, func(string) bool {
+		reply, again := attempt()
+		// A key that now holds another type leaves the client blocked, as
+		// in Redis, until a later write serves it or it times out.
+		if again != nil || isWrongType(reply) {
+			return false
+		}
+		served = reply
+		return true
+	})
+
+	// The session is marked blocked before the lock is released, so a CLIENT
+	// UNBLOCK, which takes the lock too, either finds it blocked or runs
+	// before the command started waiting.
+	var unblock <-chan bool
+	var closed <-chan struct{}
+	if s != nil {
+		select {
+		case <-s.unblock:
+		default:
+		}
+		s.blocked.Store(true)
+		defer s.blocked.Store(false)
+		unblock, closed = s.unblock, s.closed
+	}
+	p.exec.Unlock()
+
+	var timeout <-chan time.Time
+	if wait.Timeout > 0 {
+		timer := time.NewTimer(wait.Timeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	reply = wait.Reply
+	select {
+	case <-w.Done():
+		return served
+	case <-timeout:
+	case <-closed:
+	case withError := <-unblock:
+		if withError {
+			reply = resp.NewError("UNBLOCKED client unblocked via CLIENT UNBLOCK")
+		}
+	}
+
+	p.exec.Lock()
+	waiting := p.db.Unblock(w)
+	p.exec.Unlock()
+	if !waiting {
+		return served
+	}
+	return reply
+}
+
+func isWrongType(reply resp.Value) bool {
+	return reply.Type == resp.ErrorType && strings.HasPrefix(reply.Str, "WRONGTYPE")
+}
+
+// parseTimeout parses a blocking timeout in seconds, which may be fractional.
+func parseTimeout(arg resp.Value) (time.Duration, error) {
+	seconds, err := strconv.ParseFloat(string(arg.Bulk), 64)
+	if err != nil || math.IsNaN(seconds) || math.IsInf(seconds, 0) {
+		return 0, errors.New("ERR timeout is not a float or out of range")
+	}
+	if seconds < 0 {
+		return 0, errors.New("ERR timeout is negative")
+	}
+	if seconds > float64(math.MaxInt64/int64(time.Second)) {
+		return 0, errors.New("ERR timeout is out of range")
+	}
+	return time.Duration(seconds * float64(time.Second)), nil
+}
+
+func BLPopCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	return bpopGeneric(db, args, true, "blpop")
+}
+
+func BRPopCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	return bpopGeneric(db, args, false, "brpop")
+}
+
+func bpopGeneric(db *database.Database, args []resp.Value, left bool, name string) (resp.Value, *Wait) {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for '" + name + "' command"), nil
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return resp.NewError(err.Error()), nil
+	}
+
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		key := string(arg.Bulk)
+		list, ok := lookupList(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		if list != nil {
+			element := popList(db, key, list, left, 1)[0]
+			return resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte(key)),
+				resp.NewBulkString([]byte(element)),
+			}), nil
+		}
+		keys = append(keys, key)
+	}
+	return resp.Value{}, &Wait{Keys: keys, Timeout: timeout, Reply: resp.NewNullArray()}
+}
+
+// rewriteBPop propagates BLPOP and BRPOP as the pop they performed.
+func rewriteBPop(name string) RewriteFunc {
+	return func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+		return name, reply.Array[:1]
+	}
+}
+
+func BLMoveCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	if len(args) != 5 {
+		return resp.NewError("ERR wrong number of arguments for 'blmove' command"), nil
+	}
+	from, ok1 := parseDirection(args[2])
+	to, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return resp.NewError("ERR syntax error"), nil
+	}
+	return blmoveGeneric(db, args, from, to, args[4])
+}
+
+func BRPopLPushCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'brpoplpush' command"), nil
+	}
+	return blmoveGeneric(db, args, false, true, args[2])
+}
+
+func blmoveGeneric(db *database.Database, args []resp.Value, from, to bool, timeoutArg resp.Value) (resp.Value, *Wait) {
+	timeout, err := parseTimeout(timeoutArg)
+	if err != nil {
+		return resp.NewError(err.Error()), nil
+	}
+	source := string(args[0].Bulk)
+	src, ok := lookupList(db, source)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+	}
+	if src == nil {
+		return resp.Value{}, &Wait{Keys: []string{source}, Timeout: timeout, Reply: resp.NewNullBulkString()}
+	}
+	return lmoveGeneric(db, source, string(args[1].Bulk), from, to), nil
+}
+
+// rewriteBLMove propagates BLMOVE and BRPOPLPUSH without their timeout.
+func rewriteBLMove(name string) RewriteFunc {
+	return func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+		return name, args[:len(args)-1]
+	}
+}
+
+func BLMPopCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'blmpop' command"), nil
+	}
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return resp.NewError(err.Error()), nil
+	}
+	keys, left, count, errReply := parseMPop(args[1:], parseDirection)
+	if errReply != nil {
+		return *errReply, nil
+	}
+
+	for _, key := range keys {
+		list, ok := lookupList(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		if list == nil {
+			continue
+		}
+		popped := popList(db, key, list, left, count)
+		return resp.NewArray([]resp.Value{resp.NewBulkString([]byte(key)), bulkStrings(popped)}), nil
+	}
+	return resp.Value{}, &Wait{Keys: keys, Timeout: timeout, Reply: resp.NewNullArray()}
+}
+
+func BZPopMinCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	return bzpopGeneric(db, args, false, "bzpopmin")
+}
+
+func BZPopMaxCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	return bzpopGeneric(db, args, true, "bzpopmax")
+}
+
+func bzpopGeneric(db *database.Database, args []resp.Value, highest bool, name string) (resp.Value, *Wait) {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for '" + name + "' command"), nil
+	}
+	timeout, err := parseTimeout(args[len(args)-1])
+	if err != nil {
+		return resp.NewError(err.Error()), nil
+	}
+
+	keys := make([]string, 0, len(args)-1)
+	for _, arg := range args[:len(args)-1] {
+		key := string(arg.Bulk)
+		zset, ok := lookupZSet(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		if zset != nil {
+			m := popZSet(db, key, zset, 1, highest)[0]
+			return resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte(key)),
+				resp.NewBulkString([]byte(m.Member)),
+				resp.NewBulkString([]byte(formatFloat(m.Score))),
+			}), nil
+		}
+		keys = append(keys, key)
+	}
+	return resp.Value{}, &Wait{Keys: keys, Timeout: timeout, Reply: resp.NewNullArray()}
+}
+
+func BZMPopCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'bzmpop' command"), nil
+	}
+	timeout, err := parseTimeout(args[0])
+	if err != nil {
+		return resp.NewError(err.Error()), nil
+	}
+	keys, lowest, count, errReply := parseMPop(args[1:], parseMinMax)
+	if errReply != nil {
+		return *errReply, nil
+	}
+
+	for _, key := range keys {
+		zset, ok := lookupZSet(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		if zset == nil {
+			continue
+		}
+		return zmpopReply(key, popZSet(db, key, zset, count, !lowest)), nil
+	}
+	return resp.Value{}, &Wait{Keys: keys, Timeout: timeout, Reply: resp.NewNullArray()}
+}
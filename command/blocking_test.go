@@ -0,0 +1,191 @@
+package command
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func newTestProcessor() *Processor {
+	return NewProcessor(database.NewDatabase(), nil)
+}
+
+func commandValue(args ...string) resp.Value {
+	values := make([]resp.Value, len(args))
+	for i, arg := range args {
+		values[i] = resp.NewBulkString([]byte(arg))
+	}
+	return resp.NewArray(values)
+}
+
+// run executes a command and returns its reply.
+func run(p *Processor, args ...string) resp.Value {
+	return p.Process(commandValue(args...))
+}
+
+// flatten renders a reply as strings: bulk and simple strings as they are,
+// integers in decimal, nulls as "<nil>" and nested arrays flattened.
+func flatten(v resp.Value) []string {
+	switch {
+	case v.Null:
+		return []string{"<nil>"}
+	case v.Type == resp.ArrayType:
+		var out []string
+		for _, e := range v.Array {
+			out = append(out, flatten(e)...)
+		}
+		return out
+	case v.Type == resp.IntegerType:
+		return []string{strconv.FormatInt(v.Num, 10)}
+	case v.Type == resp.BulkStringType:
+		return []string{string(v.Bulk)}
+	}
+	return []string{v.Str}
+}
+
+func expectReply(t *testing.T, got resp.Value, want ...string) {
+	t.Helper()
+	if got.Type == resp.ErrorType {
+		t.Fatalf("got error %q, want %q", got.Str, want)
+	}
+	expectStrings(t, flatten(got), want...)
+}
+
+func expectStrings(t *testing.T, got []string, want ...string) {
+	t.Helper()
+	if !slices.Equal(got, want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+}
+
+// block runs a blocking command for a new session in the background and
+// returns once the session is blocked, with the channel its reply arrives
+// on.
+func block(t *testing.T, p *Processor, args ...string) (*Session, <-chan resp.Value) {
+	t.Helper()
+	s := p.NewSession()
+	reply := make(chan resp.Value, 1)
+	go func() { reply <- p.ProcessFor(s, commandValue(args...)) }()
+	deadline := time.Now().Add(2 * time.Second)
+	for !s.blocked.Load() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%q did not block", args)
+		}
+		time.Sleep(time.Millisecond)
+	}
+	return s, reply
+}
+
+func await(t *testing.T, reply <-chan resp.Value) resp.Value {
+	t.Helper()
+	select {
+	case v := <-reply:
+		return v
+	case <-time.After(2 * time.Second):
+		t.Fatal("the blocked client was not served")
+	}
+	return resp.Value{}
+}
+
+func TestBLPopServesClientsInArrivalOrder(t *testing.T) {
+	p := newTestProcessor()
+	_, first := block(t, p, "BLPOP", "q", "0")
+	_, second := block(t, p, "BLPOP", "q", "0")
+
+	run(p, "RPUSH", "q", "a")
+	expectReply(t, await(t, first), "q", "a")
+	select {
+	case v := <-second:
+		t.Fatalf("the second client was served %q with nothing left to pop", flatten(v))
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	run(p, "RPUSH", "q", "b", "c")
+	expectReply(t, await(t, second), "q", "b")
+	expectReply(t, run(p, "LRANGE", "q", "0", "-1"), "c")
+}
+
+func TestBLPopServesTheFirstReadyKey(t *testing.T) {
+	p := newTestProcessor()
+	_, reply := block(t, p, "BLPOP", "a", "b", "0")
+	run(p, "RPUSH", "b", "x")
+	expectReply(t, await(t, reply), "b", "x")
+	if n := run(p, "EXISTS", "b"); n.Num != 0 {
+		t.Fatal("the emptied list was not deleted")
+	}
+}
+
+func TestBLPopTimeout(t *testing.T) {
+	p := newTestProcessor()
+	start := time.Now()
+	v := run(p, "BLPOP", "q", "0.05")
+	if !v.Null {
+		t.Fatalf("BLPOP after its timeout = %q, want a null array", flatten(v))
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Fatalf("BLPOP returned after %v, before its timeout", elapsed)
+	}
+	if v := run(p, "BLPOP", "q", "-1"); v.Type != resp.ErrorType {
+		t.Fatal("BLPOP accepted a negative timeout")
+	}
+}
+
+func TestBLPopStaysBlockedOnWrongType(t *testing.T) {
+	p := newTestProcessor()
+	_, reply := block(t, p, "BLPOP", "q", "0")
+	run(p, "SET", "q", "x")
+	select {
+	case v := <-reply:
+		t.Fatalf("BLPOP was served %q when its key became a string", flatten(v))
+	case <-time.After(20 * time.Millisecond):
+	}
+	run(p, "DEL", "q")
+	run(p, "RPUSH", "q", "a")
+	expectReply(t, await(t, reply), "q", "a")
+}
+
+func TestBLMoveWaitsForSource(t *testing.T) {
+	p := newTestProcessor()
+	_, reply := block(t, p, "BLMOVE", "src", "dst", "LEFT", "RIGHT", "0")
+	run(p, "RPUSH", "src", "a", "b")
+	expectReply(t, await(t, reply), "a")
+	expectReply(t, run(p, "LRANGE", "src", "0", "-1"), "b")
+	expectReply(t, run(p, "LRANGE", "dst", "0", "-1"), "a")
+}
+
+func TestBLMPopCount(t *testing.T) {
+	p := newTestProcessor()
+	_, reply := block(t, p, "BLMPOP", "0", "2", "a", "b", "RIGHT", "COUNT", "2")
+	run(p, "RPUSH", "b", "1", "2", "3")
+	expectReply(t, await(t, reply), "b", "3", "2")
+}
+
+func TestClientUnblock(t *testing.T) {
+	p := newTestProcessor()
+	s, reply := block(t, p, "BLPOP", "q", "0")
+	id := strconv.FormatInt(s.ID(), 10)
+	expectReply(t, run(p, "CLIENT", "UNBLOCK", id, "ERROR"), "1")
+	if v := await(t, reply); v.Type != resp.ErrorType {
+		t.Fatalf("BLPOP after CLIENT UNBLOCK ERROR = %q, want an error", flatten(v))
+	}
+
+	_, reply = block(t, p, "BLPOP", "q", "0")
+	run(p, "RPUSH", "q", "a")
+	expectReply(t, await(t, reply), "q", "a")
+}
+
+func TestCloseSessionReleasesBlockedClient(t *testing.T) {
+	p := newTestProcessor()
+	s, reply := block(t, p, "BLPOP", "q", "0")
+	p.CloseSession(s)
+	if v := await(t, reply); !v.Null {
+		t.Fatalf("BLPOP of a closed session = %q, want a null array", flatten(v))
+	}
+	// The released client must not consume a later push.
+	run(p, "RPUSH", "q", "a")
+	expectReply(t, run(p, "LRANGE", "q", "0", "-1"), "a")
+}
@@ -0,0 +1,26 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func (p *Processor) cdcCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return resp.NewError("ERR wrong number of arguments for 'cdc' command")
+	}
+	switch strings.ToUpper(string(args[0].Bulk)) {
+	case "OFFSET":
+		if len(args) != 1 {
+			return resp.NewError("ERR wrong number of arguments for 'cdc|offset' command")
+		}
+		return resp.NewInteger(int64(p.cdc.Offset()))
+	case "SUBSCRIBE":
+		return resp.NewError("ERR CDC SUBSCRIBE is only available on client connections")
+	default:
+		return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CDC OFFSET or CDC SUBSCRIBE.", string(args[0].Bulk)))
+	}
+}
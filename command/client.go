@@ -0,0 +1,115 @@
+package command
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// Session is the state a connection carries across commands: its client ID,
+// the channels that release it from a blocking command, and the commands
+// queued by an open MULTI. The transaction fields are only touched by the
+// connection's own calls to ProcessFor.
+type Session struct {
+	id        int64
+	blocked   atomic.Bool
+	unblock   chan bool
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	multi       bool
+	multiFailed bool
+	queued      []resp.Value
+}
+
+func (s *Session) ID() int64 {
+	return s.id
+}
+
+func (s *Session) resetMulti() {
+	s.multi = false
+	s.multiFailed = false
+	s.queued = nil
+}
+
+type sessions struct {
+	mu     sync.Mutex
+	nextID int64
+	byID   map[int64]*Session
+}
+
+// NewSession registers a new connection and assigns it a client ID.
+func (p *Processor) NewSession() *Session {
+	p.sessions.mu.Lock()
+	defer p.sessions.mu.Unlock()
+	p.sessions.nextID++
+	s := &Session{
+		id:      p.sessions.nextID,
+		unblock: make(chan bool, 1),
+		closed:  make(chan struct{}),
+	}
+	p.sessions.byID[s.id] = s
+	return s
+}
+
+// CloseSession unregisters a connection and releases any blocking command it
+// is waiting in. It is safe to call more than once.
+func (p *Processor) CloseSession(s *Session) {
+	p.sessions.mu.Lock()
+	delete(p.sessions.byID, s.id)
+	p.sessions.mu.Unlock()
+	s.closeOnce.Do(func() { close(s.closed) })
+}
+
+func (p *Processor) clientCommand(s *Session, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return resp.NewError("ERR wrong number of arguments for 'client' command")
+	}
+	switch strings.ToUpper(string(args[0].Bulk)) {
+	case "ID":
+		if len(args) != 1 {
+			return resp.NewError("ERR wrong number of arguments for 'client|id' command")
+		}
+		if s == nil {
+			return resp.NewInteger(0)
+		}
+		return resp.NewInteger(s.id)
+	case "UNBLOCK":
+		if len(args) < 2 || len(args) > 3 {
+			return resp.NewError("ERR wrong number of arguments for 'client|unblock' command")
+		}
+		id, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		withError := false
+		if len(args) == 3 {
+			switch strings.ToUpper(string(args[2].Bulk)) {
+			case "TIMEOUT":
+			case "ERROR":
+				withError = true
+			default:
+				return resp.NewError("ERR CLIENT UNBLOCK reason should be TIMEOUT or ERROR")
+			}
+		}
+
+		p.sessions.mu.Lock()
+		target, ok := p.sessions.byID[id]
+		p.sessions.mu.Unlock()
+		if !ok || !target.blocked.Load() {
+			return resp.NewInteger(0)
+		}
+		select {
+		case target.unblock <- withError:
+			return resp.NewInteger(1)
+		default:
+			return resp.NewInteger(0)
+		}
+	default:
+		return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CLIENT HELP.", string(args[0].Bulk)))
+	}
+}
@@ -0,0 +1,73 @@
+package command
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/pubsub"
+	"github.com/HORUSCRIME/goredis/resp"
+	"github.com/HORUSCRIME/goredis/utils"
+)
+
+type configParam struct {
+	get func(p *Processor) string
+	set func(p *Processor, value string) error
+}
+
+var configParams = map[string]configParam{
+	"notify-keyspace-events": {
+		get: func(p *Processor) string {
+			return pubsub.FormatNotifyFlags(p.notifier.Flags())
+		},
+		set: func(p *Processor, value string) error {
+			flags, err := pubsub.ParseNotifyFlags(value)
+			if err != nil {
+				return err
+			}
+			p.notifier.SetFlags(flags)
+			return nil
+		},
+	},
+}
+
+func (p *Processor) configCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return resp.NewError("ERR wrong number of arguments for 'config' command")
+	}
+	switch strings.ToUpper(string(args[0].Bulk)) {
+	case "GET":
+		if len(args) < 2 {
+			return resp.NewError("ERR wrong number of arguments for 'config|get' command")
+		}
+		result := make([]resp.Value, 0)
+		for name, param := range configParams {
+			for _, arg := range args[1:] {
+				if utils.MatchPatternNoCase(string(arg.Bulk), name) {
+					result = append(result,
+						resp.NewBulkString([]byte(name)),
+						resp.NewBulkString([]byte(param.get(p))))
+					break
+				}
+			}
+		}
+		return resp.NewArray(result)
+	case "SET":
+		if len(args) < 3 || len(args)%2 != 1 {
+			return resp.NewError("ERR wrong number of arguments for 'config|set' command")
+		}
+		for i := 1; i < len(args); i += 2 {
+			name := strings.ToLower(string(args[i].Bulk))
+			param, ok := configParams[name]
+			if !ok {
+				return resp.NewError(fmt.Sprintf("ERR Unknown option or number of arguments for CONFIG SET - '%s'", name))
+			}
+			if err := param.set(p, string(args[i+1].Bulk)); err != nil {
+				return resp.NewError(fmt.Sprintf("ERR CONFIG SET failed (possibly related to argument '%s') - %v", name, err))
+			}
+		}
+		return resp.NewSimpleString("OK")
+	default:
+		return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try CONFIG HELP.", string(args[0].Bulk)))
+	}
+}
@@ -0,0 +1,389 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// geoUnits maps the distance units of the geo commands to meters.
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"ft": 0.3048,
+	"mi": 1609.34,
+}
+
+func parseGeoUnit(arg resp.Value) (float64, error) {
+	conversion, ok := geoUnits[strings.ToLower(string(arg.Bulk))]
+	if !ok {
+		return 0, fmt.Errorf("ERR unsupported unit provided. please use M, KM, FT, MI")
+	}
+	return conversion, nil
+}
+
+// parseLonLat parses a longitude, latitude pair within the GEOADD limits.
+func parseLonLat(lonArg, latArg resp.Value) (lon, lat float64, err error) {
+	lon, err1 := strconv.ParseFloat(string(lonArg.Bulk), 64)
+	lat, err2 := strconv.ParseFloat(string(latArg.Bulk), 64)
+	if err1 != nil || err2 != nil || math.IsNaN(lon) || math.IsNaN(lat) {
+		return 0, 0, fmt.Errorf("ERR value is not a valid float")
+	}
+	if lon < database.GeoLonMin || lon > database.GeoLonMax || lat < database.GeoLatMin || lat > database.GeoLatMax {
+		return 0, 0, fmt.Errorf("ERR invalid longitude,latitude pair %f,%f", lon, lat)
+	}
+	return lon, lat, nil
+}
+
+// formatCoordinate formats a coordinate with 17 decimals, as Redis does for
+// long doubles, without trailing zeros.
+func formatCoordinate(f float64) string {
+	s := strconv.FormatFloat(f, 'f', 17, 64)
+	s = strings.TrimRight(s, "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func formatDistance(meters, conversion float64) string {
+	return strconv.FormatFloat(meters/conversion, 'f', 4, 64)
+}
+
+func coordinatesReply(lon, lat float64) resp.Value {
+	return bulkStrings([]string{formatCoordinate(lon), formatCoordinate(lat)})
+}
+
+// GeoAddCommand stores each position as the 52-bit geohash score of its
+// member, through ZADD.
+func GeoAddCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'geoadd' command")
+	}
+
+	flags, ch := 0, false
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i].Bulk)) {
+		case "NX":
+			flags |= database.ZAddNX
+		case "XX":
+			flags |= database.ZAddXX
+		case "CH":
+			ch = true
+		default:
+			break options
+		}
+	}
+	triples := args[i:]
+	if len(triples) == 0 || len(triples)%3 != 0 {
+		return resp.NewError("ERR syntax error")
+	}
+	if flags&database.ZAddNX != 0 && flags&database.ZAddXX != 0 {
+		return resp.NewError("ERR XX and NX options at the same time are not compatible")
+	}
+
+	pairs := make([]resp.Value, 0, len(triples)/3*2)
+	for j := 0; j < len(triples); j += 3 {
+		lon, lat, err := parseLonLat(triples[j], triples[j+1])
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		hash, _ := database.GeoEncode(lon, lat)
+		pairs = append(pairs, resp.NewBulkString([]byte(strconv.FormatUint(hash, 10))), triples[j+2])
+	}
+	return zaddGeneric(db, string(args[0].Bulk), pairs, flags, ch)
+}
+
+func GeoPosCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'geopos' command")
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = resp.NewNullArray()
+		if zset == nil {
+			continue
+		}
+		if score, exists := zset.ZScore(string(member.Bulk)); exists {
+			result[i] = coordinatesReply(database.GeoDecode(uint64(score)))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+func GeoDistCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'geodist' command")
+	}
+	if len(args) > 4 {
+		return resp.NewError("ERR syntax error")
+	}
+	conversion := 1.0
+	if len(args) == 4 {
+		var err error
+		if conversion, err = parseGeoUnit(args[3]); err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewNullBulkString()
+	}
+	score1, ok1 := zset.ZScore(string(args[1].Bulk))
+	score2, ok2 := zset.ZScore(string(args[2].Bulk))
+	if !ok1 || !ok2 {
+		return resp.NewNullBulkString()
+	}
+	lon1, lat1 := database.GeoDecode(uint64(score1))
+	lon2, lat2 := database.GeoDecode(uint64(score2))
+	return resp.NewBulkString([]byte(formatDistance(database.GeoDistance(lon1, lat1, lon2, lat2), conversion)))
+}
+
+func GeoHashCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'geohash' command")
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(args)-1)
+	for i, member := range args[1:] {
+		result[i] = resp.NewNullBulkString()
+		if zset == nil {
+			continue
+		}
+		if score, exists := zset.ZScore(string(member.Bulk)); exists {
+			result[i] = resp.NewBulkString([]byte(database.GeoHashString(uint64(score))))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+// geoSearchSpec is a parsed GEOSEARCH or GEOSEARCHSTORE.
+type geoSearchSpec struct {
+	fromMember *string
+	lon, lat   float64
+	fromLonLat bool
+	shape      database.GeoShape
+	byRadius   bool
+	byBox      bool
+	conversion float64
+	sort       string // "", "ASC" or "DESC"
+	count      int
+	any        bool
+	withCoord  bool
+	withDist   bool
+	withHash   bool
+	storeDist  bool
+}
+
+// parseGeoSearch parses the options of GEOSEARCH, or of GEOSEARCHSTORE when
+// store is set, which takes STOREDIST instead of the WITH options.
+func parseGeoSearch(args []resp.Value, store bool, name string) (geoSearchSpec, error) {
+	spec := geoSearchSpec{conversion: 1}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "FROMMEMBER" && remaining >= 1 && spec.fromMember == nil && !spec.fromLonLat:
+			i++
+			member := string(args[i].Bulk)
+			spec.fromMember = &member
+		case option == "FROMLONLAT" && remaining >= 2 && spec.fromMember == nil && !spec.fromLonLat:
+			lon, lat, err := parseLonLat(args[i+1], args[i+2])
+			if err != nil {
+				return spec, err
+			}
+			spec.lon, spec.lat, spec.fromLonLat = lon, lat, true
+			i += 2
+		case option == "BYRADIUS" && remaining >= 2 && !spec.byRadius && !spec.byBox:
+			radius, err := strconv.ParseFloat(string(args[i+1].Bulk), 64)
+			if err != nil || math.IsNaN(radius) {
+				return spec, fmt.Errorf("ERR need numeric radius")
+			}
+			if radius < 0 {
+				return spec, fmt.Errorf("ERR radius cannot be negative")
+			}
+			if spec.conversion, err = parseGeoUnit(args[i+2]); err != nil {
+				return spec, err
+			}
+			spec.shape.Radius = radius * spec.conversion
+			spec.byRadius = true
+			i += 2
+		case option == "BYBOX" && remaining >= 3 && !spec.byRadius && !spec.byBox:
+			width, err1 := strconv.ParseFloat(string(args[i+1].Bulk), 64)
+			height, err2 := strconv.ParseFloat(string(args[i+2].Bulk), 64)
+			if err1 != nil || err2 != nil || math.IsNaN(width) || math.IsNaN(height) {
+				return spec, fmt.Errorf("ERR need numeric width and height")
+			}
+			if width < 0 || height < 0 {
+				return spec, fmt.Errorf("ERR height or width cannot be negative")
+			}
+			var err error
+			if spec.conversion, err = parseGeoUnit(args[i+3]); err != nil {
+				return spec, err
+			}
+			spec.shape.Width, spec.shape.Height = width*spec.conversion, height*spec.conversion
+			spec.shape.Box, spec.byBox = true, true
+			i += 3
+		case option == "ASC" || option == "DESC":
+			spec.sort = option
+		case option == "COUNT" && remaining >= 1:
+			i++
+			n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+			if err != nil {
+				return spec, fmt.Errorf("ERR value is not an integer or out of range")
+			}
+			if n <= 0 {
+				return spec, fmt.Errorf("ERR COUNT must be > 0")
+			}
+			spec.count = clampInt(n)
+		case option == "ANY":
+			spec.any = true
+		case option == "WITHCOORD" && !store:
+			spec.withCoord = true
+		case option == "WITHDIST" && !store:
+			spec.withDist = true
+		case option == "WITHHASH" && !store:
+			spec.withHash = true
+		case option == "STOREDIST" && store:
+			spec.storeDist = true
+		default:
+			return spec, fmt.Errorf("ERR syntax error")
+		}
+	}
+
+	if spec.fromMember == nil && !spec.fromLonLat {
+		return spec, fmt.Errorf("ERR exactly one of FROMMEMBER or FROMLONLAT can be specified for %s", name)
+	}
+	if !spec.byRadius && !spec.byBox {
+		return spec, fmt.Errorf("ERR exactly one of BYRADIUS and BYBOX can be specified for %s", name)
+	}
+	if spec.any && spec.count == 0 {
+		return spec, fmt.Errorf("ERR the ANY argument requires COUNT argument")
+	}
+	return spec, nil
+}
+
+// geoSearch runs a parsed search on zset, returning the points in reply
+// order and truncated to COUNT.
+func geoSearch(zset *database.ZSet, spec geoSearchSpec) ([]database.GeoPoint, error) {
+	shape := spec.shape
+	shape.Lon, shape.Lat = spec.lon, spec.lat
+	if spec.fromMember != nil {
+		score, exists := zset.ZScore(*spec.fromMember)
+		if !exists {
+			return nil, fmt.Errorf("ERR could not decode requested zset member")
+		}
+		shape.Lon, shape.Lat = database.GeoDecode(uint64(score))
+	}
+
+	limit := 0
+	if spec.any {
+		limit = spec.count
+	}
+	points := zset.GeoSearch(shape, limit)
+
+	order := spec.sort
+	if order == "" && spec.count > 0 && !spec.any {
+		// Without ANY, COUNT returns the nearest matches.
+		order = "ASC"
+	}
+	switch order {
+	case "ASC":
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Dist < points[j].Dist })
+	case "DESC":
+		sort.SliceStable(points, func(i, j int) bool { return points[i].Dist > points[j].Dist })
+	}
+	if spec.count > 0 && len(points) > spec.count {
+		points = points[:spec.count]
+	}
+	return points, nil
+}
+
+func GeoSearchCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 6 {
+		return resp.NewError("ERR wrong number of arguments for 'geosearch' command")
+	}
+	spec, err := parseGeoSearch(args[1:], false, "GEOSEARCH")
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	points, err := geoSearch(zset, spec)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+
+	result := make([]resp.Value, len(points))
+	for i, p := range points {
+		member := resp.NewBulkString([]byte(p.Member))
+		if !spec.withDist && !spec.withHash && !spec.withCoord {
+			result[i] = member
+			continue
+		}
+		item := []resp.Value{member}
+		if spec.withDist {
+			item = append(item, resp.NewBulkString([]byte(formatDistance(p.Dist, spec.conversion))))
+		}
+		if spec.withHash {
+			item = append(item, resp.NewInteger(int64(p.Score)))
+		}
+		if spec.withCoord {
+			item = append(item, coordinatesReply(p.Lon, p.Lat))
+		}
+		result[i] = resp.NewArray(item)
+	}
+	return resp.NewArray(result)
+}
+
+// GeoSearchStoreCommand stores the members found by GEOSEARCH in a sorted
+// set at the destination, scored by geohash or, with STOREDIST, by distance.
+func GeoSearchStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 7 {
+		return resp.NewError("ERR wrong number of arguments for 'geosearchstore' command")
+	}
+	spec, err := parseGeoSearch(args[2:], true, "GEOSEARCHSTORE")
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	zset, ok := lookupZSet(db, string(args[1].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	var points []database.GeoPoint
+	if zset != nil {
+		if points, err = geoSearch(zset, spec); err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+
+	members := make([]database.ZSetMember, len(points))
+	for i, p := range points {
+		score := p.Score
+		if spec.storeDist {
+			score = p.Dist / spec.conversion
+		}
+		members[i] = database.ZSetMember{Member: p.Member, Score: score}
+	}
+	return storeZSet(db, string(args[0].Bulk), members, "geosearchstore")
+}
@@ -0,0 +1,30 @@
+package command
+
+import "testing"
+
+func TestGeoCommands(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "GEOADD", "Sicily", "13.361389", "38.115556", "Palermo", "15.087269", "37.502669", "Catania"), "2")
+	expectReply(t, run(p, "GEODIST", "Sicily", "Palermo", "Catania"), "166274.1516")
+	expectReply(t, run(p, "GEODIST", "Sicily", "Palermo", "Catania", "km"), "166.2742")
+	expectReply(t, run(p, "GEODIST", "Sicily", "Palermo", "Nowhere"), "<nil>")
+	expectReply(t, run(p, "GEOHASH", "Sicily", "Palermo", "Catania", "Nowhere"), "sqc8b49rny0", "sqdtr74hyu0", "<nil>")
+	expectReply(t, run(p, "GEOPOS", "Sicily", "Palermo", "Nowhere"), "13.36138933897018433", "38.11555639549629859", "<nil>")
+
+	expectReply(t, run(p, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "ASC"), "Catania", "Palermo")
+	expectReply(t, run(p, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "DESC", "COUNT", "1", "WITHDIST"), "Palermo", "190.4424")
+	expectReply(t, run(p, "GEOSEARCH", "Sicily", "FROMMEMBER", "Palermo", "BYBOX", "400", "400", "km", "ASC", "WITHDIST"), "Palermo", "0.0000", "Catania", "166.2742")
+	expectReply(t, run(p, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "100", "km", "ASC"), "Catania")
+
+	expectReply(t, run(p, "GEOSEARCHSTORE", "near", "Sicily", "FROMLONLAT", "15", "37", "BYRADIUS", "200", "km", "STOREDIST"), "2")
+	expectReply(t, run(p, "ZRANGE", "near", "0", "0"), "Catania")
+	expectReply(t, run(p, "GEOADD", "Sicily", "XX", "CH", "13.5", "38", "Palermo", "10", "10", "Elsewhere"), "1")
+	expectReply(t, run(p, "ZCARD", "Sicily"), "2")
+
+	expectError(t, run(p, "GEOADD", "Sicily", "181", "0", "x"), "GEOADD at longitude 181")
+	expectError(t, run(p, "GEOADD", "Sicily", "0", "86", "x"), "GEOADD at latitude 86")
+	expectError(t, run(p, "GEOADD", "Sicily", "NX", "XX", "0", "0", "x"), "GEOADD NX XX")
+	expectError(t, run(p, "GEODIST", "Sicily", "Palermo", "Catania", "miles"), "GEODIST in miles")
+	expectError(t, run(p, "GEOSEARCH", "Sicily", "FROMMEMBER", "Nowhere", "BYRADIUS", "1", "km"), "GEOSEARCH from a missing member")
+	expectError(t, run(p, "GEOSEARCH", "Sicily", "FROMLONLAT", "15", "37"), "GEOSEARCH without a shape")
+}
@@ -2,9 +2,9 @@ package command
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
-	"time"
 
 	"github.com/HORUSCRIME/goredis/database"
 	"github.com/HORUSCRIME/goredis/resp"
@@ -33,30 +33,12 @@ func SetCommand(db *database.Database, args []resp.Value) resp.Value {
 	}
 	key := string(args[0].Bulk)
 	value := string(args[1].Bulk)
-	ttl := time.Duration(0)
-
-	if len(args) > 2 {
-		for i := 2; i < len(args); i++ {
-			option := strings.ToUpper(string(args[i].Bulk))
-			switch option {
-			case "EX":
-				if i+1 >= len(args) {
-					return resp.NewError("ERR syntax error")
-				}
-				seconds, err := strconv.ParseInt(string(args[i+1].Bulk), 10, 64)
-				if err != nil || seconds <= 0 {
-					return resp.NewError("ERR invalid expire time in 'SET' command")
-				}
-				ttl = time.Duration(seconds) * time.Second
-				i++
-			default:
-				return resp.NewError(fmt.Sprintf("ERR unknown option '%s' for 'SET' command", option))
-			}
-		}
-	}
 
-	db.Set(key, database.NewString(value), ttl)
-	return resp.NewSimpleString("OK")
+	opts, err := parseSetOptions(args[2:], "set")
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return setGeneric(db, key, value, opts)
 }
 
 func GetCommand(db *database.Database, args []resp.Value) resp.Value {
@@ -74,7 +56,7 @@ func GetCommand(db *database.Database, args []resp.Value) resp.Value {
 	if !isString {
 		return resp.NewError(fmt.Sprintf("WRONGTYPE Operation against a key holding the wrong kind of value"))
 	}
-	return resp.NewBulkString([]byte(strVal.Val))
+	return resp.NewBulkString([]byte(strVal.Get()))
 }
 
 func DelCommand(db *database.Database, args []resp.Value) resp.Value {
@@ -85,6 +67,7 @@ func DelCommand(db *database.Database, args []resp.Value) resp.Value {
 	for _, arg := range args {
 		key := string(arg.Bulk)
 		if db.Delete(key) {
+			db.Notify(database.NotifyGeneric, "del", key)
 			deletedCount++
 		}
 	}
@@ -136,6 +119,7 @@ func LPushCommand(db *database.Database, args []resp.Value) resp.Value {
 		list = existingList
 	}
 	newLen := list.LPush(elements...)
+	db.Notify(database.NotifyList, "lpush", key)
 	return resp.NewInteger(int64(newLen))
 }
 
@@ -162,51 +146,16 @@ func RPushCommand(db *database.Database, args []resp.Value) resp.Value {
 		list = existingList
 	}
 	newLen := list.RPush(elements...)
+	db.Notify(database.NotifyList, "rpush", key)
 	return resp.NewInteger(int64(newLen))
 }
 
 func LPopCommand(db *database.Database, args []resp.Value) resp.Value {
-	if len(args) != 1 {
-		return resp.NewError("ERR wrong number of arguments for 'lpop' command")
-	}
-	key := string(args[0].Bulk)
-
-	val, ok := db.Get(key)
-	if !ok {
-		return resp.NewNullBulkString()
-	}
-	list, isList := val.(*database.List)
-	if !isList {
-		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
-	}
-
-	element, success := list.LPop()
-	if !success {
-		return resp.NewNullBulkString()
-	}
-	return resp.NewBulkString([]byte(element))
+	return popGeneric(db, args, true, "lpop")
 }
 
 func RPopCommand(db *database.Database, args []resp.Value) resp.Value {
-	if len(args) != 1 {
-		return resp.NewError("ERR wrong number of arguments for 'rpop' command")
-	}
-	key := string(args[0].Bulk)
-
-	val, ok := db.Get(key)
-	if !ok {
-		return resp.NewNullBulkString()
-	}
-	list, isList := val.(*database.List)
-	if !isList {
-		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
-	}
-
-	element, success := list.RPop()
-	if !success {
-		return resp.NewNullBulkString()
-	}
-	return resp.NewBulkString([]byte(element))
+	return popGeneric(db, args, false, "rpop")
 }
 
 func LLenCommand(db *database.Database, args []resp.Value) resp.Value {
@@ -253,6 +202,7 @@ func HSetCommand(db *database.Database, args []resp.Value) resp.Value {
 			addedOrUpdatedCount++
 		}
 	}
+	db.Notify(database.NotifyHash, "hset", key)
 	return resp.NewInteger(int64(addedOrUpdatedCount))
 }
 
@@ -299,6 +249,10 @@ func HDelCommand(db *database.Database, args []resp.Value) resp.Value {
 	}
 
 	deletedCount := hash.HDel(fields...)
+	if deletedCount > 0 {
+		db.Notify(database.NotifyHash, "hdel", key)
+		deleteIfEmptyHash(db, key, hash)
+	}
 	return resp.NewInteger(int64(deletedCount))
 }
 
@@ -319,6 +273,29 @@ func HLenCommand(db *database.Database, args []resp.Value) resp.Value {
 	return resp.NewInteger(int64(hash.HLen()))
 }
 
+func HGetAllCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'hgetall' command")
+	}
+	key := string(args[0].Bulk)
+
+	val, ok := db.Get(key)
+	if !ok {
+		return resp.NewArray([]resp.Value{})
+	}
+	hash, isHash := val.(*database.Hash)
+	if !isHash {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	fields := hash.HGetAll()
+	result := make([]resp.Value, 0, len(fields)*2)
+	for field, value := range fields {
+		result = append(result, resp.NewBulkString([]byte(field)), resp.NewBulkString([]byte(value)))
+	}
+	return resp.NewArray(result)
+}
+
 func SAddCommand(db *database.Database, args []resp.Value) resp.Value {
 	if len(args) < 2 {
 		return resp.NewError("ERR wrong number of arguments for 'sadd' command")
@@ -342,6 +319,9 @@ func SAddCommand(db *database.Database, args []resp.Value) resp.Value {
 		set = existingSet
 	}
 	addedCount := set.SAdd(members...)
+	if addedCount > 0 {
+		db.Notify(database.NotifySet, "sadd", key)
+	}
 	return resp.NewInteger(int64(addedCount))
 }
 
@@ -365,6 +345,10 @@ func SRemCommand(db *database.Database, args []resp.Value) resp.Value {
 	}
 
 	removedCount := set.SRem(members...)
+	if removedCount > 0 {
+		db.Notify(database.NotifySet, "srem", key)
+		deleteIfEmptySet(db, key, set)
+	}
 	return resp.NewInteger(int64(removedCount))
 }
 
@@ -408,37 +392,47 @@ func SCardCommand(db *database.Database, args []resp.Value) resp.Value {
 }
 
 func ZAddCommand(db *database.Database, args []resp.Value) resp.Value {
-	if len(args) < 3 || len(args)%2 != 1 {
+	if len(args) < 3 {
 		return resp.NewError("ERR wrong number of arguments for 'zadd' command")
 	}
 
-	key := string(args[0].Bulk)
-
-	val, ok := db.Get(key)
-	var zset *database.ZSet
-	if !ok {
-		zset = database.NewZSet()
-		db.Set(key, zset, 0)
-	} else {
-		existingZSet, isZSet := val.(*database.ZSet)
-		if !isZSet {
-			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	flags, ch := 0, false
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i].Bulk)) {
+		case "NX":
+			flags |= database.ZAddNX
+		case "XX":
+			flags |= database.ZAddXX
+		case "GT":
+			flags |= database.ZAddGT
+		case "LT":
+			flags |= database.ZAddLT
+		case "CH":
+			ch = true
+		case "INCR":
+			flags |= database.ZAddIncr
+		default:
+			break options
 		}
-		zset = existingZSet
 	}
 
-	addedCount := 0
-	for i := 1; i < len(args); i += 2 {
-		scoreStr := string(args[i].Bulk)
-		member := string(args[i+1].Bulk)
-
-		score, err := strconv.ParseFloat(scoreStr, 64)
-		if err != nil {
-			return resp.NewError("ERR value is not a valid float")
-		}
-		addedCount += zset.ZAdd(score, member)
+	pairs := args[i:]
+	if len(pairs) == 0 || len(pairs)%2 != 0 {
+		return resp.NewError("ERR syntax error")
 	}
-	return resp.NewInteger(int64(addedCount))
+	if flags&database.ZAddNX != 0 && flags&database.ZAddXX != 0 {
+		return resp.NewError("ERR XX and NX options at the same time are not compatible")
+	}
+	if (flags&database.ZAddGT != 0 && flags&(database.ZAddNX|database.ZAddLT) != 0) ||
+		(flags&database.ZAddLT != 0 && flags&database.ZAddNX != 0) {
+		return resp.NewError("ERR GT, LT, and/or NX options at the same time are not compatible")
+	}
+	if flags&database.ZAddIncr != 0 && len(pairs) > 2 {
+		return resp.NewError("ERR INCR option supports a single increment-element pair")
+	}
+	return zaddGeneric(db, string(args[0].Bulk), pairs, flags, ch)
 }
 
 func ZScoreCommand(db *database.Database, args []resp.Value) resp.Value {
@@ -461,7 +455,7 @@ func ZScoreCommand(db *database.Database, args []resp.Value) resp.Value {
 	if !found {
 		return resp.NewNullBulkString()
 	}
-	return resp.NewBulkString([]byte(strconv.FormatFloat(score, 'f', -1, 64)))
+	return resp.NewBulkString([]byte(formatFloat(score)))
 }
 
 func ZRemCommand(db *database.Database, args []resp.Value) resp.Value {
@@ -484,6 +478,10 @@ func ZRemCommand(db *database.Database, args []resp.Value) resp.Value {
 	}
 
 	removedCount := zset.ZRem(members...)
+	if removedCount > 0 {
+		db.Notify(database.NotifyZSet, "zrem", key)
+		deleteIfEmptyZSet(db, key, zset)
+	}
 	return resp.NewInteger(int64(removedCount))
 }
 
@@ -503,3 +501,33 @@ func ZCardCommand(db *database.Database, args []resp.Value) resp.Value {
 	}
 	return resp.NewInteger(int64(zset.ZCard()))
 }
+
+// parseScoreBound parses a ZRANGEBYSCORE style bound such as "1.5", "(1.5",
+// "-inf" or "+inf". The second result reports whether the bound is exclusive.
+func parseScoreBound(s string) (float64, bool, error) {
+	exclusive := false
+	if strings.HasPrefix(s, "(") {
+		exclusive = true
+		s = s[1:]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil || math.IsNaN(f) {
+		return 0, false, fmt.Errorf("not a float: %q", s)
+	}
+	return f, exclusive, nil
+}
+
+// formatFloat formats a score or float reply the way Redis does: the shortest
+// representation that round-trips, switching to exponent notation only for
+// very large or very small magnitudes, with infinities spelled "inf"/"-inf".
+func formatFloat(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	case f != 0 && (math.Abs(f) >= 1e21 || math.Abs(f) < 1e-6):
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
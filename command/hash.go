@@ -0,0 +1,301 @@
+package command
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// lookupHash returns the hash stored at key, or nil when the key does not
+// exist. ok is false when the key holds another type.
+func lookupHash(db *database.Database, key string) (hash *database.Hash, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	hash, ok = val.(*database.Hash)
+	return hash, ok
+}
+
+// lookupOrCreateHash returns the hash at key, creating an empty one if the
+// key does not exist.
+func lookupOrCreateHash(db *database.Database, key string) (*database.Hash, bool) {
+	hash, ok := lookupHash(db, key)
+	if ok && hash == nil {
+		hash = database.NewHash()
+		db.Set(key, hash, 0)
+	}
+	return hash, ok
+}
+
+// deleteIfEmptyHash removes key once its hash has no fields left.
+func deleteIfEmptyHash(db *database.Database, key string, hash *database.Hash) {
+	if hash.HLen() == 0 && db.Delete(key) {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+func HMSetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 || len(args)%2 != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'hmset' command")
+	}
+	if reply := HSetCommand(db, args); reply.Type == resp.ErrorType {
+		return reply
+	}
+	return resp.NewSimpleString("OK")
+}
+
+func HMGetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'hmget' command")
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(args)-1)
+	for i, arg := range args[1:] {
+		result[i] = resp.NewNullBulkString()
+		if hash == nil {
+			continue
+		}
+		if value, found := hash.HGet(string(arg.Bulk)); found {
+			result[i] = resp.NewBulkString([]byte(value))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+func HSetNXCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'hsetnx' command")
+	}
+	key := string(args[0].Bulk)
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash != nil && hash.HExists(string(args[1].Bulk)) {
+		return resp.NewInteger(0)
+	}
+	hash, _ = lookupOrCreateHash(db, key)
+	hash.HSetNX(string(args[1].Bulk), string(args[2].Bulk))
+	db.Notify(database.NotifyHash, "hset", key)
+	return resp.NewInteger(1)
+}
+
+func HExistsCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'hexists' command")
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash != nil && hash.HExists(string(args[1].Bulk)) {
+		return resp.NewInteger(1)
+	}
+	return resp.NewInteger(0)
+}
+
+func HStrLenCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'hstrlen' command")
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash == nil {
+		return resp.NewInteger(0)
+	}
+	value, _ := hash.HGet(string(args[1].Bulk))
+	return resp.NewInteger(int64(len(value)))
+}
+
+func HKeysCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'hkeys' command")
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return bulkStrings(hash.HKeys())
+}
+
+func HValsCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'hvals' command")
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return bulkStrings(hash.HVals())
+}
+
+func HIncrByCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'hincrby' command")
+	}
+	key, field := string(args[0].Bulk), string(args[1].Bulk)
+	incr, ok := parseStrictInt64(string(args[2].Bulk))
+	if !ok {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	var current int64
+	if hash != nil {
+		if value, found := hash.HGet(field); found {
+			if current, ok = parseStrictInt64(value); !ok {
+				return resp.NewError("ERR hash value is not an integer")
+			}
+		}
+	}
+	if (incr < 0 && current < 0 && incr < math.MinInt64-current) ||
+		(incr > 0 && current > 0 && incr > math.MaxInt64-current) {
+		return resp.NewError("ERR increment or decrement would overflow")
+	}
+
+	current += incr
+	hash, _ = lookupOrCreateHash(db, key)
+	hash.HSetKeepTTL(field, strconv.FormatInt(current, 10))
+	db.Notify(database.NotifyHash, "hincrby", key)
+	return resp.NewInteger(current)
+}
+
+func HIncrByFloatCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'hincrbyfloat' command")
+	}
+	key, field := string(args[0].Bulk), string(args[1].Bulk)
+	incr, ok := parseLongDouble(string(args[2].Bulk))
+	if !ok {
+		return resp.NewError("ERR value is not a valid float")
+	}
+
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	current := new(big.Float).SetPrec(longDoublePrec)
+	if hash != nil {
+		if value, found := hash.HGet(field); found {
+			if current, ok = parseLongDouble(value); !ok {
+				return resp.NewError("ERR hash value is not a float")
+			}
+		}
+	}
+
+	if current.IsInf() || incr.IsInf() {
+		return resp.NewError("ERR increment would produce NaN or Infinity")
+	}
+	current.Add(current, incr)
+	if current.MantExp(nil) > 16384 {
+		return resp.NewError("ERR increment would produce NaN or Infinity")
+	}
+
+	newVal := formatLongDouble(current)
+	hash, _ = lookupOrCreateHash(db, key)
+	hash.HSetKeepTTL(field, newVal)
+	db.Notify(database.NotifyHash, "hincrbyfloat", key)
+	return resp.NewBulkString([]byte(newVal))
+}
+
+// rewriteHIncrByFloat propagates HINCRBYFLOAT as HSET of the resulting value.
+func rewriteHIncrByFloat(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	return "HSET", []resp.Value{args[0], args[1], reply}
+}
+
+func HRandFieldCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 3 {
+		return resp.NewError("ERR wrong number of arguments for 'hrandfield' command")
+	}
+	withValues := false
+	var count int64
+	if len(args) > 1 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		count = n
+		if len(args) == 3 {
+			if strings.ToUpper(string(args[2].Bulk)) != "WITHVALUES" {
+				return resp.NewError("ERR syntax error")
+			}
+			withValues = true
+			if count < -math.MaxInt64/2 {
+				return resp.NewError("ERR value is out of range")
+			}
+		}
+	}
+
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash == nil {
+		if len(args) == 1 {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewArray([]resp.Value{})
+	}
+
+	all := hash.HGetAll()
+	fields := make([]string, 0, len(all))
+	for field := range all {
+		fields = append(fields, field)
+	}
+	if len(args) == 1 {
+		return resp.NewBulkString([]byte(fields[rand.Intn(len(fields))]))
+	}
+
+	picked := randomSample(fields, count)
+	result := make([]resp.Value, 0, len(picked)*2)
+	for _, field := range picked {
+		result = append(result, resp.NewBulkString([]byte(field)))
+		if withValues {
+			result = append(result, resp.NewBulkString([]byte(all[field])))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+// randomSample implements the count argument of HRANDFIELD, SRANDMEMBER and
+// ZRANDMEMBER: a positive count returns up to count distinct elements, a
+// negative one returns exactly -count elements that may repeat. elements is
+// shuffled in place.
+func randomSample(elements []string, count int64) []string {
+	if count < 0 {
+		picked := make([]string, -count)
+		for i := range picked {
+			picked[i] = elements[rand.Intn(len(elements))]
+		}
+		return picked
+	}
+	n := len(elements)
+	if count < int64(n) {
+		n = int(count)
+	}
+	for i := 0; i < n; i++ {
+		j := i + rand.Intn(len(elements)-i)
+		elements[i], elements[j] = elements[j], elements[i]
+	}
+	return elements[:n]
+}
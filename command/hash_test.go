@@ -0,0 +1,85 @@
+package command
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func sortedReply(v resp.Value) []string {
+	s := flatten(v)
+	slices.Sort(s)
+	return s
+}
+
+func TestHashFields(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "HSET", "h", "a", "1", "b", "22"), "2")
+	expectReply(t, run(p, "HSET", "h", "a", "3", "c", "4"), "1")
+	expectReply(t, run(p, "HMSET", "h", "d", "5"), "OK")
+	expectReply(t, run(p, "HSETNX", "h", "a", "9"), "0")
+	expectReply(t, run(p, "HSETNX", "h", "e", "6"), "1")
+	expectReply(t, run(p, "HMGET", "h", "a", "missing", "b"), "3", "<nil>", "22")
+	expectReply(t, run(p, "HMGET", "missing", "a"), "<nil>")
+	expectReply(t, run(p, "HLEN", "h"), "5")
+	expectReply(t, run(p, "HEXISTS", "h", "c"), "1")
+	expectReply(t, run(p, "HSTRLEN", "h", "b"), "2")
+	expectReply(t, run(p, "HSTRLEN", "h", "missing"), "0")
+	expectStrings(t, sortedReply(run(p, "HKEYS", "h")), "a", "b", "c", "d", "e")
+	expectStrings(t, sortedReply(run(p, "HVALS", "h")), "22", "3", "4", "5", "6")
+
+	expectReply(t, run(p, "HDEL", "h", "a", "b", "missing"), "2")
+	expectReply(t, run(p, "HDEL", "h", "c", "d", "e"), "3")
+	expectReply(t, run(p, "EXISTS", "h"), "0")
+	expectError(t, run(p, "HSET", "h", "a"), "HSET without a value")
+
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "HSET", "s", "a", "1"), "HSET of a string")
+	expectError(t, run(p, "HGETALL", "s"), "HGETALL of a string")
+}
+
+func TestHIncrBy(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "HINCRBY", "h", "n", "5"), "5")
+	expectReply(t, run(p, "HINCRBY", "h", "n", "-10"), "-5")
+	run(p, "HSET", "h", "s", "abc", "max", "9223372036854775807")
+	expectError(t, run(p, "HINCRBY", "h", "s", "1"), "HINCRBY of a non-integer field")
+	expectError(t, run(p, "HINCRBY", "h", "max", "1"), "HINCRBY past the int64 range")
+	expectError(t, run(p, "HINCRBY", "h", "n", "1.5"), "HINCRBY by 1.5")
+
+	expectReply(t, run(p, "HINCRBYFLOAT", "h", "f", "10.5"), "10.5")
+	expectReply(t, run(p, "HINCRBYFLOAT", "h", "f", "0.1"), "10.6")
+	expectReply(t, run(p, "HINCRBYFLOAT", "h", "n", "-5.0e3"), "-5005")
+	expectError(t, run(p, "HINCRBYFLOAT", "h", "s", "1"), "HINCRBYFLOAT of a non-float field")
+	expectError(t, run(p, "HINCRBYFLOAT", "h", "f", "inf"), "HINCRBYFLOAT by inf")
+
+	propagated := recordPropagation(p)
+	run(p, "HINCRBYFLOAT", "h", "f", "1")
+	expectStrings(t, propagated(), "HSET h f 11.6")
+}
+
+func TestHRandField(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "HRANDFIELD", "missing"), "<nil>")
+	expectReply(t, run(p, "HRANDFIELD", "missing", "3"))
+	run(p, "HSET", "h", "a", "1", "b", "2", "c", "3")
+
+	if f := flatten(run(p, "HRANDFIELD", "h")); len(f) != 1 || !slices.Contains([]string{"a", "b", "c"}, f[0]) {
+		t.Fatalf("HRANDFIELD h = %q", f)
+	}
+	expectStrings(t, sortedReply(run(p, "HRANDFIELD", "h", "10")), "a", "b", "c")
+	if f := flatten(run(p, "HRANDFIELD", "h", "-7")); len(f) != 7 {
+		t.Fatalf("HRANDFIELD h -7 returned %d fields, want 7", len(f))
+	}
+	pairs := flatten(run(p, "HRANDFIELD", "h", "2", "WITHVALUES"))
+	if len(pairs) != 4 {
+		t.Fatalf("HRANDFIELD h 2 WITHVALUES = %q", pairs)
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if want := map[string]string{"a": "1", "b": "2", "c": "3"}[pairs[i]]; pairs[i+1] != want {
+			t.Fatalf("HRANDFIELD paired %s with %s", pairs[i], pairs[i+1])
+		}
+	}
+	expectError(t, run(p, "HRANDFIELD", "h", "2", "WITHSCORES"), "HRANDFIELD WITHSCORES")
+}
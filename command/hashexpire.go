@@ -0,0 +1,546 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// maxFieldExpireMillis is the latest field expiry Redis accepts, 2^48-1 ms
+// after the epoch.
+const maxFieldExpireMillis = 1<<48 - 1
+
+// Replies for a single field of the hash field expiration commands.
+const (
+	fieldMissing   = -2
+	fieldNoTTL     = -1
+	fieldCondFail  = 0
+	fieldUpdated   = 1
+	fieldDeleted   = 2
+	fieldPersisted = 1
+)
+
+// parseFields parses "FIELDS numfields field ..." where every field is
+// followed by width-1 more arguments, and returns the arguments after
+// numfields.
+func parseFields(args []resp.Value, width int) ([]resp.Value, error) {
+	if len(args) < 2 || strings.ToUpper(string(args[0].Bulk)) != "FIELDS" {
+		return nil, errors.New("ERR Mandatory argument FIELDS is missing or not at the right position")
+	}
+	n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil || n <= 0 {
+		return nil, errors.New("ERR Parameter `numFields` should be greater than 0")
+	}
+	if n*int64(width) != int64(len(args)-2) {
+		return nil, errors.New("ERR The `numfields` parameter must match the number of arguments")
+	}
+	return args[2:], nil
+}
+
+// parseFieldExpire parses an expiry argument in the given unit, absolute or
+// relative to now.
+func parseFieldExpire(arg resp.Value, unit time.Duration, absolute bool, cmdName string) (time.Time, error) {
+	n, err := strconv.ParseInt(string(arg.Bulk), 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("ERR value is not an integer or out of range")
+	}
+	if n < 0 {
+		return time.Time{}, errors.New("ERR invalid expire time, must be >= 0")
+	}
+	invalid := fmt.Errorf("ERR invalid expire time in '%s' command", cmdName)
+	if unit == time.Second {
+		if n > maxFieldExpireMillis/1000 {
+			return time.Time{}, invalid
+		}
+		n *= 1000
+	}
+	if !absolute {
+		now := time.Now().UnixMilli()
+		if n > maxFieldExpireMillis-now {
+			return time.Time{}, invalid
+		}
+		n += now
+	} else if n > maxFieldExpireMillis {
+		return time.Time{}, invalid
+	}
+	return time.UnixMilli(n), nil
+}
+
+// fieldArgs returns the field arguments of a command whose FIELDS keyword is
+// at or after from, for use by rewrites on already validated commands.
+func fieldArgs(args []resp.Value, from int) []resp.Value {
+	for i := from; i < len(args); i++ {
+		if strings.ToUpper(string(args[i].Bulk)) == "FIELDS" {
+			return args[i+2:]
+		}
+	}
+	return nil
+}
+
+func HExpireCommand(db *database.Database, args []resp.Value) resp.Value {
+	return hexpireGeneric(db, args, time.Second, false, "hexpire")
+}
+
+func HPExpireCommand(db *database.Database, args []resp.Value) resp.Value {
+	return hexpireGeneric(db, args, time.Millisecond, false, "hpexpire")
+}
+
+func HExpireAtCommand(db *database.Database, args []resp.Value) resp.Value {
+	return hexpireGeneric(db, args, time.Second, true, "hexpireat")
+}
+
+func HPExpireAtCommand(db *database.Database, args []resp.Value) resp.Value {
+	return hexpireGeneric(db, args, time.Millisecond, true, "hpexpireat")
+}
+
+func hexpireGeneric(db *database.Database, args []resp.Value, unit time.Duration, absolute bool, name string) resp.Value {
+	if len(args) < 5 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	key := string(args[0].Bulk)
+	at, err := parseFieldExpire(args[1], unit, absolute, name)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	rest := args[2:]
+	cond := strings.ToUpper(string(rest[0].Bulk))
+	switch cond {
+	case "FIELDS":
+		cond = ""
+	case "NX", "XX", "GT", "LT":
+		rest = rest[1:]
+	default:
+		return resp.NewError(fmt.Sprintf("ERR Unsupported option %s", string(rest[0].Bulk)))
+	}
+	fields, err := parseFields(rest, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(fields))
+	updated, deleted := 0, 0
+	now := time.Now()
+	for i, arg := range fields {
+		field := string(arg.Bulk)
+		var current time.Time
+		var exists bool
+		if hash != nil {
+			current, exists = hash.FieldExpireTime(field)
+		}
+		switch {
+		case !exists:
+			result[i] = resp.NewInteger(fieldMissing)
+		case !fieldExpireAllowed(cond, current, at):
+			result[i] = resp.NewInteger(fieldCondFail)
+		case !at.After(now):
+			hash.HDel(field)
+			deleted++
+			result[i] = resp.NewInteger(fieldDeleted)
+		default:
+			hash.ExpireFieldAt(field, at)
+			updated++
+			result[i] = resp.NewInteger(fieldUpdated)
+		}
+	}
+
+	if updated > 0 {
+		db.TrackFieldExpiry(key)
+		db.Notify(database.NotifyHash, "hexpire", key)
+	}
+	if deleted > 0 {
+		db.Notify(database.NotifyHash, "hdel", key)
+		deleteIfEmptyHash(db, key, hash)
+	}
+	return resp.NewArray(result)
+}
+
+// fieldExpireAllowed applies the NX, XX, GT and LT conditions. A field
+// without an expiry counts as expiring never.
+func fieldExpireAllowed(cond string, current, at time.Time) bool {
+	switch cond {
+	case "NX":
+		return current.IsZero()
+	case "XX":
+		return !current.IsZero()
+	case "GT":
+		return !current.IsZero() && at.After(current)
+	case "LT":
+		return current.IsZero() || at.Before(current)
+	}
+	return true
+}
+
+// rewriteHExpire propagates the HEXPIRE family as HPEXPIREAT of the fields
+// that were updated, or HDEL of those that were deleted because the time was
+// in the past.
+func rewriteHExpire(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	fields := fieldArgs(args, 2)
+	var updated, deleted []resp.Value
+	for i, r := range reply.Array {
+		switch r.Num {
+		case fieldUpdated:
+			updated = append(updated, fields[i])
+		case fieldDeleted:
+			deleted = append(deleted, fields[i])
+		}
+	}
+	if len(updated) == 0 {
+		return "HDEL", append([]resp.Value{args[0]}, deleted...)
+	}
+	return rewriteFieldExpiry(db, args[0], updated)
+}
+
+// rewriteFieldExpiry records the current state of fields, which all share
+// the same expiry: HPEXPIREAT when they have one, HPERSIST when they have
+// none, and HDEL when they are gone.
+func rewriteFieldExpiry(db *database.Database, key resp.Value, fields []resp.Value) (string, []resp.Value) {
+	numFields := resp.NewBulkString([]byte(strconv.Itoa(len(fields))))
+	var at time.Time
+	exists := false
+	if val, ok := db.Peek(string(key.Bulk)); ok {
+		if hash, isHash := val.(*database.Hash); isHash {
+			at, exists = hash.FieldExpireTime(string(fields[0].Bulk))
+		}
+	}
+	switch {
+	case !exists:
+		return "HDEL", append([]resp.Value{key}, fields...)
+	case at.IsZero():
+		return "HPERSIST", append([]resp.Value{key, resp.NewBulkString([]byte("FIELDS")), numFields}, fields...)
+	}
+	ms := resp.NewBulkString([]byte(strconv.FormatInt(at.UnixMilli(), 10)))
+	return "HPEXPIREAT", append([]resp.Value{key, ms, resp.NewBulkString([]byte("FIELDS")), numFields}, fields...)
+}
+
+func HTTLCommand(db *database.Database, args []resp.Value) resp.Value {
+	return httlGeneric(db, args, time.Second, false, "httl")
+}
+
+func HPTTLCommand(db *database.Database, args []resp.Value) resp.Value {
+	return httlGeneric(db, args, time.Millisecond, false, "hpttl")
+}
+
+func HExpireTimeCommand(db *database.Database, args []resp.Value) resp.Value {
+	return httlGeneric(db, args, time.Second, true, "hexpiretime")
+}
+
+func HPExpireTimeCommand(db *database.Database, args []resp.Value) resp.Value {
+	return httlGeneric(db, args, time.Millisecond, true, "hpexpiretime")
+}
+
+func httlGeneric(db *database.Database, args []resp.Value, unit time.Duration, absolute bool, name string) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	fields, err := parseFields(args[1:], 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	now := time.Now().UnixMilli()
+	result := make([]resp.Value, len(fields))
+	for i, arg := range fields {
+		var at time.Time
+		var exists bool
+		if hash != nil {
+			at, exists = hash.FieldExpireTime(string(arg.Bulk))
+		}
+		switch {
+		case !exists:
+			result[i] = resp.NewInteger(fieldMissing)
+		case at.IsZero():
+			result[i] = resp.NewInteger(fieldNoTTL)
+		default:
+			ms := at.UnixMilli()
+			if !absolute {
+				ms -= now
+			}
+			if unit == time.Second {
+				ms = (ms + 999) / 1000
+			}
+			result[i] = resp.NewInteger(ms)
+		}
+	}
+	return resp.NewArray(result)
+}
+
+func HPersistCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'hpersist' command")
+	}
+	key := string(args[0].Bulk)
+	fields, err := parseFields(args[1:], 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	result := make([]resp.Value, len(fields))
+	persisted := 0
+	for i, arg := range fields {
+		field := string(arg.Bulk)
+		switch {
+		case hash == nil || !hash.HExists(field):
+			result[i] = resp.NewInteger(fieldMissing)
+		case !hash.PersistField(field):
+			result[i] = resp.NewInteger(fieldNoTTL)
+		default:
+			persisted++
+			result[i] = resp.NewInteger(fieldPersisted)
+		}
+	}
+	if persisted > 0 {
+		db.Notify(database.NotifyHash, "hpersist", key)
+	}
+	return resp.NewArray(result)
+}
+
+// fieldExpireOption is the expiry option of HGETEX and HSETEX.
+type fieldExpireOption struct {
+	set      bool // EX, PX, EXAT or PXAT was given
+	at       time.Time
+	persist  bool
+	keepTTL  bool
+	relative bool
+}
+
+// parseFieldExpireOption parses an EX, PX, EXAT or PXAT option with its
+// value at args[0], reporting how many arguments it used.
+func parseFieldExpireOption(args []resp.Value, cmdName string) (fieldExpireOption, int, error) {
+	var unit time.Duration
+	absolute := false
+	switch strings.ToUpper(string(args[0].Bulk)) {
+	case "EX":
+		unit = time.Second
+	case "PX":
+		unit = time.Millisecond
+	case "EXAT":
+		unit, absolute = time.Second, true
+	case "PXAT":
+		unit, absolute = time.Millisecond, true
+	default:
+		return fieldExpireOption{}, 0, nil
+	}
+	if len(args) < 2 {
+		return fieldExpireOption{}, 0, errors.New("ERR syntax error")
+	}
+	at, err := parseFieldExpire(args[1], unit, absolute, cmdName)
+	if err != nil {
+		return fieldExpireOption{}, 0, err
+	}
+	return fieldExpireOption{set: true, at: at, relative: !absolute || unit == time.Second}, 2, nil
+}
+
+func HGetExCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'hgetex' command")
+	}
+	key := string(args[0].Bulk)
+	rest := args[1:]
+	opt, used, err := parseFieldExpireOption(rest, "hgetex")
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	rest = rest[used:]
+	if used == 0 && strings.ToUpper(string(rest[0].Bulk)) == "PERSIST" {
+		opt.persist = true
+		rest = rest[1:]
+	}
+	fields, err := parseFields(rest, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(fields))
+	var updated, persisted, deleted int
+	now := time.Now()
+	for i, arg := range fields {
+		field := string(arg.Bulk)
+		result[i] = resp.NewNullBulkString()
+		if hash == nil {
+			continue
+		}
+		value, found := hash.HGet(field)
+		if !found {
+			continue
+		}
+		result[i] = resp.NewBulkString([]byte(value))
+		switch {
+		case opt.persist:
+			if hash.PersistField(field) {
+				persisted++
+			}
+		case opt.set && !opt.at.After(now):
+			hash.HDel(field)
+			deleted++
+		case opt.set:
+			hash.ExpireFieldAt(field, opt.at)
+			updated++
+		}
+	}
+
+	if updated > 0 {
+		db.TrackFieldExpiry(key)
+		db.Notify(database.NotifyHash, "hexpire", key)
+	}
+	if persisted > 0 {
+		db.Notify(database.NotifyHash, "hpersist", key)
+	}
+	if deleted > 0 {
+		db.Notify(database.NotifyHash, "hdel", key)
+		deleteIfEmptyHash(db, key, hash)
+	}
+	return resp.NewArray(result)
+}
+
+// rewriteHGetEx propagates HGETEX as the change it made to the fields that
+// existed: HPEXPIREAT, HPERSIST or HDEL.
+func rewriteHGetEx(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	fields := fieldArgs(args, 1)
+	var existing []resp.Value
+	for i, r := range reply.Array {
+		if !r.Null {
+			existing = append(existing, fields[i])
+		}
+	}
+	return rewriteFieldExpiry(db, args[0], existing)
+}
+
+func HSetExCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		return resp.NewError("ERR wrong number of arguments for 'hsetex' command")
+	}
+	key := string(args[0].Bulk)
+	var fnx, fxx bool
+	var opt fieldExpireOption
+	rest := args[1:]
+	for len(rest) > 0 && strings.ToUpper(string(rest[0].Bulk)) != "FIELDS" {
+		switch strings.ToUpper(string(rest[0].Bulk)) {
+		case "FNX":
+			if fnx || fxx {
+				return resp.NewError("ERR syntax error")
+			}
+			fnx = true
+			rest = rest[1:]
+			continue
+		case "FXX":
+			if fnx || fxx {
+				return resp.NewError("ERR syntax error")
+			}
+			fxx = true
+			rest = rest[1:]
+			continue
+		case "KEEPTTL":
+			if opt.set || opt.keepTTL {
+				return resp.NewError("ERR syntax error")
+			}
+			opt.keepTTL = true
+			rest = rest[1:]
+			continue
+		}
+		if opt.set || opt.keepTTL {
+			return resp.NewError("ERR syntax error")
+		}
+		parsed, used, err := parseFieldExpireOption(rest, "hsetex")
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		if used == 0 {
+			return resp.NewError("ERR syntax error")
+		}
+		opt = parsed
+		rest = rest[used:]
+	}
+	pairs, err := parseFields(rest, 2)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+
+	hash, ok := lookupHash(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if fnx || fxx {
+		for i := 0; i < len(pairs); i += 2 {
+			exists := hash != nil && hash.HExists(string(pairs[i].Bulk))
+			if exists == fnx {
+				return resp.NewInteger(0)
+			}
+		}
+	}
+
+	hash, _ = lookupOrCreateHash(db, key)
+	for i := 0; i < len(pairs); i += 2 {
+		field, value := string(pairs[i].Bulk), string(pairs[i+1].Bulk)
+		if opt.keepTTL {
+			hash.HSetKeepTTL(field, value)
+		} else {
+			hash.HSet(field, value)
+		}
+	}
+	db.Notify(database.NotifyHash, "hset", key)
+
+	if opt.set {
+		if opt.at.After(time.Now()) {
+			for i := 0; i < len(pairs); i += 2 {
+				hash.ExpireFieldAt(string(pairs[i].Bulk), opt.at)
+			}
+			db.TrackFieldExpiry(key)
+			db.Notify(database.NotifyHash, "hexpire", key)
+		} else {
+			for i := 0; i < len(pairs); i += 2 {
+				hash.HDel(string(pairs[i].Bulk))
+			}
+			db.Notify(database.NotifyHash, "hdel", key)
+			deleteIfEmptyHash(db, key, hash)
+		}
+	}
+	return resp.NewInteger(1)
+}
+
+// rewriteHSetEx propagates a relative or second-precision expiry of HSETEX
+// as PXAT, or as HDEL when the fields were deleted right away.
+func rewriteHSetEx(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	pairs := fieldArgs(args, 1)
+	var opt fieldExpireOption
+	for i := 1; i < len(args) && strings.ToUpper(string(args[i].Bulk)) != "FIELDS"; i++ {
+		if parsed, used, err := parseFieldExpireOption(args[i:], "hsetex"); err == nil && used > 0 {
+			opt = parsed
+		}
+	}
+	if !opt.set {
+		return "HSETEX", args
+	}
+
+	fields := make([]resp.Value, 0, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		fields = append(fields, pairs[i])
+	}
+	name, expiry := rewriteFieldExpiry(db, args[0], fields)
+	if name != "HPEXPIREAT" {
+		return "HDEL", append([]resp.Value{args[0]}, fields...)
+	}
+	numFields := resp.NewBulkString([]byte(strconv.Itoa(len(fields))))
+	rewritten := []resp.Value{args[0], resp.NewBulkString([]byte("PXAT")), expiry[1], resp.NewBulkString([]byte("FIELDS")), numFields}
+	return "HSETEX", append(rewritten, pairs...)
+}
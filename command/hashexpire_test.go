@@ -0,0 +1,118 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// recordPropagation collects the commands p propagates, each rendered as a
+// space-separated string.
+func recordPropagation(p *Processor) func() []string {
+	var mu sync.Mutex
+	var cmds []string
+	p.OnPropagate(func(cmd resp.Value) {
+		mu.Lock()
+		defer mu.Unlock()
+		cmds = append(cmds, strings.Join(flatten(cmd), " "))
+	})
+	return func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), cmds...)
+	}
+}
+
+func TestHExpireReplies(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "HSET", "h", "a", "1", "b", "2", "c", "3")
+
+	expectReply(t, run(p, "HEXPIRE", "h", "100", "FIELDS", "2", "a", "missing"), "1", "-2")
+	expectReply(t, run(p, "HEXPIRE", "h", "200", "NX", "FIELDS", "2", "a", "b"), "0", "1")
+	expectReply(t, run(p, "HEXPIRE", "h", "50", "GT", "FIELDS", "2", "a", "c"), "0", "0")
+	expectReply(t, run(p, "HEXPIRE", "h", "50", "LT", "FIELDS", "2", "a", "c"), "1", "1")
+	expectReply(t, run(p, "HTTL", "h", "FIELDS", "3", "a", "b", "missing"), "50", "200", "-2")
+	expectReply(t, run(p, "HTTL", "nokey", "FIELDS", "1", "a"), "-2")
+
+	expectReply(t, run(p, "HPERSIST", "h", "FIELDS", "2", "a", "a"), "1", "-1")
+	expectReply(t, run(p, "HTTL", "h", "FIELDS", "1", "a"), "-1")
+
+	// An expiry in the past deletes the field, and the key with the last one.
+	expectReply(t, run(p, "HEXPIREAT", "h", "1", "FIELDS", "2", "a", "b"), "2", "2")
+	expectReply(t, run(p, "HEXPIREAT", "h", "1", "FIELDS", "1", "c"), "2")
+	expectReply(t, run(p, "EXISTS", "h"), "0")
+
+	if v := run(p, "HEXPIRE", "h", "10", "FIELDS", "2", "a"); v.Type != resp.ErrorType {
+		t.Fatal("HEXPIRE accepted a numfields larger than the fields given")
+	}
+}
+
+func TestHSetClearsFieldTTL(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "HSET", "h", "a", "1")
+	run(p, "HEXPIRE", "h", "100", "FIELDS", "1", "a")
+	run(p, "HSET", "h", "a", "2")
+	expectReply(t, run(p, "HTTL", "h", "FIELDS", "1", "a"), "-1")
+}
+
+func TestExpiredFieldsArePropagated(t *testing.T) {
+	p := newTestProcessor()
+	propagated := recordPropagation(p)
+	run(p, "HSET", "h", "a", "1", "b", "2")
+	run(p, "HPEXPIRE", "h", "20", "FIELDS", "1", "a")
+	time.Sleep(40 * time.Millisecond)
+
+	// Reading the hash expires the field lazily.
+	expectReply(t, run(p, "HGET", "h", "a"), "<nil>")
+	expectReply(t, run(p, "HLEN", "h"), "1")
+
+	cmds := propagated()
+	if len(cmds) != 3 {
+		t.Fatalf("propagated %q, want HSET, HPEXPIREAT and HDEL", cmds)
+	}
+	if !strings.HasPrefix(cmds[1], "HPEXPIREAT h ") || !strings.HasSuffix(cmds[1], " FIELDS 1 a") {
+		t.Fatalf("HPEXPIRE propagated as %q, want HPEXPIREAT with an absolute time", cmds[1])
+	}
+	if cmds[2] != "HDEL h a" {
+		t.Fatalf("the expired field propagated as %q, want HDEL h a", cmds[2])
+	}
+}
+
+func TestActiveExpireDeletesHashFields(t *testing.T) {
+	p := newTestProcessor()
+	stop := p.StartActiveExpire(5 * time.Millisecond)
+	defer stop()
+	propagated := recordPropagation(p)
+	run(p, "HSET", "h", "a", "1")
+	run(p, "HPEXPIRE", "h", "10", "FIELDS", "1", "a")
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(propagated()) < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("propagated %q, the expired field was never deleted", propagated())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	expectReply(t, run(p, "EXISTS", "h"), "0")
+}
+
+func TestHGetExSetsAndClearsTTL(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "HSET", "h", "a", "1", "b", "2")
+
+	expectReply(t, run(p, "HGETEX", "h", "PX", "100000", "FIELDS", "2", "a", "missing"), "1", "<nil>")
+	ttl := run(p, "HPTTL", "h", "FIELDS", "1", "a").Array[0].Num
+	if ttl <= 0 || ttl > 100000 {
+		t.Fatalf("HPTTL after HGETEX PX 100000 = %d", ttl)
+	}
+	expectReply(t, run(p, "HGETEX", "h", "PERSIST", "FIELDS", "1", "a"), "1")
+	expectReply(t, run(p, "HTTL", "h", "FIELDS", "1", "a"), "-1")
+
+	at := strconv.FormatInt(time.Now().Add(-time.Second).Unix(), 10)
+	expectReply(t, run(p, "HGETEX", "h", "EXAT", at, "FIELDS", "1", "b"), "2")
+	expectReply(t, run(p, "HEXISTS", "h", "b"), "0")
+}
@@ -0,0 +1,126 @@
+package command
+
+import (
+	"errors"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func PFAddCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'pfadd' command")
+	}
+	key := string(args[0].Bulk)
+	elements := make([][]byte, 0, len(args)-1)
+	for _, arg := range args[1:] {
+		elements = append(elements, arg.Bulk)
+	}
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	created := false
+	if str == nil {
+		str = database.NewString(string(database.NewHLL()))
+		db.Set(key, str, 0)
+		created = true
+	}
+
+	var changed bool
+	var err error
+	str.Update(func(buf []byte) []byte {
+		buf, changed, err = database.HLLAdd(buf, elements)
+		return buf
+	})
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	if !changed && !created {
+		return resp.NewInteger(0)
+	}
+	db.Notify(database.NotifyString, "pfadd", key)
+	return resp.NewInteger(1)
+}
+
+func PFCountCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'pfcount' command")
+	}
+
+	if len(args) == 1 {
+		str, ok := lookupString(db, string(args[0].Bulk))
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		if str == nil {
+			return resp.NewInteger(0)
+		}
+		// Refreshing the cached cardinality in the header is not a logical
+		// change, so it is done in place without notifying anyone.
+		var count uint64
+		var err error
+		str.Mutate(0, func(buf []byte) {
+			count, err = database.HLLCount(buf)
+		})
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		return resp.NewInteger(int64(count))
+	}
+
+	var regs database.HLLRegisters
+	for _, arg := range args {
+		if _, err := mergeHLL(db, string(arg.Bulk), &regs); err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+	return resp.NewInteger(int64(regs.Count()))
+}
+
+func PFMergeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'pfmerge' command")
+	}
+	destKey := string(args[0].Bulk)
+
+	var regs database.HLLRegisters
+	dense := false
+	for _, arg := range args {
+		isDense, err := mergeHLL(db, string(arg.Bulk), &regs)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		dense = dense || isDense
+	}
+
+	merged := regs.Encode(dense)
+	if dest, _ := lookupString(db, destKey); dest != nil {
+		dest.Update(func([]byte) []byte { return merged })
+	} else {
+		db.Set(destKey, database.NewString(string(merged)), 0)
+	}
+	db.Notify(database.NotifyString, "pfadd", destKey)
+	return resp.NewSimpleString("OK")
+}
+
+// mergeHLL merges the HyperLogLog at key into regs, reporting whether it is
+// dense. A missing key merges nothing.
+func mergeHLL(db *database.Database, key string, regs *database.HLLRegisters) (bool, error) {
+	str, ok := lookupString(db, key)
+	if !ok {
+		return false, errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return false, nil
+	}
+	var dense bool
+	var err error
+	str.View(func(buf []byte) {
+		if err = regs.Merge(buf); err == nil {
+			dense = database.IsDenseHLL(buf)
+		}
+	})
+	return dense, err
+}
@@ -0,0 +1,26 @@
+package command
+
+import "testing"
+
+func TestPFCommands(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "PFADD", "h1", "a", "b", "c", "d"), "1")
+	expectReply(t, run(p, "PFADD", "h1", "a", "b"), "0")
+	expectReply(t, run(p, "PFADD", "empty"), "1")
+	expectReply(t, run(p, "PFADD", "empty"), "0")
+	expectReply(t, run(p, "PFCOUNT", "h1"), "4")
+	expectReply(t, run(p, "PFCOUNT", "empty", "missing"), "0")
+
+	run(p, "PFADD", "h2", "c", "d", "e", "f", "g")
+	expectReply(t, run(p, "PFCOUNT", "h1", "h2"), "7")
+	expectReply(t, run(p, "PFMERGE", "dst", "h1", "h2"), "OK")
+	expectReply(t, run(p, "PFCOUNT", "dst"), "7")
+	expectReply(t, run(p, "PFMERGE", "h1", "h2"), "OK")
+	expectReply(t, run(p, "PFCOUNT", "h1"), "7")
+
+	run(p, "SET", "s", "not an hll")
+	expectError(t, run(p, "PFCOUNT", "s"), "PFCOUNT of a plain string")
+	expectError(t, run(p, "PFADD", "s", "a"), "PFADD to a plain string")
+	run(p, "RPUSH", "l", "a")
+	expectError(t, run(p, "PFMERGE", "dst", "l"), "PFMERGE of a list")
+}
@@ -0,0 +1,626 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// lookupJSON returns the JSON document stored at key, or nil when the key
+// does not exist. ok is false when the key holds another type.
+func lookupJSON(db *database.Database, key string) (doc *database.JSON, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	doc, ok = val.(*database.JSON)
+	return doc, ok
+}
+
+func parseJSONPathArg(arg resp.Value) (*database.JSONPath, error) {
+	path, err := database.ParseJSONPath(string(arg.Bulk))
+	if err != nil {
+		return nil, fmt.Errorf("ERR %s", err)
+	}
+	return path, nil
+}
+
+// optionalJSONPath parses the path argument of commands where it defaults
+// to the root, in the legacy syntax.
+func optionalJSONPath(args []resp.Value, i int) (*database.JSONPath, string, error) {
+	if i >= len(args) {
+		path, _ := database.ParseJSONPath(".")
+		return path, ".", nil
+	}
+	path, err := parseJSONPathArg(args[i])
+	return path, string(args[i].Bulk), err
+}
+
+func parseJSONValueArg(arg resp.Value) (any, error) {
+	v, err := database.ParseJSON(string(arg.Bulk))
+	if err != nil {
+		return nil, fmt.Errorf("ERR invalid JSON value: %s", err)
+	}
+	return v, nil
+}
+
+func jsonPathMissing(path string) resp.Value {
+	return resp.NewError(fmt.Sprintf("ERR Path '%s' does not exist", path))
+}
+
+func jsonWrongType(expected string, v any) error {
+	return fmt.Errorf("WRONGTYPE wrong type of path value - expected %s but found %s", expected, database.JSONTypeName(v))
+}
+
+const errJSONNoKey = "ERR could not perform this operation on a key that doesn't exist"
+
+// jsonRead replies for a read of path: one result per match for a
+// JSONPath, with nil for matches fn rejects, or the result for the first
+// match of a legacy path, where a rejected match is a WRONGTYPE error.
+func jsonRead(doc *database.JSON, path *database.JSONPath, pathArg, expected string, fn func(v any) (resp.Value, bool)) resp.Value {
+	values := doc.Get(path)
+	if !path.Legacy {
+		result := make([]resp.Value, len(values))
+		for i, v := range values {
+			r, ok := fn(v)
+			if !ok {
+				r = resp.NewNullBulkString()
+			}
+			result[i] = r
+		}
+		return resp.NewArray(result)
+	}
+	if len(values) == 0 {
+		return jsonPathMissing(pathArg)
+	}
+	r, ok := fn(values[0])
+	if !ok {
+		return resp.NewError(jsonWrongType(expected, values[0]).Error())
+	}
+	return r
+}
+
+// jsonUpdate applies fn to each node path matches and returns the results
+// in match order, with nil for nodes that are not of the expected type.
+// For a legacy path such a node is an error, and so is matching nothing.
+// changed reports whether any node was replaced.
+func jsonUpdate(doc *database.JSON, path *database.JSONPath, pathArg, expected string,
+	fn func(v any) (updated, result any, ok bool, err error)) (results []any, changed bool, errReply *resp.Value) {
+	err := doc.Update(path, func(v any) (any, bool, error) {
+		updated, result, ok, err := fn(v)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			if path.Legacy {
+				return nil, false, jsonWrongType(expected, v)
+			}
+			results = append(results, nil)
+			return nil, false, nil
+		}
+		results = append(results, result)
+		changed = true
+		return updated, true, nil
+	})
+	if err != nil {
+		reply := resp.NewError(err.Error())
+		return nil, changed, &reply
+	}
+	if path.Legacy && len(results) == 0 {
+		reply := jsonPathMissing(pathArg)
+		return nil, false, &reply
+	}
+	slices.Reverse(results)
+	return results, changed, nil
+}
+
+// jsonIntegersReply replies with integer results, nil ones as nil, or the
+// first result alone for a legacy path.
+func jsonIntegersReply(path *database.JSONPath, results []any) resp.Value {
+	values := make([]resp.Value, len(results))
+	for i, r := range results {
+		if r == nil {
+			values[i] = resp.NewNullBulkString()
+		} else {
+			values[i] = resp.NewInteger(int64(r.(int)))
+		}
+	}
+	if path.Legacy {
+		return values[0]
+	}
+	return resp.NewArray(values)
+}
+
+func JSONSetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 && len(args) != 4 {
+		return resp.NewError("ERR wrong number of arguments for 'json.set' command")
+	}
+	key := string(args[0].Bulk)
+	path, err := parseJSONPathArg(args[1])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	value, err := parseJSONValueArg(args[2])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	nx, xx := false, false
+	if len(args) == 4 {
+		switch strings.ToUpper(string(args[3].Bulk)) {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+	}
+
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		if xx {
+			return resp.NewNullBulkString()
+		}
+		if !path.IsRoot() {
+			return resp.NewError("ERR new objects must be created at the root")
+		}
+		db.Set(key, database.NewJSON(value), 0)
+	} else if !doc.Set(path, value, nx, xx) {
+		return resp.NewNullBulkString()
+	}
+	db.Notify(database.NotifyModule, "json.set", key)
+	return resp.NewSimpleString("OK")
+}
+
+// JSONGetCommand replies with the serialized matches of each path: the
+// value itself for a single legacy path, an array of matches for a single
+// JSONPath, and an object keyed by path when several are given.
+func JSONGetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'json.get' command")
+	}
+	var format database.JSONFormat
+	i := 1
+options:
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch {
+		case option == "NOESCAPE":
+		case (option == "INDENT" || option == "NEWLINE" || option == "SPACE") && i+1 < len(args):
+			i++
+			switch option {
+			case "INDENT":
+				format.Indent = string(args[i].Bulk)
+			case "NEWLINE":
+				format.Newline = string(args[i].Bulk)
+			default:
+				format.Space = string(args[i].Bulk)
+			}
+		default:
+			break options
+		}
+	}
+
+	pathArgs := args[i:]
+	if len(pathArgs) == 0 {
+		pathArgs = []resp.Value{resp.NewBulkString([]byte("."))}
+	}
+	paths := make([]*database.JSONPath, len(pathArgs))
+	legacy := true
+	for j, arg := range pathArgs {
+		path, err := parseJSONPathArg(arg)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		paths[j] = path
+		legacy = legacy && path.Legacy
+	}
+
+	doc, ok := lookupJSON(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewNullBulkString()
+	}
+
+	results := make([]any, len(paths))
+	for j, path := range paths {
+		values := doc.Get(path)
+		if !legacy {
+			results[j] = values
+			continue
+		}
+		if len(values) == 0 {
+			return jsonPathMissing(string(pathArgs[j].Bulk))
+		}
+		results[j] = values[0]
+	}
+	if len(paths) == 1 {
+		return resp.NewBulkString([]byte(format.Marshal(results[0])))
+	}
+	obj := database.NewJSONObject()
+	for j, arg := range pathArgs {
+		obj.Set(string(arg.Bulk), results[j])
+	}
+	return resp.NewBulkString([]byte(format.Marshal(obj)))
+}
+
+func JSONMGetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'json.mget' command")
+	}
+	path, err := parseJSONPathArg(args[len(args)-1])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	keys := args[:len(args)-1]
+	result := make([]resp.Value, len(keys))
+	for i, key := range keys {
+		result[i] = resp.NewNullBulkString()
+		doc, ok := lookupJSON(db, string(key.Bulk))
+		if !ok || doc == nil {
+			continue
+		}
+		values := doc.Get(path)
+		switch {
+		case !path.Legacy:
+			result[i] = resp.NewBulkString([]byte(database.JSONFormat{}.Marshal(values)))
+		case len(values) > 0:
+			result[i] = resp.NewBulkString([]byte(database.JSONFormat{}.Marshal(values[0])))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+// JSONDelCommand implements JSON.DEL and JSON.FORGET. Deleting the root
+// deletes the key.
+func JSONDelCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'json.del' command")
+	}
+	key := string(args[0].Bulk)
+	path, _, err := optionalJSONPath(args, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewInteger(0)
+	}
+	deleted := 0
+	if path.IsRoot() {
+		db.Delete(key)
+		deleted = 1
+	} else {
+		deleted = doc.Delete(path)
+	}
+	if deleted > 0 {
+		db.Notify(database.NotifyModule, "json.del", key)
+	}
+	return resp.NewInteger(int64(deleted))
+}
+
+func JSONTypeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'json.type' command")
+	}
+	path, _, err := optionalJSONPath(args, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	doc, ok := lookupJSON(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewNullBulkString()
+	}
+	values := doc.Get(path)
+	if path.Legacy {
+		if len(values) == 0 {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewSimpleString(database.JSONTypeName(values[0]))
+	}
+	types := make([]string, len(values))
+	for i, v := range values {
+		types[i] = database.JSONTypeName(v)
+	}
+	return bulkStrings(types)
+}
+
+func JSONNumIncrByCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'json.numincrby' command")
+	}
+	key := string(args[0].Bulk)
+	path, err := parseJSONPathArg(args[1])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	delta, err := database.ParseJSON(string(args[2].Bulk))
+	if err != nil || (database.JSONTypeName(delta) != "integer" && database.JSONTypeName(delta) != "number") {
+		return resp.NewError("ERR expected a number")
+	}
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewError(errJSONNoKey)
+	}
+
+	results, changed, errReply := jsonUpdate(doc, path, string(args[1].Bulk), "a number", func(v any) (any, any, bool, error) {
+		sum, ok, err := addJSONNumbers(v, delta)
+		return sum, sum, ok, err
+	})
+	if changed {
+		db.Notify(database.NotifyModule, "json.numincrby", key)
+	}
+	if errReply != nil {
+		return *errReply
+	}
+	if path.Legacy {
+		return resp.NewBulkString([]byte(database.JSONFormat{}.Marshal(results[0])))
+	}
+	return resp.NewBulkString([]byte(database.JSONFormat{}.Marshal(results)))
+}
+
+// addJSONNumbers adds delta to the number v, keeping an integer when both
+// are integers and the sum does not overflow. ok is false when v is not a
+// number.
+func addJSONNumbers(v, delta any) (sum any, ok bool, err error) {
+	a, isInt := v.(int64)
+	b, deltaInt := delta.(int64)
+	if isInt && deltaInt {
+		if s := a + b; (s > a) == (b > 0) {
+			return s, true, nil
+		}
+	}
+	var x, y float64
+	switch t := v.(type) {
+	case int64:
+		x = float64(t)
+	case float64:
+		x = t
+	default:
+		return nil, false, nil
+	}
+	if deltaInt {
+		y = float64(b)
+	} else {
+		y = delta.(float64)
+	}
+	if s := x + y; !math.IsInf(s, 0) && !math.IsNaN(s) {
+		return s, true, nil
+	}
+	return nil, false, fmt.Errorf("ERR result is infinite or not a number")
+}
+
+func JSONStrAppendCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 && len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'json.strappend' command")
+	}
+	key := string(args[0].Bulk)
+	path, pathArg, err := optionalJSONPath(args[:len(args)-1], 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	value, err := database.ParseJSON(string(args[len(args)-1].Bulk))
+	suffix, isString := value.(string)
+	if err != nil || !isString {
+		return resp.NewError("ERR expected a JSON string")
+	}
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewError(errJSONNoKey)
+	}
+
+	results, changed, errReply := jsonUpdate(doc, path, pathArg, "string", func(v any) (any, any, bool, error) {
+		s, ok := v.(string)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		s += suffix
+		return s, len(s), true, nil
+	})
+	if changed {
+		db.Notify(database.NotifyModule, "json.strappend", key)
+	}
+	if errReply != nil {
+		return *errReply
+	}
+	return jsonIntegersReply(path, results)
+}
+
+func JSONArrAppendCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'json.arrappend' command")
+	}
+	return jsonArrInsert(db, args[0], args[1], nil, args[2:], "json.arrappend")
+}
+
+func JSONArrInsertCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'json.arrinsert' command")
+	}
+	index, err := strconv.ParseInt(string(args[2].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	return jsonArrInsert(db, args[0], args[1], &index, args[3:], "json.arrinsert")
+}
+
+// jsonArrInsert inserts values into the arrays path matches, before index,
+// which counts from the end when negative, or at the end when it is nil.
+func jsonArrInsert(db *database.Database, keyArg, pathArg resp.Value, index *int64, valueArgs []resp.Value, event string) resp.Value {
+	key := string(keyArg.Bulk)
+	path, err := parseJSONPathArg(pathArg)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	values := make([]any, len(valueArgs))
+	for i, arg := range valueArgs {
+		if values[i], err = parseJSONValueArg(arg); err != nil {
+			return resp.NewError(err.Error())
+		}
+	}
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewError(errJSONNoKey)
+	}
+
+	inserted := false
+	results, changed, errReply := jsonUpdate(doc, path, string(pathArg.Bulk), "array", func(v any) (any, any, bool, error) {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		at := int64(len(arr))
+		if index != nil {
+			at = *index
+			if at < 0 {
+				at += int64(len(arr))
+			}
+			if at < 0 || at > int64(len(arr)) {
+				return nil, nil, false, fmt.Errorf("ERR index out of bounds")
+			}
+		}
+		elems := values
+		if inserted {
+			elems = database.CloneJSON(values).([]any)
+		}
+		inserted = true
+		arr = slices.Insert(arr, int(at), elems...)
+		return arr, len(arr), true, nil
+	})
+	if changed {
+		db.Notify(database.NotifyModule, event, key)
+	}
+	if errReply != nil {
+		return *errReply
+	}
+	return jsonIntegersReply(path, results)
+}
+
+func JSONArrPopCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 3 {
+		return resp.NewError("ERR wrong number of arguments for 'json.arrpop' command")
+	}
+	key := string(args[0].Bulk)
+	path, pathArg, err := optionalJSONPath(args, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	index := int64(-1)
+	if len(args) == 3 {
+		if index, err = strconv.ParseInt(string(args[2].Bulk), 10, 64); err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+	}
+	doc, ok := lookupJSON(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewNullBulkString()
+	}
+
+	results, changed, errReply := jsonUpdate(doc, path, pathArg, "array", func(v any) (any, any, bool, error) {
+		arr, ok := v.([]any)
+		if !ok {
+			return nil, nil, false, nil
+		}
+		if len(arr) == 0 {
+			return arr, nil, true, nil
+		}
+		at := index
+		if at < 0 {
+			at += int64(len(arr))
+		}
+		at = min(max(at, 0), int64(len(arr)-1))
+		popped := database.JSONFormat{}.Marshal(arr[at])
+		return slices.Delete(arr, int(at), int(at)+1), popped, true, nil
+	})
+	if changed {
+		db.Notify(database.NotifyModule, "json.arrpop", key)
+	}
+	if errReply != nil {
+		return *errReply
+	}
+	values := make([]resp.Value, len(results))
+	for i, r := range results {
+		if r == nil {
+			values[i] = resp.NewNullBulkString()
+		} else {
+			values[i] = resp.NewBulkString([]byte(r.(string)))
+		}
+	}
+	if path.Legacy {
+		return values[0]
+	}
+	return resp.NewArray(values)
+}
+
+func JSONArrLenCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'json.arrlen' command")
+	}
+	path, pathArg, err := optionalJSONPath(args, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	doc, ok := lookupJSON(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewNullBulkString()
+	}
+	return jsonRead(doc, path, pathArg, "array", func(v any) (resp.Value, bool) {
+		arr, ok := v.([]any)
+		return resp.NewInteger(int64(len(arr))), ok
+	})
+}
+
+func JSONObjKeysCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 && len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'json.objkeys' command")
+	}
+	path, pathArg, err := optionalJSONPath(args, 1)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	doc, ok := lookupJSON(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if doc == nil {
+		return resp.NewNullBulkString()
+	}
+	return jsonRead(doc, path, pathArg, "object", func(v any) (resp.Value, bool) {
+		obj, ok := v.(*database.JSONObject)
+		if !ok {
+			return resp.Value{}, false
+		}
+		return bulkStrings(obj.Keys()), true
+	})
+}
@@ -0,0 +1,28 @@
+package command
+
+import "testing"
+
+func TestJSONPathAndLegacyReplies(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "JSON.SET", "k", "$", `{"a":[1,2],"b":{"a":"x"}}`), "OK")
+
+	expectReply(t, run(p, "JSON.GET", "k", "$..a"), `[[1,2],"x"]`)
+	expectReply(t, run(p, "JSON.GET", "k", ".a"), `[1,2]`)
+	expectReply(t, run(p, "JSON.GET", "k", "$.missing"), `[]`)
+	expectReply(t, run(p, "JSON.GET", "missing", "$"), "<nil>")
+	expectError(t, run(p, "JSON.GET", "k", ".missing"), "JSON.GET of a missing legacy path")
+
+	expectReply(t, run(p, "JSON.ARRAPPEND", "k", "$..a", "3"), "3", "<nil>")
+	expectReply(t, run(p, "JSON.NUMINCRBY", "k", "$.a[0]", "1.5"), "[2.5]")
+	expectReply(t, run(p, "JSON.TYPE", "k", "$.a[*]"), "number", "integer", "integer")
+
+	// A new member needs an existing parent.
+	expectReply(t, run(p, "JSON.SET", "k", "$.c.d", "1"), "<nil>")
+	expectReply(t, run(p, "JSON.SET", "k", "$.c", "{}", "NX"), "OK")
+	expectReply(t, run(p, "JSON.SET", "k", "$.c", "[]", "NX"), "<nil>")
+
+	expectReply(t, run(p, "JSON.DEL", "k", "$.a[2,0]"), "2")
+	expectReply(t, run(p, "JSON.GET", "k"), `{"a":[2],"b":{"a":"x"},"c":{}}`)
+	expectReply(t, run(p, "JSON.DEL", "k", "$"), "1")
+	expectReply(t, run(p, "EXISTS", "k"), "0")
+}
@@ -0,0 +1,509 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// lookupList returns the list stored at key, or nil when the key does not
+// exist. ok is false when the key holds another type.
+func lookupList(db *database.Database, key string) (list *database.List, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	list, ok = val.(*database.List)
+	return list, ok
+}
+
+// deleteIfEmptyList removes key once its list has no elements left, as Redis
+// never keeps empty lists around.
+func deleteIfEmptyList(db *database.Database, key string, list *database.List) {
+	if list.LLen() == 0 && db.Delete(key) {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+// popList pops up to count elements from one end of the list at key,
+// notifying the pop and deleting the key once it is empty.
+func popList(db *database.Database, key string, list *database.List, left bool, count int) []string {
+	popped := make([]string, 0, min(count, list.LLen()))
+	for len(popped) < count {
+		var element string
+		var ok bool
+		if left {
+			element, ok = list.LPop()
+		} else {
+			element, ok = list.RPop()
+		}
+		if !ok {
+			break
+		}
+		popped = append(popped, element)
+	}
+	if len(popped) > 0 {
+		event := "rpop"
+		if left {
+			event = "lpop"
+		}
+		db.Notify(database.NotifyList, event, key)
+		deleteIfEmptyList(db, key, list)
+	}
+	return popped
+}
+
+func popGeneric(db *database.Database, args []resp.Value, left bool, name string) resp.Value {
+	if len(args) < 1 || len(args) > 2 {
+		return resp.NewError("ERR wrong number of arguments for '" + name + "' command")
+	}
+	key := string(args[0].Bulk)
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil || n < 0 {
+			return resp.NewError("ERR value is out of range, must be positive")
+		}
+		count = clampInt(n)
+	}
+
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		if len(args) == 2 {
+			return resp.NewNullArray()
+		}
+		return resp.NewNullBulkString()
+	}
+
+	popped := popList(db, key, list, left, count)
+	if len(args) == 1 {
+		return resp.NewBulkString([]byte(popped[0]))
+	}
+	return bulkStrings(popped)
+}
+
+func bulkStrings(elements []string) resp.Value {
+	result := make([]resp.Value, len(elements))
+	for i, element := range elements {
+		result[i] = resp.NewBulkString([]byte(element))
+	}
+	return resp.NewArray(result)
+}
+
+func pushXGeneric(db *database.Database, args []resp.Value, left bool, name string) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for '" + name + "' command")
+	}
+	key := string(args[0].Bulk)
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewInteger(0)
+	}
+	elements := make([]string, len(args)-1)
+	for i, arg := range args[1:] {
+		elements[i] = string(arg.Bulk)
+	}
+	if left {
+		list.LPush(elements...)
+		db.Notify(database.NotifyList, "lpush", key)
+	} else {
+		list.RPush(elements...)
+		db.Notify(database.NotifyList, "rpush", key)
+	}
+	return resp.NewInteger(int64(list.LLen()))
+}
+
+func LPushXCommand(db *database.Database, args []resp.Value) resp.Value {
+	return pushXGeneric(db, args, true, "lpushx")
+}
+
+func RPushXCommand(db *database.Database, args []resp.Value) resp.Value {
+	return pushXGeneric(db, args, false, "rpushx")
+}
+
+func LRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'lrange' command")
+	}
+	start, err1 := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2].Bulk), 10, 64)
+	if err1 != nil || err2 != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	list, ok := lookupList(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	first, last, nonEmpty := listRange(start, stop, list.LLen())
+	if !nonEmpty {
+		return resp.NewArray([]resp.Value{})
+	}
+	return bulkStrings(list.Range(first, last))
+}
+
+// listRange resolves LRANGE/LTRIM style indexes against length. ok is false
+// when the range selects nothing.
+func listRange(start, stop int64, length int) (int, int, bool) {
+	n := int64(length)
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if start > stop || start >= n {
+		return 0, 0, false
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	return int(start), int(stop), true
+}
+
+func LIndexCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'lindex' command")
+	}
+	index, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	list, ok := lookupList(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewNullBulkString()
+	}
+	element, found := list.Index(clampInt(index))
+	if !found {
+		return resp.NewNullBulkString()
+	}
+	return resp.NewBulkString([]byte(element))
+}
+
+func LSetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'lset' command")
+	}
+	key := string(args[0].Bulk)
+	index, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewError("ERR no such key")
+	}
+	if !list.Set(clampInt(index), string(args[2].Bulk)) {
+		return resp.NewError("ERR index out of range")
+	}
+	db.Notify(database.NotifyList, "lset", key)
+	return resp.NewSimpleString("OK")
+}
+
+func LInsertCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 4 {
+		return resp.NewError("ERR wrong number of arguments for 'linsert' command")
+	}
+	key := string(args[0].Bulk)
+	var after bool
+	switch strings.ToUpper(string(args[1].Bulk)) {
+	case "BEFORE":
+	case "AFTER":
+		after = true
+	default:
+		return resp.NewError("ERR syntax error")
+	}
+
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewInteger(0)
+	}
+	newLen := list.Insert(string(args[2].Bulk), string(args[3].Bulk), after)
+	if newLen != -1 {
+		db.Notify(database.NotifyList, "linsert", key)
+	}
+	return resp.NewInteger(int64(newLen))
+}
+
+func LRemCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'lrem' command")
+	}
+	key := string(args[0].Bulk)
+	count, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewInteger(0)
+	}
+	removed := list.Remove(clampInt(count), string(args[2].Bulk))
+	if removed > 0 {
+		db.Notify(database.NotifyList, "lrem", key)
+		deleteIfEmptyList(db, key, list)
+	}
+	return resp.NewInteger(int64(removed))
+}
+
+func LTrimCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'ltrim' command")
+	}
+	key := string(args[0].Bulk)
+	start, err1 := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2].Bulk), 10, 64)
+	if err1 != nil || err2 != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	list, ok := lookupList(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if list == nil {
+		return resp.NewSimpleString("OK")
+	}
+	first, last, nonEmpty := listRange(start, stop, list.LLen())
+	if !nonEmpty {
+		first, last = 1, 0
+	}
+	list.Trim(first, last)
+	db.Notify(database.NotifyList, "ltrim", key)
+	deleteIfEmptyList(db, key, list)
+	return resp.NewSimpleString("OK")
+}
+
+func LPosCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return resp.NewError("ERR wrong number of arguments for 'lpos' command")
+	}
+	rank, count, maxLen := int64(1), int64(0), int64(0)
+	countGiven := false
+	for i := 2; i < len(args); i += 2 {
+		n, err := strconv.ParseInt(string(args[i+1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		switch strings.ToUpper(string(args[i].Bulk)) {
+		case "RANK":
+			if n == 0 || n == -1<<63 {
+				return resp.NewError("ERR RANK can't be zero: use 1 to start from the first match, 2 from the second ... or use negative to start from the end of the list")
+			}
+			rank = n
+		case "COUNT":
+			if n < 0 {
+				return resp.NewError("ERR COUNT can't be negative")
+			}
+			count, countGiven = n, true
+		case "MAXLEN":
+			if n < 0 {
+				return resp.NewError("ERR MAXLEN can't be negative")
+			}
+			maxLen = n
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+	}
+
+	list, ok := lookupList(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	var positions []int
+	if list != nil {
+		limit := count
+		if !countGiven {
+			limit = 1
+		}
+		positions = list.Positions(string(args[1].Bulk), clampInt(rank), clampInt(limit), clampInt(maxLen))
+	}
+
+	if !countGiven {
+		if len(positions) == 0 {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewInteger(int64(positions[0]))
+	}
+	result := make([]resp.Value, len(positions))
+	for i, pos := range positions {
+		result[i] = resp.NewInteger(int64(pos))
+	}
+	return resp.NewArray(result)
+}
+
+// parseDirection parses the LEFT|RIGHT arguments of LMOVE and LMPOP.
+func parseDirection(arg resp.Value) (left bool, ok bool) {
+	switch strings.ToUpper(string(arg.Bulk)) {
+	case "LEFT":
+		return true, true
+	case "RIGHT":
+		return false, true
+	}
+	return false, false
+}
+
+func LMoveCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 4 {
+		return resp.NewError("ERR wrong number of arguments for 'lmove' command")
+	}
+	from, ok1 := parseDirection(args[2])
+	to, ok2 := parseDirection(args[3])
+	if !ok1 || !ok2 {
+		return resp.NewError("ERR syntax error")
+	}
+	return lmoveGeneric(db, string(args[0].Bulk), string(args[1].Bulk), from, to)
+}
+
+func RPopLPushCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'rpoplpush' command")
+	}
+	return lmoveGeneric(db, string(args[0].Bulk), string(args[1].Bulk), false, true)
+}
+
+// lmoveGeneric atomically pops an element from one end of source and pushes
+// it onto one end of destination, which may be the same list.
+func lmoveGeneric(db *database.Database, source, destination string, from, to bool) resp.Value {
+	src, ok := lookupList(db, source)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if src == nil {
+		return resp.NewNullBulkString()
+	}
+	dst, ok := lookupList(db, destination)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	var element string
+	if from {
+		element, _ = src.LPop()
+		db.Notify(database.NotifyList, "lpop", source)
+	} else {
+		element, _ = src.RPop()
+		db.Notify(database.NotifyList, "rpop", source)
+	}
+	if dst == nil {
+		dst = database.NewList()
+		db.Set(destination, dst, 0)
+	}
+	if to {
+		dst.LPush(element)
+		db.Notify(database.NotifyList, "lpush", destination)
+	} else {
+		dst.RPush(element)
+		db.Notify(database.NotifyList, "rpush", destination)
+	}
+	deleteIfEmptyList(db, source, src)
+	return resp.NewBulkString([]byte(element))
+}
+
+func LMPopCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'lmpop' command")
+	}
+	keys, left, count, errReply := parseMPop(args, parseDirection)
+	if errReply != nil {
+		return *errReply
+	}
+
+	for _, key := range keys {
+		list, ok := lookupList(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		if list == nil {
+			continue
+		}
+		popped := popList(db, key, list, left, count)
+		return resp.NewArray([]resp.Value{resp.NewBulkString([]byte(key)), bulkStrings(popped)})
+	}
+	return resp.NewNullArray()
+}
+
+// parseMPop parses "numkeys key [key ...] LEFT|RIGHT [COUNT count]", or
+// MIN|MAX for the sorted set forms, with parseWhere parsing the end to pop
+// from.
+func parseMPop(args []resp.Value, parseWhere func(resp.Value) (bool, bool)) (keys []string, left bool, count int, errReply *resp.Value) {
+	fail := func(msg string) ([]string, bool, int, *resp.Value) {
+		reply := resp.NewError(msg)
+		return nil, false, 0, &reply
+	}
+	numKeys, err := strconv.ParseInt(string(args[0].Bulk), 10, 64)
+	if err != nil {
+		return fail("ERR value is not an integer or out of range")
+	}
+	if numKeys <= 0 {
+		return fail("ERR numkeys should be greater than 0")
+	}
+	if numKeys > int64(len(args)-2) {
+		return fail("ERR Number of keys can't be greater than number of args")
+	}
+	for _, arg := range args[1 : 1+numKeys] {
+		keys = append(keys, string(arg.Bulk))
+	}
+	rest := args[1+numKeys:]
+	left, ok := parseWhere(rest[0])
+	if !ok {
+		return fail("ERR syntax error")
+	}
+	count = 1
+	rest = rest[1:]
+	if len(rest) > 0 {
+		if len(rest) != 2 || strings.ToUpper(string(rest[0].Bulk)) != "COUNT" {
+			return fail("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(string(rest[1].Bulk), 10, 64)
+		if err != nil || n <= 0 {
+			return fail("ERR count should be greater than 0")
+		}
+		count = clampInt(n)
+	}
+	return keys, left, count, nil
+}
+
+// rewriteMPop propagates LMPOP as the LPOP or RPOP of the key it popped from.
+func rewriteMPop(numKeysIndex int) RewriteFunc {
+	return func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+		rest := args[numKeysIndex:]
+		numKeys, _ := strconv.Atoi(string(rest[0].Bulk))
+		left, _ := parseDirection(rest[1+numKeys])
+		name := "RPOP"
+		if left {
+			name = "LPOP"
+		}
+		count := strconv.Itoa(len(reply.Array[1].Array))
+		return name, []resp.Value{reply.Array[0], resp.NewBulkString([]byte(count))}
+	}
+}
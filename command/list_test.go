@@ -0,0 +1,97 @@
+package command
+
+import "testing"
+
+func TestPushAndPop(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "LPUSHX", "l", "a"), "0")
+	expectReply(t, run(p, "RPUSH", "l", "a", "b", "c"), "3")
+	expectReply(t, run(p, "LPUSH", "l", "y", "z"), "5")
+	expectReply(t, run(p, "RPUSHX", "l", "d"), "6")
+	expectReply(t, run(p, "LRANGE", "l", "0", "-1"), "z", "y", "a", "b", "c", "d")
+
+	expectReply(t, run(p, "LPOP", "l"), "z")
+	expectReply(t, run(p, "RPOP", "l", "2"), "d", "c")
+	expectReply(t, run(p, "LPOP", "l", "0"))
+	expectReply(t, run(p, "LPOP", "l", "10"), "y", "a", "b")
+	expectReply(t, run(p, "EXISTS", "l"), "0")
+	expectReply(t, run(p, "LPOP", "l"), "<nil>")
+	expectReply(t, run(p, "LPOP", "l", "1"), "<nil>")
+	expectError(t, run(p, "LPOP", "l", "-1"), "LPOP with a negative count")
+
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "RPUSH", "s", "a"), "RPUSH to a string")
+}
+
+func TestLRangeAndLIndex(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "l", "a", "b", "c", "d")
+	expectReply(t, run(p, "LRANGE", "l", "1", "2"), "b", "c")
+	expectReply(t, run(p, "LRANGE", "l", "-100", "100"), "a", "b", "c", "d")
+	expectReply(t, run(p, "LRANGE", "l", "-2", "-1"), "c", "d")
+	expectReply(t, run(p, "LRANGE", "l", "3", "1"))
+	expectReply(t, run(p, "LRANGE", "l", "5", "10"))
+	expectReply(t, run(p, "LINDEX", "l", "-1"), "d")
+	expectReply(t, run(p, "LINDEX", "l", "4"), "<nil>")
+	expectError(t, run(p, "LINDEX", "l", "x"), "LINDEX x")
+}
+
+func TestListEdits(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "l", "a", "b", "a", "c", "a")
+	expectReply(t, run(p, "LSET", "l", "-1", "e"), "OK")
+	expectError(t, run(p, "LSET", "l", "5", "x"), "LSET past the end")
+	expectError(t, run(p, "LSET", "missing", "0", "x"), "LSET of a missing key")
+
+	expectReply(t, run(p, "LINSERT", "l", "BEFORE", "c", "x"), "6")
+	expectReply(t, run(p, "LINSERT", "l", "AFTER", "e", "y"), "7")
+	expectReply(t, run(p, "LINSERT", "l", "AFTER", "nope", "z"), "-1")
+	expectReply(t, run(p, "LINSERT", "missing", "AFTER", "a", "z"), "0")
+	expectReply(t, run(p, "LRANGE", "l", "0", "-1"), "a", "b", "a", "x", "c", "e", "y")
+
+	expectReply(t, run(p, "LREM", "l", "-1", "a"), "1")
+	expectReply(t, run(p, "LRANGE", "l", "0", "-1"), "a", "b", "x", "c", "e", "y")
+	expectReply(t, run(p, "LREM", "l", "0", "a"), "1")
+
+	expectReply(t, run(p, "LTRIM", "l", "1", "-2"), "OK")
+	expectReply(t, run(p, "LRANGE", "l", "0", "-1"), "x", "c", "e")
+	expectReply(t, run(p, "LTRIM", "l", "5", "10"), "OK")
+	expectReply(t, run(p, "EXISTS", "l"), "0")
+}
+
+func TestLPos(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "l", "a", "b", "c", "1", "2", "3", "c", "c")
+	expectReply(t, run(p, "LPOS", "l", "c"), "2")
+	expectReply(t, run(p, "LPOS", "l", "c", "RANK", "2"), "6")
+	expectReply(t, run(p, "LPOS", "l", "c", "RANK", "-1"), "7")
+	expectReply(t, run(p, "LPOS", "l", "c", "COUNT", "2"), "2", "6")
+	expectReply(t, run(p, "LPOS", "l", "c", "COUNT", "0"), "2", "6", "7")
+	expectReply(t, run(p, "LPOS", "l", "c", "RANK", "-1", "COUNT", "2"), "7", "6")
+	expectReply(t, run(p, "LPOS", "l", "c", "COUNT", "0", "MAXLEN", "3"), "2")
+	expectReply(t, run(p, "LPOS", "l", "x"), "<nil>")
+	expectReply(t, run(p, "LPOS", "l", "x", "COUNT", "1"))
+	expectError(t, run(p, "LPOS", "l", "c", "RANK", "0"), "LPOS RANK 0")
+	expectError(t, run(p, "LPOS", "l", "c", "COUNT", "-1"), "LPOS COUNT -1")
+}
+
+func TestLMoveAndLMPop(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "src", "a", "b", "c")
+	expectReply(t, run(p, "LMOVE", "src", "dst", "RIGHT", "LEFT"), "c")
+	expectReply(t, run(p, "LMOVE", "src", "dst", "LEFT", "RIGHT"), "a")
+	expectReply(t, run(p, "RPOPLPUSH", "src", "src"), "b")
+	expectReply(t, run(p, "LRANGE", "dst", "0", "-1"), "c", "a")
+	expectReply(t, run(p, "LMOVE", "missing", "dst", "LEFT", "LEFT"), "<nil>")
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "LMOVE", "dst", "s", "LEFT", "LEFT"), "LMOVE to a string")
+	expectReply(t, run(p, "LRANGE", "dst", "0", "-1"), "c", "a")
+
+	propagated := recordPropagation(p)
+	expectReply(t, run(p, "LMPOP", "3", "missing", "dst", "src", "RIGHT", "COUNT", "5"), "dst", "a", "c")
+	expectReply(t, run(p, "LMPOP", "1", "dst", "LEFT"), "<nil>")
+	expectStrings(t, propagated(), "RPOP dst 2")
+	expectError(t, run(p, "LMPOP", "0", "src", "LEFT"), "LMPOP with no keys")
+	expectError(t, run(p, "LMPOP", "1", "src", "UP"), "LMPOP UP")
+	expectError(t, run(p, "LMPOP", "1", "src", "LEFT", "COUNT", "0"), "LMPOP COUNT 0")
+}
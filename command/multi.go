@@ -0,0 +1,93 @@
+package command
+
+import (
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// transactionCommands are run by the processor itself instead of being
+// queued while a transaction is open.
+var transactionCommands = map[string]bool{"MULTI": true, "EXEC": true, "DISCARD": true}
+
+// transactionCommand runs MULTI, EXEC and DISCARD. A transaction belongs to a
+// session: MULTI starts queueing its commands, and EXEC runs them all under
+// the write lock, so no other client's command is interleaved with them and
+// clients blocked on the keys they wrote are served afterwards.
+func (p *Processor) transactionCommand(s *Session, commandName string, args []resp.Value) resp.Value {
+	if len(args) != 0 {
+		return resp.NewError("ERR wrong number of arguments for '" + strings.ToLower(commandName) + "' command")
+	}
+	if s == nil {
+		return resp.NewError("ERR " + commandName + " is only available to client connections")
+	}
+
+	switch commandName {
+	case "MULTI":
+		if s.multi {
+			return resp.NewError("ERR MULTI calls can not be nested")
+		}
+		s.multi = true
+		return resp.NewSimpleString("OK")
+	case "DISCARD":
+		if !s.multi {
+			return resp.NewError("ERR DISCARD without MULTI")
+		}
+		s.resetMulti()
+		return resp.NewSimpleString("OK")
+	}
+
+	if !s.multi {
+		return resp.NewError("ERR EXEC without MULTI")
+	}
+	queued, failed := s.queued, s.multiFailed
+	s.resetMulti()
+	if failed {
+		return resp.NewError("EXECABORT Transaction discarded because of previous errors.")
+	}
+
+	p.exec.Lock()
+	defer p.exec.Unlock()
+	replies := make([]resp.Value, len(queued))
+	for i, cmd := range queued {
+		replies[i] = p.execQueued(s, cmd)
+	}
+	p.db.ServeReady()
+	return resp.NewArray(replies)
+}
+
+// execQueued runs a queued command with the write lock already held.
+// Blocking commands do not wait inside a transaction; they reply as if they
+// had timed out, as in Redis.
+func (p *Processor) execQueued(s *Session, cmdValue resp.Value) resp.Value {
+	commandName := strings.ToUpper(string(cmdValue.Array[0].Bulk))
+	args := cmdValue.Array[1:]
+
+	p.mu.RLock()
+	handler := p.handlers[commandName]
+	write := p.writes[commandName]
+	rewrite := p.rewrites[commandName]
+	blocking, isBlocking := p.blocking[commandName]
+	p.mu.RUnlock()
+
+	switch {
+	case commandName == "CLIENT":
+		return p.clientCommand(s, args)
+	case isBlocking:
+		var wait *Wait
+		reply := p.apply(commandName, args, rewrite, func() resp.Value {
+			var reply resp.Value
+			reply, wait = blocking(p.db, args)
+			return reply
+		})
+		if wait != nil {
+			return wait.Reply
+		}
+		return reply
+	case !write:
+		return handler(p.db, args)
+	}
+	return p.apply(commandName, args, rewrite, func() resp.Value {
+		return handler(p.db, args)
+	})
+}
@@ -0,0 +1,89 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func runFor(p *Processor, s *Session, args ...string) resp.Value {
+	return p.ProcessFor(s, commandValue(args...))
+}
+
+func TestMultiExec(t *testing.T) {
+	p := newTestProcessor()
+	s := p.NewSession()
+	expectReply(t, runFor(p, s, "MULTI"), "OK")
+	expectReply(t, runFor(p, s, "SET", "k", "1"), "QUEUED")
+	expectReply(t, runFor(p, s, "INCR", "k"), "QUEUED")
+	expectReply(t, runFor(p, s, "BLPOP", "q", "0"), "QUEUED")
+	// Another client does not see the queued writes before EXEC.
+	if v := run(p, "GET", "k"); !v.Null {
+		t.Fatalf("GET k before EXEC = %q", flatten(v))
+	}
+	expectReply(t, runFor(p, s, "EXEC"), "OK", "2", "<nil>")
+	expectReply(t, run(p, "GET", "k"), "2")
+}
+
+func TestMultiErrors(t *testing.T) {
+	p := newTestProcessor()
+	s := p.NewSession()
+	for _, c := range []struct {
+		args []string
+		err  string
+	}{
+		{[]string{"EXEC"}, "ERR EXEC without MULTI"},
+		{[]string{"DISCARD"}, "ERR DISCARD without MULTI"},
+		{[]string{"MULTI", "x"}, "ERR wrong number of arguments"},
+	} {
+		if v := runFor(p, s, c.args...); v.Type != resp.ErrorType || !strings.HasPrefix(v.Str, c.err) {
+			t.Errorf("%q = %q, want %s", c.args, flatten(v), c.err)
+		}
+	}
+	if v := run(p, "MULTI"); v.Type != resp.ErrorType {
+		t.Error("MULTI without a session was accepted")
+	}
+
+	runFor(p, s, "MULTI")
+	if v := runFor(p, s, "MULTI"); v.Type != resp.ErrorType {
+		t.Error("a nested MULTI was accepted")
+	}
+	runFor(p, s, "SET", "k", "1")
+	expectReply(t, runFor(p, s, "DISCARD"), "OK")
+	if v := run(p, "EXISTS", "k"); v.Num != 0 {
+		t.Fatal("a discarded transaction was applied")
+	}
+
+	// A command rejected while queueing aborts the transaction, while one
+	// that fails when run does not.
+	runFor(p, s, "MULTI")
+	runFor(p, s, "SET", "k", "1")
+	runFor(p, s, "NOSUCHCOMMAND")
+	if v := runFor(p, s, "EXEC"); v.Type != resp.ErrorType || !strings.HasPrefix(v.Str, "EXECABORT") {
+		t.Fatalf("EXEC after a rejected command = %q, want EXECABORT", flatten(v))
+	}
+	runFor(p, s, "MULTI")
+	runFor(p, s, "SET", "k", "a")
+	runFor(p, s, "INCR", "k")
+	runFor(p, s, "SET", "j", "b")
+	v := runFor(p, s, "EXEC")
+	if len(v.Array) != 3 || v.Array[1].Type != resp.ErrorType {
+		t.Fatalf("EXEC = %q, want INCR's error in the middle", flatten(v))
+	}
+	expectReply(t, run(p, "GET", "j"), "b")
+}
+
+func TestExecServesBlockedClientsAfterwards(t *testing.T) {
+	p := newTestProcessor()
+	_, reply := block(t, p, "BLPOP", "q", "0")
+	s := p.NewSession()
+	runFor(p, s, "MULTI")
+	runFor(p, s, "RPUSH", "q", "a")
+	runFor(p, s, "DEL", "q")
+	runFor(p, s, "RPUSH", "q", "b", "c")
+	runFor(p, s, "EXEC")
+	// The waiter sees the state the whole transaction left behind.
+	expectReply(t, await(t, reply), "q", "b")
+	expectReply(t, run(p, "LRANGE", "q", "0", "-1"), "c")
+}
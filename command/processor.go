@@ -5,57 +5,297 @@ import (
 	"log"
 	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/HORUSCRIME/goredis/cdc"
 	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/pubsub"
 	"github.com/HORUSCRIME/goredis/resp"
 )
 
 type HandlerFunc func(db *database.Database, args []resp.Value) resp.Value
 
+// RewriteFunc replaces a write command with the one that is propagated to the
+// AOF and CDC feed, typically to record a result instead of an operation.
+type RewriteFunc func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value)
+
+// Propagation is a command as it is propagated to the AOF and CDC feed.
+type Propagation struct {
+	Name string
+	Args []resp.Value
+}
+
+// ExpandFunc is a RewriteFunc for writes that take several commands, or
+// none, to describe, such as XREADGROUP.
+type ExpandFunc func(db *database.Database, args []resp.Value, reply resp.Value) []Propagation
+
 type Processor struct {
 	handlers map[string]HandlerFunc
+	writes   map[string]bool
+	rewrites map[string]ExpandFunc
 	db       *database.Database 
+	notifier *pubsub.KeyspaceNotifier
+	cdc      *cdc.Feed
 	mu       sync.RWMutex
+
+	propagators []func(cmd resp.Value)
+
+	blocking map[string]BlockingFunc
+	sessions sessions
+
+	// exec serializes write commands against each other and against reads,
+	// so every write is atomic and reaches the CDC feed in the order it was
+	// applied. dirty counts keyspace events and tells whether a write
+	// command actually changed anything.
+	exec  sync.RWMutex
+	dirty atomic.Int64
+
+	// replaying is set while Replay runs, so commands read back from
+	// persistence are not appended to the CDC feed or propagated again.
+	replaying atomic.Bool
+
+	// expireUsers counts the callers of StartActiveExpire that have not
+	// stopped it; the cycle runs while it is positive.
+	expireMu    sync.Mutex
+	expireUsers int
+	expireDone  chan struct{}
 }
 
-func NewProcessor(db *database.Database) *Processor {
+func NewProcessor(db *database.Database, notifier *pubsub.KeyspaceNotifier) *Processor {
 	p := &Processor{
 		db:       db,
+		notifier: notifier,
+		cdc:      cdc.NewFeed(cdc.DefaultRetention),
 		handlers: make(map[string]HandlerFunc),
+		writes:   make(map[string]bool),
+		rewrites: make(map[string]ExpandFunc),
+		blocking: make(map[string]BlockingFunc),
+		sessions: sessions{byID: make(map[int64]*Session)},
 	}
+	db.AddKeyspaceListener(p.keyspaceEvent)
+	db.AddFieldExpiryListener(p.fieldsExpired)
 	p.registerDefaultHandlers()
 	return p
 }
 
+func (p *Processor) CDC() *cdc.Feed {
+	return p.cdc
+}
+
 func (p *Processor) registerDefaultHandlers() {
 	p.Register("PING", PingCommand)
 	p.Register("ECHO", EchoCommand)
-	p.Register("SET", SetCommand)
+	p.RegisterWrite("SET", SetCommand)
+	p.RegisterRewrite("SET", rewriteSet(1))
 	p.Register("GET", GetCommand)
-	p.Register("DEL", DelCommand)
+	p.RegisterWrite("SETNX", SetNXCommand)
+	p.RegisterWrite("SETEX", SetEXCommand)
+	p.RegisterRewrite("SETEX", rewriteSet(2))
+	p.RegisterWrite("PSETEX", PSetEXCommand)
+	p.RegisterRewrite("PSETEX", rewriteSet(2))
+	p.RegisterWrite("GETSET", GetSetCommand)
+	p.RegisterRewrite("GETSET", rewriteSet(1))
+	p.RegisterWrite("GETDEL", GetDelCommand)
+	p.RegisterRewrite("GETDEL", rewriteAsDel)
+	p.RegisterWrite("GETEX", GetExCommand)
+	p.RegisterRewrite("GETEX", rewriteGetEx)
+	p.Register("MGET", MGetCommand)
+	p.RegisterWrite("MSET", MSetCommand)
+	p.RegisterWrite("MSETNX", MSetNXCommand)
+	p.RegisterWrite("DEL", DelCommand)
+	p.RegisterWrite("INCR", IncrCommand)
+	p.RegisterWrite("DECR", DecrCommand)
+	p.RegisterWrite("INCRBY", IncrByCommand)
+	p.RegisterWrite("DECRBY", DecrByCommand)
+	p.RegisterWrite("INCRBYFLOAT", IncrByFloatCommand)
+	p.RegisterRewrite("INCRBYFLOAT", rewriteIncrByFloat)
+	p.RegisterWrite("APPEND", AppendCommand)
+	p.Register("STRLEN", StrLenCommand)
+	p.Register("GETRANGE", GetRangeCommand)
+	p.Register("SUBSTR", GetRangeCommand)
+	p.RegisterWrite("SETRANGE", SetRangeCommand)
+	p.Register("LCS", LcsCommand)
+	p.RegisterWrite("SETBIT", SetBitCommand)
+	p.Register("GETBIT", GetBitCommand)
+	p.Register("BITCOUNT", BitCountCommand)
+	p.Register("BITPOS", BitPosCommand)
+	p.RegisterWrite("BITOP", BitOpCommand)
+	p.RegisterWrite("BITFIELD", BitFieldCommand)
+	p.Register("BITFIELD_RO", BitFieldROCommand)
+	p.RegisterWrite("PFADD", PFAddCommand)
+	p.Register("PFCOUNT", PFCountCommand)
+	p.RegisterWrite("PFMERGE", PFMergeCommand)
 	p.Register("EXISTS", ExistsCommand)
 	p.Register("TYPE", TypeCommand)
+	p.RegisterWrite("SORT", SortCommand)
+	p.Register("SORT_RO", SortROCommand)
+	p.Register("CONFIG", p.configCommand)
+	p.Register("CDC", p.cdcCommand)
 
-	p.Register("LPUSH", LPushCommand)
-	p.Register("RPUSH", RPushCommand)
-	p.Register("LPOP", LPopCommand)
-	p.Register("RPOP", RPopCommand)
+	p.RegisterWrite("LPUSH", LPushCommand)
+	p.RegisterWrite("RPUSH", RPushCommand)
+	p.RegisterWrite("LPOP", LPopCommand)
+	p.RegisterWrite("RPOP", RPopCommand)
 	p.Register("LLEN", LLenCommand)
+	p.RegisterWrite("LPUSHX", LPushXCommand)
+	p.RegisterWrite("RPUSHX", RPushXCommand)
+	p.Register("LRANGE", LRangeCommand)
+	p.Register("LINDEX", LIndexCommand)
+	p.RegisterWrite("LSET", LSetCommand)
+	p.RegisterWrite("LINSERT", LInsertCommand)
+	p.RegisterWrite("LREM", LRemCommand)
+	p.RegisterWrite("LTRIM", LTrimCommand)
+	p.Register("LPOS", LPosCommand)
+	p.RegisterWrite("LMOVE", LMoveCommand)
+	p.RegisterWrite("RPOPLPUSH", RPopLPushCommand)
+	p.RegisterWrite("LMPOP", LMPopCommand)
+	p.RegisterRewrite("LMPOP", rewriteMPop(0))
+	p.RegisterBlocking("BLPOP", BLPopCommand)
+	p.RegisterRewrite("BLPOP", rewriteBPop("LPOP"))
+	p.RegisterBlocking("BRPOP", BRPopCommand)
+	p.RegisterRewrite("BRPOP", rewriteBPop("RPOP"))
+	p.RegisterBlocking("BLMOVE", BLMoveCommand)
+	p.RegisterRewrite("BLMOVE", rewriteBLMove("LMOVE"))
+	p.RegisterBlocking("BRPOPLPUSH", BRPopLPushCommand)
+	p.RegisterRewrite("BRPOPLPUSH", rewriteBLMove("RPOPLPUSH"))
+	p.RegisterBlocking("BLMPOP", BLMPopCommand)
+	p.RegisterRewrite("BLMPOP", rewriteMPop(1))
 
-	p.Register("HSET", HSetCommand)
+	p.RegisterWrite("HSET", HSetCommand)
 	p.Register("HGET", HGetCommand)
-	p.Register("HDEL", HDelCommand)
+	p.RegisterWrite("HDEL", HDelCommand)
 	p.Register("HLEN", HLenCommand)
+	p.Register("HGETALL", HGetAllCommand)
+	p.RegisterWrite("HMSET", HMSetCommand)
+	p.Register("HMGET", HMGetCommand)
+	p.RegisterWrite("HSETNX", HSetNXCommand)
+	p.Register("HEXISTS", HExistsCommand)
+	p.Register("HSTRLEN", HStrLenCommand)
+	p.Register("HKEYS", HKeysCommand)
+	p.Register("HVALS", HValsCommand)
+	p.RegisterWrite("HINCRBY", HIncrByCommand)
+	p.RegisterWrite("HINCRBYFLOAT", HIncrByFloatCommand)
+	p.RegisterRewrite("HINCRBYFLOAT", rewriteHIncrByFloat)
+	p.Register("HRANDFIELD", HRandFieldCommand)
+	p.Register("HSCAN", HScanCommand)
+	p.Register("SSCAN", SScanCommand)
+	p.Register("ZSCAN", ZScanCommand)
+	p.RegisterWrite("HEXPIRE", HExpireCommand)
+	p.RegisterRewrite("HEXPIRE", rewriteHExpire)
+	p.RegisterWrite("HPEXPIRE", HPExpireCommand)
+	p.RegisterRewrite("HPEXPIRE", rewriteHExpire)
+	p.RegisterWrite("HEXPIREAT", HExpireAtCommand)
+	p.RegisterRewrite("HEXPIREAT", rewriteHExpire)
+	p.RegisterWrite("HPEXPIREAT", HPExpireAtCommand)
+	p.RegisterRewrite("HPEXPIREAT", rewriteHExpire)
+	p.Register("HTTL", HTTLCommand)
+	p.Register("HPTTL", HPTTLCommand)
+	p.Register("HEXPIRETIME", HExpireTimeCommand)
+	p.Register("HPEXPIRETIME", HPExpireTimeCommand)
+	p.RegisterWrite("HPERSIST", HPersistCommand)
+	p.RegisterWrite("HGETEX", HGetExCommand)
+	p.RegisterRewrite("HGETEX", rewriteHGetEx)
+	p.RegisterWrite("HSETEX", HSetExCommand)
+	p.RegisterRewrite("HSETEX", rewriteHSetEx)
 
-	p.Register("SADD", SAddCommand)
-	p.Register("SREM", SRemCommand)
+	p.RegisterWrite("SADD", SAddCommand)
+	p.RegisterWrite("SREM", SRemCommand)
 	p.Register("SISMEMBER", SIsMemberCommand)
 	p.Register("SCARD", SCardCommand)
+	p.Register("SMEMBERS", SMembersCommand)
+	p.Register("SMISMEMBER", SMIsMemberCommand)
+	p.Register("SRANDMEMBER", SRandMemberCommand)
+	p.RegisterWrite("SPOP", SPopCommand)
+	p.RegisterRewrite("SPOP", rewriteSPop)
+	p.RegisterWrite("SMOVE", SMoveCommand)
+	p.Register("SINTER", SInterCommand)
+	p.Register("SUNION", SUnionCommand)
+	p.Register("SDIFF", SDiffCommand)
+	p.RegisterWrite("SINTERSTORE", SInterStoreCommand)
+	p.RegisterWrite("SUNIONSTORE", SUnionStoreCommand)
+	p.RegisterWrite("SDIFFSTORE", SDiffStoreCommand)
+	p.Register("SINTERCARD", SInterCardCommand)
 
-	p.Register("ZADD", ZAddCommand)
+	p.RegisterWrite("ZADD", ZAddCommand)
 	p.Register("ZSCORE", ZScoreCommand)
-	p.Register("ZREM", ZRemCommand)
+	p.RegisterWrite("ZREM", ZRemCommand)
 	p.Register("ZCARD", ZCardCommand)
+	p.Register("ZRANGEBYSCORE", ZRangeByScoreCommand)
+	p.Register("ZREVRANGEBYSCORE", ZRevRangeByScoreCommand)
+	p.Register("ZRANGE", ZRangeCommand)
+	p.RegisterWrite("ZINCRBY", ZIncrByCommand)
+	p.Register("ZUNION", ZUnionCommand)
+	p.Register("ZINTER", ZInterCommand)
+	p.Register("ZDIFF", ZDiffCommand)
+	p.RegisterWrite("ZUNIONSTORE", ZUnionStoreCommand)
+	p.RegisterWrite("ZINTERSTORE", ZInterStoreCommand)
+	p.RegisterWrite("ZDIFFSTORE", ZDiffStoreCommand)
+	p.Register("ZINTERCARD", ZInterCardCommand)
+	p.RegisterWrite("ZPOPMIN", ZPopMinCommand)
+	p.RegisterWrite("ZPOPMAX", ZPopMaxCommand)
+	p.RegisterWrite("ZMPOP", ZMPopCommand)
+	p.RegisterRewrite("ZMPOP", rewriteZMPop(0))
+	p.RegisterBlocking("BZPOPMIN", BZPopMinCommand)
+	p.RegisterRewrite("BZPOPMIN", rewriteBPop("ZPOPMIN"))
+	p.RegisterBlocking("BZPOPMAX", BZPopMaxCommand)
+	p.RegisterRewrite("BZPOPMAX", rewriteBPop("ZPOPMAX"))
+	p.RegisterBlocking("BZMPOP", BZMPopCommand)
+	p.RegisterRewrite("BZMPOP", rewriteZMPop(1))
+	p.RegisterWrite("ZREMRANGEBYRANK", ZRemRangeByRankCommand)
+	p.RegisterWrite("ZREMRANGEBYSCORE", ZRemRangeByScoreCommand)
+	p.RegisterWrite("ZREMRANGEBYLEX", ZRemRangeByLexCommand)
+	p.RegisterWrite("ZRANGESTORE", ZRangeStoreCommand)
+	p.Register("ZREVRANGE", ZRevRangeCommand)
+	p.Register("ZRANGEBYLEX", ZRangeByLexCommand)
+	p.Register("ZREVRANGEBYLEX", ZRevRangeByLexCommand)
+	p.Register("ZRANK", ZRankCommand)
+	p.Register("ZREVRANK", ZRevRankCommand)
+	p.Register("ZCOUNT", ZCountCommand)
+	p.Register("ZLEXCOUNT", ZLexCountCommand)
+	p.Register("ZMSCORE", ZMScoreCommand)
+	p.Register("ZRANDMEMBER", ZRandMemberCommand)
+
+	p.RegisterWrite("XADD", XAddCommand)
+	p.RegisterRewrite("XADD", rewriteXAdd)
+	p.Register("XRANGE", XRangeCommand)
+	p.Register("XREVRANGE", XRevRangeCommand)
+	p.Register("XLEN", XLenCommand)
+	p.RegisterWrite("XDEL", XDelCommand)
+	p.RegisterWrite("XTRIM", XTrimCommand)
+	p.RegisterBlocking("XREAD", XReadCommand)
+	p.RegisterWrite("XGROUP", XGroupCommand)
+	p.RegisterRewrite("XGROUP", rewriteXGroup)
+	p.RegisterBlocking("XREADGROUP", XReadGroupCommand)
+	p.RegisterExpand("XREADGROUP", expandXReadGroup)
+	p.RegisterWrite("XACK", XAckCommand)
+	p.Register("XPENDING", XPendingCommand)
+	p.RegisterWrite("XCLAIM", XClaimCommand)
+	p.RegisterExpand("XCLAIM", expandXClaim)
+	p.RegisterWrite("XAUTOCLAIM", XAutoClaimCommand)
+	p.RegisterExpand("XAUTOCLAIM", expandXAutoClaim)
+	p.Register("XINFO", XInfoCommand)
+
+	p.RegisterWrite("GEOADD", GeoAddCommand)
+	p.Register("GEOPOS", GeoPosCommand)
+	p.Register("GEODIST", GeoDistCommand)
+	p.Register("GEOHASH", GeoHashCommand)
+	p.Register("GEOSEARCH", GeoSearchCommand)
+	p.RegisterWrite("GEOSEARCHSTORE", GeoSearchStoreCommand)
+
+	p.RegisterWrite("JSON.SET", JSONSetCommand)
+	p.Register("JSON.GET", JSONGetCommand)
+	p.Register("JSON.MGET", JSONMGetCommand)
+	p.RegisterWrite("JSON.DEL", JSONDelCommand)
+	p.RegisterWrite("JSON.FORGET", JSONDelCommand)
+	p.Register("JSON.TYPE", JSONTypeCommand)
+	p.RegisterWrite("JSON.NUMINCRBY", JSONNumIncrByCommand)
+	p.RegisterWrite("JSON.STRAPPEND", JSONStrAppendCommand)
+	p.RegisterWrite("JSON.ARRAPPEND", JSONArrAppendCommand)
+	p.RegisterWrite("JSON.ARRINSERT", JSONArrInsertCommand)
+	p.RegisterWrite("JSON.ARRPOP", JSONArrPopCommand)
+	p.Register("JSON.ARRLEN", JSONArrLenCommand)
+	p.Register("JSON.OBJKEYS", JSONObjKeysCommand)
 }
 
 func (p *Processor) Register(cmd string, handler HandlerFunc) {
@@ -64,29 +304,255 @@ func (p *Processor) Register(cmd string, handler HandlerFunc) {
 	p.handlers[strings.ToUpper(cmd)] = handler
 }
 
+// RegisterWrite registers a command that may modify the database. Writes run
+// exclusively and are propagated to the CDC feed when they change anything.
+func (p *Processor) RegisterWrite(cmd string, handler HandlerFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.handlers[strings.ToUpper(cmd)] = handler
+	p.writes[strings.ToUpper(cmd)] = true
+}
+
+func (p *Processor) RegisterRewrite(cmd string, rewrite RewriteFunc) {
+	p.RegisterExpand(cmd, func(db *database.Database, args []resp.Value, reply resp.Value) []Propagation {
+		name, rewritten := rewrite(db, args, reply)
+		return []Propagation{{Name: name, Args: rewritten}}
+	})
+}
+
+func (p *Processor) RegisterExpand(cmd string, expand ExpandFunc) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.rewrites[strings.ToUpper(cmd)] = expand
+}
+
+// OnPropagate registers fn to receive every write command, in the order the
+// writes were applied, after any rewrite. It is how the AOF is fed.
+func (p *Processor) OnPropagate(fn func(cmd resp.Value)) {
+	p.exec.Lock()
+	defer p.exec.Unlock()
+	p.propagators = append(p.propagators, fn)
+}
+
 
 func (p *Processor) Process(cmdValue resp.Value) resp.Value {
+	return p.ProcessFor(nil, cmdValue)
+}
+
+// Replay applies a command read back from persistence, such as an AOF
+// entry. The write already reached the CDC feed and the propagators when it
+// was first applied, so it is not passed to them again. Call it before the
+// processor serves clients.
+func (p *Processor) Replay(cmdValue resp.Value) resp.Value {
+	p.replaying.Store(true)
+	defer p.replaying.Store(false)
+	return p.ProcessFor(nil, cmdValue)
+}
+
+// ProcessFor runs a command on behalf of a connection's session, which
+// blocking commands, CLIENT and transactions need. s may be nil.
+func (p *Processor) ProcessFor(s *Session, cmdValue resp.Value) resp.Value {
+	commandName, args, errReply := p.parse(cmdValue)
+	if errReply != nil {
+		// As in Redis, a command rejected while queueing fails the whole
+		// transaction.
+		if s != nil && s.multi {
+			s.multiFailed = true
+		}
+		return *errReply
+	}
+	if s != nil && s.multi && !transactionCommands[commandName] {
+		s.queued = append(s.queued, cmdValue)
+		return resp.NewSimpleString("QUEUED")
+	}
+
+	log.Printf("Executing command: %s, args: %v", commandName, args)
+	if transactionCommands[commandName] {
+		return p.transactionCommand(s, commandName, args)
+	}
+
+	p.mu.RLock()
+	handler := p.handlers[commandName]
+	write := p.writes[commandName]
+	rewrite := p.rewrites[commandName]
+	blocking, isBlocking := p.blocking[commandName]
+	p.mu.RUnlock()
+
+	switch {
+	case commandName == "CLIENT":
+		p.exec.RLock()
+		defer p.exec.RUnlock()
+		return p.clientCommand(s, args)
+	case isBlocking:
+		return p.processBlocking(s, commandName, args, blocking, rewrite)
+	case !write:
+		p.exec.RLock()
+		defer p.exec.RUnlock()
+		return handler(p.db, args)
+	}
+
+	p.exec.Lock()
+	defer p.exec.Unlock()
+	reply := p.apply(commandName, args, rewrite, func() resp.Value {
+		return handler(p.db, args)
+	})
+	p.db.ServeReady()
+	return reply
+}
+
+// parse checks that cmdValue is a known command with bulk string arguments
+// and returns its upper-cased name and arguments, or the error to reply
+// with.
+func (p *Processor) parse(cmdValue resp.Value) (string, []resp.Value, *resp.Value) {
+	fail := func(msg string) (string, []resp.Value, *resp.Value) {
+		reply := resp.NewError(msg)
+		return "", nil, &reply
+	}
 	if cmdValue.Type != resp.ArrayType || len(cmdValue.Array) == 0 {
-		return resp.NewError("ERR invalid command format")
+		return fail("ERR invalid command format")
 	}
 
 	commandName := strings.ToUpper(string(cmdValue.Array[0].Bulk))
 	args := cmdValue.Array[1:]
 
 	p.mu.RLock()
-	handler, ok := p.handlers[commandName]
+	_, ok := p.handlers[commandName]
+	_, isBlocking := p.blocking[commandName]
 	p.mu.RUnlock()
 
-	if !ok {
-		return resp.NewError(fmt.Sprintf("ERR unknown command '%s'", commandName))
+	if !ok && !isBlocking && commandName != "CLIENT" && !transactionCommands[commandName] {
+		return fail(fmt.Sprintf("ERR unknown command '%s'", commandName))
 	}
 
 	for _, arg := range args {
 		if arg.Type != resp.BulkStringType {
-			return resp.NewError("ERR arguments must be bulk strings")
+			return fail("ERR arguments must be bulk strings")
 		}
 	}
+	return commandName, args, nil
+}
 
-	log.Printf("Executing command: %s, args: %v", commandName, args)
-	return handler(p.db, args)
+// apply runs a write and propagates it if it changed anything. The caller
+// must hold exec.
+func (p *Processor) apply(commandName string, args []resp.Value, rewrite ExpandFunc, run func() resp.Value) resp.Value {
+	defer p.db.SuppressKeyMiss()()
+	dirty := p.dirty.Load()
+	reply := run()
+	if p.dirty.Load() != dirty {
+		if rewrite != nil && reply.Type != resp.ErrorType {
+			for _, cmd := range rewrite(p.db, args, reply) {
+				p.propagate(cmd.Name, cmd.Args)
+			}
+		} else {
+			p.propagate(commandName, args)
+		}
+	}
+	return reply
+}
+
+func (p *Processor) keyspaceEvent(class int, event, key string) {
+	// A miss is a read and changes nothing.
+	if class == database.NotifyKeyMiss {
+		return
+	}
+	p.dirty.Add(1)
+	if event == "expired" || event == "evicted" {
+		p.propagate("DEL", []resp.Value{resp.NewBulkString([]byte(key))})
+	}
+}
+
+// fieldsExpired propagates expired hash fields as an HDEL, as keyspaceEvent
+// does with a DEL for expired keys.
+func (p *Processor) fieldsExpired(key string, fields []string) {
+	args := []resp.Value{resp.NewBulkString([]byte(key))}
+	for _, field := range fields {
+		args = append(args, resp.NewBulkString([]byte(field)))
+	}
+	p.propagate("HDEL", args)
+}
+
+// Evict removes key on behalf of an eviction policy. It is serialized with
+// commands like a write, and propagated as a DEL.
+func (p *Processor) Evict(key string) bool {
+	p.exec.Lock()
+	defer p.exec.Unlock()
+	return p.db.Evict(key)
+}
+
+// ActiveExpireInterval is how often expired keys and hash fields that are
+// never read again are reclaimed, ten times a second as in Redis.
+const ActiveExpireInterval = 100 * time.Millisecond
+
+// StartActiveExpire runs the database's active expiration cycle every
+// interval, serialized with writes, until stop is called. A processor runs
+// one cycle however many callers start it, such as a Store that is also
+// served over TCP; it stops when every caller has stopped it, and later
+// callers share the interval of the first.
+func (p *Processor) StartActiveExpire(interval time.Duration) (stop func()) {
+	p.expireMu.Lock()
+	defer p.expireMu.Unlock()
+	if p.expireUsers == 0 {
+		p.expireDone = make(chan struct{})
+		go p.activeExpire(interval, p.expireDone)
+	}
+	p.expireUsers++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			p.expireMu.Lock()
+			defer p.expireMu.Unlock()
+			p.expireUsers--
+			if p.expireUsers == 0 {
+				close(p.expireDone)
+			}
+		})
+	}
+}
+
+func (p *Processor) activeExpire(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			p.exec.Lock()
+			p.db.ActiveExpire()
+			p.db.ServeReady()
+			p.exec.Unlock()
+		case <-done:
+			return
+		}
+	}
+}
+
+// keyArgIndex lists the write commands whose first key is not their first
+// argument, for labelling CDC events.
+var keyArgIndex = map[string]int{
+	"BITOP":  1,
+	"XGROUP": 1,
+}
+
+func (p *Processor) propagate(commandName string, args []resp.Value) {
+	if p.replaying.Load() {
+		return
+	}
+	strArgs := make([]string, len(args))
+	for i, arg := range args {
+		strArgs[i] = string(arg.Bulk)
+	}
+	key := ""
+	if i := keyArgIndex[commandName]; i < len(strArgs) {
+		key = strArgs[i]
+	}
+	p.cdc.Append(p.db.Index(), key, commandName, strArgs)
+
+	if len(p.propagators) > 0 {
+		cmd := make([]resp.Value, 0, len(args)+1)
+		cmd = append(cmd, resp.NewBulkString([]byte(commandName)))
+		cmd = append(cmd, args...)
+		for _, fn := range p.propagators {
+			fn(resp.NewArray(cmd))
+		}
+	}
 }
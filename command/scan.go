@@ -0,0 +1,155 @@
+package command
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+	"github.com/HORUSCRIME/goredis/utils"
+)
+
+// scanDefaultCount is the number of elements a SCAN call visits when COUNT
+// is not given, as in Redis.
+const scanDefaultCount = 10
+
+// scanOptions are the arguments shared by HSCAN, SSCAN and ZSCAN.
+type scanOptions struct {
+	cursor   uint64
+	pattern  string
+	count    int
+	noValues bool
+}
+
+// parseScan parses "cursor [MATCH pattern] [COUNT count]", plus NOVALUES
+// when allowNoValues is set.
+func parseScan(args []resp.Value, allowNoValues bool) (scanOptions, *resp.Value) {
+	opts := scanOptions{count: scanDefaultCount}
+	cursor, err := strconv.ParseUint(string(args[0].Bulk), 10, 64)
+	if err != nil {
+		reply := resp.NewError("ERR invalid cursor")
+		return opts, &reply
+	}
+	opts.cursor = cursor
+
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch {
+		case option == "MATCH" && i+1 < len(args):
+			i++
+			opts.pattern = string(args[i].Bulk)
+		case option == "COUNT" && i+1 < len(args):
+			i++
+			count, err := strconv.Atoi(string(args[i].Bulk))
+			if err != nil {
+				reply := resp.NewError("ERR value is not an integer or out of range")
+				return opts, &reply
+			}
+			if count < 1 {
+				reply := resp.NewError("ERR syntax error")
+				return opts, &reply
+			}
+			opts.count = count
+		case option == "NOVALUES" && allowNoValues:
+			opts.noValues = true
+		default:
+			reply := resp.NewError("ERR syntax error")
+			return opts, &reply
+		}
+	}
+	return opts, nil
+}
+
+// match reports whether element passes the MATCH filter.
+func (o scanOptions) match(element string) bool {
+	return o.pattern == "" || o.pattern == "*" || utils.MatchPattern(o.pattern, element)
+}
+
+// scanReply builds the two-element reply of the SCAN family.
+func scanReply(cursor uint64, elements []string) resp.Value {
+	return resp.NewArray([]resp.Value{
+		resp.NewBulkString([]byte(strconv.FormatUint(cursor, 10))),
+		bulkStrings(elements),
+	})
+}
+
+func HScanCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'hscan' command")
+	}
+	opts, errReply := parseScan(args[1:], true)
+	if errReply != nil {
+		return *errReply
+	}
+	hash, ok := lookupHash(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if hash == nil {
+		return scanReply(0, nil)
+	}
+
+	elements := make([]string, 0)
+	cursor := hash.HScan(opts.cursor, opts.count, func(field, value string) {
+		if !opts.match(field) {
+			return
+		}
+		elements = append(elements, field)
+		if !opts.noValues {
+			elements = append(elements, value)
+		}
+	})
+	return scanReply(cursor, elements)
+}
+
+func SScanCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'sscan' command")
+	}
+	opts, errReply := parseScan(args[1:], false)
+	if errReply != nil {
+		return *errReply
+	}
+	val, exists := db.Get(string(args[0].Bulk))
+	if !exists {
+		return scanReply(0, nil)
+	}
+	set, isSet := val.(*database.Set)
+	if !isSet {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	elements := make([]string, 0)
+	cursor := set.SScan(opts.cursor, opts.count, func(member string) {
+		if opts.match(member) {
+			elements = append(elements, member)
+		}
+	})
+	return scanReply(cursor, elements)
+}
+
+func ZScanCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'zscan' command")
+	}
+	opts, errReply := parseScan(args[1:], false)
+	if errReply != nil {
+		return *errReply
+	}
+	val, exists := db.Get(string(args[0].Bulk))
+	if !exists {
+		return scanReply(0, nil)
+	}
+	zset, isZSet := val.(*database.ZSet)
+	if !isZSet {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	elements := make([]string, 0)
+	cursor := zset.ZScan(opts.cursor, opts.count, func(member string, score float64) {
+		if opts.match(member) {
+			elements = append(elements, member, formatFloat(score))
+		}
+	})
+	return scanReply(cursor, elements)
+}
@@ -0,0 +1,116 @@
+package command
+
+import (
+	"slices"
+	"strconv"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// scanAll runs a SCAN family command to completion, COUNT elements at a
+// time, and returns the sorted elements it returned.
+func scanAll(t *testing.T, p *Processor, args ...string) []string {
+	t.Helper()
+	var all []string
+	cursor := "0"
+	for calls := 0; ; calls++ {
+		if calls > 1000 {
+			t.Fatalf("%q did not finish", args)
+		}
+		reply := run(p, slices.Concat(args[:2], []string{cursor}, args[2:])...)
+		if reply.Type != resp.ArrayType || len(reply.Array) != 2 {
+			t.Fatalf("%q replied %q", args, flatten(reply))
+		}
+		cursor = string(reply.Array[0].Bulk)
+		all = append(all, flatten(reply.Array[1])...)
+		if cursor == "0" {
+			return all
+		}
+	}
+}
+
+func TestScanFamily(t *testing.T) {
+	p := newTestProcessor()
+	var fields, members []string
+	for i := range 25 {
+		n := strconv.Itoa(i)
+		run(p, "HSET", "h", "f"+n, n)
+		run(p, "SADD", "s", "m"+n)
+		run(p, "ZADD", "z", n, "m"+n)
+		fields = append(fields, "f"+n)
+		members = append(members, "m"+n)
+	}
+	slices.Sort(fields)
+	slices.Sort(members)
+
+	got := scanAll(t, p, "HSCAN", "h", "COUNT", "3", "NOVALUES")
+	slices.Sort(got)
+	expectStrings(t, got, fields...)
+	got = scanAll(t, p, "SSCAN", "s", "COUNT", "4")
+	slices.Sort(got)
+	expectStrings(t, got, members...)
+
+	pairs := scanAll(t, p, "ZSCAN", "z", "COUNT", "7")
+	if len(pairs) != 50 {
+		t.Fatalf("ZSCAN returned %d elements, want 50", len(pairs))
+	}
+	for i := 0; i < len(pairs); i += 2 {
+		if pairs[i] != "m"+pairs[i+1] {
+			t.Fatalf("ZSCAN paired %s with score %s", pairs[i], pairs[i+1])
+		}
+	}
+	pairs = scanAll(t, p, "HSCAN", "h", "MATCH", "f1*")
+	expectStrings(t, sortedPairs(pairs), "f10=10", "f11=11", "f12=12", "f13=13", "f14=14", "f15=15", "f16=16", "f17=17", "f18=18", "f19=19", "f1=1")
+}
+
+// sortedPairs joins the field-value pairs of an HSCAN reply and sorts them.
+func sortedPairs(elements []string) []string {
+	var pairs []string
+	for i := 0; i+1 < len(elements); i += 2 {
+		pairs = append(pairs, elements[i]+"="+elements[i+1])
+	}
+	slices.Sort(pairs)
+	return pairs
+}
+
+func TestScanDeletingDuringIteration(t *testing.T) {
+	p := newTestProcessor()
+	for i := range 30 {
+		run(p, "SADD", "s", strconv.Itoa(i))
+	}
+	seen := make(map[string]bool)
+	cursor := "0"
+	for {
+		reply := run(p, "SSCAN", "s", cursor, "COUNT", "5")
+		cursor = string(reply.Array[0].Bulk)
+		for _, m := range flatten(reply.Array[1]) {
+			seen[m] = true
+			// Removing odd members moves others into visited slots; the
+			// even ones must still all be returned.
+			if n, _ := strconv.Atoi(m); n%2 == 1 {
+				run(p, "SREM", "s", m)
+			}
+		}
+		if cursor == "0" {
+			break
+		}
+	}
+	for i := 0; i < 30; i += 2 {
+		if !seen[strconv.Itoa(i)] {
+			t.Fatalf("SSCAN missed %d", i)
+		}
+	}
+}
+
+func TestScanErrors(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "SSCAN", "missing", "0"), "0")
+	run(p, "SADD", "s", "a")
+	run(p, "SET", "str", "v")
+	expectError(t, run(p, "SSCAN", "str", "0"), "SSCAN of a string")
+	expectError(t, run(p, "SSCAN", "s", "-1"), "SSCAN with a negative cursor")
+	expectError(t, run(p, "SSCAN", "s", "0", "COUNT", "0"), "SSCAN COUNT 0")
+	expectError(t, run(p, "SSCAN", "s", "0", "NOVALUES"), "SSCAN NOVALUES")
+	expectError(t, run(p, "HSCAN", "s", "0", "MATCH"), "HSCAN MATCH without a pattern")
+}
@@ -0,0 +1,315 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// lookupSet returns the set stored at key, or nil when the key does not
+// exist. ok is false when the key holds another type.
+func lookupSet(db *database.Database, key string) (set *database.Set, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	set, ok = val.(*database.Set)
+	return set, ok
+}
+
+// deleteIfEmptySet removes key once its set has no members left.
+func deleteIfEmptySet(db *database.Database, key string, set *database.Set) {
+	if set.SCard() == 0 && db.Delete(key) {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+func SMembersCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'smembers' command")
+	}
+	set, ok := lookupSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if set == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return bulkStrings(set.SMembers())
+}
+
+func SMIsMemberCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'smismember' command")
+	}
+	set, ok := lookupSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(args)-1)
+	for i, arg := range args[1:] {
+		if set != nil && set.SIsMember(string(arg.Bulk)) {
+			result[i] = resp.NewInteger(1)
+		} else {
+			result[i] = resp.NewInteger(0)
+		}
+	}
+	return resp.NewArray(result)
+}
+
+func SRandMemberCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 2 {
+		return resp.NewError("ERR wrong number of arguments for 'srandmember' command")
+	}
+	var count int64
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		if n == math.MinInt64 {
+			return resp.NewError("ERR value is out of range")
+		}
+		count = n
+	}
+
+	set, ok := lookupSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if len(args) == 1 {
+		if set == nil {
+			return resp.NewNullBulkString()
+		}
+		member, _ := set.SRandMember()
+		return resp.NewBulkString([]byte(member))
+	}
+	if set == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return bulkStrings(randomSample(set.SMembers(), count))
+}
+
+func SPopCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 2 {
+		return resp.NewError("ERR wrong number of arguments for 'spop' command")
+	}
+	key := string(args[0].Bulk)
+	var count int64
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil || n < 0 {
+			return resp.NewError("ERR value is out of range, must be positive")
+		}
+		count = n
+	}
+
+	set, ok := lookupSet(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if set == nil {
+		if len(args) == 1 {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewArray([]resp.Value{})
+	}
+
+	var popped []string
+	if len(args) == 1 {
+		member, _ := set.SRandMember()
+		popped = []string{member}
+	} else {
+		popped = randomSample(set.SMembers(), count)
+	}
+	if len(popped) > 0 {
+		set.SRem(popped...)
+		db.Notify(database.NotifySet, "spop", key)
+		deleteIfEmptySet(db, key, set)
+	}
+	if len(args) == 1 {
+		return resp.NewBulkString([]byte(popped[0]))
+	}
+	return bulkStrings(popped)
+}
+
+// rewriteSPop propagates SPOP as SREM of the members it popped, since the
+// choice is random.
+func rewriteSPop(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	if reply.Type == resp.BulkStringType {
+		return "SREM", []resp.Value{args[0], reply}
+	}
+	return "SREM", append([]resp.Value{args[0]}, reply.Array...)
+}
+
+func SMoveCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'smove' command")
+	}
+	srcKey, dstKey, member := string(args[0].Bulk), string(args[1].Bulk), string(args[2].Bulk)
+
+	src, ok := lookupSet(db, srcKey)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	dst, ok := lookupSet(db, dstKey)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if src == nil {
+		return resp.NewInteger(0)
+	}
+	if src == dst {
+		if src.SIsMember(member) {
+			return resp.NewInteger(1)
+		}
+		return resp.NewInteger(0)
+	}
+
+	if dst == nil {
+		if !src.SIsMember(member) {
+			return resp.NewInteger(0)
+		}
+		dst = database.NewSet()
+		db.Set(dstKey, dst, 0)
+	}
+	if !database.SMove(src, dst, member) {
+		return resp.NewInteger(0)
+	}
+	db.Notify(database.NotifySet, "srem", srcKey)
+	db.Notify(database.NotifySet, "sadd", dstKey)
+	deleteIfEmptySet(db, srcKey, src)
+	return resp.NewInteger(1)
+}
+
+// setAlgebra computes SINTER, SUNION or SDIFF of the sets at keys. Missing
+// keys count as empty sets. ok is false when a key holds another type.
+func setAlgebra(db *database.Database, op string, keys []resp.Value) (members []string, ok bool) {
+	sets := make([]*database.Set, 0, len(keys))
+	for i, arg := range keys {
+		set, ok := lookupSet(db, string(arg.Bulk))
+		if !ok {
+			return nil, false
+		}
+		if set == nil {
+			if op == "sinter" {
+				return []string{}, true
+			}
+			if op == "sdiff" && i == 0 {
+				sets = append(sets, database.NewSet())
+			}
+			continue
+		}
+		sets = append(sets, set)
+	}
+
+	switch op {
+	case "sinter":
+		return database.SInter(sets...), true
+	case "sunion":
+		return database.SUnion(sets...), true
+	}
+	return database.SDiff(sets[0], sets[1:]...), true
+}
+
+func SInterCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraCommand(db, args, "sinter")
+}
+
+func SUnionCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraCommand(db, args, "sunion")
+}
+
+func SDiffCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraCommand(db, args, "sdiff")
+}
+
+func setAlgebraCommand(db *database.Database, args []resp.Value, op string) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", op))
+	}
+	members, ok := setAlgebra(db, op, args)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	return bulkStrings(members)
+}
+
+func SInterStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraStore(db, args, "sinter")
+}
+
+func SUnionStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraStore(db, args, "sunion")
+}
+
+func SDiffStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setAlgebraStore(db, args, "sdiff")
+}
+
+// setAlgebraStore implements the STORE variants, which replace destination
+// with the result, or delete it when the result is empty.
+func setAlgebraStore(db *database.Database, args []resp.Value, op string) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%sstore' command", op))
+	}
+	dstKey := string(args[0].Bulk)
+	members, ok := setAlgebra(db, op, args[1:])
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	if len(members) == 0 {
+		if db.Delete(dstKey) {
+			db.Notify(database.NotifyGeneric, "del", dstKey)
+		}
+		return resp.NewInteger(0)
+	}
+	dst := database.NewSet()
+	dst.SAdd(members...)
+	db.Set(dstKey, dst, 0)
+	db.Notify(database.NotifySet, op+"store", dstKey)
+	return resp.NewInteger(int64(len(members)))
+}
+
+func SInterCardCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'sintercard' command")
+	}
+	numKeys, err := strconv.Atoi(string(args[0].Bulk))
+	if err != nil || numKeys <= 0 {
+		return resp.NewError("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return resp.NewError("ERR Number of keys can't be greater than number of args")
+	}
+	keys := args[1 : 1+numKeys]
+	limit := 0
+	for rest := args[1+numKeys:]; len(rest) > 0; rest = rest[2:] {
+		if len(rest) < 2 || strings.ToUpper(string(rest[0].Bulk)) != "LIMIT" {
+			return resp.NewError("ERR syntax error")
+		}
+		n, err := strconv.Atoi(string(rest[1].Bulk))
+		if err != nil || n < 0 {
+			return resp.NewError("ERR LIMIT can't be negative")
+		}
+		limit = n
+	}
+
+	sets := make([]*database.Set, 0, len(keys))
+	for _, arg := range keys {
+		set, ok := lookupSet(db, string(arg.Bulk))
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		if set == nil {
+			return resp.NewInteger(0)
+		}
+		sets = append(sets, set)
+	}
+	return resp.NewInteger(int64(database.SInterCard(limit, sets...)))
+}
@@ -0,0 +1,90 @@
+package command
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSetAlgebra(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SADD", "a", "1", "2", "3", "4")
+	run(p, "SADD", "b", "3", "4", "5")
+	run(p, "SADD", "c", "4", "6")
+	expectStrings(t, sortedReply(run(p, "SINTER", "a", "b", "c")), "4")
+	expectStrings(t, sortedReply(run(p, "SUNION", "a", "b", "c")), "1", "2", "3", "4", "5", "6")
+	expectStrings(t, sortedReply(run(p, "SDIFF", "a", "b", "c")), "1", "2")
+	expectStrings(t, sortedReply(run(p, "SDIFF", "a", "missing")), "1", "2", "3", "4")
+	expectReply(t, run(p, "SDIFF", "missing", "a"))
+	expectReply(t, run(p, "SINTER", "a", "missing"))
+
+	expectReply(t, run(p, "SINTERSTORE", "dst", "a", "b"), "2")
+	expectStrings(t, sortedReply(run(p, "SMEMBERS", "dst")), "3", "4")
+	// The destination may be one of the sources.
+	expectReply(t, run(p, "SUNIONSTORE", "dst", "dst", "c"), "3")
+	expectStrings(t, sortedReply(run(p, "SMEMBERS", "dst")), "3", "4", "6")
+	expectReply(t, run(p, "SDIFFSTORE", "dst", "c", "a", "b"), "1")
+	expectReply(t, run(p, "SINTERSTORE", "dst", "a", "missing"), "0")
+	expectReply(t, run(p, "EXISTS", "dst"), "0")
+
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "SUNION", "a", "s"), "SUNION with a string")
+	expectError(t, run(p, "SUNIONSTORE", "dst", "a", "s"), "SUNIONSTORE with a string")
+}
+
+func TestSInterCard(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SADD", "a", "1", "2", "3", "4")
+	run(p, "SADD", "b", "2", "3", "4", "5")
+	expectReply(t, run(p, "SINTERCARD", "2", "a", "b"), "3")
+	expectReply(t, run(p, "SINTERCARD", "2", "a", "b", "LIMIT", "2"), "2")
+	expectReply(t, run(p, "SINTERCARD", "2", "a", "b", "LIMIT", "0"), "3")
+	expectReply(t, run(p, "SINTERCARD", "2", "a", "missing"), "0")
+	expectError(t, run(p, "SINTERCARD", "0", "a"), "SINTERCARD 0")
+	expectError(t, run(p, "SINTERCARD", "3", "a", "b"), "SINTERCARD with too few keys")
+	expectError(t, run(p, "SINTERCARD", "2", "a", "b", "LIMIT", "-1"), "SINTERCARD LIMIT -1")
+}
+
+func TestSMove(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SADD", "src", "a", "b")
+	expectReply(t, run(p, "SMOVE", "src", "dst", "a"), "1")
+	expectReply(t, run(p, "SMOVE", "src", "dst", "x"), "0")
+	expectReply(t, run(p, "SMOVE", "src", "src", "b"), "1")
+	expectReply(t, run(p, "SMOVE", "missing", "dst", "b"), "0")
+	expectReply(t, run(p, "SMOVE", "src", "dst", "b"), "1")
+	expectReply(t, run(p, "EXISTS", "src"), "0")
+	expectStrings(t, sortedReply(run(p, "SMEMBERS", "dst")), "a", "b")
+	expectReply(t, run(p, "SMISMEMBER", "dst", "a", "c", "b"), "1", "0", "1")
+
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "SMOVE", "dst", "s", "a"), "SMOVE to a string")
+	expectReply(t, run(p, "SCARD", "dst"), "2")
+}
+
+func TestSPopAndSRandMember(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SADD", "s", "a", "b", "c", "d", "e")
+	expectStrings(t, sortedReply(run(p, "SRANDMEMBER", "s", "10")), "a", "b", "c", "d", "e")
+	if got := flatten(run(p, "SRANDMEMBER", "s", "-8")); len(got) != 8 {
+		t.Fatalf("SRANDMEMBER s -8 returned %d members, want 8", len(got))
+	}
+	expectReply(t, run(p, "SRANDMEMBER", "missing"), "<nil>")
+	expectReply(t, run(p, "SRANDMEMBER", "missing", "2"))
+
+	propagated := recordPropagation(p)
+	popped := flatten(run(p, "SPOP", "s", "3"))
+	popped = append(popped, flatten(run(p, "SPOP", "s"))...)
+	if len(popped) != 4 {
+		t.Fatalf("SPOP popped %q", popped)
+	}
+	want := []string{"SREM s " + popped[0] + " " + popped[1] + " " + popped[2], "SREM s " + popped[3]}
+	expectStrings(t, propagated(), want...)
+
+	left := flatten(run(p, "SPOP", "s", "5"))
+	all := append(popped, left...)
+	slices.Sort(all)
+	expectStrings(t, all, "a", "b", "c", "d", "e")
+	expectReply(t, run(p, "EXISTS", "s"), "0")
+	expectReply(t, run(p, "SPOP", "s"), "<nil>")
+	expectError(t, run(p, "SPOP", "s", "-1"), "SPOP -1")
+}
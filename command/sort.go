@@ -0,0 +1,267 @@
+package command
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// sortSpec holds the parsed options of SORT and SORT_RO.
+type sortSpec struct {
+	by     string
+	noSort bool
+	gets   []string
+	offset int
+	count  int
+	desc   bool
+	alpha  bool
+	store  string
+}
+
+// sortItem is an element being sorted with the weight it is compared by.
+type sortItem struct {
+	element string
+	score   float64
+	weight  string
+	found   bool
+}
+
+func SortCommand(db *database.Database, args []resp.Value) resp.Value {
+	return sortGeneric(db, args, false)
+}
+
+func SortROCommand(db *database.Database, args []resp.Value) resp.Value {
+	return sortGeneric(db, args, true)
+}
+
+// parseSort parses the options following the key. STORE is rejected when
+// readOnly is set.
+func parseSort(args []resp.Value, readOnly bool) (sortSpec, *resp.Value) {
+	spec := sortSpec{count: -1}
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "ASC":
+			spec.desc = false
+		case option == "DESC":
+			spec.desc = true
+		case option == "ALPHA":
+			spec.alpha = true
+		case option == "LIMIT" && remaining >= 2:
+			offset, err1 := strconv.Atoi(string(args[i+1].Bulk))
+			count, err2 := strconv.Atoi(string(args[i+2].Bulk))
+			if err1 != nil || err2 != nil {
+				reply := resp.NewError("ERR value is not an integer or out of range")
+				return spec, &reply
+			}
+			spec.offset, spec.count = max(offset, 0), count
+			i += 2
+		case option == "BY" && remaining >= 1:
+			i++
+			spec.by = string(args[i].Bulk)
+			// A pattern without "*" names the same key for every element,
+			// so there is nothing to sort by.
+			spec.noSort = !strings.Contains(spec.by, "*")
+		case option == "GET" && remaining >= 1:
+			i++
+			spec.gets = append(spec.gets, string(args[i].Bulk))
+		case option == "STORE" && remaining >= 1 && !readOnly:
+			i++
+			spec.store = string(args[i].Bulk)
+		default:
+			reply := resp.NewError("ERR syntax error")
+			return spec, &reply
+		}
+	}
+	return spec, nil
+}
+
+// sortElements returns the elements of the list, set or sorted set at key,
+// and the type of the value.
+func sortElements(db *database.Database, key string) (elements []string, kind string, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, "none", true
+	}
+	kind = val.Type()
+	switch v := val.(type) {
+	case *database.List:
+		if v.LLen() == 0 {
+			return nil, kind, true
+		}
+		return v.Range(0, v.LLen()-1), kind, true
+	case *database.Set:
+		return v.SMembers(), kind, true
+	case *database.ZSet:
+		if v.ZCard() == 0 {
+			return nil, kind, true
+		}
+		members := v.ZRange(0, v.ZCard()-1, false)
+		elements = make([]string, len(members))
+		for i, m := range members {
+			elements[i] = m.Member
+		}
+		return elements, kind, true
+	}
+	return nil, kind, false
+}
+
+// lookupSortPattern resolves a BY or GET pattern for element. The first "*"
+// is replaced by the element to form a key name, and a trailing "->field"
+// reads that field of a hash instead of a string value. "#" stands for the
+// element itself. ok is false when the key, field or a "*" is missing.
+func lookupSortPattern(db *database.Database, pattern, element string) (value string, ok bool) {
+	if pattern == "#" {
+		return element, true
+	}
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		return "", false
+	}
+	key, field := pattern, ""
+	if arrow := strings.Index(pattern[star+1:], "->"); arrow >= 0 && star+1+arrow+2 < len(pattern) {
+		key, field = pattern[:star+1+arrow], pattern[star+1+arrow+2:]
+	}
+	key = key[:star] + element + key[star+1:]
+
+	val, exists := db.Get(key)
+	if !exists {
+		return "", false
+	}
+	if field != "" {
+		hash, isHash := val.(*database.Hash)
+		if !isHash {
+			return "", false
+		}
+		return hash.HGet(field)
+	}
+	str, isString := val.(*database.String)
+	if !isString {
+		return "", false
+	}
+	return str.Get(), true
+}
+
+func sortGeneric(db *database.Database, args []resp.Value, readOnly bool) resp.Value {
+	name := "sort"
+	if readOnly {
+		name = "sort_ro"
+	}
+	if len(args) < 1 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	spec, errReply := parseSort(args[1:], readOnly)
+	if errReply != nil {
+		return *errReply
+	}
+	elements, kind, ok := sortElements(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	// Sets have no order of their own, so a stored result is sorted anyway
+	// to keep it identical when the command is replayed.
+	if spec.noSort && kind == "set" && spec.store != "" {
+		spec.noSort, spec.alpha = false, true
+		spec.by = ""
+	}
+
+	items := make([]sortItem, len(elements))
+	for i, element := range elements {
+		items[i] = sortItem{element: element, weight: element, found: true}
+	}
+	if !spec.noSort {
+		for i := range items {
+			item := &items[i]
+			if spec.by != "" {
+				item.weight, item.found = lookupSortPattern(db, spec.by, item.element)
+			}
+			if spec.alpha || !item.found {
+				continue
+			}
+			score, err := strconv.ParseFloat(item.weight, 64)
+			if err != nil || score != score {
+				return resp.NewError("ERR One or more scores can't be converted into double")
+			}
+			item.score = score
+		}
+		slices.SortFunc(items, func(a, b sortItem) int {
+			cmp := compareSortItems(a, b, spec.alpha)
+			if spec.desc {
+				return -cmp
+			}
+			return cmp
+		})
+	} else if spec.desc && kind == "zset" {
+		// Unsorted sorted sets keep their own order, reversed by DESC.
+		slices.Reverse(items)
+	}
+
+	start, end := min(spec.offset, len(items)), len(items)
+	if spec.count >= 0 {
+		end = min(start+spec.count, len(items))
+	}
+	items = items[start:end]
+
+	values := make([]resp.Value, 0, len(items)*max(len(spec.gets), 1))
+	for _, item := range items {
+		if len(spec.gets) == 0 {
+			values = append(values, resp.NewBulkString([]byte(item.element)))
+			continue
+		}
+		for _, get := range spec.gets {
+			if value, found := lookupSortPattern(db, get, item.element); found {
+				values = append(values, resp.NewBulkString([]byte(value)))
+			} else {
+				values = append(values, resp.NewNullBulkString())
+			}
+		}
+	}
+
+	if spec.store == "" {
+		return resp.NewArray(values)
+	}
+	if len(values) == 0 {
+		if db.Delete(spec.store) {
+			db.Notify(database.NotifyGeneric, "del", spec.store)
+		}
+		return resp.NewInteger(0)
+	}
+	list := database.NewList()
+	for _, value := range values {
+		list.RPush(string(value.Bulk))
+	}
+	db.Set(spec.store, list, 0)
+	db.Notify(database.NotifyList, "sortstore", spec.store)
+	return resp.NewInteger(int64(len(values)))
+}
+
+// compareSortItems orders a before b by score, or by weight when alpha is
+// set, with missing weights first. Ties fall back to the elements so the
+// order is deterministic.
+func compareSortItems(a, b sortItem, alpha bool) int {
+	cmp := 0
+	switch {
+	case alpha && a.found && b.found:
+		cmp = strings.Compare(a.weight, b.weight)
+	case alpha && a.found != b.found:
+		if a.found {
+			cmp = 1
+		} else {
+			cmp = -1
+		}
+	case !alpha && a.score < b.score:
+		cmp = -1
+	case !alpha && a.score > b.score:
+		cmp = 1
+	}
+	if cmp == 0 {
+		cmp = strings.Compare(a.element, b.element)
+	}
+	return cmp
+}
@@ -0,0 +1,54 @@
+package command
+
+import "testing"
+
+func TestSort(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "l", "3", "10", "1", "2.5")
+	expectReply(t, run(p, "SORT", "l"), "1", "2.5", "3", "10")
+	expectReply(t, run(p, "SORT", "l", "DESC", "LIMIT", "1", "2"), "3", "2.5")
+	expectReply(t, run(p, "SORT", "l", "ALPHA"), "1", "10", "2.5", "3")
+	expectReply(t, run(p, "SORT", "l", "LIMIT", "-5", "1"), "1")
+	expectReply(t, run(p, "SORT", "l", "LIMIT", "10", "1"))
+	expectReply(t, run(p, "SORT", "missing"))
+
+	run(p, "RPUSH", "words", "b", "a")
+	expectError(t, run(p, "SORT", "words"), "a numeric SORT of words")
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "SORT", "s"), "SORT of a string")
+	expectError(t, run(p, "SORT", "l", "LIMIT", "0"), "SORT LIMIT without a count")
+	expectError(t, run(p, "SORT_RO", "l", "STORE", "dst"), "SORT_RO STORE")
+}
+
+func TestSortByAndGet(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "RPUSH", "ids", "1", "2", "3")
+	run(p, "MSET", "weight_1", "30", "weight_2", "10", "name_1", "one", "name_3", "three")
+	run(p, "HSET", "user_1", "age", "40")
+	run(p, "HSET", "user_2", "age", "20")
+	run(p, "HSET", "user_3", "age", "30")
+
+	expectReply(t, run(p, "SORT", "ids", "BY", "weight_*"), "3", "2", "1")
+	expectReply(t, run(p, "SORT", "ids", "BY", "user_*->age", "DESC"), "1", "3", "2")
+	expectReply(t, run(p, "SORT", "ids", "BY", "weight_*", "GET", "#", "GET", "name_*", "GET", "user_*->age"),
+		"3", "three", "30", "2", "<nil>", "20", "1", "one", "40")
+	// A pattern without "*" skips sorting and keeps the list order.
+	expectReply(t, run(p, "SORT", "ids", "BY", "nosort", "GET", "name_*"), "one", "<nil>", "three")
+	expectReply(t, run(p, "SORT_RO", "ids", "BY", "name_*", "ALPHA"), "2", "1", "3")
+}
+
+func TestSortStore(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SADD", "set", "c", "a", "b")
+	expectReply(t, run(p, "SORT", "set", "ALPHA", "DESC", "STORE", "dst"), "3")
+	expectReply(t, run(p, "LRANGE", "dst", "0", "-1"), "c", "b", "a")
+	// An unsorted set is sorted anyway when stored, so a replica replaying
+	// the command stores the same list.
+	expectReply(t, run(p, "SORT", "set", "BY", "nosort", "STORE", "dst"), "3")
+	expectReply(t, run(p, "LRANGE", "dst", "0", "-1"), "a", "b", "c")
+
+	run(p, "ZADD", "z", "1", "x", "2", "y")
+	expectReply(t, run(p, "SORT", "z", "BY", "nosort", "DESC"), "y", "x")
+	expectReply(t, run(p, "SORT", "missing", "STORE", "dst"), "0")
+	expectReply(t, run(p, "EXISTS", "dst"), "0")
+}
@@ -0,0 +1,552 @@
+package command
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+var errInvalidStreamID = errors.New("ERR Invalid stream ID specified as stream command argument")
+
+// lookupStream returns the stream stored at key, or nil when the key does
+// not exist. ok is false when the key holds another type.
+func lookupStream(db *database.Database, key string) (stream *database.Stream, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	stream, ok = val.(*database.Stream)
+	return stream, ok
+}
+
+// parseStreamID parses an explicit ID, where a bare millisecond time gets
+// missingSeq as its sequence number.
+func parseStreamID(arg resp.Value, missingSeq uint64) (database.StreamID, error) {
+	id, ok := database.ParseStreamID(string(arg.Bulk), missingSeq)
+	if !ok {
+		return id, errInvalidStreamID
+	}
+	return id, nil
+}
+
+// parseStreamRangeBound parses an XRANGE bound: an ID, "-" or "+", or an
+// ID prefixed with "(" to exclude it.
+func parseStreamRangeBound(arg resp.Value, start bool) (database.StreamID, error) {
+	s := string(arg.Bulk)
+	switch s {
+	case "-":
+		return database.StreamID{}, nil
+	case "+":
+		return database.MaxStreamID, nil
+	}
+	exclusive := strings.HasPrefix(s, "(")
+	s = strings.TrimPrefix(s, "(")
+	missingSeq := uint64(0)
+	if !start {
+		missingSeq = math.MaxUint64
+	}
+	id, ok := database.ParseStreamID(s, missingSeq)
+	if !ok {
+		return id, errInvalidStreamID
+	}
+	if !exclusive {
+		return id, nil
+	}
+	if start {
+		if id, ok = id.Incr(); !ok {
+			return id, errors.New("ERR invalid start ID for the interval")
+		}
+	} else if id, ok = id.Decr(); !ok {
+		return id, errors.New("ERR invalid end ID for the interval")
+	}
+	return id, nil
+}
+
+// streamEntriesReply builds the [id, [field, value, ...]] pairs returned by
+// XRANGE and XREAD. Entries deleted while pending have nil fields.
+func streamEntriesReply(entries []database.StreamEntry) resp.Value {
+	result := make([]resp.Value, len(entries))
+	for i, e := range entries {
+		fields := resp.NewNullArray()
+		if e.Fields != nil {
+			fields = bulkStrings(e.Fields)
+		}
+		result[i] = resp.NewArray([]resp.Value{resp.NewBulkString([]byte(e.ID.String())), fields})
+	}
+	return resp.NewArray(result)
+}
+
+// streamTrim holds the MAXLEN or MINID arguments of XADD and XTRIM.
+type streamTrim struct {
+	strategy string // "", "MAXLEN" or "MINID"
+	approx   bool
+	maxLen   int
+	minID    database.StreamID
+	limit    int
+}
+
+// parseStreamTrim parses "MAXLEN|MINID [=|~] threshold [LIMIT count]"
+// starting at args[i] and returns the index of the last argument consumed.
+func parseStreamTrim(args []resp.Value, i int, t *streamTrim) (int, *resp.Value) {
+	fail := func(msg string) (int, *resp.Value) {
+		reply := resp.NewError(msg)
+		return i, &reply
+	}
+	t.strategy = strings.ToUpper(string(args[i].Bulk))
+	i++
+	if i < len(args)-1 {
+		switch string(args[i].Bulk) {
+		case "~":
+			t.approx = true
+			i++
+		case "=":
+			i++
+		}
+	}
+	if i >= len(args) {
+		return fail("ERR syntax error")
+	}
+
+	if t.strategy == "MAXLEN" {
+		n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+		if err != nil {
+			return fail("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return fail("ERR The MAXLEN argument must be >= 0.")
+		}
+		t.maxLen = clampInt(n)
+	} else {
+		id, err := parseStreamID(args[i], 0)
+		if err != nil {
+			return fail(err.Error())
+		}
+		t.minID = id
+	}
+
+	// Approximate trimming removes whole nodes, by default at most 100
+	// nodes' worth of entries per call, as in Redis.
+	if t.approx {
+		t.limit = 100 * database.StreamNodeMaxEntries
+	}
+	if i+2 < len(args) && strings.ToUpper(string(args[i+1].Bulk)) == "LIMIT" {
+		n, err := strconv.ParseInt(string(args[i+2].Bulk), 10, 64)
+		if err != nil {
+			return fail("ERR value is not an integer or out of range")
+		}
+		if n < 0 {
+			return fail("ERR The LIMIT argument must be >= 0.")
+		}
+		if !t.approx {
+			return fail("ERR syntax error, LIMIT cannot be used without the special ~ option")
+		}
+		t.limit = clampInt(n)
+		i += 2
+	}
+	return i, nil
+}
+
+// apply trims stream and returns how many entries were removed.
+func (t *streamTrim) apply(stream *database.Stream) int {
+	switch t.strategy {
+	case "MAXLEN":
+		return stream.TrimMaxLen(t.maxLen, t.approx, t.limit)
+	case "MINID":
+		return stream.TrimMinID(t.minID, t.approx, t.limit)
+	}
+	return 0
+}
+
+// parseXAdd parses the options of XADD and returns the index of the ID
+// argument.
+func parseXAdd(args []resp.Value) (idIndex int, noMkStream bool, trim streamTrim, errReply *resp.Value) {
+	i := 1
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch {
+		case option == "NOMKSTREAM":
+			noMkStream = true
+			continue
+		case (option == "MAXLEN" || option == "MINID") && i+1 < len(args):
+			if i, errReply = parseStreamTrim(args, i, &trim); errReply != nil {
+				return 0, false, trim, errReply
+			}
+			continue
+		}
+		break
+	}
+	return i, noMkStream, trim, nil
+}
+
+// nextStreamID resolves the ID argument of XADD, which is "*" for an
+// automatic ID, "ms-*" for an automatic sequence number, or an explicit ID.
+func nextStreamID(arg resp.Value, last database.StreamID) (database.StreamID, error) {
+	errSmaller := errors.New("ERR The ID specified in XADD is equal or smaller than the target stream top item")
+	s := string(arg.Bulk)
+	if s == "*" {
+		now := uint64(time.Now().UnixMilli())
+		if now > last.Ms {
+			return database.StreamID{Ms: now}, nil
+		}
+		id, ok := last.Incr()
+		if !ok {
+			return id, errors.New("ERR The stream has exhausted the last possible ID, unable to add more items")
+		}
+		return id, nil
+	}
+
+	if msPart, found := strings.CutSuffix(s, "-*"); found {
+		ms, err := strconv.ParseUint(msPart, 10, 64)
+		if err != nil {
+			return database.StreamID{}, errInvalidStreamID
+		}
+		switch {
+		case ms > last.Ms:
+			return database.StreamID{Ms: ms}, nil
+		case ms < last.Ms || last.Seq == math.MaxUint64:
+			return database.StreamID{}, errSmaller
+		}
+		return database.StreamID{Ms: ms, Seq: last.Seq + 1}, nil
+	}
+
+	id, err := parseStreamID(arg, 0)
+	if err != nil {
+		return id, err
+	}
+	if id == (database.StreamID{}) {
+		return id, errors.New("ERR The ID specified in XADD must be greater than 0-0")
+	}
+	if id.Compare(last) <= 0 {
+		return id, errSmaller
+	}
+	return id, nil
+}
+
+func XAddCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'xadd' command")
+	}
+	idIndex, noMkStream, trim, errReply := parseXAdd(args)
+	if errReply != nil {
+		return *errReply
+	}
+	fieldArgs := args[idIndex+1:]
+	if len(fieldArgs) == 0 || len(fieldArgs)%2 != 0 {
+		return resp.NewError("ERR wrong number of arguments for 'xadd' command")
+	}
+	key := string(args[0].Bulk)
+
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil && noMkStream {
+		return resp.NewNullBulkString()
+	}
+	var last database.StreamID
+	if stream != nil {
+		last = stream.LastID()
+	}
+	id, err := nextStreamID(args[idIndex], last)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+
+	if stream == nil {
+		stream = database.NewStream()
+		db.Set(key, stream, 0)
+	}
+	fields := make([]string, len(fieldArgs))
+	for i, arg := range fieldArgs {
+		fields[i] = string(arg.Bulk)
+	}
+	stream.Add(id, fields)
+	db.Notify(database.NotifyStream, "xadd", key)
+	if trim.apply(stream) > 0 {
+		db.Notify(database.NotifyStream, "xtrim", key)
+	}
+	return resp.NewBulkString([]byte(id.String()))
+}
+
+// rewriteXAdd propagates XADD with the ID it generated, so a replay adds the
+// same entry.
+func rewriteXAdd(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	idIndex, _, _, _ := parseXAdd(args)
+	rewritten := append([]resp.Value{}, args...)
+	rewritten[idIndex] = reply
+	return "XADD", rewritten
+}
+
+func XRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	return xrangeGeneric(db, args, false, "xrange")
+}
+
+func XRevRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	return xrangeGeneric(db, args, true, "xrevrange")
+}
+
+func xrangeGeneric(db *database.Database, args []resp.Value, reverse bool, name string) resp.Value {
+	if len(args) != 3 && len(args) != 5 {
+		if len(args) < 3 {
+			return resp.NewError("ERR wrong number of arguments for '" + name + "' command")
+		}
+		return resp.NewError("ERR syntax error")
+	}
+	startArg, endArg := args[1], args[2]
+	if reverse {
+		startArg, endArg = endArg, startArg
+	}
+	start, err := parseStreamRangeBound(startArg, true)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	end, err := parseStreamRangeBound(endArg, false)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	count := 0
+	if len(args) == 5 {
+		if strings.ToUpper(string(args[3].Bulk)) != "COUNT" {
+			return resp.NewError("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(string(args[4].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return resp.NewArray([]resp.Value{})
+		}
+		count = clampInt(n)
+	}
+
+	stream, ok := lookupStream(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return streamEntriesReply(stream.Range(start, end, count, reverse))
+}
+
+func XLenCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'xlen' command")
+	}
+	stream, ok := lookupStream(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewInteger(0)
+	}
+	return resp.NewInteger(int64(stream.Len()))
+}
+
+func XDelCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'xdel' command")
+	}
+	key := string(args[0].Bulk)
+	ids := make([]database.StreamID, len(args)-1)
+	for i, arg := range args[1:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		ids[i] = id
+	}
+
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewInteger(0)
+	}
+	deleted := stream.Delete(ids...)
+	if deleted > 0 {
+		db.Notify(database.NotifyStream, "xdel", key)
+	}
+	return resp.NewInteger(int64(deleted))
+}
+
+func XTrimCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'xtrim' command")
+	}
+	key := string(args[0].Bulk)
+	strategy := strings.ToUpper(string(args[1].Bulk))
+	if strategy != "MAXLEN" && strategy != "MINID" {
+		return resp.NewError("ERR syntax error")
+	}
+	var trim streamTrim
+	last, errReply := parseStreamTrim(args, 1, &trim)
+	if errReply != nil {
+		return *errReply
+	}
+	if last != len(args)-1 {
+		return resp.NewError("ERR syntax error")
+	}
+
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewInteger(0)
+	}
+	removed := trim.apply(stream)
+	if removed > 0 {
+		db.Notify(database.NotifyStream, "xtrim", key)
+	}
+	return resp.NewInteger(int64(removed))
+}
+
+// xreadOptions are the arguments of XREAD and XREADGROUP.
+type xreadOptions struct {
+	count    int           // 0 for no limit
+	block    time.Duration // negative when not blocking
+	noAck    bool
+	group    string
+	consumer string
+	keys     []string
+	ids      []resp.Value
+}
+
+// parseXRead parses "[GROUP group consumer] [COUNT count] [BLOCK ms]
+// [NOACK] STREAMS key [key ...] id [id ...]", where GROUP and NOACK are
+// only accepted with withGroup set, and GROUP is then required.
+func parseXRead(args []resp.Value, withGroup bool) (xreadOptions, *resp.Value) {
+	opts := xreadOptions{block: -1}
+	fail := func(msg string) (xreadOptions, *resp.Value) {
+		reply := resp.NewError(msg)
+		return opts, &reply
+	}
+	i := 0
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "STREAMS":
+		case option == "COUNT" && remaining >= 1:
+			i++
+			n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+			if err != nil {
+				return fail("ERR value is not an integer or out of range")
+			}
+			opts.count = clampInt(max(n, 0))
+			continue
+		case option == "BLOCK" && remaining >= 1:
+			i++
+			n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+			switch {
+			case err != nil:
+				return fail("ERR timeout is not an integer or out of range")
+			case n < 0:
+				return fail("ERR timeout is negative")
+			case n > math.MaxInt64/int64(time.Millisecond):
+				return fail("ERR timeout is out of range")
+			}
+			opts.block = time.Duration(n) * time.Millisecond
+			continue
+		case option == "GROUP" && remaining >= 2 && withGroup:
+			opts.group, opts.consumer = string(args[i+1].Bulk), string(args[i+2].Bulk)
+			i += 2
+			continue
+		case option == "NOACK" && withGroup:
+			opts.noAck = true
+			continue
+		case option == "GROUP" || option == "NOACK":
+			return fail("ERR The GROUP option is only supported by XREADGROUP. You called XREAD instead.")
+		default:
+			return fail("ERR syntax error")
+		}
+		break
+	}
+	if i == len(args) {
+		return fail("ERR syntax error")
+	}
+	if withGroup && opts.group == "" {
+		return fail("ERR Missing GROUP option for XREADGROUP")
+	}
+
+	streamArgs := args[i+1:]
+	if len(streamArgs) == 0 || len(streamArgs)%2 != 0 {
+		if withGroup {
+			return fail("ERR Unbalanced 'xreadgroup' list of streams: for each stream key an ID or '>' must be specified.")
+		}
+		return fail("ERR Unbalanced 'xread' list of streams: for each stream key an ID or '$' must be specified.")
+	}
+	numKeys := len(streamArgs) / 2
+	for _, arg := range streamArgs[:numKeys] {
+		opts.keys = append(opts.keys, string(arg.Bulk))
+	}
+	opts.ids = streamArgs[numKeys:]
+	return opts, nil
+}
+
+// XReadCommand implements XREAD, which only blocks when BLOCK is given. A
+// "$" ID is resolved to the stream's last ID when the command first runs,
+// so a blocked client is served the entries added after that.
+func XReadCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	opts, errReply := parseXRead(args, false)
+	if errReply != nil {
+		return *errReply, nil
+	}
+
+	streams := make([]*database.Stream, len(opts.keys))
+	for k, key := range opts.keys {
+		stream, ok := lookupStream(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		streams[k] = stream
+	}
+
+	var resolved []resp.Value
+	result := make([]resp.Value, 0)
+	for k, arg := range opts.ids {
+		var after database.StreamID
+		if string(arg.Bulk) == "$" {
+			if streams[k] != nil {
+				after = streams[k].LastID()
+			}
+			if resolved == nil {
+				resolved = append([]resp.Value{}, args...)
+			}
+			resolved[len(args)-len(opts.ids)+k] = resp.NewBulkString([]byte(after.String()))
+		} else {
+			id, err := parseStreamID(arg, 0)
+			if err != nil {
+				return resp.NewError(err.Error()), nil
+			}
+			after = id
+		}
+
+		start, ok := after.Incr()
+		if streams[k] == nil || !ok {
+			continue
+		}
+		entries := streams[k].Range(start, database.MaxStreamID, opts.count, false)
+		if len(entries) > 0 {
+			result = append(result, resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte(opts.keys[k])),
+				streamEntriesReply(entries),
+			}))
+		}
+	}
+
+	if len(result) > 0 {
+		return resp.NewArray(result), nil
+	}
+	if opts.block < 0 {
+		return resp.NewNullArray(), nil
+	}
+	return resp.Value{}, &Wait{Keys: opts.keys, Timeout: opts.block, Reply: resp.NewNullArray(), Args: resolved}
+}
@@ -0,0 +1,92 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func expectError(t *testing.T, v resp.Value, what string) {
+	t.Helper()
+	if v.Type != resp.ErrorType {
+		t.Fatalf("%s = %q, want an error", what, flatten(v))
+	}
+}
+
+func TestXAddIDs(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "XADD", "s", "1-1", "f", "v"), "1-1")
+	expectError(t, run(p, "XADD", "s", "1-1", "f", "v"), "XADD with the last ID")
+	expectError(t, run(p, "XADD", "s", "0-5", "f", "v"), "XADD with a smaller ID")
+	expectReply(t, run(p, "XADD", "s", "1-*", "f", "v"), "1-2")
+	expectReply(t, run(p, "XADD", "s", "3", "f", "v"), "3-0")
+	id := string(run(p, "XADD", "s", "*", "f", "v").Bulk)
+	if ms, seq, _ := strings.Cut(id, "-"); len(ms) < 13 || seq != "0" {
+		t.Fatalf("XADD * = %q, want the current time in milliseconds with sequence 0", id)
+	}
+	expectReply(t, run(p, "XLEN", "s"), "4")
+
+	expectError(t, run(p, "XADD", "empty", "0-0", "f", "v"), "XADD 0-0")
+	expectError(t, run(p, "XADD", "s", "*", "f"), "XADD with an odd number of field arguments")
+	expectReply(t, run(p, "XADD", "missing", "NOMKSTREAM", "*", "f", "v"), "<nil>")
+	expectReply(t, run(p, "EXISTS", "missing"), "0")
+}
+
+func TestXAddPropagatesItsID(t *testing.T) {
+	p := newTestProcessor()
+	propagated := recordPropagation(p)
+	id := string(run(p, "XADD", "s", "*", "f", "v").Bulk)
+	if cmds := propagated(); len(cmds) != 1 || cmds[0] != "XADD s "+id+" f v" {
+		t.Fatalf("XADD * propagated as %q, want XADD s %s f v", cmds, id)
+	}
+}
+
+func TestXRange(t *testing.T) {
+	p := newTestProcessor()
+	for _, id := range []string{"1-1", "2-1", "3-1", "3-2", "5-1"} {
+		run(p, "XADD", "s", id, "id", id)
+	}
+	expectReply(t, run(p, "XRANGE", "s", "-", "+", "COUNT", "2"), "1-1", "id", "1-1", "2-1", "id", "2-1")
+	// An exclusive start, and an end without a sequence covering all of 3.
+	expectReply(t, run(p, "XRANGE", "s", "(1-1", "3"), "2-1", "id", "2-1", "3-1", "id", "3-1", "3-2", "id", "3-2")
+	expectReply(t, run(p, "XREVRANGE", "s", "+", "(3-1", "COUNT", "2"), "5-1", "id", "5-1", "3-2", "id", "3-2")
+	if v := run(p, "XRANGE", "s", "4", "4"); len(v.Array) != 0 {
+		t.Fatalf("XRANGE over a gap = %q, want no entries", flatten(v))
+	}
+	if v := run(p, "XRANGE", "s", "(5-1", "+"); len(v.Array) != 0 {
+		t.Fatalf("XRANGE after the last entry = %q, want no entries", flatten(v))
+	}
+}
+
+func TestXTrimAndXDel(t *testing.T) {
+	p := newTestProcessor()
+	for _, id := range []string{"1-1", "2-1", "3-1", "4-1", "5-1"} {
+		run(p, "XADD", "s", id, "f", "v")
+	}
+	expectReply(t, run(p, "XDEL", "s", "2-1", "9-9"), "1")
+	expectReply(t, run(p, "XTRIM", "s", "MAXLEN", "2"), "2")
+	expectReply(t, run(p, "XLEN", "s"), "2")
+	expectReply(t, run(p, "XTRIM", "s", "MINID", "5"), "1")
+	expectReply(t, run(p, "XRANGE", "s", "-", "+"), "5-1", "f", "v")
+
+	// Trimming never lets a new ID go below the last one.
+	expectError(t, run(p, "XADD", "s", "4-1", "f", "v"), "XADD below a trimmed entry")
+	expectReply(t, run(p, "XADD", "s", "MAXLEN", "1", "6-1", "f", "v"), "6-1")
+	expectReply(t, run(p, "XRANGE", "s", "-", "+"), "6-1", "f", "v")
+}
+
+func TestXReadBlocksForNewEntries(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "XADD", "s", "1-1", "f", "old")
+	expectReply(t, run(p, "XREAD", "STREAMS", "s", "0"), "s", "1-1", "f", "old")
+
+	_, reply := block(t, p, "XREAD", "BLOCK", "0", "STREAMS", "s", "$")
+	run(p, "XADD", "s", "2-1", "f", "new")
+	expectReply(t, await(t, reply), "s", "2-1", "f", "new")
+
+	if v := run(p, "XREAD", "BLOCK", "20", "STREAMS", "s", "$"); !v.Null {
+		t.Fatalf("XREAD after its timeout = %q, want a null array", flatten(v))
+	}
+	expectError(t, run(p, "XREAD", "STREAMS", "s"), "XREAD without an ID")
+}
@@ -0,0 +1,846 @@
+package command
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// noGroupError is the NOGROUP error of XPENDING, XCLAIM and XAUTOCLAIM.
+func noGroupError(key, group string) resp.Value {
+	return resp.NewError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s'", key, group))
+}
+
+// lookupGroupStream returns the stream at key when it has the group, and
+// otherwise the error reply to send.
+func lookupGroupStream(db *database.Database, key, group string) (*database.Stream, *resp.Value) {
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		reply := resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		return nil, &reply
+	}
+	if stream == nil || !stream.HasGroup(group) {
+		reply := noGroupError(key, group)
+		return nil, &reply
+	}
+	return stream, nil
+}
+
+// parseGroupID parses the ID of XGROUP CREATE and SETID, where "$" stands
+// for the last ID of the stream.
+func parseGroupID(arg resp.Value, stream *database.Stream) (database.StreamID, error) {
+	if string(arg.Bulk) == "$" {
+		if stream == nil {
+			return database.StreamID{}, nil
+		}
+		return stream.LastID(), nil
+	}
+	return parseStreamID(arg, 0)
+}
+
+// parseEntriesRead parses the ENTRIESREAD option of XGROUP CREATE and
+// SETID, which follows args[0], and returns -1 when it is absent.
+func parseEntriesRead(args []resp.Value) (int64, *resp.Value) {
+	if len(args) == 0 {
+		return -1, nil
+	}
+	if len(args) != 2 || strings.ToUpper(string(args[0].Bulk)) != "ENTRIESREAD" {
+		reply := resp.NewError("ERR syntax error")
+		return 0, &reply
+	}
+	n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		reply := resp.NewError("ERR value is not an integer or out of range")
+		return 0, &reply
+	}
+	if n < -1 {
+		reply := resp.NewError("ERR value for ENTRIESREAD must be positive or -1")
+		return 0, &reply
+	}
+	return n, nil
+}
+
+func XGroupCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return resp.NewError("ERR wrong number of arguments for 'xgroup' command")
+	}
+	sub := strings.ToUpper(string(args[0].Bulk))
+	arity := map[string][2]int{
+		"CREATE":         {4, 7},
+		"SETID":          {4, 6},
+		"DESTROY":        {3, 3},
+		"CREATECONSUMER": {4, 4},
+		"DELCONSUMER":    {4, 4},
+	}
+	bounds, known := arity[sub]
+	if !known {
+		return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try XGROUP HELP.", string(args[0].Bulk)))
+	}
+	if len(args) < bounds[0] || len(args) > bounds[1] {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for 'xgroup|%s' command", strings.ToLower(sub)))
+	}
+	key, group := string(args[1].Bulk), string(args[2].Bulk)
+
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	mkStream := sub == "CREATE" && len(args) > 4 && strings.ToUpper(string(args[4].Bulk)) == "MKSTREAM"
+	if stream == nil && !mkStream {
+		return resp.NewError("ERR The XGROUP subcommand requires the key to exist. Note that for CREATE you may want to use the MKSTREAM option to create an empty stream automatically.")
+	}
+
+	switch sub {
+	case "CREATE":
+		id, err := parseGroupID(args[3], stream)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		rest := args[4:]
+		if mkStream {
+			rest = rest[1:]
+		}
+		entriesRead, errReply := parseEntriesRead(rest)
+		if errReply != nil {
+			return *errReply
+		}
+		if stream == nil {
+			stream = database.NewStream()
+			db.Set(key, stream, 0)
+		}
+		if !stream.CreateGroup(group, id, entriesRead) {
+			return resp.NewError("BUSYGROUP Consumer Group name already exists")
+		}
+		db.Notify(database.NotifyStream, "xgroup-create", key)
+		return resp.NewSimpleString("OK")
+	case "SETID":
+		id, err := parseGroupID(args[3], stream)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		entriesRead, errReply := parseEntriesRead(args[4:])
+		if errReply != nil {
+			return *errReply
+		}
+		if !stream.SetGroupID(group, id, entriesRead) {
+			return resp.NewError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+		}
+		db.Notify(database.NotifyStream, "xgroup-setid", key)
+		return resp.NewSimpleString("OK")
+	case "DESTROY":
+		if !stream.DestroyGroup(group) {
+			return resp.NewInteger(0)
+		}
+		db.Notify(database.NotifyStream, "xgroup-destroy", key)
+		return resp.NewInteger(1)
+	case "CREATECONSUMER":
+		created, ok := stream.CreateConsumer(group, string(args[3].Bulk), time.Now())
+		if !ok {
+			return resp.NewError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+		}
+		if !created {
+			return resp.NewInteger(0)
+		}
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+		return resp.NewInteger(1)
+	}
+
+	pending, ok := stream.DeleteConsumer(group, string(args[3].Bulk))
+	if !ok {
+		return resp.NewError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+	}
+	db.Notify(database.NotifyStream, "xgroup-delconsumer", key)
+	return resp.NewInteger(int64(pending))
+}
+
+// rewriteXGroup propagates XGROUP CREATE and SETID with "$" resolved to the
+// ID it stood for.
+func rewriteXGroup(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	sub := strings.ToUpper(string(args[0].Bulk))
+	if (sub != "CREATE" && sub != "SETID") || string(args[3].Bulk) != "$" {
+		return "XGROUP", args
+	}
+	rewritten := append([]resp.Value{}, args...)
+	if val, ok := db.Peek(string(args[1].Bulk)); ok {
+		rewritten[3] = resp.NewBulkString([]byte(val.(*database.Stream).LastID().String()))
+	}
+	return "XGROUP", rewritten
+}
+
+// XReadGroupCommand implements XREADGROUP. The ID ">" reads entries never
+// delivered to the group, and blocks when BLOCK is given; any other ID
+// reads the consumer's pending entries after it and never blocks.
+func XReadGroupCommand(db *database.Database, args []resp.Value) (resp.Value, *Wait) {
+	opts, errReply := parseXRead(args, true)
+	if errReply != nil {
+		return *errReply, nil
+	}
+
+	streams := make([]*database.Stream, len(opts.keys))
+	history := false
+	for k, key := range opts.keys {
+		stream, ok := lookupStream(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value"), nil
+		}
+		if stream == nil || !stream.HasGroup(opts.group) {
+			return resp.NewError(fmt.Sprintf("NOGROUP No such key '%s' or consumer group '%s' in XREADGROUP with GROUP option", key, opts.group)), nil
+		}
+		streams[k] = stream
+		switch id := string(opts.ids[k].Bulk); id {
+		case ">":
+		case "$":
+			return resp.NewError("ERR The $ ID is meaningless in the context of XREADGROUP: you want to read the history of this consumer by specifying a proper ID, or use the > ID to get new messages. The $ ID would just return an empty result set."), nil
+		default:
+			if _, err := parseStreamID(opts.ids[k], 0); err != nil {
+				return resp.NewError(err.Error()), nil
+			}
+			history = true
+		}
+	}
+
+	now := time.Now()
+	result := make([]resp.Value, 0)
+	for k, key := range opts.keys {
+		var entries []database.StreamEntry
+		var created bool
+		if string(opts.ids[k].Bulk) == ">" {
+			entries, created, _ = streams[k].ReadGroup(opts.group, opts.consumer, opts.count, opts.noAck, now)
+			if len(entries) > 0 {
+				db.Notify(database.NotifyInternal, "xreadgroup", key)
+			}
+		} else {
+			after, _ := parseStreamID(opts.ids[k], 0)
+			entries, created, _ = streams[k].ReadPending(opts.group, opts.consumer, after, opts.count, now)
+			if len(entries) > 0 {
+				db.Notify(database.NotifyInternal, "xreadgroup", key)
+			}
+		}
+		if created {
+			db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+		}
+		if len(entries) > 0 || history {
+			result = append(result, resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte(key)),
+				streamEntriesReply(entries),
+			}))
+		}
+	}
+
+	if len(result) > 0 {
+		return resp.NewArray(result), nil
+	}
+	if opts.block < 0 {
+		return resp.NewNullArray(), nil
+	}
+	return resp.Value{}, &Wait{Keys: opts.keys, Timeout: opts.block, Reply: resp.NewNullArray()}
+}
+
+// expandXReadGroup propagates XREADGROUP as Redis does: an XCLAIM that
+// creates the pending entries it delivered, with their delivery time, and
+// an XGROUP SETID that moves the group's last delivered ID. Reads of
+// pending entries propagate the new delivery time and count of each entry
+// still in the stream.
+func expandXReadGroup(db *database.Database, args []resp.Value, reply resp.Value) []Propagation {
+	opts, _ := parseXRead(args, true)
+	delivered := make(map[string][]resp.Value)
+	for _, r := range reply.Array {
+		delivered[string(r.Array[0].Bulk)] = r.Array[1].Array
+	}
+
+	var cmds []Propagation
+	for k, key := range opts.keys {
+		val, ok := db.Peek(key)
+		if !ok {
+			continue
+		}
+		stream := val.(*database.Stream)
+		entries := delivered[key]
+		if len(entries) == 0 {
+			cmds = append(cmds, createConsumerPropagation(key, opts.group, opts.consumer))
+			continue
+		}
+		if string(opts.ids[k].Bulk) != ">" {
+			for _, e := range entries {
+				if !e.Array[1].Null {
+					cmds = append(cmds, claimEntryPropagation(stream, key, opts.group, opts.consumer, e.Array[0]))
+				}
+			}
+			continue
+		}
+
+		if opts.noAck {
+			cmds = append(cmds, createConsumerPropagation(key, opts.group, opts.consumer))
+		} else {
+			ids := make([]resp.Value, len(entries))
+			for i, e := range entries {
+				ids[i] = e.Array[0]
+			}
+			first, _ := database.ParseStreamID(string(ids[0].Bulk), 0)
+			pending, _ := stream.Pending(opts.group, first, first, 1, "", 0, time.Now())
+			if len(pending) == 1 {
+				cmds = append(cmds, claimPropagation(key, opts.group, opts.consumer, ids, pending[0]))
+			}
+		}
+		if info, ok := stream.GroupInfo(opts.group); ok {
+			cmds = append(cmds, setIDPropagation(key, info))
+		}
+	}
+	return cmds
+}
+
+func createConsumerPropagation(key, group, consumer string) Propagation {
+	return Propagation{Name: "XGROUP", Args: bulkStrings([]string{"CREATECONSUMER", key, group, consumer}).Array}
+}
+
+func setIDPropagation(key string, info database.StreamGroupInfo) Propagation {
+	return Propagation{Name: "XGROUP", Args: bulkStrings([]string{
+		"SETID", key, info.Name, info.LastID.String(), "ENTRIESREAD", strconv.FormatInt(info.EntriesRead, 10),
+	}).Array}
+}
+
+// claimPropagation builds an XCLAIM that makes ids pending for consumer
+// with the delivery time and count of pe.
+func claimPropagation(key, group, consumer string, ids []resp.Value, pe database.PendingEntry) Propagation {
+	args := bulkStrings([]string{key, group, consumer, "0"}).Array
+	args = append(args, ids...)
+	args = append(args, bulkStrings([]string{
+		"TIME", strconv.FormatInt(pe.DeliveryTime.UnixMilli(), 10),
+		"RETRYCOUNT", strconv.FormatInt(pe.DeliveryCount, 10),
+		"FORCE", "JUSTID",
+	}).Array...)
+	return Propagation{Name: "XCLAIM", Args: args}
+}
+
+func XAckCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'xack' command")
+	}
+	key, group := string(args[0].Bulk), string(args[1].Bulk)
+	ids := make([]database.StreamID, len(args)-2)
+	for i, arg := range args[2:] {
+		id, err := parseStreamID(arg, 0)
+		if err != nil {
+			return resp.NewError(err.Error())
+		}
+		ids[i] = id
+	}
+
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewInteger(0)
+	}
+	acked := stream.Ack(group, ids...)
+	if acked > 0 {
+		db.Notify(database.NotifyInternal, "xack", key)
+	}
+	return resp.NewInteger(int64(acked))
+}
+
+func XPendingCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'xpending' command")
+	}
+	key, group := string(args[0].Bulk), string(args[1].Bulk)
+	rest := args[2:]
+	var minIdle time.Duration
+	if len(rest) >= 2 && strings.ToUpper(string(rest[0].Bulk)) == "IDLE" {
+		ms, err := strconv.ParseInt(string(rest[1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		minIdle = time.Duration(max(min(ms, math.MaxInt64/int64(time.Millisecond)), 0)) * time.Millisecond
+		rest = rest[2:]
+		if len(rest) == 0 {
+			return resp.NewError("ERR syntax error")
+		}
+	}
+	if len(rest) != 0 && len(rest) != 3 && len(rest) != 4 {
+		return resp.NewError("ERR syntax error")
+	}
+
+	var start, end database.StreamID
+	count := 0
+	consumer := ""
+	if len(rest) > 0 {
+		var err error
+		if start, err = parseStreamRangeBound(rest[0], true); err != nil {
+			return resp.NewError(err.Error())
+		}
+		if end, err = parseStreamRangeBound(rest[1], false); err != nil {
+			return resp.NewError(err.Error())
+		}
+		n, err := strconv.ParseInt(string(rest[2].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		if n <= 0 {
+			return resp.NewArray([]resp.Value{})
+		}
+		count = clampInt(n)
+		if len(rest) == 4 {
+			consumer = string(rest[3].Bulk)
+		}
+	}
+
+	stream, errReply := lookupGroupStream(db, key, group)
+	if errReply != nil {
+		return *errReply
+	}
+
+	if len(rest) == 0 {
+		total, first, last, consumers, _ := stream.PendingSummary(group)
+		if total == 0 {
+			return resp.NewArray([]resp.Value{resp.NewInteger(0), resp.NewNullBulkString(), resp.NewNullBulkString(), resp.NewNullArray()})
+		}
+		perConsumer := make([]resp.Value, len(consumers))
+		for i, c := range consumers {
+			perConsumer[i] = bulkStrings([]string{c.Name, strconv.Itoa(c.Pending)})
+		}
+		return resp.NewArray([]resp.Value{
+			resp.NewInteger(int64(total)),
+			resp.NewBulkString([]byte(first.String())),
+			resp.NewBulkString([]byte(last.String())),
+			resp.NewArray(perConsumer),
+		})
+	}
+
+	now := time.Now()
+	pending, _ := stream.Pending(group, start, end, count, consumer, minIdle, now)
+	result := make([]resp.Value, len(pending))
+	for i, pe := range pending {
+		result[i] = resp.NewArray([]resp.Value{
+			resp.NewBulkString([]byte(pe.ID.String())),
+			resp.NewBulkString([]byte(pe.Consumer)),
+			resp.NewInteger(now.Sub(pe.DeliveryTime).Milliseconds()),
+			resp.NewInteger(pe.DeliveryCount),
+		})
+	}
+	return resp.NewArray(result)
+}
+
+// parseMinIdle parses the min-idle-time argument of XCLAIM and XAUTOCLAIM,
+// where negative values count as 0.
+func parseMinIdle(arg resp.Value, name string) (time.Duration, *resp.Value) {
+	ms, err := strconv.ParseInt(string(arg.Bulk), 10, 64)
+	if err != nil {
+		reply := resp.NewError("ERR Invalid min-idle-time argument for " + name)
+		return 0, &reply
+	}
+	return time.Duration(max(min(ms, math.MaxInt64/int64(time.Millisecond)), 0)) * time.Millisecond, nil
+}
+
+// claimedReply builds the entries, or only their IDs, claimed by XCLAIM and
+// XAUTOCLAIM.
+func claimedReply(claimed []database.StreamEntry, justID bool) resp.Value {
+	if !justID {
+		return streamEntriesReply(claimed)
+	}
+	ids := make([]resp.Value, len(claimed))
+	for i, e := range claimed {
+		ids[i] = resp.NewBulkString([]byte(e.ID.String()))
+	}
+	return resp.NewArray(ids)
+}
+
+func XClaimCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		return resp.NewError("ERR wrong number of arguments for 'xclaim' command")
+	}
+	key, group, consumer := string(args[0].Bulk), string(args[1].Bulk), string(args[2].Bulk)
+	minIdle, errReply := parseMinIdle(args[3], "XCLAIM")
+	if errReply != nil {
+		return *errReply
+	}
+
+	i := 4
+	var ids []database.StreamID
+	for ; i < len(args); i++ {
+		id, ok := database.ParseStreamID(string(args[i].Bulk), 0)
+		if !ok {
+			break
+		}
+		ids = append(ids, id)
+	}
+	if len(ids) == 0 {
+		return resp.NewError(errInvalidStreamID.Error())
+	}
+
+	now := time.Now()
+	opts := database.ClaimOptions{MinIdle: minIdle, RetryCount: -1}
+	for ; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		remaining := len(args) - i - 1
+		switch {
+		case option == "FORCE":
+			opts.Force = true
+		case option == "JUSTID":
+			opts.JustID = true
+		case (option == "IDLE" || option == "TIME" || option == "RETRYCOUNT") && remaining >= 1:
+			i++
+			n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+			if err != nil {
+				return resp.NewError(fmt.Sprintf("ERR Invalid %s option argument for XCLAIM", option))
+			}
+			switch option {
+			case "IDLE":
+				opts.DeliveryTime = now.Add(-time.Duration(max(min(n, math.MaxInt64/int64(time.Millisecond)), 0)) * time.Millisecond)
+			case "TIME":
+				opts.DeliveryTime = time.UnixMilli(n)
+			default:
+				opts.RetryCount = max(n, 0)
+			}
+		case option == "LASTID" && remaining >= 1:
+			i++
+			id, err := parseStreamID(args[i], 0)
+			if err != nil {
+				return resp.NewError(err.Error())
+			}
+			opts.LastID = id
+		default:
+			return resp.NewError(fmt.Sprintf("ERR Unrecognized XCLAIM option '%s'", string(args[i].Bulk)))
+		}
+	}
+
+	stream, errReply := lookupGroupStream(db, key, group)
+	if errReply != nil {
+		return *errReply
+	}
+	before, _ := stream.GroupInfo(group)
+	claimed, deleted, _ := stream.Claim(group, consumer, ids, opts, now)
+	after, _ := stream.GroupInfo(group)
+	if len(claimed) > 0 || len(deleted) > 0 || after.LastID != before.LastID {
+		db.Notify(database.NotifyInternal, "xclaim", key)
+	}
+	return claimedReply(claimed, opts.JustID)
+}
+
+// expandXClaim propagates XCLAIM as one forced XCLAIM per claimed entry
+// with its resulting delivery time and count, so a replay does not depend
+// on idle times. IDs it no longer finds pending are propagated as an XACK,
+// and a LASTID as an XGROUP SETID.
+func expandXClaim(db *database.Database, args []resp.Value, reply resp.Value) []Propagation {
+	key, group, consumer := string(args[0].Bulk), string(args[1].Bulk), string(args[2].Bulk)
+	val, ok := db.Peek(key)
+	if !ok {
+		return nil
+	}
+	stream := val.(*database.Stream)
+
+	claimed := make(map[string]bool)
+	var cmds []Propagation
+	for _, r := range reply.Array {
+		id := r
+		if r.Type == resp.ArrayType {
+			id = r.Array[0]
+		}
+		claimed[string(id.Bulk)] = true
+		cmds = append(cmds, claimEntryPropagation(stream, key, group, consumer, id))
+	}
+
+	var dropped []resp.Value
+	i := 4
+	for ; i < len(args); i++ {
+		id, isID := database.ParseStreamID(string(args[i].Bulk), 0)
+		if !isID {
+			break
+		}
+		if pending, _ := stream.Pending(group, id, id, 1, "", 0, time.Now()); !claimed[string(args[i].Bulk)] && len(pending) == 0 {
+			dropped = append(dropped, args[i])
+		}
+	}
+	lastID := false
+	for ; i < len(args); i++ {
+		lastID = lastID || strings.EqualFold(string(args[i].Bulk), "LASTID")
+	}
+	if len(dropped) > 0 {
+		cmds = append(cmds, Propagation{Name: "XACK", Args: append([]resp.Value{args[0], args[1]}, dropped...)})
+	}
+	if info, ok := stream.GroupInfo(group); ok && lastID {
+		cmds = append(cmds, setIDPropagation(key, info))
+	}
+	return cmds
+}
+
+// claimEntryPropagation builds the forced XCLAIM of one claimed entry.
+func claimEntryPropagation(stream *database.Stream, key, group, consumer string, id resp.Value) Propagation {
+	sid, _ := database.ParseStreamID(string(id.Bulk), 0)
+	pending, _ := stream.Pending(group, sid, sid, 1, "", 0, time.Now())
+	pe := database.PendingEntry{DeliveryTime: time.Now(), DeliveryCount: 1}
+	if len(pending) == 1 {
+		pe = pending[0]
+	}
+	return claimPropagation(key, group, consumer, []resp.Value{id}, pe)
+}
+
+func XAutoClaimCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 5 {
+		return resp.NewError("ERR wrong number of arguments for 'xautoclaim' command")
+	}
+	key, group, consumer := string(args[0].Bulk), string(args[1].Bulk), string(args[2].Bulk)
+	minIdle, errReply := parseMinIdle(args[3], "XAUTOCLAIM")
+	if errReply != nil {
+		return *errReply
+	}
+	start, err := parseStreamRangeBound(args[4], true)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	count := 100
+	justID := false
+	for i := 5; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch {
+		case option == "JUSTID":
+			justID = true
+		case option == "COUNT" && i+1 < len(args):
+			i++
+			n, err := strconv.ParseInt(string(args[i].Bulk), 10, 64)
+			if err != nil {
+				return resp.NewError("ERR value is not an integer or out of range")
+			}
+			if n < 1 || n > math.MaxInt32/10 {
+				return resp.NewError("ERR COUNT must be > 0")
+			}
+			count = int(n)
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+	}
+
+	stream, errReply := lookupGroupStream(db, key, group)
+	if errReply != nil {
+		return *errReply
+	}
+	now := time.Now()
+	if created, _ := stream.CreateConsumer(group, consumer, now); created {
+		db.Notify(database.NotifyStream, "xgroup-createconsumer", key)
+	}
+	next, claimed, deleted, _ := stream.AutoClaim(group, consumer, minIdle, start, count, justID, now)
+	if len(claimed) > 0 || len(deleted) > 0 {
+		db.Notify(database.NotifyInternal, "xautoclaim", key)
+	}
+
+	deletedIDs := make([]resp.Value, len(deleted))
+	for i, id := range deleted {
+		deletedIDs[i] = resp.NewBulkString([]byte(id.String()))
+	}
+	return resp.NewArray([]resp.Value{
+		resp.NewBulkString([]byte(next.String())),
+		claimedReply(claimed, justID),
+		resp.NewArray(deletedIDs),
+	})
+}
+
+// expandXAutoClaim propagates XAUTOCLAIM as the forced XCLAIM of each entry
+// it claimed and an XACK of the deleted entries it dropped.
+func expandXAutoClaim(db *database.Database, args []resp.Value, reply resp.Value) []Propagation {
+	key, group, consumer := string(args[0].Bulk), string(args[1].Bulk), string(args[2].Bulk)
+	val, ok := db.Peek(key)
+	if !ok {
+		return nil
+	}
+	stream := val.(*database.Stream)
+
+	cmds := []Propagation{createConsumerPropagation(key, group, consumer)}
+	for _, r := range reply.Array[1].Array {
+		id := r
+		if r.Type == resp.ArrayType {
+			id = r.Array[0]
+		}
+		cmds = append(cmds, claimEntryPropagation(stream, key, group, consumer, id))
+	}
+	if deleted := reply.Array[2].Array; len(deleted) > 0 {
+		cmds = append(cmds, Propagation{Name: "XACK", Args: append([]resp.Value{args[0], args[1]}, deleted...)})
+	}
+	return cmds
+}
+
+func XInfoCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) == 0 {
+		return resp.NewError("ERR wrong number of arguments for 'xinfo' command")
+	}
+	sub := strings.ToUpper(string(args[0].Bulk))
+	switch {
+	case sub == "STREAM" && len(args) >= 2:
+	case sub == "GROUPS" && len(args) == 2:
+	case sub == "CONSUMERS" && len(args) == 3:
+	case sub == "STREAM" || sub == "GROUPS" || sub == "CONSUMERS":
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for 'xinfo|%s' command", strings.ToLower(sub)))
+	default:
+		return resp.NewError(fmt.Sprintf("ERR unknown subcommand '%s'. Try XINFO HELP.", string(args[0].Bulk)))
+	}
+	key := string(args[1].Bulk)
+	stream, ok := lookupStream(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if stream == nil {
+		return resp.NewError("ERR no such key")
+	}
+
+	now := time.Now()
+	switch sub {
+	case "GROUPS":
+		groups := stream.Groups()
+		result := make([]resp.Value, len(groups))
+		for i, g := range groups {
+			result[i] = resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte("name")), resp.NewBulkString([]byte(g.Name)),
+				resp.NewBulkString([]byte("consumers")), resp.NewInteger(int64(g.Consumers)),
+				resp.NewBulkString([]byte("pending")), resp.NewInteger(int64(g.Pending)),
+				resp.NewBulkString([]byte("last-delivered-id")), resp.NewBulkString([]byte(g.LastID.String())),
+				resp.NewBulkString([]byte("entries-read")), optionalInteger(g.EntriesRead),
+				resp.NewBulkString([]byte("lag")), optionalInteger(g.Lag),
+			})
+		}
+		return resp.NewArray(result)
+	case "CONSUMERS":
+		group := string(args[2].Bulk)
+		consumers, ok := stream.Consumers(group)
+		if !ok {
+			return resp.NewError(fmt.Sprintf("NOGROUP No such consumer group '%s' for key name '%s'", group, key))
+		}
+		result := make([]resp.Value, len(consumers))
+		for i, c := range consumers {
+			inactive := int64(-1)
+			if !c.ActiveTime.IsZero() {
+				inactive = now.Sub(c.ActiveTime).Milliseconds()
+			}
+			result[i] = resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte("name")), resp.NewBulkString([]byte(c.Name)),
+				resp.NewBulkString([]byte("pending")), resp.NewInteger(int64(c.Pending)),
+				resp.NewBulkString([]byte("idle")), resp.NewInteger(now.Sub(c.SeenTime).Milliseconds()),
+				resp.NewBulkString([]byte("inactive")), resp.NewInteger(inactive),
+			})
+		}
+		return resp.NewArray(result)
+	}
+
+	if len(args) == 2 {
+		return xinfoStream(stream)
+	}
+	count := 10
+	rest := args[2:]
+	if strings.ToUpper(string(rest[0].Bulk)) != "FULL" || (len(rest) != 1 && len(rest) != 3) {
+		return resp.NewError("ERR syntax error")
+	}
+	if len(rest) == 3 {
+		if strings.ToUpper(string(rest[1].Bulk)) != "COUNT" {
+			return resp.NewError("ERR syntax error")
+		}
+		n, err := strconv.ParseInt(string(rest[2].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		count = clampInt(max(n, 0))
+	}
+	return xinfoStreamFull(stream, count, now)
+}
+
+// optionalInteger replies n, or nil when it is negative, for the
+// entries-read and lag counters that may be unknown.
+func optionalInteger(n int64) resp.Value {
+	if n < 0 {
+		return resp.NewNullBulkString()
+	}
+	return resp.NewInteger(n)
+}
+
+// xinfoStreamHeader builds the fields XINFO STREAM starts with, in both
+// forms.
+func xinfoStreamHeader(info database.StreamInfo) []resp.Value {
+	return []resp.Value{
+		resp.NewBulkString([]byte("length")), resp.NewInteger(int64(info.Length)),
+		resp.NewBulkString([]byte("radix-tree-keys")), resp.NewInteger(int64(info.Nodes)),
+		resp.NewBulkString([]byte("radix-tree-nodes")), resp.NewInteger(int64(info.Nodes)),
+		resp.NewBulkString([]byte("last-generated-id")), resp.NewBulkString([]byte(info.LastID.String())),
+		resp.NewBulkString([]byte("max-deleted-entry-id")), resp.NewBulkString([]byte(info.MaxDeletedID.String())),
+		resp.NewBulkString([]byte("entries-added")), resp.NewInteger(int64(info.EntriesAdded)),
+		resp.NewBulkString([]byte("recorded-first-entry-id")), resp.NewBulkString([]byte(info.FirstID.String())),
+	}
+}
+
+func xinfoStream(stream *database.Stream) resp.Value {
+	info := stream.Info()
+	entry := func(e *database.StreamEntry) resp.Value {
+		if e == nil {
+			return resp.NewNullBulkString()
+		}
+		return streamEntriesReply([]database.StreamEntry{*e}).Array[0]
+	}
+	fields := append(xinfoStreamHeader(info),
+		resp.NewBulkString([]byte("groups")), resp.NewInteger(int64(info.Groups)),
+		resp.NewBulkString([]byte("first-entry")), entry(info.FirstEntry),
+		resp.NewBulkString([]byte("last-entry")), entry(info.LastEntry),
+	)
+	return resp.NewArray(fields)
+}
+
+// xinfoStreamFull builds XINFO STREAM FULL, listing up to count entries and
+// pending entries of each group and consumer, all when count is 0.
+func xinfoStreamFull(stream *database.Stream, count int, now time.Time) resp.Value {
+	groups := stream.Groups()
+	groupValues := make([]resp.Value, len(groups))
+	for i, g := range groups {
+		pending, _ := stream.Pending(g.Name, database.StreamID{}, database.MaxStreamID, count, "", 0, now)
+		pel := make([]resp.Value, len(pending))
+		for j, pe := range pending {
+			pel[j] = resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte(pe.ID.String())),
+				resp.NewBulkString([]byte(pe.Consumer)),
+				resp.NewInteger(pe.DeliveryTime.UnixMilli()),
+				resp.NewInteger(pe.DeliveryCount),
+			})
+		}
+
+		consumers, _ := stream.Consumers(g.Name)
+		consumerValues := make([]resp.Value, len(consumers))
+		for j, c := range consumers {
+			pending, _ := stream.Pending(g.Name, database.StreamID{}, database.MaxStreamID, count, c.Name, 0, now)
+			cpel := make([]resp.Value, len(pending))
+			for k, pe := range pending {
+				cpel[k] = resp.NewArray([]resp.Value{
+					resp.NewBulkString([]byte(pe.ID.String())),
+					resp.NewInteger(pe.DeliveryTime.UnixMilli()),
+					resp.NewInteger(pe.DeliveryCount),
+				})
+			}
+			activeTime := int64(-1)
+			if !c.ActiveTime.IsZero() {
+				activeTime = c.ActiveTime.UnixMilli()
+			}
+			consumerValues[j] = resp.NewArray([]resp.Value{
+				resp.NewBulkString([]byte("name")), resp.NewBulkString([]byte(c.Name)),
+				resp.NewBulkString([]byte("seen-time")), resp.NewInteger(c.SeenTime.UnixMilli()),
+				resp.NewBulkString([]byte("active-time")), resp.NewInteger(activeTime),
+				resp.NewBulkString([]byte("pel-count")), resp.NewInteger(int64(c.Pending)),
+				resp.NewBulkString([]byte("pending")), resp.NewArray(cpel),
+			})
+		}
+
+		groupValues[i] = resp.NewArray([]resp.Value{
+			resp.NewBulkString([]byte("name")), resp.NewBulkString([]byte(g.Name)),
+			resp.NewBulkString([]byte("last-delivered-id")), resp.NewBulkString([]byte(g.LastID.String())),
+			resp.NewBulkString([]byte("entries-read")), optionalInteger(g.EntriesRead),
+			resp.NewBulkString([]byte("lag")), optionalInteger(g.Lag),
+			resp.NewBulkString([]byte("pel-count")), resp.NewInteger(int64(g.Pending)),
+			resp.NewBulkString([]byte("pending")), resp.NewArray(pel),
+			resp.NewBulkString([]byte("consumers")), resp.NewArray(consumerValues),
+		})
+	}
+
+	fields := append(xinfoStreamHeader(stream.Info()),
+		resp.NewBulkString([]byte("entries")), streamEntriesReply(stream.Range(database.StreamID{}, database.MaxStreamID, count, false)),
+		resp.NewBulkString([]byte("groups")), resp.NewArray(groupValues),
+	)
+	return resp.NewArray(fields)
+}
@@ -0,0 +1,128 @@
+package command
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// pendingWithoutIdle returns the ID, consumer and delivery count of each
+// entry of an extended XPENDING reply, leaving out the idle times.
+func pendingWithoutIdle(v resp.Value) []string {
+	var out []string
+	for _, e := range v.Array {
+		out = append(out, string(e.Array[0].Bulk), string(e.Array[1].Bulk), flatten(e.Array[3])[0])
+	}
+	return out
+}
+
+func TestXReadGroupDeliversEachEntryOnce(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM"), "OK")
+	expectError(t, run(p, "XGROUP", "CREATE", "s", "g", "$"), "XGROUP CREATE of an existing group")
+	run(p, "XADD", "s", "1-1", "f", "a")
+	run(p, "XADD", "s", "2-1", "f", "b")
+
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "1", "STREAMS", "s", ">"), "s", "1-1", "f", "a")
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">"), "s", "2-1", "f", "b")
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">"), "<nil>")
+	expectReply(t, run(p, "XPENDING", "s", "g"), "2", "1-1", "2-1", "alice", "1", "bob", "1")
+
+	expectReply(t, run(p, "XACK", "s", "g", "1-1", "9-9"), "1")
+	expectReply(t, run(p, "XACK", "s", "g", "1-1"), "0")
+	expectReply(t, run(p, "XPENDING", "s", "g"), "1", "2-1", "2-1", "bob", "1")
+
+	expectError(t, run(p, "XREADGROUP", "GROUP", "nogroup", "c", "STREAMS", "s", ">"), "XREADGROUP of a missing group")
+	expectError(t, run(p, "XREADGROUP", "GROUP", "g", "c", "STREAMS", "s", "$"), "XREADGROUP with $")
+}
+
+func TestXReadGroupHistory(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	run(p, "XADD", "s", "1-1", "f", "a")
+	run(p, "XADD", "s", "2-1", "f", "b")
+	run(p, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+
+	// Rereading its pending entries counts as another delivery.
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"), "s", "1-1", "f", "a", "2-1", "f", "b")
+	got := pendingWithoutIdle(run(p, "XPENDING", "s", "g", "-", "+", "10", "alice"))
+	expectStrings(t, got, "1-1", "alice", "2", "2-1", "alice", "2")
+
+	// A pending entry deleted from the stream reads back as nil.
+	run(p, "XDEL", "s", "1-1")
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", "0"), "s", "1-1", "<nil>", "2-1", "f", "b")
+	// Another consumer has no history.
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", "0"), "s")
+}
+
+func TestXReadGroupNoAck(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	run(p, "XADD", "s", "1-1", "f", "a")
+	expectReply(t, run(p, "XREADGROUP", "GROUP", "g", "alice", "NOACK", "STREAMS", "s", ">"), "s", "1-1", "f", "a")
+	expectReply(t, run(p, "XPENDING", "s", "g"), "0", "<nil>", "<nil>", "<nil>")
+}
+
+func TestXReadGroupBlocks(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "XGROUP", "CREATE", "s", "g", "$", "MKSTREAM")
+	_, first := block(t, p, "XREADGROUP", "GROUP", "g", "alice", "BLOCK", "0", "STREAMS", "s", ">")
+	_, second := block(t, p, "XREADGROUP", "GROUP", "g", "bob", "BLOCK", "0", "STREAMS", "s", ">")
+
+	run(p, "XADD", "s", "1-1", "f", "a")
+	expectReply(t, await(t, first), "s", "1-1", "f", "a")
+	run(p, "XADD", "s", "2-1", "f", "b")
+	expectReply(t, await(t, second), "s", "2-1", "f", "b")
+}
+
+func TestXClaimAndXAutoClaim(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		run(p, "XADD", "s", id, "f", id)
+	}
+	run(p, "XREADGROUP", "GROUP", "g", "alice", "STREAMS", "s", ">")
+
+	expectReply(t, run(p, "XCLAIM", "s", "g", "bob", "3600000", "1-1"))
+	expectReply(t, run(p, "XCLAIM", "s", "g", "bob", "0", "1-1"), "1-1", "f", "1-1")
+	expectReply(t, run(p, "XCLAIM", "s", "g", "bob", "0", "2-1", "JUSTID"), "2-1")
+
+	run(p, "XDEL", "s", "3-1")
+	// The deleted entry is dropped from the PEL instead of being claimed.
+	expectReply(t, run(p, "XAUTOCLAIM", "s", "g", "carol", "0", "0", "COUNT", "10"),
+		"0-0", "1-1", "f", "1-1", "2-1", "f", "2-1", "3-1")
+	// JUSTID claims do not count as deliveries.
+	got := pendingWithoutIdle(run(p, "XPENDING", "s", "g", "-", "+", "10"))
+	expectStrings(t, got, "1-1", "carol", "3", "2-1", "carol", "2")
+}
+
+func TestConsumerGroupPropagationReplays(t *testing.T) {
+	p := newTestProcessor()
+	propagated := recordPropagation(p)
+	run(p, "XGROUP", "CREATE", "s", "g", "0", "MKSTREAM")
+	for _, id := range []string{"1-1", "2-1", "3-1"} {
+		run(p, "XADD", "s", id, "f", id)
+	}
+	run(p, "XREADGROUP", "GROUP", "g", "alice", "COUNT", "2", "STREAMS", "s", ">")
+	run(p, "XREADGROUP", "GROUP", "g", "bob", "STREAMS", "s", ">")
+	run(p, "XACK", "s", "g", "1-1")
+	run(p, "XCLAIM", "s", "g", "bob", "0", "2-1")
+
+	replica := newTestProcessor()
+	for _, cmd := range propagated() {
+		if v := replica.Process(commandValue(strings.Fields(cmd)...)); v.Type == resp.ErrorType {
+			t.Fatalf("replaying %q: %s", cmd, v.Str)
+		}
+	}
+	for _, args := range [][]string{
+		{"XPENDING", "s", "g"},
+		{"XRANGE", "s", "-", "+"},
+	} {
+		expectStrings(t, flatten(replica.Process(commandValue(args...))), flatten(run(p, args...))...)
+	}
+	expectStrings(t, pendingWithoutIdle(replica.Process(commandValue("XPENDING", "s", "g", "-", "+", "10"))),
+		pendingWithoutIdle(run(p, "XPENDING", "s", "g", "-", "+", "10"))...)
+	// The group's last delivered ID was replicated too.
+	expectReply(t, replica.Process(commandValue("XREADGROUP", "GROUP", "g", "carol", "STREAMS", "s", ">")), "<nil>")
+}
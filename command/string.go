@@ -0,0 +1,751 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// longDoublePrec matches the 64-bit mantissa of the x87 long double Redis
+// uses for INCRBYFLOAT, so sums round the same way.
+const longDoublePrec = 64
+
+func IncrCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'incr' command")
+	}
+	return incrDecrBy(db, string(args[0].Bulk), 1)
+}
+
+func DecrCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'decr' command")
+	}
+	return incrDecrBy(db, string(args[0].Bulk), -1)
+}
+
+func IncrByCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'incrby' command")
+	}
+	delta, ok := parseStrictInt64(string(args[1].Bulk))
+	if !ok {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	return incrDecrBy(db, string(args[0].Bulk), delta)
+}
+
+func DecrByCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'decrby' command")
+	}
+	delta, ok := parseStrictInt64(string(args[1].Bulk))
+	if !ok {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	if delta == math.MinInt64 {
+		return resp.NewError("ERR decrement would overflow")
+	}
+	return incrDecrBy(db, string(args[0].Bulk), -delta)
+}
+
+func incrDecrBy(db *database.Database, key string, delta int64) resp.Value {
+	current := int64(0)
+	val, ok := db.Get(key)
+	var str *database.String
+	if ok {
+		existing, isString := val.(*database.String)
+		if !isString {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		n, valid := parseStrictInt64(existing.Get())
+		if !valid {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		current = n
+		str = existing
+	}
+
+	if (delta < 0 && current < 0 && delta < math.MinInt64-current) ||
+		(delta > 0 && current > 0 && delta > math.MaxInt64-current) {
+		return resp.NewError("ERR increment or decrement would overflow")
+	}
+	current += delta
+
+	newVal := strconv.FormatInt(current, 10)
+	if str == nil {
+		db.Set(key, database.NewString(newVal), 0)
+	} else {
+		str.Set(newVal)
+	}
+	db.Notify(database.NotifyString, "incrby", key)
+	return resp.NewInteger(current)
+}
+
+func IncrByFloatCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'incrbyfloat' command")
+	}
+	key := string(args[0].Bulk)
+
+	incr, ok := parseLongDouble(string(args[1].Bulk))
+	if !ok {
+		return resp.NewError("ERR value is not a valid float")
+	}
+
+	current := new(big.Float).SetPrec(longDoublePrec)
+	val, exists := db.Get(key)
+	var str *database.String
+	if exists {
+		existing, isString := val.(*database.String)
+		if !isString {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		n, valid := parseLongDouble(existing.Get())
+		if !valid {
+			return resp.NewError("ERR value is not a valid float")
+		}
+		current = n
+		str = existing
+	}
+
+	if current.IsInf() || incr.IsInf() {
+		return resp.NewError("ERR increment would produce NaN or Infinity")
+	}
+	current.Add(current, incr)
+	if current.MantExp(nil) > 16384 {
+		return resp.NewError("ERR increment would produce NaN or Infinity")
+	}
+
+	newVal := formatLongDouble(current)
+	if str == nil {
+		db.Set(key, database.NewString(newVal), 0)
+	} else {
+		str.Set(newVal)
+	}
+	db.Notify(database.NotifyString, "incrbyfloat", key)
+	return resp.NewBulkString([]byte(newVal))
+}
+
+// rewriteIncrByFloat propagates INCRBYFLOAT as SET of the resulting value, so
+// replaying the AOF or CDC feed cannot drift because of float rounding.
+func rewriteIncrByFloat(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	return "SET", []resp.Value{args[0], reply, resp.NewBulkString([]byte("KEEPTTL"))}
+}
+
+// parseStrictInt64 accepts only canonical base-10 integers, the same inputs as
+// Redis's string2ll: no sign other than '-', no leading zeros or spaces.
+func parseStrictInt64(s string) (int64, bool) {
+	if len(s) == 0 || len(s) > 20 || s[0] == '+' || (len(s) > 1 && s[0] == '0') ||
+		strings.HasPrefix(s, "-0") {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, false
+	}
+	return n, true
+}
+
+func parseLongDouble(s string) (*big.Float, bool) {
+	if len(s) == 0 || len(s) > 5*1024 || strings.TrimSpace(s) != s {
+		return nil, false
+	}
+	f, _, err := big.ParseFloat(s, 10, longDoublePrec, big.ToNearestEven)
+	if err != nil {
+		return nil, false
+	}
+	return f, true
+}
+
+// formatLongDouble prints f like Redis's human-readable long double format:
+// fixed point with 17 decimals, trailing zeros and a bare '.' removed.
+func formatLongDouble(f *big.Float) string {
+	s := f.Text('f', 17)
+	if strings.Contains(s, ".") {
+		s = strings.TrimRight(s, "0")
+		s = strings.TrimSuffix(s, ".")
+	}
+	if s == "-0" {
+		s = "0"
+	}
+	return s
+}
+
+const maxStringSize = 512 * 1024 * 1024
+
+// lookupString returns the string stored at key, or nil if the key does not
+// exist. ok is false when the key holds another type.
+func lookupString(db *database.Database, key string) (str *database.String, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	str, ok = val.(*database.String)
+	return str, ok
+}
+
+func AppendCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'append' command")
+	}
+	key := string(args[0].Bulk)
+	value := string(args[1].Bulk)
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+
+	var newLen int
+	if str == nil {
+		db.Set(key, database.NewString(value), 0)
+		newLen = len(value)
+	} else {
+		if str.Len()+len(value) > maxStringSize {
+			return resp.NewError("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+		}
+		newLen = str.Append(value)
+	}
+	db.Notify(database.NotifyString, "append", key)
+	return resp.NewInteger(int64(newLen))
+}
+
+func StrLenCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'strlen' command")
+	}
+	str, ok := lookupString(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return resp.NewInteger(0)
+	}
+	return resp.NewInteger(int64(str.Len()))
+}
+
+func GetRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'getrange' command")
+	}
+	start, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	end, err := strconv.ParseInt(string(args[2].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+
+	str, ok := lookupString(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return resp.NewBulkString([]byte{})
+	}
+	return resp.NewBulkString([]byte(str.GetRange(clampInt(start), clampInt(end))))
+}
+
+func SetRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'setrange' command")
+	}
+	key := string(args[0].Bulk)
+	offset, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	if err != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	if offset < 0 {
+		return resp.NewError("ERR offset is out of range")
+	}
+	value := string(args[2].Bulk)
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if len(value) == 0 {
+		if str == nil {
+			return resp.NewInteger(0)
+		}
+		return resp.NewInteger(int64(str.Len()))
+	}
+	if offset+int64(len(value)) > maxStringSize {
+		return resp.NewError("ERR string exceeds maximum allowed size (proto-max-bulk-len)")
+	}
+
+	if str == nil {
+		str = database.NewString("")
+		db.Set(key, str, 0)
+	}
+	newLen := str.SetRange(int(offset), value)
+	db.Notify(database.NotifyString, "setrange", key)
+	return resp.NewInteger(int64(newLen))
+}
+
+// LcsCommand implements LCS key1 key2 [LEN] [IDX] [MINMATCHLEN len]
+// [WITHMATCHLEN]. Matches are reported from the end of the strings, as Redis
+// does.
+func LcsCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'lcs' command")
+	}
+
+	getLen, getIdx, withMatchLen := false, false, false
+	minMatchLen := int64(0)
+	for i := 2; i < len(args); i++ {
+		switch strings.ToUpper(string(args[i].Bulk)) {
+		case "LEN":
+			getLen = true
+		case "IDX":
+			getIdx = true
+		case "WITHMATCHLEN":
+			withMatchLen = true
+		case "MINMATCHLEN":
+			if i+1 >= len(args) {
+				return resp.NewError("ERR syntax error")
+			}
+			n, err := strconv.ParseInt(string(args[i+1].Bulk), 10, 64)
+			if err != nil {
+				return resp.NewError("ERR value is not an integer or out of range")
+			}
+			if n < 0 {
+				n = 0
+			}
+			minMatchLen = n
+			i++
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+	}
+	if getLen && getIdx {
+		return resp.NewError("ERR If you want both the length and indexes, please just use IDX.")
+	}
+
+	var a, b string
+	for i, dst := range []*string{&a, &b} {
+		str, ok := lookupString(db, string(args[i].Bulk))
+		if !ok {
+			return resp.NewError("ERR The specified keys must contain string values")
+		}
+		if str != nil {
+			*dst = str.Get()
+		}
+	}
+
+	if uint64(len(a)+1)*uint64(len(b)+1) > maxStringSize/4 {
+		return resp.NewError("ERR Insufficient memory, transient memory for LCS exceeds proto-max-bulk-len")
+	}
+
+	// lcs[i][j] is the length of the LCS of a[:i] and b[:j].
+	width := len(b) + 1
+	lcs := make([]uint32, (len(a)+1)*width)
+	at := func(i, j int) uint32 { return lcs[i*width+j] }
+	for i := 1; i <= len(a); i++ {
+		for j := 1; j <= len(b); j++ {
+			switch {
+			case a[i-1] == b[j-1]:
+				lcs[i*width+j] = at(i-1, j-1) + 1
+			case at(i-1, j) > at(i, j-1):
+				lcs[i*width+j] = at(i-1, j)
+			default:
+				lcs[i*width+j] = at(i, j-1)
+			}
+		}
+	}
+
+	total := int(at(len(a), len(b)))
+	if getLen {
+		return resp.NewInteger(int64(total))
+	}
+
+	result := make([]byte, total)
+	matches := make([]resp.Value, 0)
+	idx := total
+	aStart, aEnd, bStart, bEnd := len(a), 0, 0, 0
+	i, j := len(a), len(b)
+	for i > 0 && j > 0 {
+		emit := false
+		if a[i-1] == b[j-1] {
+			result[idx-1] = a[i-1]
+			if aStart == len(a) {
+				aStart, aEnd = i-1, i-1
+				bStart, bEnd = j-1, j-1
+			} else if aStart == i && bStart == j {
+				aStart--
+				bStart--
+			} else {
+				emit = true
+			}
+			if aStart == 0 || bStart == 0 {
+				emit = true
+			}
+			idx--
+			i--
+			j--
+		} else {
+			if at(i-1, j) > at(i, j-1) {
+				i--
+			} else {
+				j--
+			}
+			if aStart != len(a) {
+				emit = true
+			}
+		}
+
+		if emit {
+			matchLen := aEnd - aStart + 1
+			if getIdx && (minMatchLen == 0 || int64(matchLen) >= minMatchLen) {
+				match := []resp.Value{
+					resp.NewArray([]resp.Value{resp.NewInteger(int64(aStart)), resp.NewInteger(int64(aEnd))}),
+					resp.NewArray([]resp.Value{resp.NewInteger(int64(bStart)), resp.NewInteger(int64(bEnd))}),
+				}
+				if withMatchLen {
+					match = append(match, resp.NewInteger(int64(matchLen)))
+				}
+				matches = append(matches, resp.NewArray(match))
+			}
+			aStart = len(a)
+		}
+	}
+
+	if getIdx {
+		return resp.NewArray([]resp.Value{
+			resp.NewBulkString([]byte("matches")),
+			resp.NewArray(matches),
+			resp.NewBulkString([]byte("len")),
+			resp.NewInteger(int64(total)),
+		})
+	}
+	return resp.NewBulkString(result)
+}
+
+// clampInt converts a parsed 64-bit argument to int, saturating on platforms
+// where int is narrower.
+func clampInt(n int64) int {
+	if n > math.MaxInt {
+		return math.MaxInt
+	}
+	if n < math.MinInt {
+		return math.MinInt
+	}
+	return int(n)
+}
+
+type setOptions struct {
+	nx, xx   bool
+	get      bool
+	keepTTL  bool
+	expireAt time.Time
+}
+
+// parseSetOptions parses the trailing options of SET: NX, XX, GET, KEEPTTL and
+// one of EX, PX, EXAT or PXAT.
+func parseSetOptions(args []resp.Value, cmdName string) (setOptions, error) {
+	var opts setOptions
+	hasExpire := false
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch option {
+		case "NX":
+			if opts.xx {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.nx = true
+		case "XX":
+			if opts.nx {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.xx = true
+		case "GET":
+			opts.get = true
+		case "KEEPTTL":
+			if hasExpire {
+				return opts, errors.New("ERR syntax error")
+			}
+			opts.keepTTL = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if hasExpire || opts.keepTTL || i+1 >= len(args) {
+				return opts, errors.New("ERR syntax error")
+			}
+			at, err := parseExpireOption(option, string(args[i+1].Bulk), cmdName)
+			if err != nil {
+				return opts, err
+			}
+			opts.expireAt = at
+			hasExpire = true
+			i++
+		default:
+			return opts, fmt.Errorf("ERR unknown option '%s' for 'SET' command", option)
+		}
+	}
+	return opts, nil
+}
+
+// parseExpireOption converts the argument of EX, PX, EXAT or PXAT into an
+// absolute expiry with millisecond precision.
+func parseExpireOption(option, arg, cmdName string) (time.Time, error) {
+	n, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil {
+		return time.Time{}, errors.New("ERR value is not an integer or out of range")
+	}
+	invalid := fmt.Errorf("ERR invalid expire time in '%s' command", cmdName)
+	if n <= 0 {
+		return time.Time{}, invalid
+	}
+
+	millis := n
+	if option == "EX" || option == "EXAT" {
+		if n > math.MaxInt64/1000 {
+			return time.Time{}, invalid
+		}
+		millis = n * 1000
+	}
+	if option == "EX" || option == "PX" {
+		now := time.Now().UnixMilli()
+		if millis > math.MaxInt64-now {
+			return time.Time{}, invalid
+		}
+		millis += now
+	}
+	return time.UnixMilli(millis), nil
+}
+
+func setGeneric(db *database.Database, key, value string, opts setOptions) resp.Value {
+	val, exists := db.Get(key)
+	oldValue := resp.NewNullBulkString()
+	if opts.get && exists {
+		str, isString := val.(*database.String)
+		if !isString {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		oldValue = resp.NewBulkString([]byte(str.Get()))
+	}
+
+	if (opts.nx && exists) || (opts.xx && !exists) {
+		if opts.get {
+			return oldValue
+		}
+		return resp.NewNullBulkString()
+	}
+
+	if opts.keepTTL {
+		db.SetKeepTTL(key, database.NewString(value))
+	} else {
+		db.SetExpireAt(key, database.NewString(value), opts.expireAt)
+	}
+	db.Notify(database.NotifyString, "set", key)
+	if !opts.expireAt.IsZero() {
+		db.Notify(database.NotifyGeneric, "expire", key)
+	}
+
+	if opts.get {
+		return oldValue
+	}
+	return resp.NewSimpleString("OK")
+}
+
+// rewriteSet propagates SET and its variants as a plain SET carrying the
+// absolute expiry, so replay does not restart relative TTLs. The value is
+// the argument at valueIndex.
+func rewriteSet(valueIndex int) RewriteFunc {
+	return func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+		cmd := []resp.Value{args[0], args[valueIndex]}
+		if at, ok := db.ExpireTime(string(args[0].Bulk)); ok && !at.IsZero() {
+			cmd = append(cmd,
+				resp.NewBulkString([]byte("PXAT")),
+				resp.NewBulkString([]byte(strconv.FormatInt(at.UnixMilli(), 10))))
+		}
+		return "SET", cmd
+	}
+}
+
+func SetNXCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'setnx' command")
+	}
+	reply := setGeneric(db, string(args[0].Bulk), string(args[1].Bulk), setOptions{nx: true})
+	if reply.Type == resp.SimpleStringType {
+		return resp.NewInteger(1)
+	}
+	return resp.NewInteger(0)
+}
+
+func SetEXCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setExGeneric(db, args, "EX", "setex")
+}
+
+func PSetEXCommand(db *database.Database, args []resp.Value) resp.Value {
+	return setExGeneric(db, args, "PX", "psetex")
+}
+
+func setExGeneric(db *database.Database, args []resp.Value, unit, cmdName string) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", cmdName))
+	}
+	at, err := parseExpireOption(unit, string(args[1].Bulk), cmdName)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return setGeneric(db, string(args[0].Bulk), string(args[2].Bulk), setOptions{expireAt: at})
+}
+
+func GetSetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 2 {
+		return resp.NewError("ERR wrong number of arguments for 'getset' command")
+	}
+	return setGeneric(db, string(args[0].Bulk), string(args[1].Bulk), setOptions{get: true})
+}
+
+func GetDelCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 1 {
+		return resp.NewError("ERR wrong number of arguments for 'getdel' command")
+	}
+	key := string(args[0].Bulk)
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return resp.NewNullBulkString()
+	}
+	value := str.Get()
+	db.Delete(key)
+	db.Notify(database.NotifyGeneric, "del", key)
+	return resp.NewBulkString([]byte(value))
+}
+
+// GetExCommand implements GETEX key [EX|PX|EXAT|PXAT time | PERSIST].
+func GetExCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'getex' command")
+	}
+	key := string(args[0].Bulk)
+
+	var expireAt time.Time
+	persist := false
+	for i := 1; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch option {
+		case "PERSIST":
+			if !expireAt.IsZero() || persist {
+				return resp.NewError("ERR syntax error")
+			}
+			persist = true
+		case "EX", "PX", "EXAT", "PXAT":
+			if !expireAt.IsZero() || persist || i+1 >= len(args) {
+				return resp.NewError("ERR syntax error")
+			}
+			at, err := parseExpireOption(option, string(args[i+1].Bulk), "getex")
+			if err != nil {
+				return resp.NewError(err.Error())
+			}
+			expireAt = at
+			i++
+		default:
+			return resp.NewError("ERR syntax error")
+		}
+	}
+
+	str, ok := lookupString(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if str == nil {
+		return resp.NewNullBulkString()
+	}
+	value := resp.NewBulkString([]byte(str.Get()))
+
+	switch {
+	case !expireAt.IsZero() && !expireAt.After(time.Now()):
+		db.Delete(key)
+		db.Notify(database.NotifyGeneric, "del", key)
+	case !expireAt.IsZero():
+		db.ExpireAt(key, expireAt)
+		db.Notify(database.NotifyGeneric, "expire", key)
+	case persist:
+		if db.Persist(key) {
+			db.Notify(database.NotifyGeneric, "persist", key)
+		}
+	}
+	return value
+}
+
+// rewriteGetEx propagates GETEX with the absolute expiry it applied, or as DEL
+// when the new expiry was already in the past.
+func rewriteGetEx(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	at, ok := db.ExpireTime(string(args[0].Bulk))
+	switch {
+	case !ok:
+		return "DEL", args[:1]
+	case at.IsZero():
+		return "GETEX", []resp.Value{args[0], resp.NewBulkString([]byte("PERSIST"))}
+	}
+	return "GETEX", []resp.Value{
+		args[0],
+		resp.NewBulkString([]byte("PXAT")),
+		resp.NewBulkString([]byte(strconv.FormatInt(at.UnixMilli(), 10))),
+	}
+}
+
+func rewriteAsDel(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+	return "DEL", args[:1]
+}
+
+func MGetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 {
+		return resp.NewError("ERR wrong number of arguments for 'mget' command")
+	}
+	result := make([]resp.Value, len(args))
+	for i, arg := range args {
+		result[i] = resp.NewNullBulkString()
+		if val, ok := db.Get(string(arg.Bulk)); ok {
+			if str, isString := val.(*database.String); isString {
+				result[i] = resp.NewBulkString([]byte(str.Get()))
+			}
+		}
+	}
+	return resp.NewArray(result)
+}
+
+// MSetCommand sets every pair atomically: writes run under the processor's
+// exclusive lock, so no client observes a partial MSET.
+func MSetCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return resp.NewError("ERR wrong number of arguments for 'mset' command")
+	}
+	msetPairs(db, args)
+	return resp.NewSimpleString("OK")
+}
+
+func MSetNXCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 || len(args)%2 != 0 {
+		return resp.NewError("ERR wrong number of arguments for 'msetnx' command")
+	}
+	for i := 0; i < len(args); i += 2 {
+		if db.Exists(string(args[i].Bulk)) {
+			return resp.NewInteger(0)
+		}
+	}
+	msetPairs(db, args)
+	return resp.NewInteger(1)
+}
+
+func msetPairs(db *database.Database, args []resp.Value) {
+	for i := 0; i < len(args); i += 2 {
+		key := string(args[i].Bulk)
+		db.Set(key, database.NewString(string(args[i+1].Bulk)), 0)
+		db.Notify(database.NotifyString, "set", key)
+	}
+}
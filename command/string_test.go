@@ -0,0 +1,200 @@
+package command
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIncrDecr(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "INCR", "n"), "1")
+	expectReply(t, run(p, "INCRBY", "n", "41"), "42")
+	expectReply(t, run(p, "DECR", "n"), "41")
+	expectReply(t, run(p, "DECRBY", "n", "-9"), "50")
+	expectReply(t, run(p, "GET", "n"), "50")
+
+	run(p, "SET", "max", "9223372036854775807")
+	expectError(t, run(p, "INCR", "max"), "INCR past the largest int64")
+	expectError(t, run(p, "DECRBY", "n", "-9223372036854775808"), "DECRBY of the smallest int64")
+	expectReply(t, run(p, "GET", "max"), "9223372036854775807")
+
+	for _, value := range []string{" 1", "01", "+1", "1.0", ""} {
+		run(p, "SET", "bad", value)
+		expectError(t, run(p, "INCR", "bad"), "INCR of "+value)
+	}
+	expectError(t, run(p, "INCRBY", "n", "1 "), "INCRBY with a trailing space")
+	run(p, "RPUSH", "list", "a")
+	expectError(t, run(p, "INCR", "list"), "INCR of a list")
+}
+
+func TestIncrKeepsTTL(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "n", "1", "EX", "100")
+	run(p, "INCR", "n")
+	run(p, "INCRBYFLOAT", "n", "0.5")
+	if at, _ := p.db.ExpireTime("n"); at.IsZero() {
+		t.Fatal("INCR or INCRBYFLOAT removed the key's TTL")
+	}
+}
+
+func TestIncrByFloat(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "INCRBYFLOAT", "f", "10.5"), "10.5")
+	expectReply(t, run(p, "INCRBYFLOAT", "f", "0.1"), "10.6")
+	expectReply(t, run(p, "INCRBYFLOAT", "f", "-5"), "5.6")
+	run(p, "SET", "e", "5.0e3")
+	expectReply(t, run(p, "INCRBYFLOAT", "e", "2.0e2"), "5200")
+
+	expectError(t, run(p, "INCRBYFLOAT", "f", "inf"), "INCRBYFLOAT by inf")
+	expectError(t, run(p, "INCRBYFLOAT", "f", "abc"), "INCRBYFLOAT by abc")
+	expectReply(t, run(p, "GET", "f"), "5.6")
+}
+
+func TestIncrByFloatPropagatesSet(t *testing.T) {
+	p := newTestProcessor()
+	propagated := recordPropagation(p)
+	run(p, "INCRBYFLOAT", "f", "0.1")
+	run(p, "INCRBYFLOAT", "f", "0.2")
+	want := []string{"SET f 0.1 KEEPTTL", "SET f 0.3 KEEPTTL"}
+	expectStrings(t, propagated(), want...)
+}
+
+func TestAppendAndRanges(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "APPEND", "s", "Hello"), "5")
+	expectReply(t, run(p, "APPEND", "s", " World"), "11")
+	expectReply(t, run(p, "STRLEN", "s"), "11")
+	expectReply(t, run(p, "STRLEN", "missing"), "0")
+
+	expectReply(t, run(p, "GETRANGE", "s", "0", "4"), "Hello")
+	expectReply(t, run(p, "GETRANGE", "s", "-5", "-1"), "World")
+	expectReply(t, run(p, "GETRANGE", "s", "-100", "2"), "Hel")
+	expectReply(t, run(p, "GETRANGE", "s", "5", "2"), "")
+	expectReply(t, run(p, "GETRANGE", "s", "20", "30"), "")
+	expectReply(t, run(p, "GETRANGE", "missing", "0", "-1"), "")
+
+	expectReply(t, run(p, "SETRANGE", "s", "6", "Redis"), "11")
+	expectReply(t, run(p, "GET", "s"), "Hello Redis")
+	// Writing past the end pads with zero bytes.
+	expectReply(t, run(p, "SETRANGE", "pad", "3", "x"), "4")
+	expectReply(t, run(p, "GET", "pad"), "\x00\x00\x00x")
+	// An empty value neither creates the key nor changes it.
+	expectReply(t, run(p, "SETRANGE", "none", "5", ""), "0")
+	expectReply(t, run(p, "EXISTS", "none"), "0")
+	expectError(t, run(p, "SETRANGE", "s", "-1", "x"), "SETRANGE at a negative offset")
+	expectError(t, run(p, "SETRANGE", "s", "536870911", "xx"), "SETRANGE past 512MB")
+}
+
+func TestLcs(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "key1", "ohmytext")
+	run(p, "SET", "key2", "mynewtext")
+	expectReply(t, run(p, "LCS", "key1", "key2"), "mytext")
+	expectReply(t, run(p, "LCS", "key1", "key2", "LEN"), "6")
+	expectReply(t, run(p, "LCS", "key1", "key2", "IDX"), "matches", "4", "7", "5", "8", "2", "3", "0", "1", "len", "6")
+	expectReply(t, run(p, "LCS", "key1", "key2", "IDX", "MINMATCHLEN", "4", "WITHMATCHLEN"), "matches", "4", "7", "5", "8", "4", "len", "6")
+	expectReply(t, run(p, "LCS", "key1", "missing"), "")
+	expectError(t, run(p, "LCS", "key1", "key2", "LEN", "IDX"), "LCS with LEN and IDX")
+	run(p, "RPUSH", "list", "a")
+	expectError(t, run(p, "LCS", "key1", "list"), "LCS of a list")
+}
+
+func TestSetOptions(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "SET", "k", "a", "XX"), "<nil>")
+	expectReply(t, run(p, "SET", "k", "a", "NX"), "OK")
+	expectReply(t, run(p, "SET", "k", "b", "NX", "GET"), "a")
+	expectReply(t, run(p, "SET", "k", "b", "XX", "GET"), "a")
+	expectReply(t, run(p, "GET", "k"), "b")
+	expectReply(t, run(p, "SET", "new", "v", "GET"), "<nil>")
+
+	expectError(t, run(p, "SET", "k", "v", "NX", "XX"), "SET NX XX")
+	expectError(t, run(p, "SET", "k", "v", "EX", "10", "PX", "100"), "SET with two expiries")
+	expectError(t, run(p, "SET", "k", "v", "EX", "10", "KEEPTTL"), "SET EX KEEPTTL")
+	expectError(t, run(p, "SET", "k", "v", "EX", "0"), "SET EX 0")
+	expectError(t, run(p, "SET", "k", "v", "PX", "abc"), "SET PX abc")
+	run(p, "RPUSH", "list", "a")
+	expectError(t, run(p, "SET", "list", "v", "GET"), "SET GET of a list")
+}
+
+func TestSetKeepTTL(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "k", "a", "EX", "100")
+	run(p, "SET", "k", "b", "KEEPTTL")
+	if at, _ := p.db.ExpireTime("k"); at.IsZero() {
+		t.Fatal("SET KEEPTTL removed the TTL")
+	}
+	run(p, "SET", "k", "c")
+	if at, _ := p.db.ExpireTime("k"); !at.IsZero() {
+		t.Fatal("a plain SET kept the TTL")
+	}
+}
+
+func TestSetPropagatesAbsoluteExpiry(t *testing.T) {
+	p := newTestProcessor()
+	propagated := recordPropagation(p)
+	run(p, "SET", "a", "1", "EX", "100")
+	run(p, "SETEX", "b", "100", "2")
+	run(p, "SET", "c", "3", "NX")
+	run(p, "SET", "c", "4", "NX")
+
+	cmds := propagated()
+	if len(cmds) != 3 {
+		t.Fatalf("propagated %q, want three SETs", cmds)
+	}
+	for i, prefix := range []string{"SET a 1 PXAT ", "SET b 2 PXAT "} {
+		if !strings.HasPrefix(cmds[i], prefix) {
+			t.Fatalf("propagated %q, want %s<ms>", cmds[i], prefix)
+		}
+	}
+	if cmds[2] != "SET c 3" {
+		t.Fatalf("SET NX propagated as %q, want SET c 3", cmds[2])
+	}
+}
+
+func TestGetExAndGetDel(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "SET", "k", "v")
+	expectReply(t, run(p, "GETEX", "k", "EX", "100"), "v")
+	if at, _ := p.db.ExpireTime("k"); at.IsZero() {
+		t.Fatal("GETEX EX did not set a TTL")
+	}
+	expectReply(t, run(p, "GETEX", "k", "PERSIST"), "v")
+	if at, _ := p.db.ExpireTime("k"); !at.IsZero() {
+		t.Fatal("GETEX PERSIST kept the TTL")
+	}
+	expectReply(t, run(p, "GETEX", "missing", "EX", "100"), "<nil>")
+
+	expectReply(t, run(p, "GETDEL", "k"), "v")
+	expectReply(t, run(p, "EXISTS", "k"), "0")
+	expectReply(t, run(p, "GETDEL", "k"), "<nil>")
+}
+
+func TestMultiKeyStrings(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "MSET", "a", "1", "b", "2"), "OK")
+	run(p, "RPUSH", "list", "x")
+	expectReply(t, run(p, "MGET", "a", "missing", "list", "b"), "1", "<nil>", "<nil>", "2")
+
+	// MSETNX sets nothing if any key exists.
+	expectReply(t, run(p, "MSETNX", "c", "3", "a", "9"), "0")
+	expectReply(t, run(p, "MGET", "a", "c"), "1", "<nil>")
+	expectReply(t, run(p, "MSETNX", "c", "3", "d", "4"), "1")
+	expectReply(t, run(p, "MGET", "c", "d"), "3", "4")
+	expectError(t, run(p, "MSET", "a", "1", "b"), "MSET with an odd number of arguments")
+}
+
+func TestKeyMissOnlyForReads(t *testing.T) {
+	p := newTestProcessor()
+	var misses []string
+	p.db.AddKeyspaceListener(func(class int, event, key string) {
+		if event == "keymiss" {
+			misses = append(misses, key)
+		}
+	})
+	run(p, "GET", "a")
+	run(p, "INCR", "b")
+	run(p, "APPEND", "c", "x")
+	run(p, "MGET", "d", "b")
+	expectStrings(t, misses, "a", "d")
+}
@@ -0,0 +1,988 @@
+package command
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// lookupZSet returns the sorted set stored at key, or nil when the key does
+// not exist. ok is false when the key holds another type.
+func lookupZSet(db *database.Database, key string) (zset *database.ZSet, ok bool) {
+	val, exists := db.Get(key)
+	if !exists {
+		return nil, true
+	}
+	zset, ok = val.(*database.ZSet)
+	return zset, ok
+}
+
+// errWrongType is the WRONGTYPE reply as an error, for helpers that return
+// errors.
+var errWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+// zaddGeneric applies score/member pairs to the sorted set at key for ZADD
+// and ZINCRBY. It replies with the new score in INCR mode, or nil when a
+// flag prevented the increment, and otherwise with the number of members
+// added, plus those updated when ch is set.
+func zaddGeneric(db *database.Database, key string, pairs []resp.Value, flags int, ch bool) resp.Value {
+	scores := make([]float64, len(pairs)/2)
+	for i := range scores {
+		score, err := strconv.ParseFloat(string(pairs[2*i].Bulk), 64)
+		if err != nil || math.IsNaN(score) {
+			return resp.NewError("ERR value is not a valid float")
+		}
+		scores[i] = score
+	}
+
+	zset, ok := lookupZSet(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	incr := flags&database.ZAddIncr != 0
+	if zset == nil {
+		if flags&database.ZAddXX != 0 {
+			if incr {
+				return resp.NewNullBulkString()
+			}
+			return resp.NewInteger(0)
+		}
+		zset = database.NewZSet()
+		db.Set(key, zset, 0)
+	}
+
+	var added, updated int
+	var newScore float64
+	processed := false
+	for i, score := range scores {
+		result, outcome, err := zset.ZAddFlags(score, string(pairs[2*i+1].Bulk), flags)
+		if err != nil {
+			return resp.NewError("ERR " + err.Error())
+		}
+		switch outcome {
+		case database.ZAddAdded:
+			added++
+		case database.ZAddUpdated:
+			updated++
+		}
+		if outcome != database.ZAddSkipped {
+			newScore, processed = result, true
+		}
+	}
+
+	if added+updated > 0 {
+		event := "zadd"
+		if incr {
+			event = "zincr"
+		}
+		db.Notify(database.NotifyZSet, event, key)
+	}
+	if incr {
+		if !processed {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewBulkString([]byte(formatFloat(newScore)))
+	}
+	if ch {
+		return resp.NewInteger(int64(added + updated))
+	}
+	return resp.NewInteger(int64(added))
+}
+
+func ZIncrByCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zincrby' command")
+	}
+	return zaddGeneric(db, string(args[0].Bulk), args[1:], database.ZAddIncr, false)
+}
+
+// zsetReply encodes members, each followed by its score when withScores is
+// set.
+func zsetReply(members []database.ZSetMember, withScores bool) resp.Value {
+	result := make([]resp.Value, 0, len(members)*2)
+	for _, m := range members {
+		result = append(result, resp.NewBulkString([]byte(m.Member)))
+		if withScores {
+			result = append(result, resp.NewBulkString([]byte(formatFloat(m.Score))))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+// parseScoreRange parses the min and max arguments of the BYSCORE commands.
+func parseScoreRange(min, max resp.Value) (database.ScoreRange, error) {
+	var r database.ScoreRange
+	var err1, err2 error
+	r.Min, r.MinEx, err1 = parseScoreBound(string(min.Bulk))
+	r.Max, r.MaxEx, err2 = parseScoreBound(string(max.Bulk))
+	if err1 != nil || err2 != nil {
+		return r, errors.New("ERR min or max is not a float")
+	}
+	return r, nil
+}
+
+// parseLexRange parses the min and max arguments of the BYLEX commands:
+// "-", "+", or a member prefixed with "[" (inclusive) or "(" (exclusive).
+// empty reports a "+" minimum or "-" maximum, which no member satisfies.
+func parseLexRange(min, max resp.Value) (r database.LexRange, empty bool, err error) {
+	var okMin, okMax bool
+	r.Min, r.MinEx, r.MinInf, okMin = parseLexBound(string(min.Bulk), "-")
+	r.Max, r.MaxEx, r.MaxInf, okMax = parseLexBound(string(max.Bulk), "+")
+	if !okMin || !okMax {
+		return r, false, errors.New("ERR min or max not valid string range item")
+	}
+	return r, string(min.Bulk) == "+" || string(max.Bulk) == "-", nil
+}
+
+// parseLexBound parses one BYLEX bound. infinite reports that s is inf, the
+// unbounded end on its side.
+func parseLexBound(s, inf string) (member string, exclusive, infinite, ok bool) {
+	switch {
+	case s == inf:
+		return "", false, true, true
+	case s == "-" || s == "+":
+		return "", false, false, true
+	case strings.HasPrefix(s, "["):
+		return s[1:], false, false, true
+	case strings.HasPrefix(s, "("):
+		return s[1:], true, false, true
+	}
+	return "", false, false, false
+}
+
+// Options accepted by the ZRANGE family, as flags of parseZRangeOptions.
+const (
+	zrangeBy = 1 << iota
+	zrangeRev
+	zrangeLimit
+	zrangeWithScores
+)
+
+// zrangeSpec describes one ZRANGE query: start and stop are ranks, scores or
+// members depending on by, given in the order of the command (max first for
+// the REV score and lex forms).
+type zrangeSpec struct {
+	start, stop resp.Value
+	by          string
+	reverse     bool
+	withScores  bool
+	limited     bool
+	offset      int
+	count       int
+}
+
+// parseZRangeOptions parses the options following "start stop" into spec,
+// accepting only those in allowed.
+func parseZRangeOptions(args []resp.Value, spec *zrangeSpec, allowed int) error {
+	for i := 0; i < len(args); i++ {
+		option := strings.ToUpper(string(args[i].Bulk))
+		switch {
+		case (option == "BYSCORE" || option == "BYLEX") && allowed&zrangeBy != 0:
+			spec.by = option
+		case option == "REV" && allowed&zrangeRev != 0:
+			spec.reverse = true
+		case option == "WITHSCORES" && allowed&zrangeWithScores != 0:
+			spec.withScores = true
+		case option == "LIMIT" && allowed&zrangeLimit != 0 && i+2 < len(args):
+			offset, err1 := strconv.ParseInt(string(args[i+1].Bulk), 10, 64)
+			count, err2 := strconv.ParseInt(string(args[i+2].Bulk), 10, 64)
+			if err1 != nil || err2 != nil {
+				return errors.New("ERR value is not an integer or out of range")
+			}
+			spec.limited = true
+			spec.offset, spec.count = clampInt(offset), clampInt(count)
+			i += 2
+		default:
+			return errors.New("ERR syntax error")
+		}
+	}
+	if spec.limited && spec.by == "" {
+		return errors.New("ERR syntax error, LIMIT is only supported in combination with either BYSCORE or BYLEX")
+	}
+	if spec.withScores && spec.by == "BYLEX" {
+		return errors.New("ERR syntax error, WITHSCORES not supported in combination with BYLEX")
+	}
+	return nil
+}
+
+// zrange runs spec against zset.
+func zrange(zset *database.ZSet, spec zrangeSpec) ([]database.ZSetMember, error) {
+	if !spec.limited {
+		spec.count = -1
+	}
+	min, max := spec.start, spec.stop
+	if spec.reverse {
+		min, max = max, min
+	}
+
+	switch spec.by {
+	case "BYSCORE":
+		r, err := parseScoreRange(min, max)
+		if err != nil {
+			return nil, err
+		}
+		if zset == nil {
+			return nil, nil
+		}
+		return zset.ZRangeByScore(r, spec.reverse, spec.offset, spec.count), nil
+	case "BYLEX":
+		r, empty, err := parseLexRange(min, max)
+		if err != nil {
+			return nil, err
+		}
+		if zset == nil || empty {
+			return nil, nil
+		}
+		return zset.ZRangeByLex(r, spec.reverse, spec.offset, spec.count), nil
+	}
+
+	start, err1 := strconv.ParseInt(string(spec.start.Bulk), 10, 64)
+	stop, err2 := strconv.ParseInt(string(spec.stop.Bulk), 10, 64)
+	if err1 != nil || err2 != nil {
+		return nil, errors.New("ERR value is not an integer or out of range")
+	}
+	if zset == nil {
+		return nil, nil
+	}
+	from, to, ok := listRange(start, stop, zset.ZCard())
+	if !ok {
+		return nil, nil
+	}
+	return zset.ZRange(from, to, spec.reverse), nil
+}
+
+// zrangeCommand looks up the sorted set at key and replies with the result
+// of spec.
+func zrangeCommand(db *database.Database, key string, spec zrangeSpec) resp.Value {
+	zset, ok := lookupZSet(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	members, err := zrange(zset, spec)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zsetReply(members, spec.withScores)
+}
+
+func ZRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zrange' command")
+	}
+	spec := zrangeSpec{start: args[1], stop: args[2]}
+	if err := parseZRangeOptions(args[3:], &spec, zrangeBy|zrangeRev|zrangeLimit|zrangeWithScores); err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zrangeCommand(db, string(args[0].Bulk), spec)
+}
+
+func ZRevRangeCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zrevrange' command")
+	}
+	spec := zrangeSpec{start: args[1], stop: args[2], reverse: true}
+	if err := parseZRangeOptions(args[3:], &spec, zrangeWithScores); err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zrangeCommand(db, string(args[0].Bulk), spec)
+}
+
+func ZRangeByScoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrangeByCommand(db, args, "BYSCORE", false, "zrangebyscore")
+}
+
+func ZRevRangeByScoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrangeByCommand(db, args, "BYSCORE", true, "zrevrangebyscore")
+}
+
+func ZRangeByLexCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrangeByCommand(db, args, "BYLEX", false, "zrangebylex")
+}
+
+func ZRevRangeByLexCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrangeByCommand(db, args, "BYLEX", true, "zrevrangebylex")
+}
+
+// zrangeByCommand implements the legacy ZRANGEBYSCORE and ZRANGEBYLEX
+// commands and their ZREV forms.
+func zrangeByCommand(db *database.Database, args []resp.Value, by string, reverse bool, name string) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	spec := zrangeSpec{start: args[1], stop: args[2], by: by, reverse: reverse}
+	allowed := zrangeLimit
+	if by == "BYSCORE" {
+		allowed |= zrangeWithScores
+	}
+	if err := parseZRangeOptions(args[3:], &spec, allowed); err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zrangeCommand(db, string(args[0].Bulk), spec)
+}
+
+func ZRangeStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 4 {
+		return resp.NewError("ERR wrong number of arguments for 'zrangestore' command")
+	}
+	dstKey := string(args[0].Bulk)
+	spec := zrangeSpec{start: args[2], stop: args[3]}
+	if err := parseZRangeOptions(args[4:], &spec, zrangeBy|zrangeRev|zrangeLimit); err != nil {
+		return resp.NewError(err.Error())
+	}
+	src, ok := lookupZSet(db, string(args[1].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	members, err := zrange(src, spec)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return storeZSet(db, dstKey, members, "zrangestore")
+}
+
+// storeZSet replaces the key at dstKey with a sorted set of members, or
+// deletes it when members is empty, and returns the size of the result.
+func storeZSet(db *database.Database, dstKey string, members []database.ZSetMember, event string) resp.Value {
+	if len(members) == 0 {
+		if db.Delete(dstKey) {
+			db.Notify(database.NotifyGeneric, "del", dstKey)
+		}
+		return resp.NewInteger(0)
+	}
+	dst := database.NewZSet()
+	for _, m := range members {
+		dst.ZAdd(m.Score, m.Member)
+	}
+	db.Set(dstKey, dst, 0)
+	db.Notify(database.NotifyZSet, event, dstKey)
+	return resp.NewInteger(int64(dst.ZCard()))
+}
+
+func ZRankCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrankGeneric(db, args, false, "zrank")
+}
+
+func ZRevRankCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zrankGeneric(db, args, true, "zrevrank")
+}
+
+func zrankGeneric(db *database.Database, args []resp.Value, reverse bool, name string) resp.Value {
+	if len(args) < 2 || len(args) > 3 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	withScore := false
+	if len(args) == 3 {
+		if strings.ToUpper(string(args[2].Bulk)) != "WITHSCORE" {
+			return resp.NewError("ERR syntax error")
+		}
+		withScore = true
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewNullBulkString()
+	}
+	member := string(args[1].Bulk)
+	rank, found := zset.ZRank(member, reverse)
+	if !found {
+		return resp.NewNullBulkString()
+	}
+	if !withScore {
+		return resp.NewInteger(int64(rank))
+	}
+	score, _ := zset.ZScore(member)
+	return resp.NewArray([]resp.Value{
+		resp.NewInteger(int64(rank)),
+		resp.NewBulkString([]byte(formatFloat(score))),
+	})
+}
+
+func ZCountCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zcount' command")
+	}
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewInteger(0)
+	}
+	return resp.NewInteger(int64(zset.ZCount(r)))
+}
+
+func ZLexCountCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zlexcount' command")
+	}
+	r, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil || empty {
+		return resp.NewInteger(0)
+	}
+	return resp.NewInteger(int64(zset.ZLexCount(r)))
+}
+
+func ZMScoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'zmscore' command")
+	}
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	result := make([]resp.Value, len(args)-1)
+	for i, arg := range args[1:] {
+		result[i] = resp.NewNullBulkString()
+		if zset == nil {
+			continue
+		}
+		if score, found := zset.ZScore(string(arg.Bulk)); found {
+			result[i] = resp.NewBulkString([]byte(formatFloat(score)))
+		}
+	}
+	return resp.NewArray(result)
+}
+
+func ZRandMemberCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 1 || len(args) > 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zrandmember' command")
+	}
+	withScores := false
+	var count int64
+	if len(args) > 1 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil {
+			return resp.NewError("ERR value is not an integer or out of range")
+		}
+		count = n
+		if len(args) == 3 {
+			if strings.ToUpper(string(args[2].Bulk)) != "WITHSCORES" {
+				return resp.NewError("ERR syntax error")
+			}
+			withScores = true
+			if count < -math.MaxInt64/2 {
+				return resp.NewError("ERR value is out of range")
+			}
+		}
+	}
+
+	zset, ok := lookupZSet(db, string(args[0].Bulk))
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		if len(args) == 1 {
+			return resp.NewNullBulkString()
+		}
+		return resp.NewArray([]resp.Value{})
+	}
+
+	card := zset.ZCard()
+	if len(args) == 1 {
+		i := rand.Intn(card)
+		return resp.NewBulkString([]byte(zset.ZRange(i, i, false)[0].Member))
+	}
+	all := zset.ZRange(0, card-1, false)
+	names := make([]string, len(all))
+	for i, m := range all {
+		names[i] = m.Member
+	}
+	picked := randomSample(names, count)
+	members := make([]database.ZSetMember, len(picked))
+	for i, member := range picked {
+		score, _ := zset.ZScore(member)
+		members[i] = database.ZSetMember{Member: member, Score: score}
+	}
+	return zsetReply(members, withScores)
+}
+
+// zsetSource is one input key of the aggregation commands: a sorted set, or
+// a plain set whose members all score 1. Both are nil for a missing key.
+type zsetSource struct {
+	zset   *database.ZSet
+	set    *database.Set
+	weight float64
+}
+
+func (s zsetSource) card() int {
+	switch {
+	case s.zset != nil:
+		return s.zset.ZCard()
+	case s.set != nil:
+		return s.set.SCard()
+	}
+	return 0
+}
+
+// members returns the members of the source with their unweighted scores.
+func (s zsetSource) members() []database.ZSetMember {
+	switch {
+	case s.zset != nil:
+		if card := s.zset.ZCard(); card > 0 {
+			return s.zset.ZRange(0, card-1, false)
+		}
+	case s.set != nil:
+		members := s.set.SMembers()
+		result := make([]database.ZSetMember, len(members))
+		for i, member := range members {
+			result[i] = database.ZSetMember{Member: member, Score: 1}
+		}
+		return result
+	}
+	return nil
+}
+
+func (s zsetSource) score(member string) (float64, bool) {
+	switch {
+	case s.zset != nil:
+		return s.zset.ZScore(member)
+	case s.set != nil:
+		return 1, s.set.SIsMember(member)
+	}
+	return 0, false
+}
+
+// weighted multiplies score by the source weight, treating 0 * inf as 0.
+func (s zsetSource) weighted(score float64) float64 {
+	score *= s.weight
+	if math.IsNaN(score) {
+		return 0
+	}
+	return score
+}
+
+// zsetOp is a parsed ZUNION, ZINTER or ZDIFF command.
+type zsetOp struct {
+	sources    []zsetSource
+	aggregate  string
+	withScores bool
+}
+
+// parseZSetOp parses "numkeys key ... [WEIGHTS weight ...] [AGGREGATE
+// SUM|MIN|MAX] [WITHSCORES]" and looks the keys up. ZDIFF accepts neither
+// WEIGHTS nor AGGREGATE, and the STORE forms do not accept WITHSCORES.
+func parseZSetOp(db *database.Database, args []resp.Value, name string, weights, withScores bool) (zsetOp, error) {
+	op := zsetOp{aggregate: "SUM"}
+	numKeys, err := strconv.ParseInt(string(args[0].Bulk), 10, 64)
+	if err != nil {
+		return op, errors.New("ERR value is not an integer or out of range")
+	}
+	if numKeys < 1 {
+		return op, fmt.Errorf("ERR at least 1 input key is needed for '%s' command", name)
+	}
+	if numKeys > int64(len(args)-1) {
+		return op, errors.New("ERR syntax error")
+	}
+	keys := args[1 : 1+numKeys]
+	op.sources = make([]zsetSource, len(keys))
+	for i := range op.sources {
+		op.sources[i].weight = 1
+	}
+
+	rest := args[1+numKeys:]
+	for i := 0; i < len(rest); i++ {
+		option := strings.ToUpper(string(rest[i].Bulk))
+		switch {
+		case option == "WEIGHTS" && weights && i+len(keys) < len(rest):
+			for j := range op.sources {
+				i++
+				w, err := strconv.ParseFloat(string(rest[i].Bulk), 64)
+				if err != nil || math.IsNaN(w) {
+					return op, errors.New("ERR weight value is not a float")
+				}
+				op.sources[j].weight = w
+			}
+		case option == "AGGREGATE" && weights && i+1 < len(rest):
+			i++
+			op.aggregate = strings.ToUpper(string(rest[i].Bulk))
+			if op.aggregate != "SUM" && op.aggregate != "MIN" && op.aggregate != "MAX" {
+				return op, errors.New("ERR syntax error")
+			}
+		case option == "WITHSCORES" && withScores:
+			op.withScores = true
+		default:
+			return op, errors.New("ERR syntax error")
+		}
+	}
+
+	for i, arg := range keys {
+		val, exists := db.Get(string(arg.Bulk))
+		if !exists {
+			continue
+		}
+		switch v := val.(type) {
+		case *database.ZSet:
+			op.sources[i].zset = v
+		case *database.Set:
+			op.sources[i].set = v
+		default:
+			return op, errWrongType
+		}
+	}
+	return op, nil
+}
+
+// aggregateScore combines two weighted scores of a member under AGGREGATE.
+// A SUM of opposite infinities is 0, as in Redis.
+func aggregateScore(aggregate string, acc, score float64) float64 {
+	switch aggregate {
+	case "MIN":
+		return math.Min(acc, score)
+	case "MAX":
+		return math.Max(acc, score)
+	}
+	if sum := acc + score; !math.IsNaN(sum) {
+		return sum
+	}
+	return 0
+}
+
+// run computes the union, intersection or difference of the sources, in
+// (score, member) order.
+func (op zsetOp) run(kind string) []database.ZSetMember {
+	result := database.NewZSet()
+	switch kind {
+	case "union":
+		scores := make(map[string]float64)
+		for _, src := range op.sources {
+			for _, m := range src.members() {
+				score := src.weighted(m.Score)
+				if acc, seen := scores[m.Member]; seen {
+					score = aggregateScore(op.aggregate, acc, score)
+				}
+				scores[m.Member] = score
+			}
+		}
+		for member, score := range scores {
+			result.ZAdd(score, member)
+		}
+	case "inter":
+		op.intersect(func(member string, score float64) bool {
+			result.ZAdd(score, member)
+			return true
+		})
+	case "diff":
+		for _, m := range op.sources[0].members() {
+			found := false
+			for _, other := range op.sources[1:] {
+				if _, found = other.score(m.Member); found {
+					break
+				}
+			}
+			if !found {
+				result.ZAdd(m.Score, m.Member)
+			}
+		}
+	}
+	if card := result.ZCard(); card > 0 {
+		return result.ZRange(0, card-1, false)
+	}
+	return nil
+}
+
+// intersect calls fn with each member present in every source and its
+// aggregated score, until fn returns false. It walks the smallest source and
+// looks its members up in the others.
+func (op zsetOp) intersect(fn func(member string, score float64) bool) {
+	sources := append([]zsetSource(nil), op.sources...)
+	sort.SliceStable(sources, func(i, j int) bool { return sources[i].card() < sources[j].card() })
+	if sources[0].card() == 0 {
+		return
+	}
+	for _, m := range sources[0].members() {
+		score := sources[0].weighted(m.Score)
+		inAll := true
+		for _, other := range sources[1:] {
+			s, found := other.score(m.Member)
+			if !found {
+				inAll = false
+				break
+			}
+			score = aggregateScore(op.aggregate, score, other.weighted(s))
+		}
+		if inAll && !fn(m.Member, score) {
+			return
+		}
+	}
+}
+
+func ZUnionCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpCommand(db, args, "union", "zunion")
+}
+
+func ZInterCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpCommand(db, args, "inter", "zinter")
+}
+
+func ZDiffCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpCommand(db, args, "diff", "zdiff")
+}
+
+func zsetOpCommand(db *database.Database, args []resp.Value, kind, name string) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	op, err := parseZSetOp(db, args, name, kind != "diff", true)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zsetReply(op.run(kind), op.withScores)
+}
+
+func ZUnionStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpStore(db, args, "union", "zunionstore")
+}
+
+func ZInterStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpStore(db, args, "inter", "zinterstore")
+}
+
+func ZDiffStoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zsetOpStore(db, args, "diff", "zdiffstore")
+}
+
+func zsetOpStore(db *database.Database, args []resp.Value, kind, name string) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	op, err := parseZSetOp(db, args[1:], name, kind != "diff", false)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return storeZSet(db, string(args[0].Bulk), op.run(kind), name)
+}
+
+func ZInterCardCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 2 {
+		return resp.NewError("ERR wrong number of arguments for 'zintercard' command")
+	}
+	numKeys, err := strconv.Atoi(string(args[0].Bulk))
+	if err != nil || numKeys <= 0 {
+		return resp.NewError("ERR numkeys should be greater than 0")
+	}
+	if numKeys > len(args)-1 {
+		return resp.NewError("ERR Number of keys can't be greater than number of args")
+	}
+	limit := 0
+	for rest := args[1+numKeys:]; len(rest) > 0; rest = rest[2:] {
+		if len(rest) < 2 || strings.ToUpper(string(rest[0].Bulk)) != "LIMIT" {
+			return resp.NewError("ERR syntax error")
+		}
+		n, err := strconv.Atoi(string(rest[1].Bulk))
+		if err != nil || n < 0 {
+			return resp.NewError("ERR LIMIT can't be negative")
+		}
+		limit = n
+	}
+
+	op, err := parseZSetOp(db, args[:1+numKeys], "zintercard", false, false)
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	count := 0
+	op.intersect(func(string, float64) bool {
+		count++
+		return limit == 0 || count < limit
+	})
+	return resp.NewInteger(int64(count))
+}
+
+// deleteIfEmptyZSet removes key once its sorted set has no members left.
+func deleteIfEmptyZSet(db *database.Database, key string, zset *database.ZSet) {
+	if zset.ZCard() == 0 && db.Delete(key) {
+		db.Notify(database.NotifyGeneric, "del", key)
+	}
+}
+
+// popZSet pops up to count members with the lowest scores, or the highest
+// when highest is set, from the sorted set at key.
+func popZSet(db *database.Database, key string, zset *database.ZSet, count int, highest bool) []database.ZSetMember {
+	popped := zset.ZPop(count, highest)
+	if len(popped) > 0 {
+		event := "zpopmin"
+		if highest {
+			event = "zpopmax"
+		}
+		db.Notify(database.NotifyZSet, event, key)
+		deleteIfEmptyZSet(db, key, zset)
+	}
+	return popped
+}
+
+func ZPopMinCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zpopGeneric(db, args, false, "zpopmin")
+}
+
+func ZPopMaxCommand(db *database.Database, args []resp.Value) resp.Value {
+	return zpopGeneric(db, args, true, "zpopmax")
+}
+
+func zpopGeneric(db *database.Database, args []resp.Value, highest bool, name string) resp.Value {
+	if len(args) < 1 || len(args) > 2 {
+		return resp.NewError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", name))
+	}
+	key := string(args[0].Bulk)
+	count := 1
+	if len(args) == 2 {
+		n, err := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+		if err != nil || n < 0 {
+			return resp.NewError("ERR value is out of range, must be positive")
+		}
+		count = clampInt(n)
+	}
+
+	zset, ok := lookupZSet(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewArray([]resp.Value{})
+	}
+	return zsetReply(popZSet(db, key, zset, count, highest), true)
+}
+
+// parseMinMax parses the MIN|MAX argument of ZMPOP, reporting true for MIN
+// to match the LEFT|RIGHT convention of parseMPop.
+func parseMinMax(arg resp.Value) (lowest bool, ok bool) {
+	switch strings.ToUpper(string(arg.Bulk)) {
+	case "MIN":
+		return true, true
+	case "MAX":
+		return false, true
+	}
+	return false, false
+}
+
+// zmpopReply builds the ZMPOP reply: the key and a [member, score] pair for
+// each popped member.
+func zmpopReply(key string, popped []database.ZSetMember) resp.Value {
+	pairs := make([]resp.Value, len(popped))
+	for i, m := range popped {
+		pairs[i] = zsetReply([]database.ZSetMember{m}, true)
+	}
+	return resp.NewArray([]resp.Value{resp.NewBulkString([]byte(key)), resp.NewArray(pairs)})
+}
+
+func ZMPopCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) < 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zmpop' command")
+	}
+	keys, lowest, count, errReply := parseMPop(args, parseMinMax)
+	if errReply != nil {
+		return *errReply
+	}
+
+	for _, key := range keys {
+		zset, ok := lookupZSet(db, key)
+		if !ok {
+			return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+		}
+		if zset == nil {
+			continue
+		}
+		return zmpopReply(key, popZSet(db, key, zset, count, !lowest))
+	}
+	return resp.NewNullArray()
+}
+
+// rewriteZMPop propagates ZMPOP and BZMPOP as the ZPOPMIN or ZPOPMAX of the
+// key they popped from.
+func rewriteZMPop(numKeysIndex int) RewriteFunc {
+	return func(db *database.Database, args []resp.Value, reply resp.Value) (string, []resp.Value) {
+		rest := args[numKeysIndex:]
+		numKeys, _ := strconv.Atoi(string(rest[0].Bulk))
+		lowest, _ := parseMinMax(rest[1+numKeys])
+		name := "ZPOPMAX"
+		if lowest {
+			name = "ZPOPMIN"
+		}
+		count := strconv.Itoa(len(reply.Array[1].Array))
+		return name, []resp.Value{reply.Array[0], resp.NewBulkString([]byte(count))}
+	}
+}
+
+func ZRemRangeByRankCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zremrangebyrank' command")
+	}
+	start, err1 := strconv.ParseInt(string(args[1].Bulk), 10, 64)
+	stop, err2 := strconv.ParseInt(string(args[2].Bulk), 10, 64)
+	if err1 != nil || err2 != nil {
+		return resp.NewError("ERR value is not an integer or out of range")
+	}
+	return zremRangeGeneric(db, args, "zremrangebyrank", func(zset *database.ZSet) int {
+		from, to, ok := listRange(start, stop, zset.ZCard())
+		if !ok {
+			return 0
+		}
+		return zset.ZRemRangeByRank(from, to)
+	})
+}
+
+func ZRemRangeByScoreCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zremrangebyscore' command")
+	}
+	r, err := parseScoreRange(args[1], args[2])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zremRangeGeneric(db, args, "zremrangebyscore", func(zset *database.ZSet) int {
+		return zset.ZRemRangeByScore(r)
+	})
+}
+
+func ZRemRangeByLexCommand(db *database.Database, args []resp.Value) resp.Value {
+	if len(args) != 3 {
+		return resp.NewError("ERR wrong number of arguments for 'zremrangebylex' command")
+	}
+	r, empty, err := parseLexRange(args[1], args[2])
+	if err != nil {
+		return resp.NewError(err.Error())
+	}
+	return zremRangeGeneric(db, args, "zremrangebylex", func(zset *database.ZSet) int {
+		if empty {
+			return 0
+		}
+		return zset.ZRemRangeByLex(r)
+	})
+}
+
+// zremRangeGeneric runs remove on the sorted set at args[0] and sends event
+// when it removed anything.
+func zremRangeGeneric(db *database.Database, args []resp.Value, event string, remove func(*database.ZSet) int) resp.Value {
+	key := string(args[0].Bulk)
+	zset, ok := lookupZSet(db, key)
+	if !ok {
+		return resp.NewError("WRONGTYPE Operation against a key holding the wrong kind of value")
+	}
+	if zset == nil {
+		return resp.NewInteger(0)
+	}
+	removed := remove(zset)
+	if removed > 0 {
+		db.Notify(database.NotifyZSet, event, key)
+		deleteIfEmptyZSet(db, key, zset)
+	}
+	return resp.NewInteger(int64(removed))
+}
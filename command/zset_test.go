@@ -0,0 +1,205 @@
+package command
+
+import (
+	"testing"
+	"time"
+)
+
+func TestZRangeByRankScoreAndLex(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	expectReply(t, run(p, "ZRANGE", "z", "0", "-1"), "a", "b", "c", "d")
+	expectReply(t, run(p, "ZRANGE", "z", "-2", "10", "WITHSCORES"), "c", "3", "d", "4")
+	expectReply(t, run(p, "ZRANGE", "z", "0", "1", "REV"), "d", "c")
+	expectReply(t, run(p, "ZREVRANGE", "z", "1", "2"), "c", "b")
+	expectReply(t, run(p, "ZRANGE", "z", "3", "1"))
+
+	expectReply(t, run(p, "ZRANGE", "z", "(1", "3", "BYSCORE"), "b", "c")
+	expectReply(t, run(p, "ZRANGE", "z", "+inf", "(1", "BYSCORE", "REV", "LIMIT", "1", "2"), "c", "b")
+	expectReply(t, run(p, "ZRANGE", "z", "-inf", "+inf", "BYSCORE", "LIMIT", "2", "-1"), "c", "d")
+	expectReply(t, run(p, "ZRANGEBYSCORE", "z", "2", "3", "WITHSCORES"), "b", "2", "c", "3")
+	expectReply(t, run(p, "ZREVRANGEBYSCORE", "z", "3", "-inf", "LIMIT", "0", "1"), "c")
+	expectReply(t, run(p, "ZRANGEBYSCORE", "z", "(2", "(3"))
+
+	run(p, "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d", "0", "e")
+	expectReply(t, run(p, "ZRANGE", "lex", "[b", "(d", "BYLEX"), "b", "c")
+	expectReply(t, run(p, "ZRANGEBYLEX", "lex", "-", "[c"), "a", "b", "c")
+	expectReply(t, run(p, "ZREVRANGEBYLEX", "lex", "+", "(c", "LIMIT", "1", "5"), "d")
+	expectReply(t, run(p, "ZRANGEBYLEX", "lex", "+", "-"))
+	expectReply(t, run(p, "ZLEXCOUNT", "lex", "(a", "[d"), "3")
+
+	expectError(t, run(p, "ZRANGE", "z", "0", "1", "LIMIT", "0", "1"), "ZRANGE LIMIT without BY")
+	expectError(t, run(p, "ZRANGE", "lex", "-", "+", "BYLEX", "WITHSCORES"), "ZRANGE BYLEX WITHSCORES")
+	expectError(t, run(p, "ZRANGEBYLEX", "lex", "b", "+"), "ZRANGEBYLEX with an unprefixed bound")
+	expectError(t, run(p, "ZRANGEBYSCORE", "z", "x", "1"), "ZRANGEBYSCORE x")
+	expectError(t, run(p, "ZREVRANGE", "z", "0", "1", "BYSCORE"), "ZREVRANGE BYSCORE")
+}
+
+func TestZRangeStore(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b", "3", "c")
+	expectReply(t, run(p, "ZRANGESTORE", "dst", "z", "2", "+inf", "BYSCORE"), "2")
+	expectReply(t, run(p, "ZRANGE", "dst", "0", "-1", "WITHSCORES"), "b", "2", "c", "3")
+	expectReply(t, run(p, "ZRANGESTORE", "dst", "z", "5", "10"), "0")
+	expectReply(t, run(p, "EXISTS", "dst"), "0")
+	expectError(t, run(p, "ZRANGESTORE", "dst", "z", "0", "1", "WITHSCORES"), "ZRANGESTORE WITHSCORES")
+}
+
+func TestZSetQueries(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b", "2", "c", "3.5", "d")
+	expectReply(t, run(p, "ZRANK", "z", "c"), "2")
+	expectReply(t, run(p, "ZREVRANK", "z", "c"), "1")
+	expectReply(t, run(p, "ZRANK", "z", "d", "WITHSCORE"), "3", "3.5")
+	expectReply(t, run(p, "ZRANK", "z", "x"), "<nil>")
+	expectReply(t, run(p, "ZRANK", "missing", "a"), "<nil>")
+	expectError(t, run(p, "ZRANK", "z", "a", "WITHSCORES"), "ZRANK WITHSCORES")
+
+	expectReply(t, run(p, "ZCOUNT", "z", "2", "+inf"), "3")
+	expectReply(t, run(p, "ZCOUNT", "z", "(2", "3.5"), "1")
+	expectReply(t, run(p, "ZCOUNT", "missing", "-inf", "+inf"), "0")
+	expectReply(t, run(p, "ZMSCORE", "z", "a", "x", "d"), "1", "<nil>", "3.5")
+	expectReply(t, run(p, "ZMSCORE", "missing", "a"), "<nil>")
+	expectReply(t, run(p, "ZCARD", "z"), "4")
+
+	expectReply(t, run(p, "ZRANDMEMBER", "missing"), "<nil>")
+	expectStrings(t, sortedReply(run(p, "ZRANDMEMBER", "z", "10")), "a", "b", "c", "d")
+	if got := flatten(run(p, "ZRANDMEMBER", "z", "-6", "WITHSCORES")); len(got) != 12 {
+		t.Fatalf("ZRANDMEMBER z -6 WITHSCORES returned %d elements, want 12", len(got))
+	}
+
+	run(p, "SET", "s", "v")
+	expectError(t, run(p, "ZRANGE", "s", "0", "-1"), "ZRANGE of a string")
+	expectError(t, run(p, "ZCOUNT", "s", "0", "1"), "ZCOUNT of a string")
+}
+
+func TestZAddFlags(t *testing.T) {
+	p := newTestProcessor()
+	expectReply(t, run(p, "ZADD", "z", "XX", "1", "a"), "0")
+	expectReply(t, run(p, "EXISTS", "z"), "0")
+	expectReply(t, run(p, "ZADD", "z", "1", "a", "2", "b"), "2")
+	expectReply(t, run(p, "ZADD", "z", "NX", "5", "a", "3", "c"), "1")
+	expectReply(t, run(p, "ZADD", "z", "XX", "CH", "5", "a", "9", "d"), "1")
+	expectReply(t, run(p, "ZADD", "z", "CH", "5", "a", "2", "b"), "0")
+
+	expectReply(t, run(p, "ZADD", "z", "GT", "CH", "4", "a", "6", "b"), "1")
+	expectReply(t, run(p, "ZADD", "z", "LT", "CH", "4", "a", "8", "b", "1", "e"), "2")
+	expectReply(t, run(p, "ZRANGE", "z", "0", "-1", "WITHSCORES"), "e", "1", "c", "3", "a", "4", "b", "6")
+
+	expectReply(t, run(p, "ZADD", "z", "INCR", "2.5", "a"), "6.5")
+	expectReply(t, run(p, "ZADD", "z", "GT", "INCR", "-1", "a"), "<nil>")
+	expectReply(t, run(p, "ZADD", "z", "NX", "INCR", "1", "a"), "<nil>")
+	expectReply(t, run(p, "ZADD", "z", "XX", "INCR", "1", "missing"), "<nil>")
+	expectReply(t, run(p, "ZINCRBY", "z", "-0.5", "a"), "6")
+	expectReply(t, run(p, "ZINCRBY", "z", "+inf", "a"), "inf")
+	expectError(t, run(p, "ZINCRBY", "z", "-inf", "a"), "ZINCRBY of inf by -inf")
+	expectReply(t, run(p, "ZSCORE", "z", "a"), "inf")
+
+	expectError(t, run(p, "ZADD", "z", "NX", "XX", "1", "a"), "ZADD NX XX")
+	expectError(t, run(p, "ZADD", "z", "GT", "LT", "1", "a"), "ZADD GT LT")
+	expectError(t, run(p, "ZADD", "z", "NX", "GT", "1", "a"), "ZADD NX GT")
+	expectError(t, run(p, "ZADD", "z", "INCR", "1", "a", "2", "b"), "ZADD INCR with two pairs")
+	expectError(t, run(p, "ZADD", "z", "1", "a", "2"), "ZADD with an odd number of arguments")
+	expectError(t, run(p, "ZADD", "z", "nan", "a"), "ZADD nan")
+	expectError(t, run(p, "ZADD", "z", "x", "a"), "ZADD x")
+}
+
+func TestZSetAggregation(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z1", "1", "one", "2", "two")
+	run(p, "ZADD", "z2", "1", "one", "2", "two", "3", "three")
+	expectReply(t, run(p, "ZUNION", "2", "z1", "z2", "WITHSCORES"), "one", "2", "three", "3", "two", "4")
+	expectReply(t, run(p, "ZINTER", "2", "z1", "z2", "WITHSCORES"), "one", "2", "two", "4")
+	expectReply(t, run(p, "ZDIFF", "2", "z2", "z1", "WITHSCORES"), "three", "3")
+	expectReply(t, run(p, "ZINTER", "2", "z1", "z2", "AGGREGATE", "MAX", "WITHSCORES"), "one", "1", "two", "2")
+	expectReply(t, run(p, "ZUNION", "2", "z1", "z2", "WEIGHTS", "2", "3", "AGGREGATE", "MIN", "WITHSCORES"), "one", "2", "two", "4", "three", "9")
+	expectReply(t, run(p, "ZINTER", "2", "z1", "missing"))
+
+	expectReply(t, run(p, "ZUNIONSTORE", "out", "2", "z1", "z2", "WEIGHTS", "2", "3"), "3")
+	expectReply(t, run(p, "ZRANGE", "out", "0", "-1", "WITHSCORES"), "one", "5", "three", "9", "two", "10")
+	expectReply(t, run(p, "ZINTERSTORE", "out", "2", "out", "z1"), "2")
+	expectReply(t, run(p, "ZRANGE", "out", "0", "-1", "WITHSCORES"), "one", "6", "two", "12")
+	expectReply(t, run(p, "ZDIFFSTORE", "out", "2", "z1", "z2"), "0")
+	expectReply(t, run(p, "EXISTS", "out"), "0")
+
+	// Plain sets count as sorted sets whose members all score 1.
+	run(p, "SADD", "s", "two", "four")
+	expectReply(t, run(p, "ZUNION", "2", "z1", "s", "WITHSCORES"), "four", "1", "one", "1", "two", "3")
+	// Opposite infinities sum to 0, and a zero weight of inf is 0.
+	run(p, "ZADD", "inf", "+inf", "one")
+	run(p, "ZADD", "-inf", "-inf", "one")
+	expectReply(t, run(p, "ZUNION", "2", "inf", "-inf", "WITHSCORES"), "one", "0")
+	expectReply(t, run(p, "ZUNION", "1", "inf", "WEIGHTS", "0", "WITHSCORES"), "one", "0")
+
+	expectReply(t, run(p, "ZINTERCARD", "2", "z1", "z2"), "2")
+	expectReply(t, run(p, "ZINTERCARD", "2", "z1", "z2", "LIMIT", "1"), "1")
+	expectError(t, run(p, "ZUNION", "0", "z1"), "ZUNION 0")
+	expectError(t, run(p, "ZUNION", "3", "z1", "z2"), "ZUNION with too few keys")
+	expectError(t, run(p, "ZDIFF", "2", "z1", "z2", "WEIGHTS", "1", "2"), "ZDIFF WEIGHTS")
+	expectError(t, run(p, "ZUNIONSTORE", "out", "2", "z1", "z2", "WITHSCORES"), "ZUNIONSTORE WITHSCORES")
+	expectError(t, run(p, "ZUNION", "2", "z1", "z2", "WEIGHTS", "1"), "ZUNION with too few weights")
+	expectError(t, run(p, "ZUNION", "1", "z1", "AGGREGATE", "AVG"), "ZUNION AGGREGATE AVG")
+	run(p, "SET", "str", "v")
+	expectError(t, run(p, "ZUNION", "2", "z1", "str"), "ZUNION with a string")
+	expectError(t, run(p, "ZINTERCARD", "1", "z1", "LIMIT", "-1"), "ZINTERCARD LIMIT -1")
+}
+
+func TestZPopAndZMPop(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d")
+	expectReply(t, run(p, "ZPOPMIN", "z"), "a", "1")
+	expectReply(t, run(p, "ZPOPMAX", "z", "2"), "d", "4", "c", "3")
+	expectReply(t, run(p, "ZPOPMIN", "z", "0"))
+	expectReply(t, run(p, "ZPOPMIN", "missing"))
+	expectError(t, run(p, "ZPOPMIN", "z", "-1"), "ZPOPMIN -1")
+
+	propagated := recordPropagation(p)
+	run(p, "ZADD", "y", "1", "x", "2", "y")
+	expectReply(t, run(p, "ZMPOP", "3", "missing", "y", "z", "MAX", "COUNT", "5"), "y", "y", "2", "x", "1")
+	expectReply(t, run(p, "EXISTS", "y"), "0")
+	expectReply(t, run(p, "ZMPOP", "1", "missing", "MIN"), "<nil>")
+	expectStrings(t, propagated()[1:], "ZPOPMAX y 2")
+	expectError(t, run(p, "ZMPOP", "1", "z", "LEFT"), "ZMPOP LEFT")
+}
+
+func TestBZPop(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b")
+	expectReply(t, run(p, "BZPOPMAX", "missing", "z", "0"), "z", "b", "2")
+
+	propagated := recordPropagation(p)
+	_, min := block(t, p, "BZPOPMIN", "q", "0")
+	_, mpop := block(t, p, "BZMPOP", "0", "1", "q", "MAX", "COUNT", "2")
+	run(p, "ZADD", "q", "5", "x", "6", "y", "7", "z")
+	expectReply(t, await(t, min), "q", "x", "5")
+	expectReply(t, await(t, mpop), "q", "z", "7", "y", "6")
+	expectReply(t, run(p, "EXISTS", "q"), "0")
+	expectStrings(t, propagated(), "ZADD q 5 x 6 y 7 z", "ZPOPMIN q", "ZPOPMAX q 2")
+
+	start := time.Now()
+	expectReply(t, run(p, "BZPOPMIN", "q", "0.05"), "<nil>")
+	if time.Since(start) < 40*time.Millisecond {
+		t.Fatal("BZPOPMIN returned before its timeout")
+	}
+	expectError(t, run(p, "BZPOPMIN", "q", "-1"), "BZPOPMIN with a negative timeout")
+}
+
+func TestZRemRangeBy(t *testing.T) {
+	p := newTestProcessor()
+	run(p, "ZADD", "z", "1", "a", "2", "b", "3", "c", "4", "d", "5", "e")
+	expectReply(t, run(p, "ZREMRANGEBYRANK", "z", "0", "1"), "2")
+	expectReply(t, run(p, "ZREMRANGEBYRANK", "z", "5", "10"), "0")
+	expectReply(t, run(p, "ZREMRANGEBYSCORE", "z", "(3", "4"), "1")
+	expectReply(t, run(p, "ZRANGE", "z", "0", "-1"), "c", "e")
+
+	run(p, "ZADD", "lex", "0", "a", "0", "b", "0", "c", "0", "d")
+	expectReply(t, run(p, "ZREMRANGEBYLEX", "lex", "[b", "(d"), "2")
+	expectReply(t, run(p, "ZREMRANGEBYLEX", "lex", "+", "-"), "0")
+	expectReply(t, run(p, "ZRANGE", "lex", "0", "-1"), "a", "d")
+	expectReply(t, run(p, "ZREMRANGEBYLEX", "lex", "-", "+"), "2")
+	expectReply(t, run(p, "EXISTS", "lex"), "0")
+
+	expectError(t, run(p, "ZREMRANGEBYSCORE", "z", "a", "1"), "ZREMRANGEBYSCORE a")
+	expectError(t, run(p, "ZREMRANGEBYLEX", "z", "a", "+"), "ZREMRANGEBYLEX a")
+	expectError(t, run(p, "ZREMRANGEBYRANK", "z", "0", "x"), "ZREMRANGEBYRANK x")
+}
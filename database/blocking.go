@@ -0,0 +1,107 @@
+package database
+
+import "slices"
+
+// Waiter is a client blocked until one of its keys can serve it. Waiters are
+// queued per key in arrival order, so wakeups are first come, first served.
+type Waiter struct {
+	keys []string
+	try  func(key string) bool
+	done chan struct{}
+}
+
+// Done is closed once the waiter has been served.
+func (w *Waiter) Done() <-chan struct{} {
+	return w.done
+}
+
+type blocked struct {
+	waiters map[string][]*Waiter
+	ready   []string
+}
+
+// Block queues a waiter on keys. Whenever one of them is modified, ServeReady
+// calls try with that key; try serves the client and returns true, or returns
+// false to keep waiting.
+//
+// Block, Unblock and ServeReady must be serialized with each other and with
+// the commands that modify keys, so that a waiter is never served while it
+// is being unblocked.
+func (db *Database) Block(keys []string, try func(key string) bool) *Waiter {
+	w := &Waiter{keys: keys, try: try, done: make(chan struct{})}
+	db.blockMu.Lock()
+	defer db.blockMu.Unlock()
+	for _, key := range keys {
+		if !slices.Contains(db.blocked.waiters[key], w) {
+			db.blocked.waiters[key] = append(db.blocked.waiters[key], w)
+		}
+	}
+	return w
+}
+
+// Unblock removes a waiter from its queues, reporting false if it was
+// already served.
+func (db *Database) Unblock(w *Waiter) bool {
+	select {
+	case <-w.done:
+		return false
+	default:
+	}
+	db.blockMu.Lock()
+	defer db.blockMu.Unlock()
+	db.removeWaiter(w)
+	return true
+}
+
+// ServeReady offers every key modified since the last call to the clients
+// blocked on it, oldest first. Serving a client may make further keys ready,
+// which are served in turn.
+func (db *Database) ServeReady() {
+	for {
+		db.blockMu.Lock()
+		if len(db.blocked.ready) == 0 {
+			db.blockMu.Unlock()
+			return
+		}
+		key := db.blocked.ready[0]
+		db.blocked.ready = db.blocked.ready[1:]
+		queue := slices.Clone(db.blocked.waiters[key])
+		db.blockMu.Unlock()
+
+		for _, w := range queue {
+			select {
+			case <-w.done:
+				continue
+			default:
+			}
+			if w.try(key) {
+				db.blockMu.Lock()
+				db.removeWaiter(w)
+				db.blockMu.Unlock()
+				close(w.done)
+			}
+		}
+	}
+}
+
+// signalReady marks key as ready if any client is blocked on it.
+func (db *Database) signalReady(key string) {
+	db.blockMu.Lock()
+	defer db.blockMu.Unlock()
+	if len(db.blocked.waiters[key]) > 0 && !slices.Contains(db.blocked.ready, key) {
+		db.blocked.ready = append(db.blocked.ready, key)
+	}
+}
+
+func (db *Database) removeWaiter(w *Waiter) {
+	for _, key := range w.keys {
+		queue := slices.DeleteFunc(db.blocked.waiters[key], func(other *Waiter) bool {
+			return other == w
+		})
+		if len(queue) == 0 {
+			delete(db.blocked.waiters, key)
+		} else {
+			db.blocked.waiters[key] = queue
+		}
+	}
+}
@@ -7,47 +7,146 @@ import (
 )
 
 type Database struct {
-	mu   sync.RWMutex
-	data map[string]Value
-	ttl  map[string]time.Time 
+	mu    sync.RWMutex
+	data  map[string]Value
+	ttl   map[string]time.Time
+	index int
+
+	listeners listeners
+
+	fieldTTLKeys map[string]struct{}
+
+	blockMu sync.Mutex
+	blocked blocked
 }
 
 func NewDatabase() *Database {
 	return &Database{
-		data: make(map[string]Value),
-		ttl:  make(map[string]time.Time),
+		data:         make(map[string]Value),
+		ttl:          make(map[string]time.Time),
+		fieldTTLKeys: make(map[string]struct{}),
+		blocked: blocked{
+			waiters: make(map[string][]*Waiter),
+		},
 	}
 }
 
-func (db *Database) Get(key string) (Value, bool) {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
+func (db *Database) Index() int {
+	return db.index
+}
 
-	if expiry, ok := db.ttl[key]; ok && time.Now().After(expiry) {
-		log.Printf("Key '%s' expired.", key)
-		db.mu.RUnlock() 
-		db.Delete(key)
-		db.mu.RLock()
+// Get returns the value at key, expiring it first if it is due. A missing
+// key is reported as a keymiss event.
+func (db *Database) Get(key string) (Value, bool) {
+	if db.expireIfNeeded(key) || db.expireFieldsIfNeeded(key) {
+		db.keyMiss(key)
 		return nil, false
 	}
 
+	db.mu.RLock()
 	val, ok := db.data[key]
+	db.mu.RUnlock()
+
+	if !ok {
+		db.keyMiss(key)
+	}
 	return val, ok
 }
 
 func (db *Database) Set(key string, val Value, ttl time.Duration) {
-	db.mu.Lock()
-	defer db.mu.Unlock()
-
-	db.data[key] = val
+	expireAt := time.Time{}
 	if ttl > 0 {
-		db.ttl[key] = time.Now().Add(ttl)
+		expireAt = time.Now().Add(ttl)
 		log.Printf("Set key '%s' with TTL: %v", key, ttl)
+	}
+	db.SetExpireAt(key, val, expireAt)
+}
+
+// SetExpireAt stores val under key with an absolute expiry. A zero expireAt
+// stores the key without one.
+func (db *Database) SetExpireAt(key string, val Value, expireAt time.Time) {
+	db.mu.Lock()
+	_, exists := db.data[key]
+	db.data[key] = val
+	if !expireAt.IsZero() {
+		db.ttl[key] = expireAt
 	} else {
-		delete(db.ttl, key) 
+		delete(db.ttl, key)
+	}
+	db.mu.Unlock()
+
+	if !exists {
+		db.Notify(NotifyNew, "new", key)
 	}
 }
 
+// SetKeepTTL stores val under key without touching any expiry already set on
+// the key.
+func (db *Database) SetKeepTTL(key string, val Value) {
+	db.mu.Lock()
+	_, exists := db.data[key]
+	db.data[key] = val
+	db.mu.Unlock()
+
+	if !exists {
+		db.Notify(NotifyNew, "new", key)
+	}
+}
+
+// ExpireAt sets an absolute expiry on an existing key.
+func (db *Database) ExpireAt(key string, at time.Time) bool {
+	if db.expireIfNeeded(key) {
+		return false
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.data[key]; !ok {
+		return false
+	}
+	db.ttl[key] = at
+	return true
+}
+
+// Persist removes the expiry from key, reporting whether there was one.
+func (db *Database) Persist(key string) bool {
+	if db.expireIfNeeded(key) {
+		return false
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if _, ok := db.ttl[key]; !ok {
+		return false
+	}
+	delete(db.ttl, key)
+	return true
+}
+
+// Peek returns the value at key without expiring it or any of its fields, so
+// it is safe to call while propagating a command.
+func (db *Database) Peek(key string) (Value, bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	val, ok := db.data[key]
+	return val, ok
+}
+
+// ExpireTime returns the expiry of key, or the zero time if it has none. ok
+// reports whether the key exists. Unlike Get it never expires the key, so it
+// is safe to call while propagating a command.
+func (db *Database) ExpireTime(key string) (at time.Time, ok bool) {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if _, ok = db.data[key]; !ok {
+		return time.Time{}, false
+	}
+	return db.ttl[key], true
+}
+
 func (db *Database) Delete(key string) bool {
 	db.mu.Lock()
 	defer db.mu.Unlock()
@@ -61,28 +160,49 @@ func (db *Database) Delete(key string) bool {
 	return exists
 }
 
-func (db *Database) Exists(key string) bool {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	if expiry, ok := db.ttl[key]; ok && time.Now().After(expiry) {
-		db.mu.RUnlock()
-		db.Delete(key)
-		db.mu.RLock()
+// Evict removes a key on behalf of a memory or capacity policy and reports it
+// as an "evicted" event rather than a deletion.
+func (db *Database) Evict(key string) bool {
+	if !db.Delete(key) {
 		return false
 	}
+	log.Printf("Key '%s' evicted.", key)
+	db.Notify(NotifyEvicted, "evicted", key)
+	return true
+}
 
-	_, ok := db.data[key]
+func (db *Database) Exists(key string) bool {
+	_, ok := db.Get(key)
 	return ok
 }
 
 func (db *Database) Type(key string) string {
-	db.mu.RLock()
-	defer db.mu.RUnlock()
-
-	val, ok := db.data[key]
+	val, ok := db.Get(key)
 	if !ok {
 		return "none"
 	}
 	return val.Type()
-}
\ No newline at end of file
+}
+
+func (db *Database) expireIfNeeded(key string) bool {
+	db.mu.RLock()
+	expiry, ok := db.ttl[key]
+	db.mu.RUnlock()
+	if !ok || !time.Now().After(expiry) {
+		return false
+	}
+
+	db.mu.Lock()
+	expiry, ok = db.ttl[key]
+	if !ok || !time.Now().After(expiry) {
+		db.mu.Unlock()
+		return false
+	}
+	delete(db.data, key)
+	delete(db.ttl, key)
+	db.mu.Unlock()
+
+	log.Printf("Key '%s' expired.", key)
+	db.Notify(NotifyExpired, "expired", key)
+	return true
+}
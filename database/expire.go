@@ -0,0 +1,117 @@
+package database
+
+import (
+	"time"
+)
+
+// FieldExpiryListener is told which fields of the hash at key expired.
+type FieldExpiryListener func(key string, fields []string)
+
+func (db *Database) AddFieldExpiryListener(l FieldExpiryListener) {
+	db.listeners.mu.Lock()
+	defer db.listeners.mu.Unlock()
+	db.listeners.fieldFns = append(db.listeners.fieldFns, l)
+}
+
+// TrackFieldExpiry registers key as holding a hash with field expiries, so
+// the active expiration cycle visits it.
+func (db *Database) TrackFieldExpiry(key string) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	db.fieldTTLKeys[key] = struct{}{}
+}
+
+// expireFieldsIfNeeded removes the expired fields of the hash at key and
+// deletes the key once no field is left, which it reports.
+func (db *Database) expireFieldsIfNeeded(key string) bool {
+	db.mu.RLock()
+	hash, ok := db.data[key].(*Hash)
+	db.mu.RUnlock()
+	if !ok {
+		return false
+	}
+	fields := hash.ExpireFields(time.Now())
+	if len(fields) == 0 {
+		return false
+	}
+
+	db.listeners.mu.RLock()
+	fns := db.listeners.fieldFns
+	db.listeners.mu.RUnlock()
+	for _, fn := range fns {
+		fn(key, fields)
+	}
+	db.Notify(NotifyHash, "hexpired", key)
+
+	if hash.HLen() > 0 {
+		return false
+	}
+	db.mu.Lock()
+	deleted := db.data[key] == Value(hash)
+	if deleted {
+		delete(db.data, key)
+		delete(db.ttl, key)
+	}
+	db.mu.Unlock()
+	if deleted {
+		db.Notify(NotifyGeneric, "del", key)
+	}
+	return deleted
+}
+
+const (
+	activeExpireSample   = 20
+	activeExpireDuration = 25 * time.Millisecond
+)
+
+// ActiveExpire runs one active expiration cycle: it samples keys with a TTL
+// and hashes with field TTLs and expires those that are due, repeating while
+// more than a quarter of a sample was expired and the time budget allows.
+// Lazy expiration alone would keep keys that are never accessed again.
+func (db *Database) ActiveExpire() {
+	deadline := time.Now().Add(activeExpireDuration)
+	for time.Now().Before(deadline) {
+		now := time.Now()
+		var due, sampled int
+		db.mu.RLock()
+		candidates := make([]string, 0, activeExpireSample)
+		for key, at := range db.ttl {
+			if sampled == activeExpireSample {
+				break
+			}
+			sampled++
+			if !at.After(now) {
+				candidates = append(candidates, key)
+			}
+		}
+		db.mu.RUnlock()
+		for _, key := range candidates {
+			if db.expireIfNeeded(key) {
+				due++
+			}
+		}
+		if sampled == 0 || due*4 <= sampled {
+			break
+		}
+	}
+
+	db.mu.RLock()
+	keys := make([]string, 0, len(db.fieldTTLKeys))
+	for key := range db.fieldTTLKeys {
+		keys = append(keys, key)
+	}
+	db.mu.RUnlock()
+	for _, key := range keys {
+		if time.Now().After(deadline) {
+			return
+		}
+		if db.expireIfNeeded(key) || db.expireFieldsIfNeeded(key) {
+			continue
+		}
+		db.mu.Lock()
+		if hash, ok := db.data[key].(*Hash); !ok || !hash.HasFieldExpiry() {
+			delete(db.fieldTTLKeys, key)
+		}
+		db.mu.Unlock()
+	}
+}
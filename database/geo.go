@@ -0,0 +1,341 @@
+package database
+
+import (
+	"math"
+	"slices"
+)
+
+// Coordinate limits of GEOADD. Latitudes are limited to the range of the
+// Web Mercator projection, so that geohash cells stay close to square.
+const (
+	GeoLonMin = -180.0
+	GeoLonMax = 180.0
+	GeoLatMin = -85.05112878
+	GeoLatMax = 85.05112878
+)
+
+const (
+	geoStepMax          = 26 // 52-bit scores, 26 bits per coordinate
+	earthRadiusInMeters = 6372797.560856
+	mercatorMax         = 20037726.37
+)
+
+// geoCell is a geohash of 2*step bits, longitude bits at odd positions and
+// latitude bits at even ones.
+type geoCell struct {
+	bits uint64
+	step uint
+}
+
+// geoArea is the rectangle covered by a geoCell.
+type geoArea struct {
+	lonMin, lonMax, latMin, latMax float64
+}
+
+// GeoEncode returns the 52-bit geohash of a position, which is stored as
+// the score of the member in the sorted set. ok is false when the position
+// is outside the GEOADD limits.
+func GeoEncode(lon, lat float64) (hash uint64, ok bool) {
+	cell, ok := geoEncode(lon, lat, GeoLatMin, GeoLatMax, geoStepMax)
+	return cell.bits, ok
+}
+
+func geoEncode(lon, lat, latMin, latMax float64, step uint) (geoCell, bool) {
+	if math.IsNaN(lon) || math.IsNaN(lat) || lon < GeoLonMin || lon > GeoLonMax || lat < GeoLatMin || lat > GeoLatMax {
+		return geoCell{}, false
+	}
+	// The upper limits map to 1<<step and belong to the last cell.
+	scale := float64(uint64(1) << step)
+	latOffset := min((lat-latMin)/(latMax-latMin)*scale, scale-1)
+	lonOffset := min((lon-GeoLonMin)/(GeoLonMax-GeoLonMin)*scale, scale-1)
+	return geoCell{bits: interleave(uint32(latOffset), uint32(lonOffset)), step: step}, true
+}
+
+// GeoDecode returns the position at the center of the cell of a 52-bit
+// geohash.
+func GeoDecode(hash uint64) (lon, lat float64) {
+	a := geoCell{bits: hash, step: geoStepMax}.area()
+	lon = min(max((a.lonMin+a.lonMax)/2, GeoLonMin), GeoLonMax)
+	lat = min(max((a.latMin+a.latMax)/2, GeoLatMin), GeoLatMax)
+	return lon, lat
+}
+
+func (c geoCell) area() geoArea {
+	lat, lon := deinterleave(c.bits)
+	scale := float64(uint64(1) << c.step)
+	return geoArea{
+		lonMin: GeoLonMin + float64(lon)/scale*(GeoLonMax-GeoLonMin),
+		lonMax: GeoLonMin + float64(lon+1)/scale*(GeoLonMax-GeoLonMin),
+		latMin: GeoLatMin + float64(lat)/scale*(GeoLatMax-GeoLatMin),
+		latMax: GeoLatMin + float64(lat+1)/scale*(GeoLatMax-GeoLatMin),
+	}
+}
+
+// interleave spreads the bits of lat over the even positions of the result
+// and those of lon over the odd ones.
+func interleave(lat, lon uint32) uint64 {
+	return spread(lat) | spread(lon)<<1
+}
+
+func deinterleave(bits uint64) (lat, lon uint32) {
+	return squash(bits), squash(bits >> 1)
+}
+
+func spread(v uint32) uint64 {
+	x := uint64(v)
+	x = (x | x<<16) & 0x0000FFFF0000FFFF
+	x = (x | x<<8) & 0x00FF00FF00FF00FF
+	x = (x | x<<4) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x<<2) & 0x3333333333333333
+	x = (x | x<<1) & 0x5555555555555555
+	return x
+}
+
+func squash(x uint64) uint32 {
+	x &= 0x5555555555555555
+	x = (x | x>>1) & 0x3333333333333333
+	x = (x | x>>2) & 0x0F0F0F0F0F0F0F0F
+	x = (x | x>>4) & 0x00FF00FF00FF00FF
+	x = (x | x>>8) & 0x0000FFFF0000FFFF
+	x = (x | x>>16) & 0x00000000FFFFFFFF
+	return uint32(x)
+}
+
+// GeoHashString returns the standard 11 character geohash of the position
+// stored as hash. Standard geohashes cover latitudes from -90 to 90, so the
+// position is encoded again rather than converted.
+func GeoHashString(hash uint64) string {
+	const alphabet = "0123456789bcdefghjkmnpqrstuvwxyz"
+	lon, lat := GeoDecode(hash)
+	cell, _ := geoEncode(lon, lat, -90, 90, geoStepMax)
+	buf := make([]byte, 11)
+	for i := range buf {
+		idx := 0
+		if i < 10 {
+			idx = int(cell.bits>>(52-(i+1)*5)) & 0x1f
+		}
+		buf[i] = alphabet[idx]
+	}
+	return string(buf)
+}
+
+func degToRad(d float64) float64 { return d * math.Pi / 180 }
+func radToDeg(r float64) float64 { return r * 180 / math.Pi }
+
+// GeoDistance returns the distance in meters between two positions, by the
+// haversine formula.
+func GeoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	v := math.Sin((degToRad(lon2) - degToRad(lon1)) / 2)
+	if v == 0 {
+		return geoLatDistance(lat1, lat2)
+	}
+	lat1r, lat2r := degToRad(lat1), degToRad(lat2)
+	u := math.Sin((lat2r - lat1r) / 2)
+	a := u*u + math.Cos(lat1r)*math.Cos(lat2r)*v*v
+	return 2 * earthRadiusInMeters * math.Asin(math.Sqrt(a))
+}
+
+func geoLatDistance(lat1, lat2 float64) float64 {
+	return earthRadiusInMeters * math.Abs(degToRad(lat2)-degToRad(lat1))
+}
+
+// GeoShape is the area searched by GeoSearch: a circle of Radius meters
+// around (Lon, Lat), or when Box is set a rectangle of Width by Height
+// meters centered on it.
+type GeoShape struct {
+	Lon, Lat      float64
+	Radius        float64
+	Width, Height float64
+	Box           bool
+}
+
+// contains reports whether a position lies in the shape, and its distance
+// from the center.
+func (s GeoShape) contains(lon, lat float64) (float64, bool) {
+	if !s.Box {
+		dist := GeoDistance(s.Lon, s.Lat, lon, lat)
+		return dist, dist <= s.Radius
+	}
+	if geoLatDistance(lat, s.Lat) > s.Height/2 {
+		return 0, false
+	}
+	if GeoDistance(lon, lat, s.Lon, lat) > s.Width/2 {
+		return 0, false
+	}
+	return GeoDistance(s.Lon, s.Lat, lon, lat), true
+}
+
+// boundingBox returns the longitudes and latitudes that enclose the shape.
+// Longitudes past ±180 are not wrapped; the cells east and west of the
+// antimeridian wrap instead.
+func (s GeoShape) boundingBox() geoArea {
+	height, width := s.Radius, s.Radius
+	if s.Box {
+		height, width = s.Height/2, s.Width/2
+	}
+	latDelta := radToDeg(height / earthRadiusInMeters)
+	lonDeltaTop := radToDeg(width / earthRadiusInMeters / math.Cos(degToRad(s.Lat+latDelta)))
+	lonDeltaBottom := radToDeg(width / earthRadiusInMeters / math.Cos(degToRad(s.Lat-latDelta)))
+	// The edge nearer the pole spans the most longitude.
+	lonDelta := lonDeltaTop
+	if s.Lat < 0 {
+		lonDelta = lonDeltaBottom
+	}
+	// A shape that reaches a pole spans every longitude.
+	if math.Abs(s.Lat)+latDelta >= 90 {
+		lonDelta = 180
+	}
+	lonDelta = min(lonDelta, 180)
+	return geoArea{
+		lonMin: s.Lon - lonDelta,
+		lonMax: s.Lon + lonDelta,
+		latMin: s.Lat - latDelta,
+		latMax: s.Lat + latDelta,
+	}
+}
+
+// geoStepsForRadius estimates the largest step whose cells are still as
+// large as the search radius, so that the cell of the center and its eight
+// neighbors cover the whole search area.
+func geoStepsForRadius(meters, lat float64) uint {
+	if meters == 0 {
+		return geoStepMax
+	}
+	step := 1
+	for meters < mercatorMax {
+		meters *= 2
+		step++
+	}
+	step -= 2
+	// Cells get narrower towards the poles.
+	if lat > 66 || lat < -66 {
+		step--
+		if lat > 80 || lat < -80 {
+			step--
+		}
+	}
+	return uint(min(max(step, 1), geoStepMax))
+}
+
+// move returns the cell dx columns east and dy rows north of c, wrapping
+// around at the edges.
+func (c geoCell) move(dx, dy int) geoCell {
+	lon := c.bits & 0xaaaaaaaaaaaaaaaa
+	lat := c.bits & 0x5555555555555555
+	lonMask := uint64(0xaaaaaaaaaaaaaaaa) >> (64 - c.step*2)
+	latMask := uint64(0x5555555555555555) >> (64 - c.step*2)
+	lon = moveBits(lon, dx, latMask) & lonMask
+	lat = moveBits(lat, dy, lonMask) & latMask
+	return geoCell{bits: lon | lat, step: c.step}
+}
+
+// moveBits adds d to the interleaved coordinate v, filling the bits of the
+// other coordinate, other, so that carries and borrows pass through them.
+func moveBits(v uint64, d int, other uint64) uint64 {
+	switch {
+	case d > 0:
+		return v + other + 1
+	case d < 0:
+		return (v | other) - (other + 1)
+	}
+	return v
+}
+
+// neighborsCover reports whether a cell of area and its eight neighbors
+// enclose bounds. Longitudes are compared as if the neighbors did not wrap,
+// as the bounds do not.
+func (a geoArea) neighborsCover(bounds geoArea) bool {
+	width, height := a.lonMax-a.lonMin, a.latMax-a.latMin
+	return a.lonMin-width <= bounds.lonMin && a.lonMax+width >= bounds.lonMax &&
+		a.latMin-height <= bounds.latMin && a.latMax+height >= bounds.latMax
+}
+
+// geoSearchCells returns the cells to scan for the shape: the cell of its
+// center and those of the eight neighbors that the shape reaches, in the
+// order Redis scans them.
+func geoSearchCells(shape GeoShape) []geoCell {
+	bounds := shape.boundingBox()
+	// Nothing is stored past the latitude limits, so there is no need to
+	// search beyond them.
+	bounds.latMin = max(bounds.latMin, GeoLatMin)
+	bounds.latMax = min(bounds.latMax, GeoLatMax)
+	radius := shape.Radius
+	if shape.Box {
+		radius = math.Hypot(shape.Width/2, shape.Height/2)
+	}
+	step := geoStepsForRadius(radius, shape.Lat)
+
+	lon := min(max(shape.Lon, GeoLonMin), GeoLonMax)
+	lat := min(max(shape.Lat, GeoLatMin), GeoLatMax)
+	center, ok := geoEncode(lon, lat, GeoLatMin, GeoLatMax, step)
+	if !ok {
+		return nil
+	}
+	// Near the edges of the center cell the neighbors may not reach far
+	// enough, and larger cells are needed.
+	for step > 1 && !center.area().neighborsCover(bounds) {
+		step--
+		center, _ = geoEncode(lon, lat, GeoLatMin, GeoLatMax, step)
+	}
+
+	// north, south, east, west, north-east, north-west, south-east,
+	// south-west
+	moves := [][2]int{{0, 1}, {0, -1}, {1, 0}, {-1, 0}, {1, 1}, {-1, 1}, {1, -1}, {-1, -1}}
+	area := center.area()
+	row, _ := deinterleave(center.bits)
+	cells := []geoCell{center}
+	for _, m := range moves {
+		// Moving north of the top row or south of the bottom one would
+		// wrap to the other pole.
+		if (m[1] > 0 && row == 1<<step-1) || (m[1] < 0 && row == 0) {
+			continue
+		}
+		if step >= 2 {
+			dx, dy := m[0], m[1]
+			if (dy < 0 && area.latMin < bounds.latMin) || (dy > 0 && area.latMax > bounds.latMax) ||
+				(dx < 0 && area.lonMin < bounds.lonMin) || (dx > 0 && area.lonMax > bounds.lonMax) {
+				continue
+			}
+		}
+		cell := center.move(m[0], m[1])
+		if !slices.Contains(cells, cell) {
+			cells = append(cells, cell)
+		}
+	}
+	return cells
+}
+
+// GeoPoint is a member found by GeoSearch, with its geohash score, its
+// position and its distance in meters from the center of the search.
+type GeoPoint struct {
+	Member   string
+	Score    float64
+	Lon, Lat float64
+	Dist     float64
+}
+
+// GeoSearch returns the members whose positions lie in shape, scanning the
+// geohash cells around its center. The search stops after limit members
+// when limit is positive.
+func (z *ZSet) GeoSearch(shape GeoShape, limit int) []GeoPoint {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+
+	points := make([]GeoPoint, 0)
+	for _, cell := range geoSearchCells(shape) {
+		shift := 2 * (geoStepMax - cell.step)
+		r := ScoreRange{Min: float64(cell.bits << shift), Max: float64((cell.bits + 1) << shift), MaxEx: true}
+		for _, m := range z.rangeWhere(r.aboveMin, r.belowMax, false, 0, -1) {
+			lon, lat := GeoDecode(uint64(m.Score))
+			dist, ok := shape.contains(lon, lat)
+			if !ok {
+				continue
+			}
+			points = append(points, GeoPoint{Member: m.Member, Score: m.Score, Lon: lon, Lat: lat, Dist: dist})
+			if limit > 0 && len(points) == limit {
+				return points
+			}
+		}
+	}
+	return points
+}
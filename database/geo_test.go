@@ -0,0 +1,110 @@
+package database
+
+import (
+	"math"
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+func TestGeoEncodeLimits(t *testing.T) {
+	for _, p := range [][2]float64{
+		{GeoLonMin, GeoLatMin}, {GeoLonMax, GeoLatMax}, {GeoLonMax, 0}, {0, GeoLatMax},
+	} {
+		hash, ok := GeoEncode(p[0], p[1])
+		if !ok {
+			t.Fatalf("GeoEncode(%v, %v) rejected a position on the limits", p[0], p[1])
+		}
+		if hash >= 1<<(2*geoStepMax) {
+			t.Fatalf("GeoEncode(%v, %v) = %#x, past 52 bits", p[0], p[1], hash)
+		}
+		lon, lat := GeoDecode(hash)
+		if math.Abs(lon-p[0]) > 1e-5 || math.Abs(lat-p[1]) > 1e-5 {
+			t.Fatalf("GeoDecode(GeoEncode(%v, %v)) = %v, %v", p[0], p[1], lon, lat)
+		}
+	}
+	if _, ok := GeoEncode(180.0001, 0); ok {
+		t.Fatal("GeoEncode accepted a longitude past 180")
+	}
+	if _, ok := GeoEncode(0, 85.06); ok {
+		t.Fatal("GeoEncode accepted a latitude past the limit")
+	}
+}
+
+func TestGeoHashString(t *testing.T) {
+	hash, _ := GeoEncode(13.361389, 38.115556)
+	if got := GeoHashString(hash); got != "sqc8b49rny0" {
+		t.Fatalf("GeoHashString = %q, want sqc8b49rny0", got)
+	}
+}
+
+// bruteForceSearch returns the members of points that lie in shape, found
+// by checking every one of them.
+func bruteForceSearch(points map[string]uint64, shape GeoShape) []string {
+	var members []string
+	for member, hash := range points {
+		lon, lat := GeoDecode(hash)
+		if _, ok := shape.contains(lon, lat); ok {
+			members = append(members, member)
+		}
+	}
+	slices.Sort(members)
+	return members
+}
+
+func TestGeoSearchMatchesBruteForce(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := NewZSet()
+	points := map[string]uint64{}
+	// Points cluster around the places where the cells wrap or end.
+	centers := [][2]float64{{179.9, 0}, {-179.9, 10}, {0, 85}, {120, -85}, {180, GeoLatMax}, {12, 45}}
+	for i := 0; i < 5000; i++ {
+		c := centers[i%len(centers)]
+		lon := c[0] + (rng.Float64()-0.5)*6
+		lon = math.Mod(lon+540, 360) - 180
+		lat := min(max(c[1]+(rng.Float64()-0.5)*6, GeoLatMin), GeoLatMax)
+		hash, ok := GeoEncode(lon, lat)
+		if !ok {
+			t.Fatalf("GeoEncode(%v, %v) failed", lon, lat)
+		}
+		member := "p" + strconv.Itoa(i)
+		z.ZAdd(float64(hash), member)
+		points[member] = hash
+	}
+
+	for _, c := range centers {
+		for _, radius := range []float64{1000, 50_000, 200_000, 1_000_000} {
+			for _, shape := range []GeoShape{
+				{Lon: c[0], Lat: c[1], Radius: radius},
+				{Lon: c[0], Lat: c[1], Width: radius * 2, Height: radius, Box: true},
+			} {
+				var got []string
+				for _, p := range z.GeoSearch(shape, 0) {
+					got = append(got, p.Member)
+				}
+				slices.Sort(got)
+				if want := bruteForceSearch(points, shape); !slices.Equal(got, want) {
+					t.Fatalf("GeoSearch(%+v) found %d members, want %d", shape, len(got), len(want))
+				}
+			}
+		}
+	}
+}
+
+func TestGeoSearchCellsStayInRange(t *testing.T) {
+	for _, shape := range []GeoShape{
+		{Lon: 180, Lat: GeoLatMax, Radius: 500_000},
+		{Lon: -180, Lat: GeoLatMin, Radius: 500_000},
+		{Lon: 180, Lat: 0, Width: 100_000, Height: 100_000, Box: true},
+	} {
+		for _, cell := range geoSearchCells(shape) {
+			if cell.bits >= 1<<(2*cell.step) {
+				t.Fatalf("geoSearchCells(%+v) returned %#x, past step %d", shape, cell.bits, cell.step)
+			}
+		}
+	}
+	if cells := geoSearchCells(GeoShape{Lon: math.NaN(), Lat: 0, Radius: 1}); cells != nil {
+		t.Fatalf("geoSearchCells with a NaN center = %v, want none", cells)
+	}
+}
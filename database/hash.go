@@ -1,15 +1,25 @@
 package database
 
-import "sync"
+import (
+	"sync"
+	"time"
+)
 
+// Hash keeps the expiry of fields that have one in expires. nextExpiry is a
+// lower bound of those times, so checking for due fields is O(1) until one
+// actually is.
 type Hash struct {
-	mu sync.RWMutex
-	data map[string]string
+	mu     sync.RWMutex
+	fields scanTable[string]
+
+	expires    map[string]time.Time
+	nextExpiry time.Time
 }
 
 func NewHash() *Hash {
 	return &Hash{
-		data: make(map[string]string),
+		fields:  newScanTable[string](),
+		expires: make(map[string]time.Time),
 	}
 }
 
@@ -20,16 +30,21 @@ func (h *Hash) Type() string {
 func (h *Hash) HSet(field, value string) bool {
 	h.mu.Lock()
 	defer h.mu.Unlock()
-	_, exists := h.data[field]
-	h.data[field] = value
-	return !exists 
+	delete(h.expires, field)
+	return h.fields.set(field, value)
+}
+
+// HSetKeepTTL sets field like HSet but keeps any expiry it already has.
+func (h *Hash) HSetKeepTTL(field, value string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.fields.set(field, value)
 }
 
 func (h *Hash) HGet(field string) (string, bool) {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	val, ok := h.data[field]
-	return val, ok
+	return h.fields.get(field)
 }
 
 func (h *Hash) HDel(fields ...string) int {
@@ -37,8 +52,8 @@ func (h *Hash) HDel(fields ...string) int {
 	defer h.mu.Unlock()
 	deletedCount := 0
 	for _, field := range fields {
-		if _, ok := h.data[field]; ok {
-			delete(h.data, field)
+		if h.fields.delete(field) {
+			delete(h.expires, field)
 			deletedCount++
 		}
 	}
@@ -48,5 +63,129 @@ func (h *Hash) HDel(fields ...string) int {
 func (h *Hash) HLen() int {
 	h.mu.RLock()
 	defer h.mu.RUnlock()
-	return len(h.data)
-}
\ No newline at end of file
+	return h.fields.len()
+}
+
+func (h *Hash) HGetAll() map[string]string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	result := make(map[string]string, h.fields.len())
+	for _, e := range h.fields.entries {
+		result[e.key] = e.value
+	}
+	return result
+}
+
+// HSetNX sets field only if it does not exist yet, reporting whether it did.
+func (h *Hash) HSetNX(field, value string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, exists := h.fields.get(field); exists {
+		return false
+	}
+	return h.fields.set(field, value)
+}
+
+func (h *Hash) HExists(field string) bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	_, ok := h.fields.get(field)
+	return ok
+}
+
+func (h *Hash) HKeys() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	keys := make([]string, 0, h.fields.len())
+	for _, e := range h.fields.entries {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+func (h *Hash) HVals() []string {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	vals := make([]string, 0, h.fields.len())
+	for _, e := range h.fields.entries {
+		vals = append(vals, e.value)
+	}
+	return vals
+}
+
+// FieldExpireTime returns the expiry of field, or the zero time if it has
+// none. ok reports whether the field exists.
+func (h *Hash) FieldExpireTime(field string) (at time.Time, ok bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	if _, ok = h.fields.get(field); !ok {
+		return time.Time{}, false
+	}
+	return h.expires[field], true
+}
+
+// ExpireFieldAt sets the expiry of an existing field.
+func (h *Hash) ExpireFieldAt(field string, at time.Time) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.fields.get(field); !ok {
+		return false
+	}
+	h.expires[field] = at
+	if h.nextExpiry.IsZero() || at.Before(h.nextExpiry) {
+		h.nextExpiry = at
+	}
+	return true
+}
+
+// PersistField removes the expiry of field, reporting whether it had one.
+func (h *Hash) PersistField(field string) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.expires[field]; !ok {
+		return false
+	}
+	delete(h.expires, field)
+	return true
+}
+
+// HasFieldExpiry reports whether any field has an expiry.
+func (h *Hash) HasFieldExpiry() bool {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return len(h.expires) > 0
+}
+
+// ExpireFields deletes the fields whose expiry is not after now and returns
+// them.
+func (h *Hash) ExpireFields(now time.Time) []string {
+	h.mu.RLock()
+	due := !h.nextExpiry.IsZero() && !h.nextExpiry.After(now)
+	h.mu.RUnlock()
+	if !due {
+		return nil
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	var expired []string
+	h.nextExpiry = time.Time{}
+	for field, at := range h.expires {
+		if !at.After(now) {
+			expired = append(expired, field)
+			h.fields.delete(field)
+			delete(h.expires, field)
+		} else if h.nextExpiry.IsZero() || at.Before(h.nextExpiry) {
+			h.nextExpiry = at
+		}
+	}
+	return expired
+}
+
+// HScan visits up to count fields from cursor as described on scanTable and
+// returns the next cursor.
+func (h *Hash) HScan(cursor uint64, count int, fn func(field, value string)) uint64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	return h.fields.scan(cursor, count, fn)
+}
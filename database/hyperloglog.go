@@ -0,0 +1,446 @@
+package database
+
+import (
+	"encoding/binary"
+	"errors"
+	"math"
+	"slices"
+)
+
+// HyperLogLogs are stored in plain strings, laid out after the Redis format
+// (exchanging values with Redis is not verified against real dumps):
+//
+//	"HYLL" | encoding (1 byte) | unused (3 bytes) | cached cardinality (8 bytes)
+//
+// followed by the registers. The dense encoding packs 16384 six-bit
+// registers; the sparse encoding run-length encodes them with the ZERO,
+// XZERO and VAL opcodes and is used until it grows past HLLSparseMaxBytes or
+// a register exceeds what a VAL opcode can hold.
+
+const (
+	hllP           = 14
+	hllQ           = 64 - hllP
+	hllRegisters   = 1 << hllP
+	hllPMask       = hllRegisters - 1
+	hllBits        = 6
+	hllRegisterMax = 1<<hllBits - 1
+	hllHdrSize     = 16
+	hllDenseSize   = hllHdrSize + (hllRegisters*hllBits+7)/8
+	hllDense       = 0
+	hllSparse      = 1
+
+	hllSparseValMaxValue = 32
+	hllSparseValMaxLen   = 4
+	hllSparseZeroMaxLen  = 64
+	hllSparseXZeroMaxLen = 16384
+
+	hllAlphaInf = 0.721347520444481703680
+
+	// HLLSparseMaxBytes is the size past which a sparse HyperLogLog is
+	// converted to the dense encoding.
+	HLLSparseMaxBytes = 3000
+)
+
+var (
+	ErrInvalidHLL = errors.New("WRONGTYPE Key is not a valid HyperLogLog string value.")
+	ErrCorruptHLL = errors.New("INVALIDOBJ Corrupted HLL object detected")
+)
+
+// HLLRegisters is the decoded form of a HyperLogLog, used to merge and count
+// several of them.
+type HLLRegisters [hllRegisters]uint8
+
+// NewHLL returns an empty sparse HyperLogLog.
+func NewHLL() []byte {
+	var regs HLLRegisters
+	return regs.encodeSparse()
+}
+
+// ValidHLL reports whether buf holds a HyperLogLog.
+func ValidHLL(buf []byte) error {
+	if len(buf) < hllHdrSize || string(buf[:4]) != "HYLL" {
+		return ErrInvalidHLL
+	}
+	switch buf[4] {
+	case hllDense:
+		if len(buf) != hllDenseSize {
+			return ErrInvalidHLL
+		}
+	case hllSparse:
+	default:
+		return ErrInvalidHLL
+	}
+	return nil
+}
+
+// IsDenseHLL reports whether the HyperLogLog in buf uses the dense encoding.
+func IsDenseHLL(buf []byte) bool {
+	return buf[4] == hllDense
+}
+
+// HLLAdd adds elements to the HyperLogLog in buf and returns the resulting
+// buffer, which is buf itself unless the encoding had to grow, and whether
+// any register changed. The cached cardinality is invalidated on change.
+func HLLAdd(buf []byte, elements [][]byte) ([]byte, bool, error) {
+	if err := ValidHLL(buf); err != nil {
+		return buf, false, err
+	}
+	changed := false
+	for _, element := range elements {
+		index, count := hllPatLen(element)
+		if IsDenseHLL(buf) {
+			if count > hllDenseGet(buf, index) {
+				hllDenseSet(buf, index, count)
+				changed = true
+			}
+			continue
+		}
+		var set bool
+		var err error
+		if buf, set, err = hllSparseSet(buf, index, count); err != nil {
+			return buf, false, err
+		}
+		changed = changed || set
+	}
+	if changed {
+		hllInvalidateCache(buf)
+	}
+	return buf, changed, nil
+}
+
+// hllSparseSet raises register index of the sparse HyperLogLog in buf to val
+// by rewriting only the opcode that covers it, and reports whether the
+// register changed. The HyperLogLog is converted to the dense encoding when
+// val does not fit a VAL opcode or the result grows past HLLSparseMaxBytes.
+func hllSparseSet(buf []byte, index int, val uint8) ([]byte, bool, error) {
+	p := buf[hllHdrSize:]
+	first, prev := 0, -1
+	for i := 0; i < len(p); {
+		op := p[i]
+		size, runLen, old := 1, 0, uint8(0)
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			runLen = int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return buf, false, ErrCorruptHLL
+			}
+			size = 2
+			runLen = (int(op&0x3f)<<8 | int(p[i+1])) + 1
+		default: // VAL
+			old = (op>>2)&0x1f + 1
+			runLen = int(op&0x3) + 1
+		}
+		if index >= first+runLen {
+			first += runLen
+			prev = i
+			i += size
+			continue
+		}
+		if val <= old {
+			return buf, false, nil
+		}
+		if val > hllSparseValMaxValue {
+			return hllSparseToDense(buf, index, val)
+		}
+
+		// Split the run around the register: the registers before it keep
+		// the old value, then one VAL for the register, then the rest.
+		var seq []byte
+		seq = appendSparseRun(seq, old, index-first)
+		seq = append(seq, 0x80|(val-1)<<2)
+		seq = appendSparseRun(seq, old, first+runLen-index-1)
+		at := hllHdrSize + i
+		buf = slices.Replace(buf, at, at+size, seq...)
+		if prev >= 0 {
+			at = hllHdrSize + prev
+		}
+		buf = hllSparseMergeVals(buf, at)
+		if len(buf) > HLLSparseMaxBytes {
+			return hllSparseToDense(buf, index, val)
+		}
+		return buf, true, nil
+	}
+	return buf, false, ErrCorruptHLL
+}
+
+// hllSparseMergeVals joins adjacent VAL opcodes with the same value in the
+// few opcodes starting at the one at offset at, which is where a split left
+// them.
+func hllSparseMergeVals(buf []byte, at int) []byte {
+	for scanned := 0; scanned < 5 && at+1 < len(buf); scanned++ {
+		op, next := buf[at], buf[at+1]
+		if op&0xc0 == 0x40 {
+			at += 2
+			continue
+		}
+		if op&0x80 != 0 && next&0x80 != 0 && op&0x7c == next&0x7c {
+			if n := int(op&0x3) + int(next&0x3) + 2; n <= hllSparseValMaxLen {
+				buf[at] = op&^0x3 | byte(n-1)
+				buf = slices.Delete(buf, at+1, at+2)
+				continue
+			}
+		}
+		at++
+	}
+	return buf
+}
+
+// hllSparseToDense converts the sparse HyperLogLog in buf to the dense
+// encoding and raises register index to val in it.
+func hllSparseToDense(buf []byte, index int, val uint8) ([]byte, bool, error) {
+	var regs HLLRegisters
+	if err := regs.Merge(buf); err != nil {
+		return buf, false, err
+	}
+	regs[index] = max(regs[index], val)
+	return regs.Encode(true), true, nil
+}
+
+// HLLCount returns the estimated cardinality of the HyperLogLog in buf,
+// using and refreshing the cached value stored in its header.
+func HLLCount(buf []byte) (uint64, error) {
+	if err := ValidHLL(buf); err != nil {
+		return 0, err
+	}
+	card := buf[8:hllHdrSize]
+	if card[7]&0x80 == 0 {
+		return binary.LittleEndian.Uint64(card), nil
+	}
+	var regs HLLRegisters
+	if err := regs.Merge(buf); err != nil {
+		return 0, err
+	}
+	count := regs.Count()
+	binary.LittleEndian.PutUint64(card, count)
+	return count, nil
+}
+
+func hllInvalidateCache(buf []byte) {
+	buf[hllHdrSize-1] |= 0x80
+}
+
+// Merge raises every register to its value in the HyperLogLog in buf.
+func (r *HLLRegisters) Merge(buf []byte) error {
+	if err := ValidHLL(buf); err != nil {
+		return err
+	}
+	if IsDenseHLL(buf) {
+		for i := range r {
+			if v := hllDenseGet(buf, i); v > r[i] {
+				r[i] = v
+			}
+		}
+		return nil
+	}
+
+	index := 0
+	p := buf[hllHdrSize:]
+	for i := 0; i < len(p); i++ {
+		op := p[i]
+		switch {
+		case op&0xc0 == 0x00: // ZERO
+			index += int(op&0x3f) + 1
+		case op&0xc0 == 0x40: // XZERO
+			if i+1 >= len(p) {
+				return ErrCorruptHLL
+			}
+			index += (int(op&0x3f)<<8 | int(p[i+1])) + 1
+			i++
+		default: // VAL
+			val := (op>>2)&0x1f + 1
+			runLen := int(op&0x3) + 1
+			if index+runLen > hllRegisters {
+				return ErrCorruptHLL
+			}
+			for j := index; j < index+runLen; j++ {
+				if val > r[j] {
+					r[j] = val
+				}
+			}
+			index += runLen
+		}
+		if index > hllRegisters {
+			return ErrCorruptHLL
+		}
+	}
+	if index != hllRegisters {
+		return ErrCorruptHLL
+	}
+	return nil
+}
+
+// Count estimates the cardinality of the registers with the estimator from
+// Otmar Ertl's "New cardinality estimation algorithms for HyperLogLog
+// sketches", which is what Redis uses.
+func (r *HLLRegisters) Count() uint64 {
+	var histo [hllQ + 2]int
+	for _, v := range r {
+		histo[v]++
+	}
+	m := float64(hllRegisters)
+	z := m * hllTau((m-float64(histo[hllQ+1]))/m)
+	for j := hllQ; j >= 1; j-- {
+		z += float64(histo[j])
+		z *= 0.5
+	}
+	z += m * hllSigma(float64(histo[0])/m)
+	return uint64(math.Round(hllAlphaInf * m * m / z))
+}
+
+// Encode returns the registers as a HyperLogLog string with no cached
+// cardinality. It is sparse unless dense is set or the sparse form would be
+// too large or cannot hold a register.
+func (r *HLLRegisters) Encode(dense bool) []byte {
+	if !dense {
+		if buf := r.encodeSparse(); buf != nil {
+			hllInvalidateCache(buf)
+			return buf
+		}
+	}
+	buf := make([]byte, hllDenseSize)
+	copy(buf, "HYLL")
+	buf[4] = hllDense
+	for i, v := range r {
+		if v != 0 {
+			hllDenseSet(buf, i, v)
+		}
+	}
+	hllInvalidateCache(buf)
+	return buf
+}
+
+func (r *HLLRegisters) encodeSparse() []byte {
+	buf := make([]byte, hllHdrSize, hllHdrSize+64)
+	copy(buf, "HYLL")
+	buf[4] = hllSparse
+	for i := 0; i < hllRegisters; {
+		v := r[i]
+		run := 1
+		for i+run < hllRegisters && r[i+run] == v {
+			run++
+		}
+		i += run
+		if v > hllSparseValMaxValue {
+			return nil
+		}
+		buf = appendSparseRun(buf, v, run)
+		if len(buf) > HLLSparseMaxBytes {
+			return nil
+		}
+	}
+	return buf
+}
+
+// appendSparseRun appends the opcodes for run registers holding v.
+func appendSparseRun(buf []byte, v uint8, run int) []byte {
+	for run > 0 {
+		switch {
+		case v != 0:
+			n := min(run, hllSparseValMaxLen)
+			buf = append(buf, 0x80|(v-1)<<2|byte(n-1))
+			run -= n
+		case run > hllSparseZeroMaxLen:
+			n := min(run, hllSparseXZeroMaxLen)
+			buf = append(buf, 0x40|byte((n-1)>>8), byte(n-1))
+			run -= n
+		default:
+			buf = append(buf, byte(run-1))
+			run = 0
+		}
+	}
+	return buf
+}
+
+func hllDenseGet(buf []byte, index int) uint8 {
+	p := buf[hllHdrSize:]
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	v := uint(p[b]) >> fb
+	if b+1 < len(p) {
+		v |= uint(p[b+1]) << (8 - fb)
+	}
+	return uint8(v & hllRegisterMax)
+}
+
+func hllDenseSet(buf []byte, index int, val uint8) {
+	p := buf[hllHdrSize:]
+	b := index * hllBits / 8
+	fb := uint(index * hllBits & 7)
+	v := uint(val)
+	p[b] = byte(uint(p[b])&^(hllRegisterMax<<fb) | v<<fb)
+	if b+1 < len(p) {
+		p[b+1] = byte(uint(p[b+1])&^(hllRegisterMax>>(8-fb)) | v>>(8-fb))
+	}
+}
+
+// hllPatLen returns the register an element maps to and the length of the
+// run of zeros in its hash, plus one.
+func hllPatLen(element []byte) (int, uint8) {
+	hash := murmurHash64A(element, 0xadc83b19)
+	index := int(hash & hllPMask)
+	hash >>= hllP
+	hash |= 1 << hllQ
+	count := uint8(1)
+	for bit := uint64(1); hash&bit == 0; bit <<= 1 {
+		count++
+	}
+	return index, count
+}
+
+func murmurHash64A(data []byte, seed uint64) uint64 {
+	const m = 0xc6a4a7935bd1e995
+	const r = 47
+	h := seed ^ uint64(len(data))*m
+	for len(data) >= 8 {
+		k := binary.LittleEndian.Uint64(data)
+		k *= m
+		k ^= k >> r
+		k *= m
+		h ^= k
+		h *= m
+		data = data[8:]
+	}
+	if len(data) > 0 {
+		for i := len(data) - 1; i >= 0; i-- {
+			h ^= uint64(data[i]) << (8 * uint(i))
+		}
+		h *= m
+	}
+	h ^= h >> r
+	h *= m
+	h ^= h >> r
+	return h
+}
+
+func hllSigma(x float64) float64 {
+	if x == 1 {
+		return math.Inf(1)
+	}
+	y, z := 1.0, x
+	for {
+		x *= x
+		prev := z
+		z += x * y
+		y += y
+		if prev == z {
+			return z
+		}
+	}
+}
+
+func hllTau(x float64) float64 {
+	if x == 0 || x == 1 {
+		return 0
+	}
+	y, z := 1.0, 1-x
+	for {
+		x = math.Sqrt(x)
+		prev := z
+		y *= 0.5
+		z -= math.Pow(1-x, 2) * y
+		if prev == z {
+			return z / 3
+		}
+	}
+}
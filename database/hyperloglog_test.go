@@ -0,0 +1,90 @@
+package database
+
+import (
+	"bytes"
+	"strconv"
+	"testing"
+)
+
+func decodeHLL(t *testing.T, buf []byte) HLLRegisters {
+	t.Helper()
+	var regs HLLRegisters
+	if err := regs.Merge(buf); err != nil {
+		t.Fatal(err)
+	}
+	return regs
+}
+
+func TestHLLAddSparseMatchesRegisters(t *testing.T) {
+	buf := NewHLL()
+	var want HLLRegisters
+	for i := 0; i < 2000 && !IsDenseHLL(buf); i++ {
+		element := []byte("element:" + strconv.Itoa(i))
+		index, count := hllPatLen(element)
+		grows := count > want[index]
+		want[index] = max(want[index], count)
+
+		var changed bool
+		var err error
+		buf, changed, err = HLLAdd(buf, [][]byte{element})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if changed != grows {
+			t.Fatalf("HLLAdd(%s) changed = %v, want %v", element, changed, grows)
+		}
+		if decodeHLL(t, buf) != want {
+			t.Fatalf("registers differ from the expected ones after %d elements", i+1)
+		}
+	}
+	if !IsDenseHLL(buf) {
+		t.Fatal("2000 elements did not convert the HyperLogLog to dense")
+	}
+	if decodeHLL(t, buf) != want {
+		t.Fatal("registers changed in the conversion to dense")
+	}
+}
+
+func TestHLLSparseSetMergesVals(t *testing.T) {
+	buf := NewHLL()
+	for index := 10; index < 14; index++ {
+		var err error
+		if buf, _, err = hllSparseSet(buf, index, 3); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var regs HLLRegisters
+	for index := 10; index < 14; index++ {
+		regs[index] = 3
+	}
+	if want := regs.encodeSparse(); !bytes.Equal(buf[hllHdrSize:], want[hllHdrSize:]) {
+		t.Fatalf("opcodes = %x, want %x", buf[hllHdrSize:], want[hllHdrSize:])
+	}
+}
+
+func TestHLLSparseSetLargeValueConvertsToDense(t *testing.T) {
+	buf, changed, err := hllSparseSet(NewHLL(), 5, hllSparseValMaxValue+1)
+	if err != nil || !changed {
+		t.Fatalf("hllSparseSet = %v, %v; want true, nil", changed, err)
+	}
+	if !IsDenseHLL(buf) {
+		t.Fatal("a register above the VAL maximum did not convert to dense")
+	}
+	if v := hllDenseGet(buf, 5); v != hllSparseValMaxValue+1 {
+		t.Fatalf("register 5 = %d, want %d", v, hllSparseValMaxValue+1)
+	}
+}
+
+func TestHLLCountSparse(t *testing.T) {
+	buf := NewHLL()
+	for i := 0; i < 1000; i++ {
+		buf, _, _ = HLLAdd(buf, [][]byte{[]byte(strconv.Itoa(i))})
+	}
+	count, err := HLLCount(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count < 980 || count > 1020 {
+		t.Fatalf("HLLCount = %d for 1000 elements", count)
+	}
+}
@@ -0,0 +1,289 @@
+package database
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// JSON is a parsed JSON document. Its nodes are nil, bool, int64, float64,
+// string, []any and *JSONObject; integers and other numbers are kept
+// apart, as RedisJSON does, so that 3 and 3.0 stay distinct.
+type JSON struct {
+	mu   sync.RWMutex
+	root any
+}
+
+func NewJSON(root any) *JSON {
+	return &JSON{root: root}
+}
+
+func (j *JSON) Type() string {
+	return "ReJSON-RL"
+}
+
+// JSONObject is a JSON object that keeps its keys in insertion order.
+type JSONObject struct {
+	keys   []string
+	values map[string]any
+}
+
+func NewJSONObject() *JSONObject {
+	return &JSONObject{values: make(map[string]any)}
+}
+
+func (o *JSONObject) Len() int {
+	return len(o.keys)
+}
+
+func (o *JSONObject) Keys() []string {
+	return slices.Clone(o.keys)
+}
+
+func (o *JSONObject) Get(key string) (any, bool) {
+	v, ok := o.values[key]
+	return v, ok
+}
+
+// Set sets the value of key, appending the key when it is new.
+func (o *JSONObject) Set(key string, v any) {
+	if _, exists := o.values[key]; !exists {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = v
+}
+
+func (o *JSONObject) Delete(key string) bool {
+	if _, exists := o.values[key]; !exists {
+		return false
+	}
+	delete(o.values, key)
+	o.keys = slices.DeleteFunc(o.keys, func(k string) bool { return k == key })
+	return true
+}
+
+// ParseJSON parses a JSON text into a document node.
+func ParseJSON(data string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	dec.UseNumber()
+	v, err := parseJSONValue(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, errors.New("trailing characters after JSON value")
+	}
+	return v, nil
+}
+
+func parseJSONValue(dec *json.Decoder) (any, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		return nil, errors.New("EOF while parsing a value")
+	}
+	if err != nil {
+		return nil, err
+	}
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '[' {
+			arr := make([]any, 0)
+			for dec.More() {
+				v, err := parseJSONValue(dec)
+				if err != nil {
+					return nil, err
+				}
+				arr = append(arr, v)
+			}
+			_, err := dec.Token()
+			return arr, err
+		}
+		obj := NewJSONObject()
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return nil, err
+			}
+			v, err := parseJSONValue(dec)
+			if err != nil {
+				return nil, err
+			}
+			obj.Set(key.(string), v)
+		}
+		_, err := dec.Token()
+		return obj, err
+	case json.Number:
+		return parseJSONNumber(string(t))
+	}
+	return tok, nil
+}
+
+// parseJSONNumber returns an int64 for integers that fit one, and a float64
+// for every other number.
+func parseJSONNumber(s string) (any, error) {
+	if !strings.ContainsAny(s, ".eE") {
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n, nil
+		}
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil && !errors.Is(err, strconv.ErrRange) {
+		return nil, err
+	}
+	return f, nil
+}
+
+// JSONTypeName returns the RedisJSON name of the type of a node.
+func JSONTypeName(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case int64:
+		return "integer"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	}
+	return "object"
+}
+
+// JSONFormat is the layout of serialized JSON: Indent is repeated once per
+// nesting level, Newline follows each opening bracket and element, and
+// Space follows each colon. The zero value is the compact form.
+type JSONFormat struct {
+	Indent, Newline, Space string
+}
+
+func (f JSONFormat) Marshal(v any) string {
+	var b strings.Builder
+	f.write(&b, v, 0)
+	return b.String()
+}
+
+func (f JSONFormat) write(b *strings.Builder, v any, level int) {
+	switch t := v.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case int64:
+		b.WriteString(strconv.FormatInt(t, 10))
+	case float64:
+		b.WriteString(FormatJSONFloat(t))
+	case string:
+		writeJSONString(b, t)
+	case []any:
+		if len(t) == 0 {
+			b.WriteString("[]")
+			return
+		}
+		b.WriteByte('[')
+		for i, e := range t {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.newline(b, level+1)
+			f.write(b, e, level+1)
+		}
+		f.newline(b, level)
+		b.WriteByte(']')
+	case *JSONObject:
+		if t.Len() == 0 {
+			b.WriteString("{}")
+			return
+		}
+		b.WriteByte('{')
+		for i, k := range t.keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			f.newline(b, level+1)
+			writeJSONString(b, k)
+			b.WriteByte(':')
+			b.WriteString(f.Space)
+			f.write(b, t.values[k], level+1)
+		}
+		f.newline(b, level)
+		b.WriteByte('}')
+	}
+}
+
+func (f JSONFormat) newline(b *strings.Builder, level int) {
+	b.WriteString(f.Newline)
+	for range level {
+		b.WriteString(f.Indent)
+	}
+}
+
+// FormatJSONFloat formats a non-integer number so that it reads back as one,
+// "3.0" rather than "3".
+func FormatJSONFloat(f float64) string {
+	if math.IsInf(f, 0) || math.IsNaN(f) {
+		return "null"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+func writeJSONString(b *strings.Builder, s string) {
+	const hex = "0123456789abcdef"
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c == '\n':
+			b.WriteString(`\n`)
+		case c == '\r':
+			b.WriteString(`\r`)
+		case c == '\t':
+			b.WriteString(`\t`)
+		case c < 0x20:
+			b.WriteString(`\u00`)
+			b.WriteByte(hex[c>>4])
+			b.WriteByte(hex[c&0xf])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+}
+
+// jsonEqual reports whether two nodes hold the same JSON value, comparing
+// integers and other numbers by value.
+func jsonEqual(a, b any) bool {
+	if x, ok := jsonNumber(a); ok {
+		y, ok := jsonNumber(b)
+		return ok && x == y
+	}
+	switch t := a.(type) {
+	case []any, *JSONObject:
+		return JSONFormat{}.Marshal(t) == JSONFormat{}.Marshal(b)
+	}
+	return a == b
+}
+
+func jsonNumber(v any) (float64, bool) {
+	switch t := v.(type) {
+	case int64:
+		return float64(t), true
+	case float64:
+		return t, true
+	}
+	return 0, false
+}
@@ -0,0 +1,833 @@
+package database
+
+import (
+	"cmp"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// JSONPath is a parsed path into a JSON document. It supports the root $,
+// child names (.name and ['name']), wildcards, recursive descent (..),
+// array indexes, unions and slices, and filters such as [?(@.price < 10)].
+//
+// Paths not starting with $ use the legacy RedisJSON syntax, such as .a.b
+// or a[0]; they are evaluated the same way, but commands reply with a
+// single value instead of an array of matches.
+type JSONPath struct {
+	Legacy   bool
+	segments []jsonSegment
+}
+
+type jsonSegment struct {
+	recursive bool
+	wildcard  bool
+	names     []string
+	indexes   []int
+	slice     *jsonSlice
+	filter    jsonExpr
+}
+
+type jsonSlice struct {
+	start, end *int
+	step       int
+}
+
+// ParseJSONPath parses a JSONPath or legacy path.
+func ParseJSONPath(s string) (*JSONPath, error) {
+	path := &JSONPath{}
+	src := s
+	if !strings.HasPrefix(s, "$") {
+		path.Legacy = true
+		switch {
+		case s == ".":
+			src = "$"
+		case strings.HasPrefix(s, ".") || strings.HasPrefix(s, "["):
+			src = "$" + s
+		default:
+			src = "$." + s
+		}
+	}
+	p := &jsonPathParser{s: src, pos: 1}
+	segments, err := p.segments(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos != len(p.s) {
+		return nil, p.errorf("unexpected character")
+	}
+	path.segments = segments
+	return path, nil
+}
+
+// IsRoot reports whether the path selects the whole document.
+func (p *JSONPath) IsRoot() bool {
+	return len(p.segments) == 0
+}
+
+type jsonPathParser struct {
+	s   string
+	pos int
+}
+
+func (p *jsonPathParser) errorf(format string, args ...any) error {
+	return fmt.Errorf("invalid JSONPath at offset %d: %s", p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *jsonPathParser) peek(prefix string) bool {
+	return strings.HasPrefix(p.s[p.pos:], prefix)
+}
+
+func (p *jsonPathParser) skipSpaces() {
+	for p.pos < len(p.s) && p.s[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+// segments parses segments until one cannot start. Inside filters, names
+// also end at operators, spaces and parentheses.
+func (p *jsonPathParser) segments(inFilter bool) ([]jsonSegment, error) {
+	var segments []jsonSegment
+	for p.pos < len(p.s) {
+		var seg jsonSegment
+		switch {
+		case p.peek(".."):
+			p.pos += 2
+			seg.recursive = true
+		case p.peek("."):
+			p.pos++
+		case p.peek("["):
+		default:
+			return segments, nil
+		}
+		var err error
+		if p.peek("[") {
+			err = p.bracket(&seg)
+		} else {
+			err = p.dotName(&seg, inFilter)
+		}
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+func (p *jsonPathParser) dotName(seg *jsonSegment, inFilter bool) error {
+	if p.peek("*") {
+		p.pos++
+		seg.wildcard = true
+		return nil
+	}
+	stop := ".["
+	if inFilter {
+		stop += " =!<>)&|"
+	}
+	start := p.pos
+	for p.pos < len(p.s) && !strings.ContainsRune(stop, rune(p.s[p.pos])) {
+		p.pos++
+	}
+	if p.pos == start {
+		return p.errorf("expected a member name")
+	}
+	seg.names = []string{p.s[start:p.pos]}
+	return nil
+}
+
+func (p *jsonPathParser) bracket(seg *jsonSegment) error {
+	p.pos++ // [
+	p.skipSpaces()
+	switch {
+	case p.peek("*"):
+		p.pos++
+		seg.wildcard = true
+	case p.peek("?"):
+		p.pos++
+		p.skipSpaces()
+		if !p.peek("(") {
+			return p.errorf("expected ( after ?")
+		}
+		p.pos++
+		expr, err := p.orExpr()
+		if err != nil {
+			return err
+		}
+		p.skipSpaces()
+		if !p.peek(")") {
+			return p.errorf("expected )")
+		}
+		p.pos++
+		seg.filter = expr
+	default:
+		if err := p.union(seg); err != nil {
+			return err
+		}
+	}
+	p.skipSpaces()
+	if !p.peek("]") {
+		return p.errorf("expected ]")
+	}
+	p.pos++
+	return nil
+}
+
+// union parses a comma separated list of quoted names, indexes, or a
+// single slice.
+func (p *jsonPathParser) union(seg *jsonSegment) error {
+	for {
+		p.skipSpaces()
+		switch {
+		case p.peek("'") || p.peek(`"`):
+			name, err := p.quoted()
+			if err != nil {
+				return err
+			}
+			seg.names = append(seg.names, name)
+		default:
+			start, hasStart, err := p.integer()
+			if err != nil {
+				return err
+			}
+			p.skipSpaces()
+			if p.peek(":") {
+				if len(seg.names) > 0 || len(seg.indexes) > 0 {
+					return p.errorf("slices cannot be combined")
+				}
+				return p.sliceRest(seg, start, hasStart)
+			}
+			if !hasStart {
+				return p.errorf("expected an index or a quoted name")
+			}
+			seg.indexes = append(seg.indexes, start)
+		}
+		p.skipSpaces()
+		if !p.peek(",") {
+			return nil
+		}
+		p.pos++
+	}
+}
+
+func (p *jsonPathParser) sliceRest(seg *jsonSegment, start int, hasStart bool) error {
+	s := &jsonSlice{step: 1}
+	if hasStart {
+		s.start = &start
+	}
+	p.pos++ // :
+	p.skipSpaces()
+	end, hasEnd, err := p.integer()
+	if err != nil {
+		return err
+	}
+	if hasEnd {
+		s.end = &end
+	}
+	p.skipSpaces()
+	if p.peek(":") {
+		p.pos++
+		p.skipSpaces()
+		step, hasStep, err := p.integer()
+		if err != nil {
+			return err
+		}
+		if hasStep {
+			s.step = step
+		}
+	}
+	if s.step == 0 {
+		return p.errorf("slice step cannot be 0")
+	}
+	seg.slice = s
+	return nil
+}
+
+// integer parses an optional signed integer.
+func (p *jsonPathParser) integer() (n int, ok bool, err error) {
+	start := p.pos
+	if p.peek("-") {
+		p.pos++
+	}
+	for p.pos < len(p.s) && p.s[p.pos] >= '0' && p.s[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return 0, false, nil
+	}
+	n, err = strconv.Atoi(p.s[start:p.pos])
+	if err != nil {
+		return 0, false, p.errorf("invalid index %q", p.s[start:p.pos])
+	}
+	return n, true, nil
+}
+
+func (p *jsonPathParser) quoted() (string, error) {
+	quote := p.s[p.pos]
+	var b strings.Builder
+	for p.pos++; p.pos < len(p.s); p.pos++ {
+		c := p.s[p.pos]
+		switch {
+		case c == quote:
+			p.pos++
+			return b.String(), nil
+		case c == '\\' && p.pos+1 < len(p.s):
+			p.pos++
+			b.WriteByte(p.s[p.pos])
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// jsonExpr is a filter expression, evaluated against the current node @
+// and the document root $.
+type jsonExpr interface {
+	eval(current, root any) bool
+}
+
+type jsonOr struct{ left, right jsonExpr }
+type jsonAnd struct{ left, right jsonExpr }
+type jsonNot struct{ expr jsonExpr }
+
+// jsonCompare compares two operands, or tests that left exists when op is
+// empty.
+type jsonCompare struct {
+	left, right jsonOperand
+	op          string
+	re          *regexp.Regexp
+}
+
+// jsonOperand is a literal, or a path from @ or $ of which the first match
+// is used.
+type jsonOperand struct {
+	literal  any
+	path     []jsonSegment
+	isPath   bool
+	fromRoot bool
+}
+
+func (e jsonOr) eval(current, root any) bool {
+	return e.left.eval(current, root) || e.right.eval(current, root)
+}
+
+func (e jsonAnd) eval(current, root any) bool {
+	return e.left.eval(current, root) && e.right.eval(current, root)
+}
+
+func (e jsonNot) eval(current, root any) bool {
+	return !e.expr.eval(current, root)
+}
+
+func (o jsonOperand) value(current, root any) (any, bool) {
+	if !o.isPath {
+		return o.literal, true
+	}
+	start := current
+	if o.fromRoot {
+		start = root
+	}
+	locs := locate(o.path, start, root)
+	if len(locs) == 0 {
+		return nil, false
+	}
+	return locs[0].value, true
+}
+
+func (e jsonCompare) eval(current, root any) bool {
+	left, ok := e.left.value(current, root)
+	if !ok {
+		return false
+	}
+	if e.op == "" {
+		if !e.left.isPath {
+			return left != nil && left != false
+		}
+		return true
+	}
+	right, ok := e.right.value(current, root)
+	if !ok {
+		return false
+	}
+
+	switch e.op {
+	case "==":
+		return jsonEqual(left, right)
+	case "!=":
+		return !jsonEqual(left, right)
+	case "=~":
+		s, ok := left.(string)
+		return ok && e.re != nil && e.re.MatchString(s)
+	}
+	var c int
+	if x, ok := jsonNumber(left); ok {
+		y, ok := jsonNumber(right)
+		if !ok {
+			return false
+		}
+		c = cmpFloat(x, y)
+	} else if x, ok := left.(string); ok {
+		y, ok := right.(string)
+		if !ok {
+			return false
+		}
+		c = strings.Compare(x, y)
+	} else {
+		return false
+	}
+	switch e.op {
+	case "<":
+		return c < 0
+	case "<=":
+		return c <= 0
+	case ">":
+		return c > 0
+	}
+	return c >= 0
+}
+
+func cmpFloat(x, y float64) int {
+	switch {
+	case x < y:
+		return -1
+	case x > y:
+		return 1
+	}
+	return 0
+}
+
+func (p *jsonPathParser) orExpr() (jsonExpr, error) {
+	left, err := p.andExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpaces(); p.peek("||"); p.skipSpaces() {
+		p.pos += 2
+		right, err := p.andExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = jsonOr{left, right}
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) andExpr() (jsonExpr, error) {
+	left, err := p.unaryExpr()
+	if err != nil {
+		return nil, err
+	}
+	for p.skipSpaces(); p.peek("&&"); p.skipSpaces() {
+		p.pos += 2
+		right, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		left = jsonAnd{left, right}
+	}
+	return left, nil
+}
+
+func (p *jsonPathParser) unaryExpr() (jsonExpr, error) {
+	p.skipSpaces()
+	switch {
+	case p.peek("!") && !p.peek("!="):
+		p.pos++
+		expr, err := p.unaryExpr()
+		if err != nil {
+			return nil, err
+		}
+		return jsonNot{expr}, nil
+	case p.peek("("):
+		p.pos++
+		expr, err := p.orExpr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.peek(")") {
+			return nil, p.errorf("expected )")
+		}
+		p.pos++
+		return expr, nil
+	}
+
+	left, err := p.operand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	for _, op := range []string{"==", "!=", "<=", ">=", "=~", "<", ">"} {
+		if !p.peek(op) {
+			continue
+		}
+		p.pos += len(op)
+		p.skipSpaces()
+		right, err := p.operand()
+		if err != nil {
+			return nil, err
+		}
+		cmp := jsonCompare{left: left, right: right, op: op}
+		if op == "=~" {
+			pattern, ok := right.literal.(string)
+			if right.isPath || !ok {
+				return nil, p.errorf("=~ expects a string pattern")
+			}
+			if cmp.re, err = regexp.Compile(pattern); err != nil {
+				return nil, p.errorf("invalid regular expression")
+			}
+		}
+		return cmp, nil
+	}
+	return jsonCompare{left: left}, nil
+}
+
+func (p *jsonPathParser) operand() (jsonOperand, error) {
+	p.skipSpaces()
+	switch {
+	case p.peek("@") || p.peek("$"):
+		fromRoot := p.s[p.pos] == '$'
+		p.pos++
+		segments, err := p.segments(true)
+		if err != nil {
+			return jsonOperand{}, err
+		}
+		return jsonOperand{path: segments, isPath: true, fromRoot: fromRoot}, nil
+	case p.peek("'") || p.peek(`"`):
+		s, err := p.quoted()
+		return jsonOperand{literal: s}, err
+	case p.peek("true"):
+		p.pos += 4
+		return jsonOperand{literal: true}, nil
+	case p.peek("false"):
+		p.pos += 5
+		return jsonOperand{literal: false}, nil
+	case p.peek("null"):
+		p.pos += 4
+		return jsonOperand{literal: nil}, nil
+	}
+	start := p.pos
+	for p.pos < len(p.s) && strings.ContainsRune("+-.0123456789eE", rune(p.s[p.pos])) {
+		p.pos++
+	}
+	n, err := parseJSONNumber(p.s[start:p.pos])
+	if p.pos == start || err != nil {
+		return jsonOperand{}, p.errorf("expected a value")
+	}
+	return jsonOperand{literal: n}, nil
+}
+
+// jsonLocation is a matched node and where it is stored: the root when
+// parent is nil, and otherwise a key of a parent object or an index of a
+// parent array.
+type jsonLocation struct {
+	parent *jsonLocation
+	key    string
+	index  int
+	value  any
+}
+
+func (l *jsonLocation) set(j *JSON, v any) {
+	switch {
+	case l.parent == nil:
+		j.root = v
+	case l.parent.isArray():
+		l.parent.value.([]any)[l.index] = v
+	default:
+		l.parent.value.(*JSONObject).Set(l.key, v)
+	}
+	l.value = v
+}
+
+func (l *jsonLocation) isArray() bool {
+	_, ok := l.value.([]any)
+	return ok
+}
+
+// remove deletes the node from its parent.
+func (l *jsonLocation) remove(j *JSON) {
+	if l.parent.isArray() {
+		arr := l.parent.value.([]any)
+		l.parent.set(j, slices.Delete(arr, l.index, l.index+1))
+		return
+	}
+	l.parent.value.(*JSONObject).Delete(l.key)
+}
+
+// locate returns the locations matched by segments starting at node. root
+// is the document root, which filters may refer to.
+func locate(segments []jsonSegment, node, root any) []*jsonLocation {
+	locs := []*jsonLocation{{value: node}}
+	for _, seg := range segments {
+		var next []*jsonLocation
+		for _, l := range locs {
+			if seg.recursive {
+				descend(l, func(d *jsonLocation) {
+					next = append(next, seg.apply(d, root)...)
+				})
+			} else {
+				next = append(next, seg.apply(l, root)...)
+			}
+		}
+		locs = next
+	}
+	return locs
+}
+
+// descend calls fn for l and each of its descendants, parents first.
+func descend(l *jsonLocation, fn func(*jsonLocation)) {
+	fn(l)
+	for _, child := range children(l) {
+		descend(child, fn)
+	}
+}
+
+func children(l *jsonLocation) []*jsonLocation {
+	switch v := l.value.(type) {
+	case []any:
+		result := make([]*jsonLocation, len(v))
+		for i, e := range v {
+			result[i] = &jsonLocation{parent: l, index: i, value: e}
+		}
+		return result
+	case *JSONObject:
+		result := make([]*jsonLocation, len(v.keys))
+		for i, k := range v.keys {
+			result[i] = &jsonLocation{parent: l, key: k, value: v.values[k]}
+		}
+		return result
+	}
+	return nil
+}
+
+func (seg jsonSegment) apply(l *jsonLocation, root any) []*jsonLocation {
+	switch {
+	case seg.wildcard:
+		return children(l)
+	case seg.filter != nil:
+		var result []*jsonLocation
+		for _, child := range children(l) {
+			if seg.filter.eval(child.value, root) {
+				result = append(result, child)
+			}
+		}
+		return result
+	}
+
+	var result []*jsonLocation
+	switch v := l.value.(type) {
+	case *JSONObject:
+		for _, name := range seg.names {
+			if e, ok := v.values[name]; ok {
+				result = append(result, &jsonLocation{parent: l, key: name, value: e})
+			}
+		}
+	case []any:
+		for _, i := range seg.indexes {
+			if i < 0 {
+				i += len(v)
+			}
+			if i >= 0 && i < len(v) {
+				result = append(result, &jsonLocation{parent: l, index: i, value: v[i]})
+			}
+		}
+		if seg.slice != nil {
+			for _, i := range seg.slice.indexes(len(v)) {
+				result = append(result, &jsonLocation{parent: l, index: i, value: v[i]})
+			}
+		}
+	}
+	return result
+}
+
+// indexes returns the indexes the slice selects in an array of n elements,
+// with Python semantics.
+func (s *jsonSlice) indexes(n int) []int {
+	bound := func(p *int, def int) int {
+		if p == nil {
+			return def
+		}
+		i := *p
+		if i < 0 {
+			i += n
+		}
+		if s.step > 0 {
+			return min(max(i, 0), n)
+		}
+		return min(max(i, -1), n-1)
+	}
+	var result []int
+	if s.step > 0 {
+		for i := bound(s.start, 0); i < bound(s.end, n); i += s.step {
+			result = append(result, i)
+		}
+	} else {
+		for i := bound(s.start, n-1); i > bound(s.end, -1); i += s.step {
+			result = append(result, i)
+		}
+	}
+	return result
+}
+
+// Get returns the nodes the path matches. They are shared with the
+// document and must not be modified.
+func (j *JSON) Get(path *JSONPath) []any {
+	j.mu.RLock()
+	defer j.mu.RUnlock()
+	locs := locate(path.segments, j.root, j.root)
+	values := make([]any, len(locs))
+	for i, l := range locs {
+		values[i] = l.value
+	}
+	return values
+}
+
+// Set replaces the nodes the path matches with value, or when it matches
+// none and ends with a child name, adds that member to the objects its
+// parent path matches. With nx it only adds, and with xx it only replaces.
+// It reports whether anything changed.
+func (j *JSON) Set(path *JSONPath, value any, nx, xx bool) bool {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	locs := locate(path.segments, j.root, j.root)
+	if len(locs) > 0 {
+		if nx {
+			return false
+		}
+		for i, l := range locs {
+			v := value
+			if i > 0 {
+				v = CloneJSON(value)
+			}
+			l.set(j, v)
+		}
+		return true
+	}
+
+	last := len(path.segments) - 1
+	if xx || last < 0 {
+		return false
+	}
+	seg := path.segments[last]
+	if seg.recursive || seg.wildcard || seg.filter != nil || len(seg.names) != 1 || len(seg.indexes) > 0 || seg.slice != nil {
+		return false
+	}
+	added := false
+	for _, l := range locate(path.segments[:last], j.root, j.root) {
+		if obj, ok := l.value.(*JSONObject); ok {
+			v := value
+			if added {
+				v = CloneJSON(value)
+			}
+			obj.Set(seg.names[0], v)
+			added = true
+		}
+	}
+	return added
+}
+
+// Delete removes the nodes the path matches and returns how many it
+// removed. Deleting the root is left to the caller, which deletes the key.
+func (j *JSON) Delete(path *JSONPath) int {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	var matches [][]*jsonLocation
+	for _, l := range locate(path.segments, j.root, j.root) {
+		if l.parent != nil {
+			matches = append(matches, l.steps())
+		}
+	}
+	// Removing a node shifts the array elements after it, so nodes are
+	// removed in descending path order: later siblings and nested nodes go
+	// before the nodes they follow or are nested in, and every removal
+	// finds its node by a path that is still valid.
+	slices.SortFunc(matches, func(a, b []*jsonLocation) int { return compareJSONSteps(b, a) })
+	matches = slices.CompactFunc(matches, func(a, b []*jsonLocation) bool { return compareJSONSteps(a, b) == 0 })
+	for _, steps := range matches {
+		j.removeSteps(steps)
+	}
+	return len(matches)
+}
+
+// steps returns the locations leading from the root to l, excluding the
+// root.
+func (l *jsonLocation) steps() []*jsonLocation {
+	var steps []*jsonLocation
+	for ; l.parent != nil; l = l.parent {
+		steps = append(steps, l)
+	}
+	slices.Reverse(steps)
+	return steps
+}
+
+// compareJSONSteps orders paths by their keys and indexes, a path before
+// the paths nested in it.
+func compareJSONSteps(a, b []*jsonLocation) int {
+	for i := range min(len(a), len(b)) {
+		if c := cmp.Or(cmp.Compare(a[i].index, b[i].index), strings.Compare(a[i].key, b[i].key)); c != 0 {
+			return c
+		}
+	}
+	return cmp.Compare(len(a), len(b))
+}
+
+// removeSteps removes the node at the end of steps, following the keys
+// and indexes from the root in the current document.
+func (j *JSON) removeSteps(steps []*jsonLocation) {
+	l := &jsonLocation{value: j.root}
+	for _, step := range steps {
+		child := &jsonLocation{parent: l, key: step.key, index: step.index}
+		switch v := l.value.(type) {
+		case []any:
+			child.value = v[step.index]
+		case *JSONObject:
+			child.value, _ = v.Get(step.key)
+		}
+		l = child
+	}
+	l.remove(j)
+}
+
+// Update calls fn with each node the path matches and replaces the node
+// with the value fn returns when changed is set. Matches are visited in
+// reverse order, so that nodes nested in other matches are updated before
+// the nodes containing them, and Update stops at the first error fn
+// returns.
+func (j *JSON) Update(path *JSONPath, fn func(v any) (updated any, changed bool, err error)) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	locs := locate(path.segments, j.root, j.root)
+	for i := len(locs) - 1; i >= 0; i-- {
+		updated, changed, err := fn(locs[i].value)
+		if err != nil {
+			return err
+		}
+		if changed {
+			locs[i].set(j, updated)
+		}
+	}
+	return nil
+}
+
+// CloneJSON returns a deep copy of a node, so that a value set at several
+// locations is not shared between them.
+func CloneJSON(v any) any {
+	switch t := v.(type) {
+	case []any:
+		arr := make([]any, len(t))
+		for i, e := range t {
+			arr[i] = CloneJSON(e)
+		}
+		return arr
+	case *JSONObject:
+		obj := NewJSONObject()
+		for _, k := range t.keys {
+			obj.Set(k, CloneJSON(t.values[k]))
+		}
+		return obj
+	}
+	return v
+}
@@ -0,0 +1,162 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+const jsonStore = `{"store":{"book":[
+	{"category":"reference","author":"Nigel Rees","title":"Sayings of the Century","price":8.95},
+	{"category":"fiction","author":"Evelyn Waugh","title":"Sword of Honour","price":12.99},
+	{"category":"fiction","author":"Herman Melville","title":"Moby Dick","isbn":"0-553-21311-3","price":8.99},
+	{"category":"fiction","author":"J. R. R. Tolkien","title":"The Lord of the Rings","isbn":"0-395-19395-8","price":22.99}],
+	"bicycle":{"color":"red","price":19.95}},"expensive":10}`
+
+func mustJSON(t *testing.T, data string) *JSON {
+	t.Helper()
+	root, err := ParseJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return NewJSON(root)
+}
+
+func mustPath(t *testing.T, s string) *JSONPath {
+	t.Helper()
+	path, err := ParseJSONPath(s)
+	if err != nil {
+		t.Fatalf("ParseJSONPath(%q): %v", s, err)
+	}
+	return path
+}
+
+func compactJSON(v any) string {
+	return JSONFormat{}.Marshal(v)
+}
+
+// marshalAll serializes the matches of a path as one compact JSON array.
+func marshalAll(values []any) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = compactJSON(v)
+	}
+	return "[" + strings.Join(parts, ",") + "]"
+}
+
+func TestJSONPathGet(t *testing.T) {
+	doc := mustJSON(t, jsonStore)
+	for _, tt := range []struct{ path, want string }{
+		{"$", ""},
+		{"$.store.book[*].author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$..author", `["Nigel Rees","Evelyn Waugh","Herman Melville","J. R. R. Tolkien"]`},
+		{"$.store.*.color", `["red"]`},
+		{"$..book[2].title", `["Moby Dick"]`},
+		{"$..book[-1].title", `["The Lord of the Rings"]`},
+		{"$..book[0,1].price", `[8.95,12.99]`},
+		{"$..book[:2].price", `[8.95,12.99]`},
+		{"$..book[1:3].price", `[12.99,8.99]`},
+		{"$..book[::-2].price", `[22.99,12.99]`},
+		{"$..book[?(@.isbn)].title", `["Moby Dick","The Lord of the Rings"]`},
+		{"$..book[?(@.price < 10)].title", `["Sayings of the Century","Moby Dick"]`},
+		{"$..book[?(@.price > $.expensive && @.category == 'fiction')].price", `[12.99,22.99]`},
+		{"$..book[?(!(@.price < 20) || @.author == 'Nigel Rees')].price", `[8.95,22.99]`},
+		{"$['store']['bicycle']['color']", `["red"]`},
+		{"$.store.missing", `[]`},
+		{"$..book[10]", `[]`},
+		{"store.bicycle.price", `[19.95]`},
+		{".store.book[0].price", `[8.95]`},
+	} {
+		got := marshalAll(doc.Get(mustPath(t, tt.path)))
+		if tt.want == "" {
+			tt.want = "[" + compactJSON(doc.root) + "]"
+		}
+		if got != tt.want {
+			t.Errorf("Get(%s) = %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestJSONPathLegacy(t *testing.T) {
+	tests := []struct {
+		path   string
+		legacy bool
+	}{{"$.a", false}, {".a", true}, {"a", true}, {".", true}, {"[0]", true}}
+	for _, tt := range tests {
+		if p := mustPath(t, tt.path); p.Legacy != tt.legacy {
+			t.Errorf("ParseJSONPath(%q).Legacy = %v, want %v", tt.path, p.Legacy, tt.legacy)
+		}
+	}
+	if !mustPath(t, ".").IsRoot() || !mustPath(t, "$").IsRoot() {
+		t.Error("the root paths are not IsRoot")
+	}
+}
+
+func TestJSONPathParseErrors(t *testing.T) {
+	for _, s := range []string{"$.", "$[", "$['a'", "$[1:2:0]", "$[?(@.a <)]", "$..", "$[a]"} {
+		if _, err := ParseJSONPath(s); err == nil {
+			t.Errorf("ParseJSONPath(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestJSONSet(t *testing.T) {
+	doc := mustJSON(t, `{"a":{"b":1},"c":[{"d":1},{"d":2}],"e":[]}`)
+	set := func(path, value string, nx, xx bool) bool {
+		t.Helper()
+		v, err := ParseJSON(value)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return doc.Set(mustPath(t, path), v, nx, xx)
+	}
+	if !set("$.a.b", "2", false, true) {
+		t.Error("XX Set of an existing member failed")
+	}
+	if set("$.a.b", "3", true, false) {
+		t.Error("NX Set replaced an existing member")
+	}
+	if !set("$.a.new", `"x"`, true, false) {
+		t.Error("NX Set of a new member failed")
+	}
+	if set("$.a.x.y", "1", false, false) {
+		t.Error("Set created a member under a missing parent")
+	}
+	if set("$.e[0]", "1", false, false) {
+		t.Error("Set added an array element by index")
+	}
+	// A value set at several matches must not be shared between them.
+	if !set("$.c[*].d", `{"n":0}`, false, false) {
+		t.Error("Set of every array element failed")
+	}
+	doc.Update(mustPath(t, "$.c[0].d.n"), func(any) (any, bool, error) { return int64(5), true, nil })
+
+	want := `{"a":{"b":2,"new":"x"},"c":[{"d":{"n":5}},{"d":{"n":0}}],"e":[]}`
+	if got := compactJSON(doc.root); got != want {
+		t.Fatalf("document = %s, want %s", got, want)
+	}
+}
+
+func TestJSONDelete(t *testing.T) {
+	for _, tt := range []struct {
+		path string
+		n    int
+		want string
+	}{
+		{"$.a[1:3]", 2, `{"a":[0,3,4],"b":{"a":[1]}}`},
+		{"$.a[3,0]", 2, `{"a":[1,2,4],"b":{"a":[1]}}`},
+		{"$.a[0,0]", 1, `{"a":[1,2,3,4],"b":{"a":[1]}}`},
+		{"$.a[::-2]", 3, `{"a":[1,3],"b":{"a":[1]}}`},
+		{"$..a", 2, `{"b":{}}`},
+		{"$.a[?(@ > 2)]", 2, `{"a":[0,1,2],"b":{"a":[1]}}`},
+		{"$.missing", 0, `{"a":[0,1,2,3,4],"b":{"a":[1]}}`},
+		{"$", 0, `{"a":[0,1,2,3,4],"b":{"a":[1]}}`},
+	} {
+		doc := mustJSON(t, `{"a":[0,1,2,3,4],"b":{"a":[1]}}`)
+		if n := doc.Delete(mustPath(t, tt.path)); n != tt.n {
+			t.Errorf("Delete(%s) = %d, want %d", tt.path, n, tt.n)
+		}
+		if got := compactJSON(doc.root); got != tt.want {
+			t.Errorf("after Delete(%s) the document is %s, want %s", tt.path, got, tt.want)
+		}
+	}
+}
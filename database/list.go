@@ -2,59 +2,400 @@ package database
 
 import "sync"
 
+// listChunkSize is the number of elements held by each node of a List.
+const listChunkSize = 128
+
+// listNode is a fixed-size chunk of a List. Its live elements are
+// items[start:end], so it can grow towards either end without copying.
+type listNode struct {
+	prev, next *listNode
+	items      [listChunkSize]string
+	start, end int
+}
+
+func (n *listNode) len() int {
+	return n.end - n.start
+}
+
+// List is a doubly linked list of chunks, like the Redis quicklist: pushes
+// and pops at either end are O(1) and indexing walks O(n/listChunkSize)
+// nodes from the nearer end.
 type List struct {
-	mu  sync.RWMutex
-	elements []string
+	mu     sync.RWMutex
+	head   *listNode
+	tail   *listNode
+	length int
 }
 
 func NewList() *List {
-	return &List{
-		elements: make([]string, 0),
-	}
+	return &List{}
 }
 
 func (l *List) Type() string {
 	return "list"
 }
 
+// LPush inserts the elements one after the other at the head, so
+// LPush("a", "b", "c") leaves the list as c b a, as in Redis.
 func (l *List) LPush(elements ...string) int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.elements = append(elements, l.elements...)
-	return len(l.elements)
+	for _, element := range elements {
+		l.pushFront(element)
+	}
+	return l.length
 }
 
 func (l *List) RPush(elements ...string) int {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	l.elements = append(l.elements, elements...)
-	return len(l.elements)
+	for _, element := range elements {
+		l.pushBack(element)
+	}
+	return l.length
 }
 
 func (l *List) LPop() (string, bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if len(l.elements) == 0 {
+	if l.length == 0 {
 		return "", false
 	}
-	val := l.elements[0]
-	l.elements = l.elements[1:]
-	return val, true
+	return l.popFront(), true
 }
 
 func (l *List) RPop() (string, bool) {
 	l.mu.Lock()
 	defer l.mu.Unlock()
-	if len(l.elements) == 0 {
+	if l.length == 0 {
 		return "", false
 	}
-	val := l.elements[len(l.elements)-1]
-	l.elements = l.elements[:len(l.elements)-1]
-	return val, true
+	return l.popBack(), true
 }
 
 func (l *List) LLen() int {
 	l.mu.RLock()
 	defer l.mu.RUnlock()
-	return len(l.elements)
-}
\ No newline at end of file
+	return l.length
+}
+
+// Index returns the element at index, counting from the tail when index is
+// negative.
+func (l *List) Index(index int) (string, bool) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	if index < 0 {
+		index += l.length
+	}
+	if index < 0 || index >= l.length {
+		return "", false
+	}
+	node, i := l.locate(index)
+	return node.items[i], true
+}
+
+// Range returns the elements between start and stop inclusive, which must
+// already be normalized to 0 <= start <= stop < LLen.
+func (l *List) Range(start, stop int) []string {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	result := make([]string, 0, stop-start+1)
+	node, i := l.locate(start)
+	for len(result) < cap(result) {
+		result = append(result, node.items[i])
+		if i++; i == node.end {
+			node = node.next
+			if node != nil {
+				i = node.start
+			}
+		}
+	}
+	return result
+}
+
+func (l *List) pushFront(element string) {
+	if l.head == nil || l.head.start == 0 {
+		node := &listNode{next: l.head, start: listChunkSize, end: listChunkSize}
+		if l.head != nil {
+			l.head.prev = node
+		} else {
+			l.tail = node
+		}
+		l.head = node
+	}
+	l.head.start--
+	l.head.items[l.head.start] = element
+	l.length++
+}
+
+func (l *List) pushBack(element string) {
+	if l.tail == nil || l.tail.end == listChunkSize {
+		node := &listNode{prev: l.tail}
+		if l.tail != nil {
+			l.tail.next = node
+		} else {
+			l.head = node
+		}
+		l.tail = node
+	}
+	l.tail.items[l.tail.end] = element
+	l.tail.end++
+	l.length++
+}
+
+func (l *List) popFront() string {
+	node := l.head
+	element := node.items[node.start]
+	node.items[node.start] = ""
+	node.start++
+	l.length--
+	if node.len() == 0 {
+		l.unlink(node)
+	}
+	return element
+}
+
+func (l *List) popBack() string {
+	node := l.tail
+	node.end--
+	element := node.items[node.end]
+	node.items[node.end] = ""
+	l.length--
+	if node.len() == 0 {
+		l.unlink(node)
+	}
+	return element
+}
+
+func (l *List) unlink(node *listNode) {
+	if node.prev != nil {
+		node.prev.next = node.next
+	} else {
+		l.head = node.next
+	}
+	if node.next != nil {
+		node.next.prev = node.prev
+	} else {
+		l.tail = node.prev
+	}
+	node.prev, node.next = nil, nil
+}
+
+// locate returns the node holding index and the position of the element in
+// its items, walking from whichever end is closer.
+func (l *List) locate(index int) (*listNode, int) {
+	if index < l.length/2 {
+		node := l.head
+		for index >= node.len() {
+			index -= node.len()
+			node = node.next
+		}
+		return node, node.start + index
+	}
+	index = l.length - 1 - index
+	node := l.tail
+	for index >= node.len() {
+		index -= node.len()
+		node = node.prev
+	}
+	return node, node.end - 1 - index
+}
+
+// Set replaces the element at index, counting from the tail when index is
+// negative. It reports false when index is out of range.
+func (l *List) Set(index int, element string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if index < 0 {
+		index += l.length
+	}
+	if index < 0 || index >= l.length {
+		return false
+	}
+	node, i := l.locate(index)
+	node.items[i] = element
+	return true
+}
+
+// Insert puts element before or after the first occurrence of pivot and
+// returns the new length, or -1 when pivot is not in the list.
+func (l *List) Insert(pivot, element string, after bool) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for node := l.head; node != nil; node = node.next {
+		for i := node.start; i < node.end; i++ {
+			if node.items[i] == pivot {
+				if after {
+					i++
+				}
+				l.insertAt(node, i, element)
+				return l.length
+			}
+		}
+	}
+	return -1
+}
+
+// Remove deletes up to count occurrences of element, scanning from the head
+// when count is positive and from the tail when it is negative. A count of
+// zero removes every occurrence. It returns the number removed.
+func (l *List) Remove(count int, element string) int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	limit := count
+	if limit < 0 {
+		limit = -limit
+	}
+	removed := 0
+	match := func(s string) bool {
+		return s == element && (limit == 0 || removed < limit)
+	}
+
+	if count >= 0 {
+		for node := l.head; node != nil && (limit == 0 || removed < limit); {
+			next := node.next
+			w := node.start
+			for r := node.start; r < node.end; r++ {
+				if match(node.items[r]) {
+					removed++
+					continue
+				}
+				node.items[w] = node.items[r]
+				w++
+			}
+			clear(node.items[w:node.end])
+			node.end = w
+			if node.len() == 0 {
+				l.unlink(node)
+			}
+			node = next
+		}
+	} else {
+		for node := l.tail; node != nil && removed < limit; {
+			prev := node.prev
+			w := node.end
+			for r := node.end - 1; r >= node.start; r-- {
+				if match(node.items[r]) {
+					removed++
+					continue
+				}
+				w--
+				node.items[w] = node.items[r]
+			}
+			clear(node.items[node.start:w])
+			node.start = w
+			if node.len() == 0 {
+				l.unlink(node)
+			}
+			node = prev
+		}
+	}
+	l.length -= removed
+	return removed
+}
+
+// Trim keeps only the elements between start and stop inclusive, which must
+// already be normalized against LLen. When start > stop the list is emptied.
+func (l *List) Trim(start, stop int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if start > stop {
+		start, stop = l.length, l.length-1
+	}
+	tail := l.length - 1 - stop
+	for i := 0; i < start; i++ {
+		l.popFront()
+	}
+	for i := 0; i < tail; i++ {
+		l.popBack()
+	}
+}
+
+// Positions returns the indexes of element as LPOS does: rank selects the
+// first match to report (negative to scan from the tail), count caps the
+// number of results (0 for all) and maxLen caps the number of elements
+// compared (0 for all).
+func (l *List) Positions(element string, rank, count, maxLen int) []int {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	reverse := rank < 0
+	skip := rank - 1
+	if reverse {
+		skip = -rank - 1
+	}
+	positions := make([]int, 0)
+	compared := 0
+	l.each(reverse, func(index int, e string) bool {
+		if maxLen != 0 && compared == maxLen {
+			return false
+		}
+		compared++
+		if e != element {
+			return true
+		}
+		if skip > 0 {
+			skip--
+			return true
+		}
+		positions = append(positions, index)
+		return count == 0 || len(positions) < count
+	})
+	return positions
+}
+
+// each calls fn for every element with its index, from the head or from the
+// tail, until fn returns false.
+func (l *List) each(reverse bool, fn func(index int, element string) bool) {
+	if !reverse {
+		index := 0
+		for node := l.head; node != nil; node = node.next {
+			for i := node.start; i < node.end; i++ {
+				if !fn(index, node.items[i]) {
+					return
+				}
+				index++
+			}
+		}
+		return
+	}
+	index := l.length - 1
+	for node := l.tail; node != nil; node = node.prev {
+		for i := node.end - 1; i >= node.start; i-- {
+			if !fn(index, node.items[i]) {
+				return
+			}
+			index--
+		}
+	}
+}
+
+// insertAt inserts element before node.items[i], splitting node in two when
+// it is full.
+func (l *List) insertAt(node *listNode, i int, element string) {
+	if node.len() == listChunkSize {
+		mid := listChunkSize / 2
+		next := &listNode{prev: node, next: node.next}
+		next.end = copy(next.items[:], node.items[mid:])
+		clear(node.items[mid:])
+		node.end = mid
+		if node.next != nil {
+			node.next.prev = next
+		} else {
+			l.tail = next
+		}
+		node.next = next
+		if i > mid {
+			node, i = next, i-mid
+		}
+	}
+	if node.end < listChunkSize {
+		copy(node.items[i+1:node.end+1], node.items[i:node.end])
+		node.items[i] = element
+		node.end++
+	} else {
+		copy(node.items[node.start-1:i-1], node.items[node.start:i])
+		node.start--
+		node.items[i-1] = element
+	}
+	l.length++
+}
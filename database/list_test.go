@@ -0,0 +1,166 @@
+package database
+
+import (
+	"math/rand"
+	"slices"
+	"strconv"
+	"testing"
+)
+
+// checkList compares every element of l, read with Index and Range, against
+// want.
+func checkList(t *testing.T, l *List, want []string) {
+	t.Helper()
+	if l.LLen() != len(want) {
+		t.Fatalf("LLen = %d, want %d", l.LLen(), len(want))
+	}
+	for i := range want {
+		if got, _ := l.Index(i); got != want[i] {
+			t.Fatalf("Index(%d) = %q, want %q", i, got, want[i])
+		}
+		if got, _ := l.Index(i - len(want)); got != want[i] {
+			t.Fatalf("Index(%d) = %q, want %q", i-len(want), got, want[i])
+		}
+	}
+	if len(want) > 0 && !slices.Equal(l.Range(0, len(want)-1), want) {
+		t.Fatalf("Range = %q, want %q", l.Range(0, len(want)-1), want)
+	}
+}
+
+func TestListPushPopAcrossChunks(t *testing.T) {
+	l := NewList()
+	var want []string
+	for i := 0; i < 3*listChunkSize; i++ {
+		e := strconv.Itoa(i)
+		if i%2 == 0 {
+			l.LPush(e)
+			want = append([]string{e}, want...)
+		} else {
+			l.RPush(e)
+			want = append(want, e)
+		}
+	}
+	checkList(t, l, want)
+	if _, ok := l.Index(len(want)); ok {
+		t.Fatal("Index past the end reported an element")
+	}
+
+	for len(want) > 0 {
+		if e, _ := l.LPop(); e != want[0] {
+			t.Fatalf("LPop = %q, want %q", e, want[0])
+		}
+		want = want[1:]
+		if len(want) == 0 {
+			break
+		}
+		if e, _ := l.RPop(); e != want[len(want)-1] {
+			t.Fatalf("RPop = %q, want %q", e, want[len(want)-1])
+		}
+		want = want[:len(want)-1]
+	}
+	if _, ok := l.RPop(); ok {
+		t.Fatal("RPop on an empty list reported an element")
+	}
+	if l.head != nil || l.tail != nil {
+		t.Fatal("an emptied list kept its nodes")
+	}
+}
+
+func TestListEditsMatchSlice(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	l := NewList()
+	var want []string
+	for i := 0; i < 2000; i++ {
+		e := strconv.Itoa(rng.Intn(50))
+		switch op := rng.Intn(6); {
+		case op < 2 || len(want) == 0:
+			l.RPush(e)
+			want = append(want, e)
+		case op == 2:
+			pivot := want[rng.Intn(len(want))]
+			at := slices.Index(want, pivot)
+			if at+1 <= len(want) && rng.Intn(2) == 0 {
+				l.Insert(pivot, e, true)
+				want = slices.Insert(want, at+1, e)
+			} else {
+				l.Insert(pivot, e, false)
+				want = slices.Insert(want, at, e)
+			}
+		case op == 3:
+			index := rng.Intn(len(want))
+			l.Set(index, e)
+			want[index] = e
+		case op == 4:
+			count := rng.Intn(5) - 2
+			removed := l.Remove(count, e)
+			n := 0
+			if count >= 0 {
+				want = slices.DeleteFunc(want, func(s string) bool {
+					if s == e && (count == 0 || n < count) {
+						n++
+						return true
+					}
+					return false
+				})
+			} else {
+				for j := len(want) - 1; j >= 0 && n < -count; j-- {
+					if want[j] == e {
+						want = slices.Delete(want, j, j+1)
+						n++
+					}
+				}
+			}
+			if removed != n {
+				t.Fatalf("Remove(%d, %q) = %d, want %d", count, e, removed, n)
+			}
+		default:
+			if len(want) > 10 {
+				start, stop := 1, len(want)-2
+				l.Trim(start, stop)
+				want = want[start : stop+1]
+			}
+		}
+	}
+	checkList(t, l, want)
+}
+
+// benchListSize is the length of the lists the benchmarks run against, large
+// enough that an O(n) push or pop would dominate.
+const benchListSize = 10_000_000
+
+func newBenchList() *List {
+	l := NewList()
+	for i := 0; i < benchListSize; i++ {
+		l.RPush("element")
+	}
+	return l
+}
+
+func BenchmarkListLPush(b *testing.B) {
+	l := newBenchList()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.LPush("element")
+	}
+}
+
+func BenchmarkListRPop(b *testing.B) {
+	l := newBenchList()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, ok := l.RPop(); !ok {
+			b.StopTimer()
+			l = newBenchList()
+			b.StartTimer()
+		}
+	}
+}
+
+// BenchmarkListIndex reads the middle element, the farthest from either end.
+func BenchmarkListIndex(b *testing.B) {
+	l := newBenchList()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		l.Index(benchListSize / 2)
+	}
+}
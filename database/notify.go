@@ -0,0 +1,90 @@
+package database
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// Keyspace event classes. They mirror the class characters accepted by the
+// notify-keyspace-events configuration.
+const (
+	NotifyKeyspace = 1 << iota // K
+	NotifyKeyevent             // E
+	NotifyGeneric              // g
+	NotifyString               // $
+	NotifyList                 // l
+	NotifySet                  // s
+	NotifyHash                 // h
+	NotifyZSet                 // z
+	NotifyExpired              // x
+	NotifyEvicted              // e
+	NotifyStream               // t
+	NotifyKeyMiss              // m
+	NotifyModule               // d
+	NotifyNew                  // n
+
+	// NotifyInternal marks changes that Redis publishes no event for, such
+	// as XACK. Listeners still see them, so they count as writes, but no
+	// notify-keyspace-events flag enables them.
+	NotifyInternal
+
+	NotifyAll = NotifyGeneric | NotifyString | NotifyList | NotifySet | NotifyHash |
+		NotifyZSet | NotifyExpired | NotifyEvicted | NotifyStream | NotifyModule // A
+)
+
+type KeyspaceListener func(class int, event, key string)
+
+type listeners struct {
+	mu       sync.RWMutex
+	fns      []KeyspaceListener
+	fieldFns []FieldExpiryListener
+
+	// noKeyMiss counts the callers of SuppressKeyMiss that have not
+	// restored it; lookups report no keymiss events while it is positive.
+	noKeyMiss atomic.Int32
+}
+
+func (db *Database) AddKeyspaceListener(l KeyspaceListener) {
+	db.listeners.mu.Lock()
+	defer db.listeners.mu.Unlock()
+	db.listeners.fns = append(db.listeners.fns, l)
+}
+
+// Notify reports a keyspace event to every registered listener and wakes
+// clients blocked on key. It must not be called while holding the database
+// lock, since listeners may read keys back.
+func (db *Database) Notify(class int, event, key string) {
+	db.signalReady(key)
+
+	db.listeners.mu.RLock()
+	fns := db.listeners.fns
+	db.listeners.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(class, event, key)
+	}
+}
+
+// SuppressKeyMiss stops lookups from reporting keymiss events until the
+// returned function is called. The processor wraps write commands in it,
+// since Redis only reports the misses of reads.
+func (db *Database) SuppressKeyMiss() (restore func()) {
+	db.listeners.noKeyMiss.Add(1)
+	return func() { db.listeners.noKeyMiss.Add(-1) }
+}
+
+// keyMiss reports a lookup of a missing key. Unlike Notify it wakes no
+// blocked clients, since nothing changed.
+func (db *Database) keyMiss(key string) {
+	if db.listeners.noKeyMiss.Load() > 0 {
+		return
+	}
+
+	db.listeners.mu.RLock()
+	fns := db.listeners.fns
+	db.listeners.mu.RUnlock()
+
+	for _, fn := range fns {
+		fn(NotifyKeyMiss, "keymiss", key)
+	}
+}
@@ -0,0 +1,38 @@
+package database
+
+import (
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestKeyMiss(t *testing.T) {
+	db := NewDatabase()
+	var events []string
+	db.AddKeyspaceListener(func(class int, event, key string) {
+		if (class == NotifyKeyMiss) != (event == "keymiss") {
+			t.Errorf("event %s has class %d", event, class)
+		}
+		events = append(events, event+" "+key)
+	})
+
+	db.Set("k", NewString("v"), 0)
+	db.Set("short", NewString("v"), time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	events = nil
+
+	db.Get("k")
+	db.Get("missing")
+	db.Exists("missing")
+	db.Type("missing")
+	db.Get("short")
+	restore := db.SuppressKeyMiss()
+	db.Get("suppressed")
+	restore()
+	db.Peek("peeked")
+
+	want := []string{"keymiss missing", "keymiss missing", "keymiss missing", "expired short", "keymiss short"}
+	if !slices.Equal(events, want) {
+		t.Fatalf("got events %q, want %q", events, want)
+	}
+}
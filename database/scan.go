@@ -0,0 +1,79 @@
+package database
+
+// scanTable is a map whose entries are also kept in a dense slice, so it
+// can be iterated incrementally with a SCAN cursor.
+//
+// Deleting an entry moves the last entry into its slot, and scan walks the
+// slice from the end towards the start. An entry therefore only ever moves
+// to a lower position, into the part a cursor has not visited yet, so every
+// entry present for a whole iteration is returned at least once. Entries
+// added meanwhile are appended behind the cursor and may be missed, and an
+// entry moved by a delete may be returned twice, as with Redis.
+type scanTable[V any] struct {
+	index   map[string]int
+	entries []scanEntry[V]
+}
+
+type scanEntry[V any] struct {
+	key   string
+	value V
+}
+
+func newScanTable[V any]() scanTable[V] {
+	return scanTable[V]{index: make(map[string]int)}
+}
+
+func (t *scanTable[V]) len() int {
+	return len(t.entries)
+}
+
+func (t *scanTable[V]) get(key string) (V, bool) {
+	i, ok := t.index[key]
+	if !ok {
+		var zero V
+		return zero, false
+	}
+	return t.entries[i].value, true
+}
+
+// set stores value under key and reports whether key is new.
+func (t *scanTable[V]) set(key string, value V) bool {
+	if i, ok := t.index[key]; ok {
+		t.entries[i].value = value
+		return false
+	}
+	t.index[key] = len(t.entries)
+	t.entries = append(t.entries, scanEntry[V]{key: key, value: value})
+	return true
+}
+
+func (t *scanTable[V]) delete(key string) bool {
+	i, ok := t.index[key]
+	if !ok {
+		return false
+	}
+	last := len(t.entries) - 1
+	if i != last {
+		t.entries[i] = t.entries[last]
+		t.index[t.entries[i].key] = i
+	}
+	t.entries[last] = scanEntry[V]{}
+	t.entries = t.entries[:last]
+	delete(t.index, key)
+	return true
+}
+
+// scan visits up to count entries starting at cursor, which is 0 to start
+// an iteration, and returns the cursor for the next call, 0 once the
+// iteration is complete.
+func (t *scanTable[V]) scan(cursor uint64, count int, fn func(key string, value V)) uint64 {
+	remaining := len(t.entries)
+	if cursor != 0 && cursor < uint64(remaining) {
+		remaining = int(cursor)
+	}
+	for ; remaining > 0 && count > 0; count-- {
+		remaining--
+		fn(t.entries[remaining].key, t.entries[remaining].value)
+	}
+	return uint64(remaining)
+}
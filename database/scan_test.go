@@ -0,0 +1,69 @@
+package database
+
+import (
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+// TestScanTableReturnsSurvivors deletes and adds entries between the calls
+// of an iteration and checks that every entry present throughout it was
+// returned.
+func TestScanTableReturnsSurvivors(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for round := 0; round < 100; round++ {
+		table := newScanTable[int]()
+		for i := 0; i < 200; i++ {
+			table.set(strconv.Itoa(i), i)
+		}
+		deleted := make(map[string]bool)
+		seen := make(map[string]bool)
+		next := 200
+
+		cursor := uint64(0)
+		for {
+			cursor = table.scan(cursor, 1+rng.Intn(20), func(key string, _ int) {
+				seen[key] = true
+			})
+			if cursor == 0 {
+				break
+			}
+			for range rng.Intn(10) {
+				key := strconv.Itoa(rng.Intn(next))
+				if table.delete(key) {
+					deleted[key] = true
+				}
+			}
+			for range rng.Intn(5) {
+				table.set(strconv.Itoa(next), next)
+				deleted[strconv.Itoa(next)] = true // not present throughout
+				next++
+			}
+		}
+
+		for i := 0; i < 200; i++ {
+			if key := strconv.Itoa(i); !deleted[key] && !seen[key] {
+				t.Fatalf("round %d: the scan missed %s", round, key)
+			}
+		}
+	}
+}
+
+func TestScanTableDelete(t *testing.T) {
+	table := newScanTable[string]()
+	for _, k := range []string{"a", "b", "c"} {
+		table.set(k, k+k)
+	}
+	if table.set("a", "x") {
+		t.Error("set of an existing key reported it as new")
+	}
+	if !table.delete("a") || table.delete("a") {
+		t.Error("delete did not remove a exactly once")
+	}
+	if v, ok := table.get("c"); !ok || v != "cc" {
+		t.Errorf("get(c) = %q, %v after moving c into a's slot", v, ok)
+	}
+	if _, ok := table.get("a"); ok || table.len() != 2 {
+		t.Errorf("the table still holds a or has %d entries", table.len())
+	}
+}
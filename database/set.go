@@ -1,15 +1,26 @@
 package database
 
-import "sync"
+import (
+	"math/rand"
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// setIDs numbers sets so that operations on several of them can lock them
+// in a fixed order.
+var setIDs atomic.Uint64
 
 type Set struct {
-	mu   sync.RWMutex
-	data map[string]struct{} 
+	mu      sync.RWMutex
+	id      uint64
+	members scanTable[struct{}]
 }
 
 func NewSet() *Set {
 	return &Set{
-		data: make(map[string]struct{}),
+		id:      setIDs.Add(1),
+		members: newScanTable[struct{}](),
 	}
 }
 
@@ -22,8 +33,7 @@ func (s *Set) SAdd(members ...string) int {
 	defer s.mu.Unlock()
 	addedCount := 0
 	for _, member := range members {
-		if _, ok := s.data[member]; !ok {
-			s.data[member] = struct{}{}
+		if s.members.set(member, struct{}{}) {
 			addedCount++
 		}
 	}
@@ -35,8 +45,7 @@ func (s *Set) SRem(members ...string) int {
 	defer s.mu.Unlock()
 	removedCount := 0
 	for _, member := range members {
-		if _, ok := s.data[member]; ok {
-			delete(s.data, member)
+		if s.members.delete(member) {
 			removedCount++
 		}
 	}
@@ -46,12 +55,174 @@ func (s *Set) SRem(members ...string) int {
 func (s *Set) SIsMember(member string) bool {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	_, ok := s.data[member]
+	_, ok := s.members.get(member)
 	return ok
 }
 
 func (s *Set) SCard() int {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
-	return len(s.data)
-}
\ No newline at end of file
+	return s.members.len()
+}
+
+// SScan visits up to count members from cursor as described on scanTable
+// and returns the next cursor.
+func (s *Set) SScan(cursor uint64, count int, fn func(member string)) uint64 {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.members.scan(cursor, count, func(member string, _ struct{}) {
+		fn(member)
+	})
+}
+
+func (s *Set) SMembers() []string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.keys()
+}
+
+// SRandMember returns a random member without removing it.
+func (s *Set) SRandMember() (string, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.members.len() == 0 {
+		return "", false
+	}
+	return s.members.entries[rand.Intn(s.members.len())].key, true
+}
+
+func (s *Set) keys() []string {
+	keys := make([]string, s.members.len())
+	for i, e := range s.members.entries {
+		keys[i] = e.key
+	}
+	return keys
+}
+
+func (s *Set) has(member string) bool {
+	_, ok := s.members.get(member)
+	return ok
+}
+
+// lockSets read-locks the distinct sets among sets in ascending id order,
+// the order every multi-set operation uses, and returns the unlock function.
+func lockSets(sets []*Set) func() {
+	ordered := make([]*Set, 0, len(sets))
+	seen := make(map[*Set]bool, len(sets))
+	for _, set := range sets {
+		if !seen[set] {
+			seen[set] = true
+			ordered = append(ordered, set)
+		}
+	}
+	sort.Slice(ordered, func(i, j int) bool { return ordered[i].id < ordered[j].id })
+	for _, set := range ordered {
+		set.mu.RLock()
+	}
+	return func() {
+		for _, set := range ordered {
+			set.mu.RUnlock()
+		}
+	}
+}
+
+// SInter returns the members common to all sets.
+func SInter(sets ...*Set) []string {
+	result := make([]string, 0)
+	sinter(sets, 0, func(member string) { result = append(result, member) })
+	return result
+}
+
+// SInterCard returns the size of the intersection of sets, stopping once it
+// reaches limit when limit is positive.
+func SInterCard(limit int, sets ...*Set) int {
+	count := 0
+	sinter(sets, limit, func(string) { count++ })
+	return count
+}
+
+// sinter calls fn for each member of the intersection, up to limit when it
+// is positive. It walks the smallest set and looks its members up in the
+// others, from the next smallest on, so a miss is found early.
+func sinter(sets []*Set, limit int, fn func(member string)) {
+	if len(sets) == 0 {
+		return
+	}
+	defer lockSets(sets)()
+	bySize := append([]*Set(nil), sets...)
+	sort.Slice(bySize, func(i, j int) bool { return bySize[i].members.len() < bySize[j].members.len() })
+
+	found := 0
+	for _, e := range bySize[0].members.entries {
+		inAll := true
+		for _, other := range bySize[1:] {
+			if !other.has(e.key) {
+				inAll = false
+				break
+			}
+		}
+		if !inAll {
+			continue
+		}
+		fn(e.key)
+		if found++; limit > 0 && found == limit {
+			return
+		}
+	}
+}
+
+// SUnion returns the members found in any of sets.
+func SUnion(sets ...*Set) []string {
+	defer lockSets(sets)()
+	seen := make(map[string]struct{})
+	result := make([]string, 0)
+	for _, set := range sets {
+		for _, e := range set.members.entries {
+			if _, dup := seen[e.key]; !dup {
+				seen[e.key] = struct{}{}
+				result = append(result, e.key)
+			}
+		}
+	}
+	return result
+}
+
+// SDiff returns the members of first that are in none of others.
+func SDiff(first *Set, others ...*Set) []string {
+	defer lockSets(append([]*Set{first}, others...))()
+	result := make([]string, 0)
+	for _, e := range first.members.entries {
+		found := false
+		for _, other := range others {
+			if other == first || other.has(e.key) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			result = append(result, e.key)
+		}
+	}
+	return result
+}
+
+// SMove moves member from src to dst as one step, locking both sets in id
+// order. It reports whether member was in src.
+func SMove(src, dst *Set, member string) bool {
+	if src == dst {
+		return src.SIsMember(member)
+	}
+	first, second := src, dst
+	if second.id < first.id {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	second.mu.Lock()
+	defer second.mu.Unlock()
+	if !src.members.delete(member) {
+		return false
+	}
+	dst.members.set(member, struct{}{})
+	return true
+}
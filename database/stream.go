@@ -0,0 +1,361 @@
+package database
+
+import (
+	"cmp"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// StreamNodeMaxEntries is the number of entries held by each node of a
+// Stream, like stream-node-max-entries in Redis.
+const StreamNodeMaxEntries = 100
+
+// StreamID identifies a stream entry: a millisecond timestamp and a sequence
+// number within that millisecond.
+type StreamID struct {
+	Ms, Seq uint64
+}
+
+// MaxStreamID is the largest possible ID, the "+" of XRANGE.
+var MaxStreamID = StreamID{Ms: math.MaxUint64, Seq: math.MaxUint64}
+
+// ParseStreamID parses "ms-seq", or a bare "ms" whose sequence number is
+// missingSeq.
+func ParseStreamID(s string, missingSeq uint64) (StreamID, bool) {
+	msPart, seqPart, hasSeq := strings.Cut(s, "-")
+	ms, err := strconv.ParseUint(msPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	if !hasSeq {
+		return StreamID{Ms: ms, Seq: missingSeq}, true
+	}
+	seq, err := strconv.ParseUint(seqPart, 10, 64)
+	if err != nil {
+		return StreamID{}, false
+	}
+	return StreamID{Ms: ms, Seq: seq}, true
+}
+
+func (id StreamID) String() string {
+	return strconv.FormatUint(id.Ms, 10) + "-" + strconv.FormatUint(id.Seq, 10)
+}
+
+func (id StreamID) Compare(other StreamID) int {
+	if c := cmp.Compare(id.Ms, other.Ms); c != 0 {
+		return c
+	}
+	return cmp.Compare(id.Seq, other.Seq)
+}
+
+// Incr returns the ID that follows id. ok is false when id is MaxStreamID.
+func (id StreamID) Incr() (next StreamID, ok bool) {
+	switch {
+	case id.Seq < math.MaxUint64:
+		return StreamID{Ms: id.Ms, Seq: id.Seq + 1}, true
+	case id.Ms < math.MaxUint64:
+		return StreamID{Ms: id.Ms + 1}, true
+	}
+	return id, false
+}
+
+// Decr returns the ID that precedes id. ok is false when id is 0-0.
+func (id StreamID) Decr() (prev StreamID, ok bool) {
+	switch {
+	case id.Seq > 0:
+		return StreamID{Ms: id.Ms, Seq: id.Seq - 1}, true
+	case id.Ms > 0:
+		return StreamID{Ms: id.Ms - 1, Seq: math.MaxUint64}, true
+	}
+	return id, false
+}
+
+type StreamEntry struct {
+	ID     StreamID
+	Fields []string // field, value, field, value, ...
+}
+
+// streamNode is a run of consecutive entries. Field names equal to those of
+// the node's first entry are stored once, like the master entry of a Redis
+// listpack, and deleted entries are only flagged until the whole node is
+// deleted.
+type streamNode struct {
+	master  []string
+	entries []streamNodeEntry
+	live    int
+}
+
+type streamNodeEntry struct {
+	id      StreamID
+	fields  []string // nil when the names are those of master
+	values  []string
+	deleted bool
+}
+
+func (n *streamNode) lastID() StreamID {
+	return n.entries[len(n.entries)-1].id
+}
+
+func (n *streamNode) entry(i int) StreamEntry {
+	e := n.entries[i]
+	if e.fields != nil {
+		return StreamEntry{ID: e.id, Fields: slices.Clone(e.fields)}
+	}
+	fields := make([]string, 0, 2*len(e.values))
+	for j, value := range e.values {
+		fields = append(fields, n.master[j], value)
+	}
+	return StreamEntry{ID: e.id, Fields: fields}
+}
+
+// Stream is an append-only log of entries ordered by ID, kept as a sorted
+// slice of nodes so that lookups are a binary search over nodes and then
+// within one node.
+type Stream struct {
+	mu sync.RWMutex
+
+	nodes        []*streamNode
+	length       int
+	lastID       StreamID
+	maxDeletedID StreamID
+	entriesAdded uint64
+	groups       map[string]*streamGroup
+}
+
+func NewStream() *Stream {
+	return &Stream{}
+}
+
+func (s *Stream) Type() string {
+	return "stream"
+}
+
+func (s *Stream) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.length
+}
+
+// LastID returns the ID of the last entry ever added, which deleting
+// entries does not change.
+func (s *Stream) LastID() StreamID {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.lastID
+}
+
+// Add appends an entry and reports false, adding nothing, when id is not
+// greater than LastID. fields must hold field, value pairs.
+func (s *Stream) Add(id StreamID, fields []string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if id.Compare(s.lastID) <= 0 {
+		return false
+	}
+
+	names := make([]string, 0, len(fields)/2)
+	values := make([]string, 0, len(fields)/2)
+	for i := 0; i+1 < len(fields); i += 2 {
+		names = append(names, fields[i])
+		values = append(values, fields[i+1])
+	}
+
+	var node *streamNode
+	if len(s.nodes) > 0 && len(s.nodes[len(s.nodes)-1].entries) < StreamNodeMaxEntries {
+		node = s.nodes[len(s.nodes)-1]
+	} else {
+		node = &streamNode{master: names}
+		s.nodes = append(s.nodes, node)
+	}
+	e := streamNodeEntry{id: id, values: values}
+	if !slices.Equal(names, node.master) {
+		e.fields, e.values = slices.Clone(fields), nil
+	}
+	node.entries = append(node.entries, e)
+	node.live++
+	s.length++
+	s.lastID = id
+	s.entriesAdded++
+	return true
+}
+
+// Range returns up to count entries, all when count is 0, with IDs between
+// start and end inclusive, from the highest ID down when reverse is set.
+func (s *Stream) Range(start, end StreamID, count int, reverse bool) []StreamEntry {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.rangeEntries(start, end, count, reverse)
+}
+
+func (s *Stream) rangeEntries(start, end StreamID, count int, reverse bool) []StreamEntry {
+	result := make([]StreamEntry, 0)
+	if start.Compare(end) > 0 {
+		return result
+	}
+	if !reverse {
+		for ni := s.nodeIndex(start); ni < len(s.nodes); ni++ {
+			n := s.nodes[ni]
+			for i := range n.entries {
+				e := &n.entries[i]
+				if e.deleted || e.id.Compare(start) < 0 {
+					continue
+				}
+				if e.id.Compare(end) > 0 || (count > 0 && len(result) == count) {
+					return result
+				}
+				result = append(result, n.entry(i))
+			}
+		}
+		return result
+	}
+
+	last := sort.Search(len(s.nodes), func(i int) bool {
+		return s.nodes[i].entries[0].id.Compare(end) > 0
+	})
+	for ni := last - 1; ni >= 0; ni-- {
+		n := s.nodes[ni]
+		for i := len(n.entries) - 1; i >= 0; i-- {
+			e := &n.entries[i]
+			if e.deleted || e.id.Compare(end) > 0 {
+				continue
+			}
+			if e.id.Compare(start) < 0 || (count > 0 && len(result) == count) {
+				return result
+			}
+			result = append(result, n.entry(i))
+		}
+	}
+	return result
+}
+
+// nodeIndex returns the index of the first node that may hold id, which is
+// len(s.nodes) when id is past the last entry.
+func (s *Stream) nodeIndex(id StreamID) int {
+	return sort.Search(len(s.nodes), func(i int) bool {
+		return s.nodes[i].lastID().Compare(id) >= 0
+	})
+}
+
+// find returns the position of the live entry with the given ID.
+func (s *Stream) find(id StreamID) (ni, i int, found bool) {
+	ni = s.nodeIndex(id)
+	if ni == len(s.nodes) {
+		return ni, 0, false
+	}
+	i, found = slices.BinarySearchFunc(s.nodes[ni].entries, id, func(e streamNodeEntry, id StreamID) int {
+		return e.id.Compare(id)
+	})
+	return ni, i, found && !s.nodes[ni].entries[i].deleted
+}
+
+// firstID returns the ID of the first live entry, or 0-0 when the stream is
+// empty.
+func (s *Stream) firstID() StreamID {
+	for _, n := range s.nodes {
+		for _, e := range n.entries {
+			if !e.deleted {
+				return e.id
+			}
+		}
+	}
+	return StreamID{}
+}
+
+// Delete removes the entries with the given IDs and returns how many
+// existed.
+func (s *Stream) Delete(ids ...StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	deleted := 0
+	for _, id := range ids {
+		ni, i, found := s.find(id)
+		if !found {
+			continue
+		}
+		n := s.nodes[ni]
+		n.entries[i].deleted = true
+		n.live--
+		s.length--
+		deleted++
+		if id.Compare(s.maxDeletedID) > 0 {
+			s.maxDeletedID = id
+		}
+		if n.live == 0 {
+			s.nodes = slices.Delete(s.nodes, ni, ni+1)
+		}
+	}
+	return deleted
+}
+
+// TrimMaxLen removes the oldest entries until at most maxLen are left, and
+// returns how many it removed. With approx set only whole nodes are
+// removed, so a few more entries may be kept. limit caps the entries
+// removed, 0 meaning no cap.
+func (s *Stream) TrimMaxLen(maxLen int, approx bool, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trim(approx, limit, func(n *streamNode) bool {
+		return s.length-n.live >= maxLen
+	}, func(StreamID) bool {
+		return s.length > maxLen
+	})
+}
+
+// TrimMinID removes the entries with IDs lower than minID, as TrimMaxLen
+// does.
+func (s *Stream) TrimMinID(minID StreamID, approx bool, limit int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.trim(approx, limit, func(n *streamNode) bool {
+		return n.lastID().Compare(minID) < 0
+	}, func(id StreamID) bool {
+		return id.Compare(minID) < 0
+	})
+}
+
+// trim removes whole nodes from the front while wholeNode allows it, and
+// then, unless approx is set, the leading entries of the next node while
+// entry allows it.
+func (s *Stream) trim(approx bool, limit int, wholeNode func(*streamNode) bool, entry func(StreamID) bool) int {
+	removed := 0
+	for len(s.nodes) > 0 {
+		n := s.nodes[0]
+		if !wholeNode(n) {
+			break
+		}
+		if limit > 0 && removed+n.live > limit {
+			return removed
+		}
+		s.nodes[0] = nil
+		s.nodes = s.nodes[1:]
+		s.length -= n.live
+		removed += n.live
+	}
+	if approx || len(s.nodes) == 0 {
+		return removed
+	}
+
+	n := s.nodes[0]
+	for i := range n.entries {
+		e := &n.entries[i]
+		if e.deleted {
+			continue
+		}
+		if !entry(e.id) || (limit > 0 && removed == limit) {
+			break
+		}
+		e.deleted = true
+		n.live--
+		s.length--
+		removed++
+	}
+	if n.live == 0 {
+		s.nodes = s.nodes[1:]
+	}
+	return removed
+}
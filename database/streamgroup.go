@@ -0,0 +1,600 @@
+package database
+
+import (
+	"slices"
+	"sort"
+	"time"
+)
+
+// PendingEntry is an entry delivered to a consumer of a group and not yet
+// acknowledged.
+type PendingEntry struct {
+	ID            StreamID
+	Consumer      string
+	DeliveryTime  time.Time
+	DeliveryCount int64
+}
+
+type pendingEntry struct {
+	id            StreamID
+	consumer      *streamConsumer
+	deliveryTime  time.Time
+	deliveryCount int64
+}
+
+func (pe *pendingEntry) export() PendingEntry {
+	return PendingEntry{ID: pe.id, Consumer: pe.consumer.name, DeliveryTime: pe.deliveryTime, DeliveryCount: pe.deliveryCount}
+}
+
+// pendingList is a pending entries list sorted by ID. Entries are nearly
+// always delivered in ID order, so inserting is usually an append.
+type pendingList []*pendingEntry
+
+func (l pendingList) search(id StreamID) (int, bool) {
+	return slices.BinarySearchFunc(l, id, func(pe *pendingEntry, id StreamID) int {
+		return pe.id.Compare(id)
+	})
+}
+
+func (l pendingList) get(id StreamID) *pendingEntry {
+	if i, found := l.search(id); found {
+		return l[i]
+	}
+	return nil
+}
+
+func (l *pendingList) insert(pe *pendingEntry) {
+	i, _ := l.search(pe.id)
+	*l = slices.Insert(*l, i, pe)
+}
+
+func (l *pendingList) remove(id StreamID) {
+	if i, found := l.search(id); found {
+		*l = slices.Delete(*l, i, i+1)
+	}
+}
+
+type streamConsumer struct {
+	name       string
+	seenTime   time.Time
+	activeTime time.Time // zero until an entry is first delivered
+	pel        pendingList
+}
+
+// streamGroup is a consumer group. Every pending entry is in the group's
+// list and in the list of the consumer it was delivered to.
+type streamGroup struct {
+	lastID      StreamID
+	entriesRead int64 // -1 when unknown
+	pel         pendingList
+	consumers   map[string]*streamConsumer
+}
+
+// consumer returns the named consumer, creating it if needed, and marks it
+// as seen at now.
+func (g *streamGroup) consumer(name string, now time.Time) (c *streamConsumer, created bool) {
+	c, ok := g.consumers[name]
+	if !ok {
+		c = &streamConsumer{name: name}
+		g.consumers[name] = c
+	}
+	c.seenTime = now
+	return c, !ok
+}
+
+// deliver records id as delivered to c at deliveryTime, taking it over from
+// its previous consumer if it was already pending.
+func (g *streamGroup) deliver(c *streamConsumer, id StreamID, deliveryTime time.Time) *pendingEntry {
+	pe := g.pel.get(id)
+	if pe == nil {
+		pe = &pendingEntry{id: id, consumer: c}
+		g.pel.insert(pe)
+		c.pel.insert(pe)
+	} else if pe.consumer != c {
+		pe.consumer.pel.remove(id)
+		pe.consumer = c
+		c.pel.insert(pe)
+	}
+	pe.deliveryTime = deliveryTime
+	return pe
+}
+
+// drop removes a pending entry from the group and its consumer.
+func (g *streamGroup) drop(pe *pendingEntry) {
+	g.pel.remove(pe.id)
+	pe.consumer.pel.remove(pe.id)
+}
+
+// CreateGroup adds a consumer group that has delivered the entries up to
+// lastID, and reports false if it already exists. entriesRead is the
+// number of entries it has read, -1 when unknown.
+func (s *Stream) CreateGroup(name string, lastID StreamID, entriesRead int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.groups[name]; exists {
+		return false
+	}
+	if s.groups == nil {
+		s.groups = make(map[string]*streamGroup)
+	}
+	s.groups[name] = &streamGroup{lastID: lastID, entriesRead: entriesRead, consumers: make(map[string]*streamConsumer)}
+	return true
+}
+
+func (s *Stream) DestroyGroup(name string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, exists := s.groups[name]; !exists {
+		return false
+	}
+	delete(s.groups, name)
+	return true
+}
+
+func (s *Stream) HasGroup(name string) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	_, exists := s.groups[name]
+	return exists
+}
+
+// SetGroupID sets the last delivered ID of a group, reporting false when
+// the group does not exist.
+func (s *Stream) SetGroupID(name string, lastID StreamID, entriesRead int64) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[name]
+	if !exists {
+		return false
+	}
+	g.lastID, g.entriesRead = lastID, entriesRead
+	return true
+}
+
+// CreateConsumer adds a consumer to a group. ok is false when the group
+// does not exist.
+func (s *Stream) CreateConsumer(group, consumer string, now time.Time) (created, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return false, false
+	}
+	_, created = g.consumer(consumer, now)
+	return created, true
+}
+
+// DeleteConsumer removes a consumer and its pending entries, and returns
+// how many entries were pending. ok is false when the group does not exist.
+func (s *Stream) DeleteConsumer(group, consumer string) (pending int, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return 0, false
+	}
+	c, exists := g.consumers[consumer]
+	if !exists {
+		return 0, true
+	}
+	for _, pe := range c.pel {
+		g.pel.remove(pe.id)
+	}
+	delete(g.consumers, consumer)
+	return len(c.pel), true
+}
+
+// ReadGroup delivers to consumer up to count entries, all when count is 0,
+// that the group has not delivered yet, and moves the group's last
+// delivered ID past them. Unless noAck is set they become pending.
+// created reports whether the consumer was created, and ok is false when
+// the group does not exist.
+func (s *Stream) ReadGroup(group, consumer string, count int, noAck bool, now time.Time) (entries []StreamEntry, created, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return nil, false, false
+	}
+	c, created := g.consumer(consumer, now)
+
+	start, more := g.lastID.Incr()
+	if !more {
+		return []StreamEntry{}, created, true
+	}
+	entries = s.rangeEntries(start, MaxStreamID, count, false)
+	for _, e := range entries {
+		if g.entriesRead >= 0 && !s.hasTombstones(g.lastID) {
+			g.entriesRead++
+		} else if s.entriesAdded > 0 {
+			g.entriesRead = s.estimateEntriesRead(e.ID)
+		}
+		g.lastID = e.ID
+		if !noAck {
+			g.deliver(c, e.ID, now).deliveryCount = 1
+		}
+	}
+	if len(entries) > 0 {
+		c.activeTime = now
+	}
+	return entries, created, true
+}
+
+// ReadPending returns up to count of the entries pending for consumer with
+// IDs greater than after, and counts them as delivered again. Entries since
+// deleted from the stream have nil Fields.
+func (s *Stream) ReadPending(group, consumer string, after StreamID, count int, now time.Time) (entries []StreamEntry, created, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return nil, false, false
+	}
+	c, created := g.consumer(consumer, now)
+
+	entries = make([]StreamEntry, 0)
+	i, found := c.pel.search(after)
+	if found {
+		i++
+	}
+	for ; i < len(c.pel) && (count == 0 || len(entries) < count); i++ {
+		pe := c.pel[i]
+		entry := StreamEntry{ID: pe.id}
+		if ni, ei, exists := s.find(pe.id); exists {
+			entry = s.nodes[ni].entry(ei)
+		}
+		entries = append(entries, entry)
+		pe.deliveryTime = now
+		pe.deliveryCount++
+	}
+	if len(entries) > 0 {
+		c.activeTime = now
+	}
+	return entries, created, true
+}
+
+// Ack removes ids from the pending entries of a group and returns how many
+// were pending.
+func (s *Stream) Ack(group string, ids ...StreamID) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return 0
+	}
+	acked := 0
+	for _, id := range ids {
+		if pe := g.pel.get(id); pe != nil {
+			g.drop(pe)
+			acked++
+		}
+	}
+	return acked
+}
+
+type ConsumerPending struct {
+	Name    string
+	Pending int
+}
+
+// PendingSummary returns the number of pending entries of a group, their
+// lowest and highest IDs, and the consumers that have any, by name. ok is
+// false when the group does not exist.
+func (s *Stream) PendingSummary(group string) (count int, first, last StreamID, consumers []ConsumerPending, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return 0, first, last, nil, false
+	}
+	if len(g.pel) > 0 {
+		first, last = g.pel[0].id, g.pel[len(g.pel)-1].id
+	}
+	for name, c := range g.consumers {
+		if len(c.pel) > 0 {
+			consumers = append(consumers, ConsumerPending{Name: name, Pending: len(c.pel)})
+		}
+	}
+	sort.Slice(consumers, func(i, j int) bool {
+		return consumers[i].Name < consumers[j].Name
+	})
+	return len(g.pel), first, last, consumers, true
+}
+
+// Pending returns up to count pending entries of a group, all when count
+// is 0, with IDs between start and end, that have been idle for at least
+// minIdle. A non-empty consumer limits them to that consumer's.
+func (s *Stream) Pending(group string, start, end StreamID, count int, consumer string, minIdle time.Duration, now time.Time) ([]PendingEntry, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return nil, false
+	}
+	pel := g.pel
+	if consumer != "" {
+		c, exists := g.consumers[consumer]
+		if !exists {
+			return []PendingEntry{}, true
+		}
+		pel = c.pel
+	}
+
+	result := make([]PendingEntry, 0)
+	i, _ := pel.search(start)
+	for ; i < len(pel) && pel[i].id.Compare(end) <= 0 && (count == 0 || len(result) < count); i++ {
+		if now.Sub(pel[i].deliveryTime) >= minIdle {
+			result = append(result, pel[i].export())
+		}
+	}
+	return result, true
+}
+
+// ClaimOptions are the options of XCLAIM.
+type ClaimOptions struct {
+	MinIdle      time.Duration
+	DeliveryTime time.Time // zero means now
+	RetryCount   int64     // -1 increments the count, unless JustID is set
+	Force        bool      // claim entries that are not pending yet
+	JustID       bool
+	LastID       StreamID // the group's last delivered ID is raised to it
+}
+
+// Claim transfers the pending entries ids that have been idle for at least
+// opts.MinIdle to consumer, and returns the entries it claimed. Pending
+// entries that were deleted from the stream are dropped and returned as
+// deleted. ok is false when the group does not exist.
+func (s *Stream) Claim(group, consumer string, ids []StreamID, opts ClaimOptions, now time.Time) (claimed []StreamEntry, deleted []StreamID, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return nil, nil, false
+	}
+	if opts.LastID.Compare(g.lastID) > 0 {
+		g.lastID = opts.LastID
+	}
+	deliveryTime := opts.DeliveryTime
+	if deliveryTime.IsZero() || deliveryTime.After(now) {
+		deliveryTime = now
+	}
+
+	claimed = make([]StreamEntry, 0)
+	var c *streamConsumer
+	for _, id := range ids {
+		ni, ei, inStream := s.find(id)
+		pe := g.pel.get(id)
+		if pe == nil {
+			if !opts.Force || !inStream {
+				continue
+			}
+		} else if now.Sub(pe.deliveryTime) < opts.MinIdle {
+			continue
+		} else if !inStream {
+			g.drop(pe)
+			deleted = append(deleted, id)
+			continue
+		}
+
+		if c == nil {
+			c, _ = g.consumer(consumer, now)
+		}
+		countBefore := int64(1)
+		if pe != nil {
+			countBefore = pe.deliveryCount
+		}
+		pe = g.deliver(c, id, deliveryTime)
+		pe.deliveryCount = countBefore
+		if opts.RetryCount >= 0 {
+			pe.deliveryCount = opts.RetryCount
+		} else if !opts.JustID {
+			pe.deliveryCount++
+		}
+		c.activeTime = now
+		if opts.JustID {
+			claimed = append(claimed, StreamEntry{ID: id})
+		} else {
+			claimed = append(claimed, s.nodes[ni].entry(ei))
+		}
+	}
+	return claimed, deleted, true
+}
+
+// AutoClaim scans the pending entries of a group from start and claims for
+// consumer those idle for at least minIdle, up to count of them, as Claim
+// does. It examines at most 10 entries per claimed one, and returns the ID
+// to continue the scan from, 0-0 once it reached the end.
+func (s *Stream) AutoClaim(group, consumer string, minIdle time.Duration, start StreamID, count int, justID bool, now time.Time) (next StreamID, claimed []StreamEntry, deleted []StreamID, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return next, nil, nil, false
+	}
+	c, _ := g.consumer(consumer, now)
+
+	claimed = make([]StreamEntry, 0)
+	attempts := count * 10
+	i, _ := g.pel.search(start)
+	for ; i < len(g.pel) && attempts > 0 && count > 0; attempts-- {
+		pe := g.pel[i]
+		ni, ei, inStream := s.find(pe.id)
+		if !inStream {
+			g.drop(pe)
+			deleted = append(deleted, pe.id)
+			count--
+			continue
+		}
+		i++
+		if now.Sub(pe.deliveryTime) < minIdle {
+			continue
+		}
+		g.deliver(c, pe.id, now)
+		if !justID {
+			pe.deliveryCount++
+		}
+		c.activeTime = now
+		if justID {
+			claimed = append(claimed, StreamEntry{ID: pe.id})
+		} else {
+			claimed = append(claimed, s.nodes[ni].entry(ei))
+		}
+		count--
+	}
+	if i < len(g.pel) {
+		next = g.pel[i].id
+	}
+	return next, claimed, deleted, true
+}
+
+// hasTombstones reports whether an entry at or after start was deleted.
+func (s *Stream) hasTombstones(start StreamID) bool {
+	if s.length == 0 || s.maxDeletedID == (StreamID{}) {
+		return false
+	}
+	return start.Compare(s.maxDeletedID) <= 0
+}
+
+// estimateEntriesRead returns how many entries were added up to id, or -1
+// when deletions make it impossible to tell, as Redis estimates the
+// entries-read counter of a group.
+func (s *Stream) estimateEntriesRead(id StreamID) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	switch c := id.Compare(s.lastID); {
+	case s.length == 0 && c <= 0, c == 0:
+		return int64(s.entriesAdded)
+	case c > 0:
+		return -1
+	}
+	first := s.firstID()
+	if s.maxDeletedID == (StreamID{}) || s.maxDeletedID.Compare(first) < 0 {
+		switch id.Compare(first) {
+		case -1:
+			return int64(s.entriesAdded) - int64(s.length)
+		case 0:
+			return int64(s.entriesAdded) - int64(s.length) + 1
+		}
+	}
+	return -1
+}
+
+type StreamGroupInfo struct {
+	Name        string
+	Consumers   int
+	Pending     int
+	LastID      StreamID
+	EntriesRead int64 // -1 when unknown
+	Lag         int64 // -1 when unknown
+}
+
+// Groups describes the consumer groups of the stream, by name.
+func (s *Stream) Groups() []StreamGroupInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	result := make([]StreamGroupInfo, 0, len(s.groups))
+	for name, g := range s.groups {
+		result = append(result, s.groupInfo(name, g))
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func (s *Stream) GroupInfo(name string) (StreamGroupInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, exists := s.groups[name]
+	if !exists {
+		return StreamGroupInfo{}, false
+	}
+	return s.groupInfo(name, g), true
+}
+
+func (s *Stream) groupInfo(name string, g *streamGroup) StreamGroupInfo {
+	return StreamGroupInfo{
+		Name:        name,
+		Consumers:   len(g.consumers),
+		Pending:     len(g.pel),
+		LastID:      g.lastID,
+		EntriesRead: g.entriesRead,
+		Lag:         s.lag(g),
+	}
+}
+
+// lag returns the number of entries the group has yet to read, or -1 when
+// deletions make it impossible to tell.
+func (s *Stream) lag(g *streamGroup) int64 {
+	if s.entriesAdded == 0 {
+		return 0
+	}
+	entriesRead := g.entriesRead
+	if entriesRead < 0 || s.hasTombstones(g.lastID) || g.lastID.Compare(s.firstID()) < 0 {
+		entriesRead = s.estimateEntriesRead(g.lastID)
+	}
+	if entriesRead < 0 {
+		return -1
+	}
+	return int64(s.entriesAdded) - entriesRead
+}
+
+type StreamConsumerInfo struct {
+	Name       string
+	Pending    int
+	SeenTime   time.Time
+	ActiveTime time.Time // zero if no entry was ever delivered
+}
+
+// Consumers describes the consumers of a group, by name. ok is false when
+// the group does not exist.
+func (s *Stream) Consumers(group string) ([]StreamConsumerInfo, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	g, exists := s.groups[group]
+	if !exists {
+		return nil, false
+	}
+	result := make([]StreamConsumerInfo, 0, len(g.consumers))
+	for name, c := range g.consumers {
+		result = append(result, StreamConsumerInfo{Name: name, Pending: len(c.pel), SeenTime: c.seenTime, ActiveTime: c.activeTime})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, true
+}
+
+type StreamInfo struct {
+	Length       int
+	Nodes        int
+	LastID       StreamID
+	MaxDeletedID StreamID
+	EntriesAdded uint64
+	FirstID      StreamID
+	Groups       int
+	FirstEntry   *StreamEntry // nil when the stream is empty
+	LastEntry    *StreamEntry
+}
+
+func (s *Stream) Info() StreamInfo {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	info := StreamInfo{
+		Length:       s.length,
+		Nodes:        len(s.nodes),
+		LastID:       s.lastID,
+		MaxDeletedID: s.maxDeletedID,
+		EntriesAdded: s.entriesAdded,
+		FirstID:      s.firstID(),
+		Groups:       len(s.groups),
+	}
+	if first := s.rangeEntries(StreamID{}, MaxStreamID, 1, false); len(first) > 0 {
+		info.FirstEntry = &first[0]
+	}
+	if last := s.rangeEntries(StreamID{}, MaxStreamID, 1, true); len(last) > 0 {
+		info.LastEntry = &last[0]
+	}
+	return info
+}
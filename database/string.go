@@ -1,13 +1,126 @@
 package database
 
+import "sync"
+
+// String holds its value as a byte buffer so APPEND, SETRANGE and the bit
+// commands can mutate it in place instead of copying it on every write.
 type String struct {
-	Val string
+	mu  sync.RWMutex
+	buf []byte
 }
 
 func NewString(val string) *String {
-	return &String{Val: val}
+	return &String{buf: []byte(val)}
 }
 
 func (s *String) Type() string {
 	return "string"
-}
\ No newline at end of file
+}
+
+func (s *String) Get() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return string(s.buf)
+}
+
+func (s *String) Set(val string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf[:0], val...)
+}
+
+func (s *String) Len() int {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return len(s.buf)
+}
+
+func (s *String) Append(val string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = append(s.buf, val...)
+	return len(s.buf)
+}
+
+// GetRange returns the bytes between start and end inclusive. Negative
+// offsets count from the end of the string, and out of range offsets are
+// clamped, as in GETRANGE.
+func (s *String) GetRange(start, end int) string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	n := len(s.buf)
+	if start < 0 && end < 0 && start > end {
+		return ""
+	}
+	if start < 0 {
+		start += n
+	}
+	if end < 0 {
+		end += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 {
+		end = 0
+	}
+	if end >= n {
+		end = n - 1
+	}
+	if n == 0 || start > end {
+		return ""
+	}
+	return string(s.buf[start : end+1])
+}
+
+// SetRange overwrites the string at offset with val, zero-padding it first if
+// it is shorter than offset, and returns the new length.
+func (s *String) SetRange(offset int, val string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if need := offset + len(val); need > len(s.buf) {
+		s.grow(need)
+	}
+	copy(s.buf[offset:], val)
+	return len(s.buf)
+}
+
+// grow extends the buffer to n bytes, zero-filling the new tail.
+func (s *String) grow(n int) {
+	if n <= cap(s.buf) {
+		old := len(s.buf)
+		s.buf = s.buf[:n]
+		clear(s.buf[old:])
+		return
+	}
+	s.buf = append(s.buf, make([]byte, n-len(s.buf))...)
+}
+
+// View calls fn with the raw buffer while holding the read lock. fn must not
+// modify or retain it.
+func (s *String) View(fn func(buf []byte)) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	fn(s.buf)
+}
+
+// Mutate grows the buffer to at least n bytes, zero-filling the new tail, and
+// calls fn with it while holding the write lock. fn must not retain it.
+func (s *String) Mutate(n int, fn func(buf []byte)) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if n > len(s.buf) {
+		s.grow(n)
+	}
+	fn(s.buf)
+}
+
+// Update replaces the buffer with the one fn returns, which may be buf itself
+// modified in place. fn runs under the write lock and must not retain buf.
+func (s *String) Update(fn func(buf []byte) []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.buf = fn(s.buf)
+}
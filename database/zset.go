@@ -1,7 +1,10 @@
 package database
 
 import (
-	"sort"
+	"errors"
+	"math"
+	"math/rand"
+	"slices"
 	"sync"
 )
 
@@ -10,17 +13,20 @@ type ZSetMember struct {
 	Score  float64
 }
 
+// ZSet keeps its members twice, as Redis does: a skiplist ordered by
+// (score, member) for range and rank queries, and a hash index from member
+// to score for O(1) lookups.
 type ZSet struct {
 	mu sync.RWMutex
 
-	members []ZSetMember
-	index   map[string]float64 
+	zsl   *zskiplist
+	index scanTable[float64]
 }
 
 func NewZSet() *ZSet {
 	return &ZSet{
-		members: make([]ZSetMember, 0),
-		index:   make(map[string]float64),
+		zsl:   newZSkiplist(),
+		index: newScanTable[float64](),
 	}
 }
 
@@ -28,35 +34,88 @@ func (z *ZSet) Type() string {
 	return "zset"
 }
 
+// ZAdd sets the score of member and returns 1 if the member was added or
+// its score changed, 0 otherwise.
 func (z *ZSet) ZAdd(score float64, member string) int {
 	z.mu.Lock()
 	defer z.mu.Unlock()
 
-	if oldScore, ok := z.index[member]; ok {
+	if oldScore, ok := z.index.get(member); ok {
 		if oldScore == score {
 			return 0
 		}
-		for i, m := range z.members {
-			if m.Member == member {
-				z.members = append(z.members[:i], z.members[i+1:]...)
-				break
-			}
+		z.zsl.delete(oldScore, member)
+	}
+	z.zsl.insert(score, member)
+	z.index.set(member, score)
+	return 1
+}
+
+// Flags of ZAddFlags, one per ZADD option.
+const (
+	ZAddNX = 1 << iota
+	ZAddXX
+	ZAddGT
+	ZAddLT
+	ZAddIncr
+)
+
+// Outcomes of ZAddFlags.
+const (
+	ZAddSkipped   = iota // a condition flag prevented the change
+	ZAddUnchanged        // the member already had the resulting score
+	ZAddAdded
+	ZAddUpdated
+)
+
+// ErrScoreNaN is returned when an increment would make a score NaN, such as
+// adding -inf to +inf.
+var ErrScoreNaN = errors.New("resulting score is not a number (NaN)")
+
+// ZAddFlags sets the score of member under the ZADD flags: NX only adds new
+// members, XX only updates existing ones, GT and LT only update when the
+// new score is greater or less than the current one, and Incr adds score to
+// the current score instead of replacing it. It returns the resulting score
+// and what happened.
+func (z *ZSet) ZAddFlags(score float64, member string, flags int) (float64, int, error) {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	current, exists := z.index.get(member)
+	if !exists {
+		if flags&ZAddXX != 0 {
+			return 0, ZAddSkipped, nil
 		}
+		z.zsl.insert(score, member)
+		z.index.set(member, score)
+		return score, ZAddAdded, nil
 	}
-	z.members = append(z.members, ZSetMember{Member: member, Score: score})
-	z.index[member] = score
 
-	sort.Slice(z.members, func(i, j int) bool {
-		return z.members[i].Score < z.members[j].Score
-	})
-	return 1
+	if flags&ZAddNX != 0 {
+		return current, ZAddSkipped, nil
+	}
+	if flags&ZAddIncr != 0 {
+		score += current
+		if math.IsNaN(score) {
+			return current, ZAddSkipped, ErrScoreNaN
+		}
+	}
+	if (flags&ZAddGT != 0 && score <= current) || (flags&ZAddLT != 0 && score >= current) {
+		return current, ZAddSkipped, nil
+	}
+	if score == current {
+		return score, ZAddUnchanged, nil
+	}
+	z.zsl.delete(current, member)
+	z.zsl.insert(score, member)
+	z.index.set(member, score)
+	return score, ZAddUpdated, nil
 }
 
 func (z *ZSet) ZScore(member string) (float64, bool) {
 	z.mu.RLock()
 	defer z.mu.RUnlock()
-	score, ok := z.index[member]
-	return score, ok
+	return z.index.get(member)
 }
 
 func (z *ZSet) ZRem(members ...string) int {
@@ -64,15 +123,10 @@ func (z *ZSet) ZRem(members ...string) int {
 	defer z.mu.Unlock()
 
 	removedCount := 0
-	for _, memberToRemove := range members {
-		if _, ok := z.index[memberToRemove]; ok {
-			for i, m := range z.members {
-				if m.Member == memberToRemove {
-					z.members = append(z.members[:i], z.members[i+1:]...)
-					break
-				}
-			}
-			delete(z.index, memberToRemove)
+	for _, member := range members {
+		if score, ok := z.index.get(member); ok {
+			z.zsl.delete(score, member)
+			z.index.delete(member)
 			removedCount++
 		}
 	}
@@ -82,5 +136,438 @@ func (z *ZSet) ZRem(members ...string) int {
 func (z *ZSet) ZCard() int {
 	z.mu.RLock()
 	defer z.mu.RUnlock()
-	return len(z.members)
-}
\ No newline at end of file
+	return z.zsl.length
+}
+
+// ZRank returns the 0-based rank of member in ascending order, or in
+// descending order when reverse is set.
+func (z *ZSet) ZRank(member string, reverse bool) (int, bool) {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	score, ok := z.index.get(member)
+	if !ok {
+		return 0, false
+	}
+	rank := z.zsl.rank(score, member) - 1
+	if reverse {
+		rank = z.zsl.length - 1 - rank
+	}
+	return rank, true
+}
+
+// ZRange returns the members ranked start to stop inclusive, counting from
+// the highest score when reverse is set. The indexes must already be
+// normalized to 0 <= start <= stop < ZCard.
+func (z *ZSet) ZRange(start, stop int, reverse bool) []ZSetMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	if reverse {
+		return z.walk(z.zsl.length-start, stop-start+1, true)
+	}
+	return z.walk(start+1, stop-start+1, false)
+}
+
+// ScoreRange is a range of scores. MinEx and MaxEx make the respective
+// bound exclusive.
+type ScoreRange struct {
+	Min, Max     float64
+	MinEx, MaxEx bool
+}
+
+func (r ScoreRange) aboveMin(n *zskiplistNode) bool {
+	if r.MinEx {
+		return n.score > r.Min
+	}
+	return n.score >= r.Min
+}
+
+func (r ScoreRange) belowMax(n *zskiplistNode) bool {
+	if r.MaxEx {
+		return n.score < r.Max
+	}
+	return n.score <= r.Max
+}
+
+// LexRange is a range of members for the BYLEX commands, which assume all
+// members have the same score. MinInf and MaxInf stand for the "-" and "+"
+// bounds, and MinEx and MaxEx make a bound exclusive.
+type LexRange struct {
+	Min, Max       string
+	MinEx, MaxEx   bool
+	MinInf, MaxInf bool
+}
+
+func (r LexRange) aboveMin(n *zskiplistNode) bool {
+	switch {
+	case r.MinInf:
+		return true
+	case r.MinEx:
+		return n.member > r.Min
+	}
+	return n.member >= r.Min
+}
+
+func (r LexRange) belowMax(n *zskiplistNode) bool {
+	switch {
+	case r.MaxInf:
+		return true
+	case r.MaxEx:
+		return n.member < r.Max
+	}
+	return n.member <= r.Max
+}
+
+// ZRangeByScore returns the members whose score lies in r, in ascending
+// order or descending when reverse is set. It skips the first offset
+// matches and returns at most count members, or all of them when count is
+// negative.
+func (z *ZSet) ZRangeByScore(r ScoreRange, reverse bool, offset, count int) []ZSetMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.rangeWhere(r.aboveMin, r.belowMax, reverse, offset, count)
+}
+
+// ZRangeByLex is ZRangeByScore for a range of members.
+func (z *ZSet) ZRangeByLex(r LexRange, reverse bool, offset, count int) []ZSetMember {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.rangeWhere(r.aboveMin, r.belowMax, reverse, offset, count)
+}
+
+// ZCount returns the number of members whose score lies in r.
+func (z *ZSet) ZCount(r ScoreRange) int {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	first, last := z.zsl.rankRange(r.aboveMin, r.belowMax)
+	return last - first + 1
+}
+
+// ZLexCount returns the number of members in r.
+func (z *ZSet) ZLexCount(r LexRange) int {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	first, last := z.zsl.rankRange(r.aboveMin, r.belowMax)
+	return last - first + 1
+}
+
+// rangeWhere returns the members of the range bounded by aboveMin and
+// belowMax, as described on ZRangeByScore. The offset is applied by rank,
+// so skipping costs O(log n) rather than a walk.
+func (z *ZSet) rangeWhere(aboveMin, belowMax func(*zskiplistNode) bool, reverse bool, offset, count int) []ZSetMember {
+	first, last := z.zsl.rankRange(aboveMin, belowMax)
+	n := last - first + 1 - offset
+	if offset < 0 || n <= 0 {
+		return []ZSetMember{}
+	}
+	if count >= 0 && count < n {
+		n = count
+	}
+	if reverse {
+		return z.walk(last-offset, n, true)
+	}
+	return z.walk(first+offset, n, false)
+}
+
+// walk returns n members starting at the 1-based rank, moving towards
+// lower scores when backward is set.
+func (z *ZSet) walk(rank, n int, backward bool) []ZSetMember {
+	result := make([]ZSetMember, 0, n)
+	for x := z.zsl.byRank(rank); x != nil && len(result) < n; {
+		result = append(result, ZSetMember{Member: x.member, Score: x.score})
+		if backward {
+			x = x.backward
+		} else {
+			x = x.level[0].forward
+		}
+	}
+	return result
+}
+
+// ZPop removes and returns up to count members with the lowest scores, or
+// the highest when highest is set, in the order they are popped.
+func (z *ZSet) ZPop(count int, highest bool) []ZSetMember {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	count = min(count, z.zsl.length)
+	start := 1
+	if highest {
+		start = z.zsl.length - count + 1
+	}
+	popped := z.removeRange(start, start+count-1)
+	if highest {
+		slices.Reverse(popped)
+	}
+	return popped
+}
+
+// ZRemRangeByRank removes the members ranked start to stop inclusive, which
+// must already be normalized to 0 <= start <= stop < ZCard, and returns how
+// many it removed.
+func (z *ZSet) ZRemRangeByRank(start, stop int) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	return len(z.removeRange(start+1, stop+1))
+}
+
+// ZRemRangeByScore removes the members whose score lies in r and returns
+// how many it removed.
+func (z *ZSet) ZRemRangeByScore(r ScoreRange) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	first, last := z.zsl.rankRange(r.aboveMin, r.belowMax)
+	return len(z.removeRange(first, last))
+}
+
+// ZRemRangeByLex removes the members in r and returns how many it removed.
+func (z *ZSet) ZRemRangeByLex(r LexRange) int {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+	first, last := z.zsl.rankRange(r.aboveMin, r.belowMax)
+	return len(z.removeRange(first, last))
+}
+
+// removeRange removes the members with 1-based ranks first to last from
+// both the skiplist and the index, and returns them in ascending order.
+func (z *ZSet) removeRange(first, last int) []ZSetMember {
+	if first > last {
+		return nil
+	}
+	removed := make([]ZSetMember, 0, last-first+1)
+	z.zsl.deleteRangeByRank(first, last, func(x *zskiplistNode) {
+		z.index.delete(x.member)
+		removed = append(removed, ZSetMember{Member: x.member, Score: x.score})
+	})
+	return removed
+}
+
+// ZScan visits up to count members from cursor as described on scanTable
+// and returns the next cursor.
+func (z *ZSet) ZScan(cursor uint64, count int, fn func(member string, score float64)) uint64 {
+	z.mu.RLock()
+	defer z.mu.RUnlock()
+	return z.index.scan(cursor, count, fn)
+}
+
+const (
+	zskiplistMaxLevel = 32
+	zskiplistP        = 0.25
+)
+
+// zskiplist is the Redis sorted set skiplist. Every forward link records
+// its span, the number of level-0 steps it skips, so a rank is the sum of
+// the spans walked to reach a node.
+type zskiplist struct {
+	header *zskiplistNode
+	tail   *zskiplistNode
+	length int
+	level  int
+}
+
+type zskiplistNode struct {
+	member   string
+	score    float64
+	backward *zskiplistNode
+	level    []zskiplistLevel
+}
+
+type zskiplistLevel struct {
+	forward *zskiplistNode
+	span    int
+}
+
+func newZSkiplist() *zskiplist {
+	return &zskiplist{
+		header: &zskiplistNode{level: make([]zskiplistLevel, zskiplistMaxLevel)},
+		level:  1,
+	}
+}
+
+// before reports whether n sorts before (score, member). Equal scores are
+// ordered by member, byte-wise.
+func (n *zskiplistNode) before(score float64, member string) bool {
+	return n.score < score || (n.score == score && n.member < member)
+}
+
+// after reports whether n sorts after (score, member).
+func (n *zskiplistNode) after(score float64, member string) bool {
+	return n.score > score || (n.score == score && n.member > member)
+}
+
+func zslRandomLevel() int {
+	level := 1
+	for level < zskiplistMaxLevel && rand.Float64() < zskiplistP {
+		level++
+	}
+	return level
+}
+
+// insert adds a node for member, which must not be in the list yet.
+func (zsl *zskiplist) insert(score float64, member string) *zskiplistNode {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	var rank [zskiplistMaxLevel]int
+
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		if i < zsl.level-1 {
+			rank[i] = rank[i+1]
+		}
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			rank[i] += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	level := zslRandomLevel()
+	if level > zsl.level {
+		for i := zsl.level; i < level; i++ {
+			update[i] = zsl.header
+			update[i].level[i].span = zsl.length
+		}
+		zsl.level = level
+	}
+
+	x = &zskiplistNode{member: member, score: score, level: make([]zskiplistLevel, level)}
+	for i := 0; i < level; i++ {
+		x.level[i].forward = update[i].level[i].forward
+		update[i].level[i].forward = x
+		x.level[i].span = update[i].level[i].span - (rank[0] - rank[i])
+		update[i].level[i].span = rank[0] - rank[i] + 1
+	}
+	for i := level; i < zsl.level; i++ {
+		update[i].level[i].span++
+	}
+
+	if update[0] != zsl.header {
+		x.backward = update[0]
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x
+	} else {
+		zsl.tail = x
+	}
+	zsl.length++
+	return x
+}
+
+// delete removes the node for (score, member), reporting whether it existed.
+func (zsl *zskiplist) delete(score float64, member string) bool {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && x.level[i].forward.before(score, member) {
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+	x = x.level[0].forward
+	if x == nil || x.score != score || x.member != member {
+		return false
+	}
+	zsl.deleteNode(x, &update)
+	return true
+}
+
+// deleteNode unlinks x, given for every level the last node before it.
+func (zsl *zskiplist) deleteNode(x *zskiplistNode, update *[zskiplistMaxLevel]*zskiplistNode) {
+	for i := 0; i < zsl.level; i++ {
+		if update[i].level[i].forward == x {
+			update[i].level[i].span += x.level[i].span - 1
+			update[i].level[i].forward = x.level[i].forward
+		} else {
+			update[i].level[i].span--
+		}
+	}
+	if x.level[0].forward != nil {
+		x.level[0].forward.backward = x.backward
+	} else {
+		zsl.tail = x.backward
+	}
+	for zsl.level > 1 && zsl.header.level[zsl.level-1].forward == nil {
+		zsl.level--
+	}
+	zsl.length--
+}
+
+// deleteRangeByRank removes the nodes ranked start to end, 1-based and
+// inclusive, calling fn with each in ascending order. The nodes before the
+// range are found once, so removing m nodes costs O(log n + m).
+func (zsl *zskiplist) deleteRangeByRank(start, end int, fn func(x *zskiplistNode)) {
+	var update [zskiplistMaxLevel]*zskiplistNode
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span < start {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		update[i] = x
+	}
+
+	x = x.level[0].forward
+	for rank := start; x != nil && rank <= end; rank++ {
+		next := x.level[0].forward
+		zsl.deleteNode(x, &update)
+		fn(x)
+		x = next
+	}
+}
+
+// rank returns the 1-based rank of (score, member), or 0 if it is not in
+// the list.
+func (zsl *zskiplist) rank(score float64, member string) int {
+	rank := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !x.level[i].forward.after(score, member) {
+			rank += x.level[i].span
+			x = x.level[i].forward
+		}
+		if x != zsl.header && x.score == score && x.member == member {
+			return rank
+		}
+	}
+	return 0
+}
+
+// byRank returns the node at the 1-based rank, or nil if it is out of range.
+func (zsl *zskiplist) byRank(rank int) *zskiplistNode {
+	traversed := 0
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && traversed+x.level[i].span <= rank {
+			traversed += x.level[i].span
+			x = x.level[i].forward
+		}
+		if traversed == rank && x != zsl.header {
+			return x
+		}
+	}
+	return nil
+}
+
+// rankRange returns the 1-based ranks of the first node for which aboveMin
+// holds and of the last for which belowMax holds. When no node is in the
+// range, last is first-1.
+func (zsl *zskiplist) rankRange(aboveMin, belowMax func(*zskiplistNode) bool) (first, last int) {
+	x := zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && !aboveMin(x.level[i].forward) {
+			first += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	first++
+
+	x = zsl.header
+	for i := zsl.level - 1; i >= 0; i-- {
+		for x.level[i].forward != nil && belowMax(x.level[i].forward) {
+			last += x.level[i].span
+			x = x.level[i].forward
+		}
+	}
+	if last < first {
+		last = first - 1
+	}
+	return first, last
+}
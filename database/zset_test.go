@@ -0,0 +1,251 @@
+package database
+
+import (
+	"cmp"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"testing"
+)
+
+// checkSpans verifies that every forward link of zsl skips exactly the
+// number of level-0 steps its span records.
+func checkSpans(t *testing.T, zsl *zskiplist) {
+	t.Helper()
+	ranks := map[*zskiplistNode]int{zsl.header: 0}
+	n := 0
+	for x := zsl.header.level[0].forward; x != nil; x = x.level[0].forward {
+		n++
+		ranks[x] = n
+	}
+	if n != zsl.length {
+		t.Fatalf("length = %d, but level 0 has %d nodes", zsl.length, n)
+	}
+	for i := 0; i < zsl.level; i++ {
+		for x := zsl.header; x.level[i].forward != nil; x = x.level[i].forward {
+			if got, want := x.level[i].span, ranks[x.level[i].forward]-ranks[x]; got != want {
+				t.Fatalf("level %d span after rank %d = %d, want %d", i, ranks[x], got, want)
+			}
+		}
+	}
+}
+
+func sortedMembers(scores map[string]float64) []ZSetMember {
+	members := make([]ZSetMember, 0, len(scores))
+	for member, score := range scores {
+		members = append(members, ZSetMember{Member: member, Score: score})
+	}
+	slices.SortFunc(members, func(a, b ZSetMember) int {
+		return cmp.Or(cmp.Compare(a.Score, b.Score), cmp.Compare(a.Member, b.Member))
+	})
+	return members
+}
+
+func TestZSetRanksMatchSortedOrder(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	z := NewZSet()
+	scores := map[string]float64{}
+	for i := 0; i < 5000; i++ {
+		member := "m" + strconv.Itoa(rng.Intn(1000))
+		// Few distinct scores, so that ties are ordered by member.
+		score := float64(rng.Intn(20))
+		if rng.Intn(4) == 0 {
+			z.ZRem(member)
+			delete(scores, member)
+		} else {
+			z.ZAdd(score, member)
+			scores[member] = score
+		}
+	}
+	checkSpans(t, z.zsl)
+
+	want := sortedMembers(scores)
+	if z.ZCard() != len(want) {
+		t.Fatalf("ZCard = %d, want %d", z.ZCard(), len(want))
+	}
+	for i, m := range want {
+		if rank, _ := z.ZRank(m.Member, false); rank != i {
+			t.Fatalf("ZRank(%s) = %d, want %d", m.Member, rank, i)
+		}
+		if rank, _ := z.ZRank(m.Member, true); rank != len(want)-1-i {
+			t.Fatalf("ZRank(%s, rev) = %d, want %d", m.Member, rank, len(want)-1-i)
+		}
+	}
+	if _, ok := z.ZRank("missing", false); ok {
+		t.Fatal("ZRank of a missing member reported a rank")
+	}
+	if got := z.ZRange(0, len(want)-1, false); !slices.Equal(got, want) {
+		t.Fatal("ZRange over the whole set is out of order")
+	}
+	rev := slices.Clone(want)
+	slices.Reverse(rev)
+	if got := z.ZRange(3, 10, true); !slices.Equal(got, rev[3:11]) {
+		t.Fatalf("ZRange(3, 10, rev) = %v, want %v", got, rev[3:11])
+	}
+}
+
+func TestZSetRangeByScore(t *testing.T) {
+	z := NewZSet()
+	for i := 0; i < 100; i++ {
+		z.ZAdd(float64(i/10), "m"+strconv.Itoa(i))
+	}
+	r := ScoreRange{Min: 2, Max: 4, MinEx: true}
+	if n := z.ZCount(r); n != 20 {
+		t.Fatalf("ZCount(2 exclusive, 4) = %d, want 20", n)
+	}
+	got := z.ZRangeByScore(r, false, 5, 3)
+	if len(got) != 3 || got[0].Score != 3 || got[0].Member != "m35" {
+		t.Fatalf("ZRangeByScore LIMIT 5 3 = %v, want m35 m36 m37", got)
+	}
+	got = z.ZRangeByScore(r, true, 0, 1)
+	if len(got) != 1 || got[0].Member != "m49" {
+		t.Fatalf("ZRangeByScore rev LIMIT 0 1 = %v, want m49", got)
+	}
+	if got := z.ZRangeByScore(ScoreRange{Min: 20, Max: 30}, false, 0, -1); len(got) != 0 {
+		t.Fatalf("ZRangeByScore past the last score = %v, want none", got)
+	}
+
+	if n := z.ZRemRangeByScore(ScoreRange{Min: 0, Max: 0}); n != 10 {
+		t.Fatalf("ZRemRangeByScore(0, 0) = %d, want 10", n)
+	}
+	if n := z.ZRemRangeByRank(0, 4); n != 5 {
+		t.Fatalf("ZRemRangeByRank(0, 4) = %d, want 5", n)
+	}
+	checkSpans(t, z.zsl)
+	if rank, _ := z.ZRank("m15", false); rank != 0 {
+		t.Fatalf("ZRank(m15) after the removals = %d, want 0", rank)
+	}
+}
+
+// sliceZSet is the sorted set as it was stored before the skiplist: a
+// slice kept sorted by re-sorting on every write, with ranks found by a
+// scan. The benchmarks compare the skiplist against it.
+type sliceZSet struct {
+	members []ZSetMember
+	index   map[string]float64
+}
+
+func newSliceZSet() *sliceZSet {
+	return &sliceZSet{index: map[string]float64{}}
+}
+
+func (z *sliceZSet) ZAdd(score float64, member string) int {
+	if oldScore, ok := z.index[member]; ok {
+		if oldScore == score {
+			return 0
+		}
+		for i, m := range z.members {
+			if m.Member == member {
+				z.members = append(z.members[:i], z.members[i+1:]...)
+				break
+			}
+		}
+	}
+	z.members = append(z.members, ZSetMember{Member: member, Score: score})
+	z.index[member] = score
+	sort.Slice(z.members, func(i, j int) bool {
+		return z.members[i].Score < z.members[j].Score
+	})
+	return 1
+}
+
+func (z *sliceZSet) ZRank(member string) (int, bool) {
+	for i, m := range z.members {
+		if m.Member == member {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+func (z *sliceZSet) ZRangeByScore(min, max float64) []ZSetMember {
+	result := make([]ZSetMember, 0)
+	for _, m := range z.members {
+		if m.Score < min {
+			continue
+		}
+		if m.Score > max {
+			break
+		}
+		result = append(result, m)
+	}
+	return result
+}
+
+// zsetBench is the sorted set interface the benchmarks drive.
+type zsetBench interface {
+	ZAdd(score float64, member string) int
+	rank(member string)
+	rangeByScore(min, max float64)
+}
+
+type skiplistBench struct{ *ZSet }
+
+func (z skiplistBench) rank(member string) { z.ZRank(member, false) }
+
+func (z skiplistBench) rangeByScore(min, max float64) {
+	z.ZRangeByScore(ScoreRange{Min: min, Max: max}, false, 0, -1)
+}
+
+type sliceBench struct{ *sliceZSet }
+
+func (z sliceBench) rank(member string) { z.ZRank(member) }
+
+func (z sliceBench) rangeByScore(min, max float64) { z.ZRangeByScore(min, max) }
+
+var benchZSetSizes = []int{1_000, 100_000}
+
+// benchZSets runs fn against a skiplist and a slice sorted set, each
+// holding size members "m<i>" with score i.
+func benchZSets(b *testing.B, fn func(b *testing.B, z zsetBench, size int)) {
+	for _, size := range benchZSetSizes {
+		b.Run("skiplist/"+strconv.Itoa(size), func(b *testing.B) {
+			z := NewZSet()
+			for i := 0; i < size; i++ {
+				z.ZAdd(float64(i), "m"+strconv.Itoa(i))
+			}
+			b.ResetTimer()
+			fn(b, skiplistBench{z}, size)
+		})
+		b.Run("slice/"+strconv.Itoa(size), func(b *testing.B) {
+			// Filled directly: adding one at a time re-sorts on every add.
+			z := newSliceZSet()
+			for i := 0; i < size; i++ {
+				member := "m" + strconv.Itoa(i)
+				z.members = append(z.members, ZSetMember{Member: member, Score: float64(i)})
+				z.index[member] = float64(i)
+			}
+			b.ResetTimer()
+			fn(b, sliceBench{z}, size)
+		})
+	}
+}
+
+func BenchmarkZAdd(b *testing.B) {
+	benchZSets(b, func(b *testing.B, z zsetBench, size int) {
+		rng := rand.New(rand.NewSource(1))
+		for i := 0; i < b.N; i++ {
+			z.ZAdd(rng.Float64()*float64(size), "n"+strconv.Itoa(i))
+		}
+	})
+}
+
+func BenchmarkZRank(b *testing.B) {
+	benchZSets(b, func(b *testing.B, z zsetBench, size int) {
+		member := "m" + strconv.Itoa(size*3/4)
+		for i := 0; i < b.N; i++ {
+			z.rank(member)
+		}
+	})
+}
+
+// BenchmarkZRangeByScore reads the ten members at three quarters of the set.
+func BenchmarkZRangeByScore(b *testing.B) {
+	benchZSets(b, func(b *testing.B, z zsetBench, size int) {
+		min := float64(size * 3 / 4)
+		for i := 0; i < b.N; i++ {
+			z.rangeByScore(min, min+9)
+		}
+	})
+}
@@ -13,6 +13,9 @@ func main() {
 	address := "0.0.0.0:6379" 
 
 	s := server.NewServer(address) 
+	if err := s.EnableAOF("appendonly.aof"); err != nil {
+		log.Fatalf("Failed to enable AOF: %v", err)
+	}
 	if err := s.Start(); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
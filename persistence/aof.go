@@ -2,6 +2,8 @@ package persistence
 
 import (
 	"bufio" 
+	"errors"
+	"io"
 	"log"
 	"os"
 	"sync"
@@ -12,9 +14,10 @@ import (
 )
 
 type AOF struct {
-	file   *os.File
-	writer *bufio.Writer
-	mu     sync.Mutex 
+	filename string
+	file     *os.File
+	writer   *bufio.Writer
+	mu       sync.Mutex 
 }
 
 func NewAOF(filename string) (*AOF, error) {
@@ -24,8 +27,9 @@ func NewAOF(filename string) (*AOF, error) {
 	}
 
 	return &AOF{
-		file:   file,
-		writer: bufio.NewWriter(file),
+		filename: filename,
+		file:     file,
+		writer:   bufio.NewWriter(file),
 	}, nil
 }
 
@@ -33,16 +37,45 @@ func (a *AOF) AppendCommand(cmd resp.Value) error {
 	a.mu.Lock()
 	defer a.mu.Unlock()
 
-
-	log.Printf("AOF: Appending command: %v", cmd)
-
-	return nil
+	if err := resp.Encode(a.writer, cmd); err != nil {
+		return err
+	}
+	return a.writer.Flush()
 }
 
+// Load replays every command in the AOF through processor without feeding
+// them to the CDC feed a second time. A truncated final
+// command, as left by a crash mid-write, is logged and ignored.
 func (a *AOF) Load(db *database.Database, processor *command.Processor) error {
+	file, err := os.Open(a.filename)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer file.Close()
 
-
-	log.Println("AOF: Loading data from AOF file (placeholder).")
+	log.Printf("AOF: Loading data from %s...", a.filename)
+	reader := bufio.NewReader(file)
+	loaded := 0
+	for {
+		cmd, err := resp.Decode(reader)
+		if err != nil {
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+				if errors.Is(err, io.ErrUnexpectedEOF) {
+					log.Printf("AOF: Ignoring truncated command at the end of %s", a.filename)
+				}
+				break
+			}
+			return err
+		}
+		if reply := processor.Replay(cmd); reply.Type == resp.ErrorType {
+			log.Printf("AOF: Command %d failed during replay: %s", loaded+1, reply.Str)
+		}
+		loaded++
+	}
+	log.Printf("AOF: Finished loading %s (%d commands).", a.filename, loaded)
 	return nil
 }
 
@@ -0,0 +1,174 @@
+package persistence
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/command"
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func run(p *command.Processor, args ...string) resp.Value {
+	values := make([]resp.Value, len(args))
+	for i, arg := range args {
+		values[i] = resp.NewBulkString([]byte(arg))
+	}
+	return p.Process(resp.NewArray(values))
+}
+
+// render formats a reply for comparison, sorting the elements of arrays so
+// that replies in map order compare equal.
+func render(v resp.Value) string {
+	switch {
+	case v.Null:
+		return "<nil>"
+	case v.Type == resp.ArrayType:
+		parts := make([]string, len(v.Array))
+		for i, e := range v.Array {
+			parts[i] = render(e)
+		}
+		slices.Sort(parts)
+		return "[" + strings.Join(parts, " ") + "]"
+	case v.Type == resp.IntegerType:
+		return strconv.FormatInt(v.Num, 10)
+	case v.Type == resp.BulkStringType:
+		return string(v.Bulk)
+	}
+	return v.Str
+}
+
+// readAOF returns the name of each command in the AOF at path.
+func readAOF(t *testing.T, path string) []string {
+	t.Helper()
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := bufio.NewReader(file)
+	var names []string
+	for {
+		cmd, err := resp.Decode(reader)
+		if err != nil {
+			return names
+		}
+		names = append(names, string(cmd.Array[0].Bulk))
+	}
+}
+
+func TestAOFReplayRestoresState(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	aof, err := NewAOF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := database.NewDatabase()
+	p := command.NewProcessor(db, nil)
+	p.OnPropagate(func(cmd resp.Value) {
+		if err := aof.AppendCommand(cmd); err != nil {
+			t.Error(err)
+		}
+	})
+
+	run(p, "SET", "s", "v", "EX", "1000")
+	for range 3 {
+		run(p, "INCRBYFLOAT", "f", "0.1")
+	}
+	run(p, "HSET", "h", "a", "1", "b", "2", "c", "3", "d", "4")
+	run(p, "HEXPIRE", "h", "1000", "FIELDS", "1", "a")
+	at := time.Now().Add(time.Hour).UnixMilli()
+	run(p, "HPEXPIREAT", "h", strconv.FormatInt(at, 10), "FIELDS", "1", "b")
+	run(p, "HPEXPIRE", "h", "10", "FIELDS", "1", "c")
+	run(p, "SET", "gone", "v", "PX", "10")
+	run(p, "RPUSH", "l", "x", "y")
+	time.Sleep(30 * time.Millisecond)
+	// Reading expires the key and the field, which must reach the AOF as
+	// DEL and HDEL.
+	run(p, "GET", "gone")
+	run(p, "HGET", "h", "c")
+	if err := aof.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	names := readAOF(t, path)
+	for _, name := range []string{"INCRBYFLOAT", "HEXPIRE", "HPEXPIRE"} {
+		if slices.Contains(names, name) {
+			t.Errorf("the AOF holds %s, which does not replay exactly: %q", name, names)
+		}
+	}
+	for _, name := range []string{"DEL", "HDEL", "HPEXPIREAT"} {
+		if !slices.Contains(names, name) {
+			t.Errorf("the AOF holds no %s: %q", name, names)
+		}
+	}
+
+	replayedDB := database.NewDatabase()
+	replayed := command.NewProcessor(replayedDB, nil)
+	loader, err := NewAOF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer loader.Close()
+	if err := loader.Load(nil, replayed); err != nil {
+		t.Fatal(err)
+	}
+	if offset := replayed.CDC().Offset(); offset != 0 {
+		t.Errorf("replay appended %d events to the CDC feed", offset)
+	}
+
+	for _, read := range [][]string{
+		{"TYPE", "s"},
+		{"TYPE", "f"},
+		{"TYPE", "h"},
+		{"TYPE", "gone"},
+		{"TYPE", "l"},
+		{"GET", "s"},
+		{"GET", "f"},
+		{"HGETALL", "h"},
+		{"HPEXPIRETIME", "h", "FIELDS", "4", "a", "b", "c", "d"},
+		{"EXISTS", "gone"},
+		{"LRANGE", "l", "0", "-1"},
+	} {
+		want, got := render(run(p, read...)), render(run(replayed, read...))
+		if got != want {
+			t.Errorf("%s after replay = %s, want %s", strings.Join(read, " "), got, want)
+		}
+	}
+	want, _ := db.ExpireTime("s")
+	if got, _ := replayedDB.ExpireTime("s"); !got.Equal(want) || got.IsZero() {
+		t.Errorf("the TTL of s is %v after replay, want %v", got, want)
+	}
+	if got := render(run(replayed, "GET", "f")); got != "0.3" {
+		t.Errorf("GET f = %s after replay, want 0.3", got)
+	}
+}
+
+func TestAOFLoadIgnoresTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "appendonly.aof")
+	data := "*3\r\n$3\r\nSET\r\n$1\r\nk\r\n$1\r\nv\r\n*3\r\n$3\r\nSET\r\n$1\r\nx"
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	aof, err := NewAOF(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer aof.Close()
+	p := command.NewProcessor(database.NewDatabase(), nil)
+	if err := aof.Load(nil, p); err != nil {
+		t.Fatal(err)
+	}
+	if got := render(run(p, "GET", "k")); got != "v" {
+		t.Fatalf("GET k = %s after replay, want v", got)
+	}
+	if got := render(run(p, "EXISTS", "x")); got != "0" {
+		t.Fatalf("the truncated command was applied")
+	}
+}
@@ -0,0 +1,119 @@
+package pubsub
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/HORUSCRIME/goredis/database"
+)
+
+var notifyFlagChars = []struct {
+	char byte
+	flag int
+}{
+	{'g', database.NotifyGeneric},
+	{'$', database.NotifyString},
+	{'l', database.NotifyList},
+	{'s', database.NotifySet},
+	{'h', database.NotifyHash},
+	{'z', database.NotifyZSet},
+	{'x', database.NotifyExpired},
+	{'e', database.NotifyEvicted},
+	{'t', database.NotifyStream},
+	{'d', database.NotifyModule},
+	{'K', database.NotifyKeyspace},
+	{'E', database.NotifyKeyevent},
+	{'m', database.NotifyKeyMiss},
+	{'n', database.NotifyNew},
+}
+
+// ParseNotifyFlags converts a notify-keyspace-events string such as "KEA" or
+// "Elg$" into its class bitmask. Without K or E nothing would be published,
+// so, as in Redis, such a string disables notifications and yields 0.
+func ParseNotifyFlags(s string) (int, error) {
+	flags := 0
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == 'A' {
+			flags |= database.NotifyAll
+			continue
+		}
+		found := false
+		for _, fc := range notifyFlagChars {
+			if fc.char == c {
+				flags |= fc.flag
+				found = true
+				break
+			}
+		}
+		if !found {
+			return 0, fmt.Errorf("invalid event class character '%c'", c)
+		}
+	}
+	if flags&(database.NotifyKeyspace|database.NotifyKeyevent) == 0 {
+		return 0, nil
+	}
+	return flags, nil
+}
+
+// FormatNotifyFlags is the inverse of ParseNotifyFlags, and likewise gives ""
+// for flags that enable neither K nor E.
+func FormatNotifyFlags(flags int) string {
+	if flags&(database.NotifyKeyspace|database.NotifyKeyevent) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	all := flags&database.NotifyAll == database.NotifyAll
+	if all {
+		sb.WriteByte('A')
+	}
+	for _, fc := range notifyFlagChars {
+		if all && fc.flag&database.NotifyAll != 0 {
+			continue
+		}
+		if flags&fc.flag != 0 {
+			sb.WriteByte(fc.char)
+		}
+	}
+	return sb.String()
+}
+
+// KeyspaceNotifier publishes __keyspace@<db>__:<key> and
+// __keyevent@<db>__:<event> messages for the classes enabled in its flags.
+type KeyspaceNotifier struct {
+	ps    *PubSub
+	mu    sync.RWMutex
+	flags int
+}
+
+func NewKeyspaceNotifier(ps *PubSub) *KeyspaceNotifier {
+	return &KeyspaceNotifier{ps: ps}
+}
+
+func (n *KeyspaceNotifier) SetFlags(flags int) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.flags = flags
+}
+
+func (n *KeyspaceNotifier) Flags() int {
+	n.mu.RLock()
+	defer n.mu.RUnlock()
+	return n.flags
+}
+
+func (n *KeyspaceNotifier) Listener(dbIndex int) database.KeyspaceListener {
+	return func(class int, event, key string) {
+		flags := n.Flags()
+		if flags&class == 0 {
+			return
+		}
+		if flags&database.NotifyKeyspace != 0 {
+			n.ps.Publish(fmt.Sprintf("__keyspace@%d__:%s", dbIndex, key), []byte(event))
+		}
+		if flags&database.NotifyKeyevent != 0 {
+			n.ps.Publish(fmt.Sprintf("__keyevent@%d__:%s", dbIndex, event), []byte(key))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package pubsub
+
+import (
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/database"
+)
+
+func TestNotifyFlags(t *testing.T) {
+	for _, tt := range []struct{ in, out string }{
+		{"", ""},
+		{"KEA", "AKE"},
+		{"Elg$", "g$lE"},
+		{"Kx", "xK"},
+		{"AKEmn", "AKEmn"},
+		// Without K or E nothing is published, so the classes are dropped.
+		{"lg$", ""},
+		{"Am", ""},
+	} {
+		flags, err := ParseNotifyFlags(tt.in)
+		if err != nil {
+			t.Fatalf("ParseNotifyFlags(%q): %v", tt.in, err)
+		}
+		if got := FormatNotifyFlags(flags); got != tt.out {
+			t.Errorf("FormatNotifyFlags(ParseNotifyFlags(%q)) = %q, want %q", tt.in, got, tt.out)
+		}
+	}
+	if got := FormatNotifyFlags(database.NotifyList | database.NotifyGeneric); got != "" {
+		t.Errorf("FormatNotifyFlags of classes without K or E = %q, want \"\"", got)
+	}
+	if _, err := ParseNotifyFlags("Kq"); err == nil {
+		t.Error("ParseNotifyFlags accepted 'q'")
+	}
+}
+
+func TestKeyspaceListener(t *testing.T) {
+	ps := NewPubSub()
+	sub := ps.NewSubscriber(10)
+	sub.PSubscribe("__key*__:*")
+	n := NewKeyspaceNotifier(ps)
+	notify := n.Listener(3)
+
+	notify(database.NotifyString, "set", "k")
+	if len(sub.C) != 0 {
+		t.Fatal("a notification was published with no classes enabled")
+	}
+
+	flags, _ := ParseNotifyFlags("KE$")
+	n.SetFlags(flags)
+	notify(database.NotifyList, "lpush", "l")
+	notify(database.NotifyString, "set", "k")
+	for _, want := range []Message{
+		{Pattern: "__key*__:*", Channel: "__keyspace@3__:k", Payload: []byte("set")},
+		{Pattern: "__key*__:*", Channel: "__keyevent@3__:set", Payload: []byte("k")},
+	} {
+		got := <-sub.C
+		if got.Pattern != want.Pattern || got.Channel != want.Channel || string(got.Payload) != string(want.Payload) {
+			t.Fatalf("got %s %s %q, want %s %s %q", got.Pattern, got.Channel, got.Payload, want.Pattern, want.Channel, want.Payload)
+		}
+	}
+	if len(sub.C) != 0 {
+		t.Fatal("the disabled list class was published")
+	}
+
+	flags, _ = ParseNotifyFlags("Em")
+	n.SetFlags(flags)
+	notify(database.NotifyKeyMiss, "keymiss", "k")
+	if got := <-sub.C; got.Channel != "__keyevent@3__:keymiss" || string(got.Payload) != "k" {
+		t.Fatalf("got %s %q, want the keymiss event", got.Channel, got.Payload)
+	}
+}
@@ -2,17 +2,24 @@ package pubsub
 
 import (
 	"log"
+	"slices"
 	"sync"
+
+	"github.com/HORUSCRIME/goredis/utils"
 )
 
 type PubSub struct {
 	mu          sync.RWMutex
 	subscribers map[string]map[chan []byte]bool 
+	channels    map[string]map[*Subscriber]bool
+	patterns    map[string]map[*Subscriber]bool
 }
 
 func NewPubSub() *PubSub {
 	return &PubSub{
 		subscribers: make(map[string]map[chan []byte]bool),
+		channels:    make(map[string]map[*Subscriber]bool),
+		patterns:    make(map[string]map[*Subscriber]bool),
 	}
 }
 
@@ -55,6 +62,151 @@ func (ps *PubSub) Publish(topic string, message []byte) int {
 			}
 		}
 	}
+	for sub := range ps.channels[topic] {
+		if sub.deliver(Message{Channel: topic, Payload: message}) {
+			publishedCount++
+		}
+	}
+	for pattern, subs := range ps.patterns {
+		if !utils.MatchPattern(pattern, topic) {
+			continue
+		}
+		for sub := range subs {
+			if sub.deliver(Message{Pattern: pattern, Channel: topic, Payload: message}) {
+				publishedCount++
+			}
+		}
+	}
 	log.Printf("Published message to topic '%s', %d subscribers notified.", topic, publishedCount)
 	return publishedCount
-}
\ No newline at end of file
+}
+
+// Message is a message delivered to a Subscriber. Pattern is the pattern
+// that matched Channel when the message was delivered for a PSUBSCRIBE.
+type Message struct {
+	Pattern string
+	Channel string
+	Payload []byte
+}
+
+// Subscriber receives on C the messages published to the channels and
+// patterns it subscribes to, as a client in subscribed mode does. Its
+// methods must be called from one goroutine at a time.
+type Subscriber struct {
+	C <-chan Message
+
+	ps       *PubSub
+	c        chan Message
+	channels map[string]bool
+	patterns map[string]bool
+}
+
+// NewSubscriber creates a Subscriber whose channel buffers up to buffer
+// messages. Messages that find the buffer full are dropped, as with the
+// channels passed to Subscribe.
+func (ps *PubSub) NewSubscriber(buffer int) *Subscriber {
+	c := make(chan Message, buffer)
+	return &Subscriber{
+		C:        c,
+		ps:       ps,
+		c:        c,
+		channels: make(map[string]bool),
+		patterns: make(map[string]bool),
+	}
+}
+
+func (s *Subscriber) deliver(msg Message) bool {
+	select {
+	case s.c <- msg:
+		return true
+	default:
+		log.Printf("Skipping message for full subscriber on channel '%s'", msg.Channel)
+		return false
+	}
+}
+
+// Subscribe adds channel to the subscriber's channels and returns the number
+// of channels and patterns it is subscribed to.
+func (s *Subscriber) Subscribe(channel string) int {
+	if !s.channels[channel] {
+		s.channels[channel] = true
+		s.ps.add(s.ps.channels, channel, s)
+	}
+	return s.Count()
+}
+
+func (s *Subscriber) Unsubscribe(channel string) int {
+	if s.channels[channel] {
+		delete(s.channels, channel)
+		s.ps.remove(s.ps.channels, channel, s)
+	}
+	return s.Count()
+}
+
+// PSubscribe subscribes to every channel matching the glob-style pattern.
+func (s *Subscriber) PSubscribe(pattern string) int {
+	if !s.patterns[pattern] {
+		s.patterns[pattern] = true
+		s.ps.add(s.ps.patterns, pattern, s)
+	}
+	return s.Count()
+}
+
+func (s *Subscriber) PUnsubscribe(pattern string) int {
+	if s.patterns[pattern] {
+		delete(s.patterns, pattern)
+		s.ps.remove(s.ps.patterns, pattern, s)
+	}
+	return s.Count()
+}
+
+// Channels returns the subscribed channels in sorted order.
+func (s *Subscriber) Channels() []string {
+	return sortedKeys(s.channels)
+}
+
+// Patterns returns the subscribed patterns in sorted order.
+func (s *Subscriber) Patterns() []string {
+	return sortedKeys(s.patterns)
+}
+
+func (s *Subscriber) Count() int {
+	return len(s.channels) + len(s.patterns)
+}
+
+// Close unsubscribes from every channel and pattern.
+func (s *Subscriber) Close() {
+	for channel := range s.channels {
+		s.Unsubscribe(channel)
+	}
+	for pattern := range s.patterns {
+		s.PUnsubscribe(pattern)
+	}
+}
+
+func (ps *PubSub) add(subs map[string]map[*Subscriber]bool, name string, s *Subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	if subs[name] == nil {
+		subs[name] = make(map[*Subscriber]bool)
+	}
+	subs[name][s] = true
+}
+
+func (ps *PubSub) remove(subs map[string]map[*Subscriber]bool, name string, s *Subscriber) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	delete(subs[name], s)
+	if len(subs[name]) == 0 {
+		delete(subs, name)
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	slices.Sort(keys)
+	return keys
+}
@@ -0,0 +1,52 @@
+package pubsub
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestSubscriber(t *testing.T) {
+	ps := NewPubSub()
+	a := ps.NewSubscriber(10)
+	b := ps.NewSubscriber(1)
+	if n := a.Subscribe("news"); n != 1 {
+		t.Fatalf("Subscribe = %d, want 1", n)
+	}
+	if n := a.Subscribe("news"); n != 1 {
+		t.Fatalf("a repeated Subscribe = %d, want 1", n)
+	}
+	if n := a.PSubscribe("n*"); n != 2 {
+		t.Fatalf("PSubscribe = %d, want 2", n)
+	}
+	b.Subscribe("news")
+
+	// a receives the message once per subscription; b's full buffer drops
+	// the second message.
+	if n := ps.Publish("news", []byte("1")); n != 3 {
+		t.Fatalf("Publish reached %d subscriptions, want 3", n)
+	}
+	if n := ps.Publish("news", []byte("2")); n != 2 {
+		t.Fatalf("Publish reached %d subscriptions, want 2", n)
+	}
+	if n := ps.Publish("other", []byte("3")); n != 0 {
+		t.Fatalf("Publish to an unwatched channel reached %d subscriptions", n)
+	}
+	if msg := <-a.C; msg.Pattern != "" || msg.Channel != "news" || string(msg.Payload) != "1" {
+		t.Fatalf("got %+v, want the channel message first", msg)
+	}
+	if msg := <-a.C; msg.Pattern != "n*" || string(msg.Payload) != "1" {
+		t.Fatalf("got %+v, want the pattern message", msg)
+	}
+	if len(b.C) != 1 {
+		t.Fatalf("b holds %d messages, want 1", len(b.C))
+	}
+
+	if !slices.Equal(a.Channels(), []string{"news"}) || !slices.Equal(a.Patterns(), []string{"n*"}) {
+		t.Fatalf("a is subscribed to %q and %q", a.Channels(), a.Patterns())
+	}
+	a.Close()
+	b.Unsubscribe("news")
+	if a.Count() != 0 || len(ps.channels) != 0 || len(ps.patterns) != 0 {
+		t.Fatal("Close and Unsubscribe left subscriptions behind")
+	}
+}
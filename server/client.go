@@ -2,12 +2,18 @@ package server
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net"
+	"strconv"
+	"strings"
 	"sync"
 
+	"github.com/HORUSCRIME/goredis/cdc"
 	"github.com/HORUSCRIME/goredis/command"
+	"github.com/HORUSCRIME/goredis/pubsub"
 	"github.com/HORUSCRIME/goredis/resp"
 )
 
@@ -16,47 +22,159 @@ type Client struct {
 	reader    *bufio.Reader
 	writer    *bufio.Writer
 	processor *command.Processor 
+	session   *command.Session
+	done      chan struct{}
 	closed    bool
 	mu        sync.Mutex 
+
+	// pubsub serves SUBSCRIBE and PSUBSCRIBE; subscriber is created by the
+	// first of them. pubsubMu orders subscription replies and messages.
+	pubsub     *pubsub.PubSub
+	subscriber *pubsub.Subscriber
+	pubsubMu   sync.Mutex
+}
+
+// request is a decoded command, or the protocol error that replaced it.
+type request struct {
+	value resp.Value
+	err   error
 }
 
-func NewClient(conn net.Conn, processor *command.Processor) *Client {
+func NewClient(conn net.Conn, processor *command.Processor, ps *pubsub.PubSub) *Client {
 	return &Client{
 		conn:      conn,
 		reader:    bufio.NewReader(conn),
 		writer:    bufio.NewWriter(conn),
 		processor: processor,
+		session:   processor.NewSession(),
+		done:      make(chan struct{}),
+		pubsub:    ps,
 	}
 }
 
+// Handle executes the client's commands one at a time and replies in order.
+// Commands are read by a separate goroutine, so a disconnect is noticed, and
+// a blocked command released, even while a command is still running.
 func (c *Client) Handle() {
 	defer func() {
 		if r := recover(); r != nil {
 			log.Printf("Client handler panic: %v", r)
 		}
+		close(c.done)
+		if c.subscriber != nil {
+			c.subscriber.Close()
+		}
+		c.processor.CloseSession(c.session)
 		c.Close()
 	}()
 
-	for {
-		if c.closed {
+	requests := make(chan request)
+	go c.readRequests(requests)
+
+	for req := range requests {
+		if c.isClosed() {
 			return
 		}
+		if req.err != nil {
+			c.WriteError(fmt.Sprintf("ERR invalid command: %v", req.err))
+			continue
+		}
+
+		if c.handlePubSub(req.value) {
+			continue
+		}
 
+		if isCDCSubscribe(req.value) {
+			if c.streamCDC(req.value.Array[2:], requests) {
+				return
+			}
+			continue
+		}
+
+		response := c.processor.ProcessFor(c.session, req.value)
+
+		c.Write(response)
+	}
+}
+
+// readRequests decodes commands until the connection fails, then closes the
+// session so that a command blocked on the client's behalf returns.
+func (c *Client) readRequests(requests chan<- request) {
+	defer close(requests)
+	defer c.processor.CloseSession(c.session)
+	for {
 		value, err := resp.Decode(c.reader)
 		if err != nil {
-			if err.Error() == "EOF" { 
+			var netErr net.Error
+			if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, net.ErrClosed) || errors.As(err, &netErr) {
 				log.Printf("Client disconnected: %s", c.conn.RemoteAddr())
 				return
 			}
 			log.Printf("Error decoding RESP command from %s: %v", c.conn.RemoteAddr(), err)
-			c.WriteError(fmt.Sprintf("ERR invalid command: %v", err))
-			continue
 		}
+		select {
+		case requests <- request{value: value, err: err}:
+		case <-c.done:
+			return
+		}
+	}
+}
 
-		response := c.processor.Process(value)
+func isCDCSubscribe(value resp.Value) bool {
+	return value.Type == resp.ArrayType && len(value.Array) >= 2 &&
+		strings.EqualFold(string(value.Array[0].Bulk), "CDC") &&
+		strings.EqualFold(string(value.Array[1].Bulk), "SUBSCRIBE")
+}
 
-		c.Write(response)
+// streamCDC turns the connection into a CDC feed: after a confirmation reply
+// every write event is pushed as an array until the client disconnects.
+// CDC SUBSCRIBE [offset] resumes from offset; without it only new events are
+// sent. It reports whether it subscribed; if not, it has replied with an
+// error and the client keeps sending commands.
+func (c *Client) streamCDC(args []resp.Value, requests <-chan request) bool {
+	if len(args) > 1 {
+		c.WriteError("ERR wrong number of arguments for 'cdc|subscribe' command")
+		return false
+	}
+	from := uint64(0)
+	if len(args) == 1 {
+		offset, err := strconv.ParseUint(string(args[0].Bulk), 10, 64)
+		if err != nil {
+			c.WriteError("ERR value is not an integer or out of range")
+			return false
+		}
+		from = offset
 	}
+
+	sub, err := c.processor.CDC().Subscribe(from)
+	if err != nil {
+		c.WriteError(fmt.Sprintf("ERR %v", err))
+		return false
+	}
+	defer sub.Close()
+
+	c.Write(resp.NewArray([]resp.Value{
+		resp.NewBulkString([]byte("subscribe")),
+		resp.NewBulkString([]byte("cdc")),
+		resp.NewInteger(int64(c.processor.CDC().Offset())),
+	}))
+
+	go func() {
+		for range requests {
+		}
+		sub.Close()
+	}()
+
+	for ev := range sub.C {
+		c.Write(ev.RESP())
+		if c.isClosed() {
+			return true
+		}
+	}
+	if err := sub.Err(); err != nil && err != cdc.ErrClosed {
+		c.WriteError(fmt.Sprintf("ERR %v", err))
+	}
+	return true
 }
 
 func (c *Client) Write(value resp.Value) {
@@ -70,12 +188,12 @@ func (c *Client) Write(value resp.Value) {
 	err := resp.Encode(c.writer, value)
 	if err != nil {
 		log.Printf("Error encoding RESP response to %s: %v", c.conn.RemoteAddr(), err)
-		c.Close()
+		c.closeLocked()
 		return
 	}
 	if err := c.writer.Flush(); err != nil {
 		log.Printf("Error flushing writer to %s: %v", c.conn.RemoteAddr(), err)
-		c.Close()
+		c.closeLocked()
 	}
 }
 
@@ -86,10 +204,20 @@ func (c *Client) WriteError(msg string) {
 func (c *Client) Close() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
+	c.closeLocked()
+}
 
+// closeLocked closes the connection. The caller must hold c.mu.
+func (c *Client) closeLocked() {
 	if !c.closed {
 		c.conn.Close()
 		c.closed = true
 		log.Printf("Client connection closed: %s", c.conn.RemoteAddr())
 	}
 }
+
+func (c *Client) isClosed() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.closed
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/command"
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// brokenConn is a connection whose peer has gone away: reads block until it
+// is closed and writes fail.
+type brokenConn struct {
+	net.Conn
+	closed chan struct{}
+}
+
+func newBrokenConn() *brokenConn {
+	server, _ := net.Pipe()
+	return &brokenConn{Conn: server, closed: make(chan struct{})}
+}
+
+func (c *brokenConn) Write(p []byte) (int, error) {
+	return 0, errors.New("connection reset by peer")
+}
+
+func (c *brokenConn) Close() error {
+	select {
+	case <-c.closed:
+	default:
+		close(c.closed)
+	}
+	return c.Conn.Close()
+}
+
+func within(t *testing.T, d time.Duration, what string, fn func()) {
+	t.Helper()
+	done := make(chan struct{})
+	go func() {
+		fn()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(d):
+		t.Fatalf("%s did not return within %v", what, d)
+	}
+}
+
+func TestWriteToBrokenConnectionCloses(t *testing.T) {
+	db := database.NewDatabase()
+	c := NewClient(newBrokenConn(), command.NewProcessor(db, nil), nil)
+
+	within(t, time.Second, "Write", func() { c.Write(resp.NewSimpleString("OK")) })
+	if !c.isClosed() {
+		t.Fatal("client not closed after a failed write")
+	}
+	within(t, time.Second, "Close", c.Close)
+}
+
+// startServer starts a server on a free local port and returns its address.
+func startServer(t *testing.T) (*Server, string) {
+	t.Helper()
+	srv := NewServer("127.0.0.1:0")
+	if err := srv.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return srv, srv.listener.Addr().String()
+}
+
+func dial(t *testing.T, addr string) *net.TCPConn {
+	t.Helper()
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return conn.(*net.TCPConn)
+}
+
+// send writes a command to conn.
+func send(t *testing.T, conn net.Conn, args ...string) {
+	t.Helper()
+	values := make([]resp.Value, len(args))
+	for i, arg := range args {
+		values[i] = resp.NewBulkString([]byte(arg))
+	}
+	w := bufio.NewWriter(conn)
+	if err := resp.Encode(w, resp.NewArray(values)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func receive(t *testing.T, r *bufio.Reader) resp.Value {
+	t.Helper()
+	v, err := resp.Decode(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
+
+// reset closes conn with an RST, so that later writes to it fail.
+func reset(conn *net.TCPConn) {
+	conn.SetLinger(0)
+	conn.Close()
+}
+
+func TestStopAfterBlockedClientResets(t *testing.T) {
+	srv, addr := startServer(t)
+	conn := dial(t, addr)
+	send(t, conn, "BLPOP", "q", "0")
+	time.Sleep(50 * time.Millisecond)
+	reset(conn)
+	time.Sleep(50 * time.Millisecond)
+
+	within(t, 2*time.Second, "Stop", srv.Stop)
+}
+
+func TestCDCSubscriberResetReleasesSubscription(t *testing.T) {
+	srv, addr := startServer(t)
+	conn := dial(t, addr)
+	r := bufio.NewReader(conn)
+	send(t, conn, "CDC", "SUBSCRIBE")
+	receive(t, r)
+
+	srv.mu.RLock()
+	var client *Client
+	for c := range srv.clients {
+		client = c
+	}
+	srv.mu.RUnlock()
+
+	reset(conn)
+	for i := 0; i < 200; i++ {
+		srv.processor.Process(resp.NewArray([]resp.Value{
+			resp.NewBulkString([]byte("SET")),
+			resp.NewBulkString([]byte("k")),
+			resp.NewBulkString([]byte("v")),
+		}))
+	}
+
+	within(t, 2*time.Second, "the subscriber's handler", func() { <-client.done })
+	within(t, 2*time.Second, "Stop", srv.Stop)
+}
+
+func TestCDCSubscribeErrorKeepsConnection(t *testing.T) {
+	srv, addr := startServer(t)
+	defer srv.Stop()
+	conn := dial(t, addr)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	send(t, conn, "CDC", "SUBSCRIBE", "abc")
+	if v := receive(t, r); v.Type != resp.ErrorType {
+		t.Fatalf("CDC SUBSCRIBE abc = %v, want an error", v)
+	}
+	send(t, conn, "CDC", "SUBSCRIBE", "1", "2")
+	if v := receive(t, r); v.Type != resp.ErrorType {
+		t.Fatalf("CDC SUBSCRIBE 1 2 = %v, want an error", v)
+	}
+	send(t, conn, "PING")
+	if v := receive(t, r); v.Str != "PONG" {
+		t.Fatalf("PING after a failed CDC SUBSCRIBE = %v, want PONG", v)
+	}
+}
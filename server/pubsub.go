@@ -0,0 +1,154 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/HORUSCRIME/goredis/pubsub"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+// subscriberBuffer is how many messages a subscribed client can fall behind
+// before further messages are dropped.
+const subscriberBuffer = 1024
+
+// handlePubSub runs SUBSCRIBE, PSUBSCRIBE, UNSUBSCRIBE and PUNSUBSCRIBE, and
+// while the client is subscribed also PING and the error for every other
+// command. It reports whether it handled the request.
+func (c *Client) handlePubSub(value resp.Value) bool {
+	if value.Type != resp.ArrayType || len(value.Array) == 0 {
+		return false
+	}
+	name := strings.ToUpper(string(value.Array[0].Bulk))
+	args := value.Array[1:]
+	subscribed := c.subscriber != nil && c.subscriber.Count() > 0
+
+	switch name {
+	case "SUBSCRIBE", "PSUBSCRIBE":
+		if len(args) == 0 {
+			c.WriteError(fmt.Sprintf("ERR wrong number of arguments for '%s' command", strings.ToLower(name)))
+			return true
+		}
+		c.subscribe(name, args)
+	case "UNSUBSCRIBE", "PUNSUBSCRIBE":
+		c.unsubscribe(name, args)
+	case "PING":
+		if !subscribed {
+			return false
+		}
+		if len(args) > 1 {
+			c.WriteError("ERR wrong number of arguments for 'ping' command")
+			return true
+		}
+		message := []byte{}
+		if len(args) == 1 {
+			message = args[0].Bulk
+		}
+		c.Write(resp.NewArray([]resp.Value{resp.NewBulkString([]byte("pong")), resp.NewBulkString(message)}))
+	default:
+		if !subscribed {
+			return false
+		}
+		c.WriteError(fmt.Sprintf("ERR Can't execute '%s': only (P)SUBSCRIBE / (P)UNSUBSCRIBE / PING are allowed in this context", strings.ToLower(name)))
+	}
+	return true
+}
+
+// subscribe replies to each channel or pattern as it is added. Messages are
+// held back until the confirmations are written, so none arrives before the
+// confirmation of its subscription.
+func (c *Client) subscribe(name string, args []resp.Value) {
+	if c.subscriber == nil {
+		c.subscriber = c.pubsub.NewSubscriber(subscriberBuffer)
+		go c.forwardMessages(c.subscriber)
+	}
+	c.pubsubMu.Lock()
+	defer c.pubsubMu.Unlock()
+	for _, arg := range args {
+		var count int
+		if name == "SUBSCRIBE" {
+			count = c.subscriber.Subscribe(string(arg.Bulk))
+		} else {
+			count = c.subscriber.PSubscribe(string(arg.Bulk))
+		}
+		c.Write(subscriptionReply(strings.ToLower(name), arg.Bulk, count))
+	}
+}
+
+// unsubscribe removes the given channels or patterns, or all of them when
+// none are given.
+func (c *Client) unsubscribe(name string, args []resp.Value) {
+	kind := strings.ToLower(name)
+	var names []string
+	for _, arg := range args {
+		names = append(names, string(arg.Bulk))
+	}
+	if len(names) == 0 && c.subscriber != nil {
+		if name == "UNSUBSCRIBE" {
+			names = c.subscriber.Channels()
+		} else {
+			names = c.subscriber.Patterns()
+		}
+	}
+	if len(names) == 0 {
+		count := 0
+		if c.subscriber != nil {
+			count = c.subscriber.Count()
+		}
+		c.Write(subscriptionReply(kind, nil, count))
+		return
+	}
+
+	c.pubsubMu.Lock()
+	defer c.pubsubMu.Unlock()
+	for _, n := range names {
+		count := 0
+		if c.subscriber != nil {
+			if name == "UNSUBSCRIBE" {
+				count = c.subscriber.Unsubscribe(n)
+			} else {
+				count = c.subscriber.PUnsubscribe(n)
+			}
+		}
+		c.Write(subscriptionReply(kind, []byte(n), count))
+	}
+}
+
+func subscriptionReply(kind string, name []byte, count int) resp.Value {
+	nameValue := resp.NewNullBulkString()
+	if name != nil {
+		nameValue = resp.NewBulkString(name)
+	}
+	return resp.NewArray([]resp.Value{resp.NewBulkString([]byte(kind)), nameValue, resp.NewInteger(int64(count))})
+}
+
+// forwardMessages pushes the subscriber's messages to the client until the
+// client's handler returns.
+func (c *Client) forwardMessages(sub *pubsub.Subscriber) {
+	for {
+		select {
+		case msg := <-sub.C:
+			c.pubsubMu.Lock()
+			c.Write(messageReply(msg))
+			c.pubsubMu.Unlock()
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func messageReply(msg pubsub.Message) resp.Value {
+	if msg.Pattern != "" {
+		return resp.NewArray([]resp.Value{
+			resp.NewBulkString([]byte("pmessage")),
+			resp.NewBulkString([]byte(msg.Pattern)),
+			resp.NewBulkString([]byte(msg.Channel)),
+			resp.NewBulkString(msg.Payload),
+		})
+	}
+	return resp.NewArray([]resp.Value{
+		resp.NewBulkString([]byte("message")),
+		resp.NewBulkString([]byte(msg.Channel)),
+		resp.NewBulkString(msg.Payload),
+	})
+}
@@ -0,0 +1,100 @@
+package server
+
+import (
+	"bufio"
+	"strconv"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func strs(v resp.Value) []string {
+	var out []string
+	for _, e := range v.Array {
+		switch e.Type {
+		case resp.IntegerType:
+			out = append(out, strconv.FormatInt(e.Num, 10))
+		default:
+			if e.Null {
+				out = append(out, "<nil>")
+			} else {
+				out = append(out, string(e.Bulk))
+			}
+		}
+	}
+	return out
+}
+
+func expect(t *testing.T, r *bufio.Reader, want ...string) {
+	t.Helper()
+	got := strs(receive(t, r))
+	if len(got) != len(want) {
+		t.Fatalf("got %q, want %q", got, want)
+	}
+	for i := range got {
+		if got[i] != want[i] {
+			t.Fatalf("got %q, want %q", got, want)
+		}
+	}
+}
+
+func TestKeyspaceNotificationsOverSubscribe(t *testing.T) {
+	srv, addr := startServer(t)
+	defer srv.Stop()
+
+	sub := dial(t, addr)
+	defer sub.Close()
+	sr := bufio.NewReader(sub)
+	cli := dial(t, addr)
+	defer cli.Close()
+	cr := bufio.NewReader(cli)
+
+	send(t, cli, "CONFIG", "SET", "notify-keyspace-events", "KEA")
+	receive(t, cr)
+
+	send(t, sub, "SUBSCRIBE", "__keyevent@0__:set")
+	expect(t, sr, "subscribe", "__keyevent@0__:set", "1")
+	send(t, sub, "PSUBSCRIBE", "__keyspace@0__:*")
+	expect(t, sr, "psubscribe", "__keyspace@0__:*", "2")
+
+	send(t, cli, "SET", "k", "v")
+	receive(t, cr)
+	// The keyspace message is published before the keyevent one.
+	expect(t, sr, "pmessage", "__keyspace@0__:*", "__keyspace@0__:k", "set")
+	expect(t, sr, "message", "__keyevent@0__:set", "k")
+}
+
+func TestSubscribedMode(t *testing.T) {
+	srv, addr := startServer(t)
+	defer srv.Stop()
+	conn := dial(t, addr)
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	send(t, conn, "SUBSCRIBE")
+	if v := receive(t, r); v.Type != resp.ErrorType {
+		t.Fatalf("SUBSCRIBE without channels = %v, want an error", v)
+	}
+	send(t, conn, "SUBSCRIBE", "a", "b")
+	expect(t, r, "subscribe", "a", "1")
+	expect(t, r, "subscribe", "b", "2")
+
+	send(t, conn, "GET", "k")
+	if v := receive(t, r); v.Type != resp.ErrorType {
+		t.Fatalf("GET while subscribed = %v, want an error", v)
+	}
+	send(t, conn, "PING")
+	expect(t, r, "pong", "")
+
+	send(t, conn, "UNSUBSCRIBE")
+	expect(t, r, "unsubscribe", "a", "1")
+	expect(t, r, "unsubscribe", "b", "0")
+	send(t, conn, "UNSUBSCRIBE")
+	expect(t, r, "unsubscribe", "<nil>", "0")
+
+	// With no subscriptions left the client is back in normal mode.
+	send(t, conn, "PING")
+	if v := receive(t, r); v.Str != "PONG" {
+		t.Fatalf("PING after unsubscribing = %v, want PONG", v)
+	}
+}
@@ -8,6 +8,9 @@ import (
 
 	"github.com/HORUSCRIME/goredis/command"
 	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/persistence"
+	"github.com/HORUSCRIME/goredis/pubsub"
+	"github.com/HORUSCRIME/goredis/resp"
 )
 
 type Server struct {
@@ -17,8 +20,12 @@ type Server struct {
 	mu        sync.RWMutex
 	db        *database.Database
 	processor *command.Processor
+	pubsub    *pubsub.PubSub
+	aof       *persistence.AOF
 	shutdown  chan struct{}
 
+	stopActiveExpire func()
+
 	address string
 }
 
@@ -50,15 +57,53 @@ type Server struct {
 
 func NewServer(address string) *Server {
 	db := database.NewDatabase()
+	ps := pubsub.NewPubSub()
+	notifier := pubsub.NewKeyspaceNotifier(ps)
+	db.AddKeyspaceListener(notifier.Listener(db.Index()))
+	return NewServerWith(address, db, command.NewProcessor(db, notifier), ps)
+}
+
+// NewServerWith creates a server around an existing database and processor,
+// so an embedding application can serve the same data it uses in-process.
+func NewServerWith(address string, db *database.Database, processor *command.Processor, ps *pubsub.PubSub) *Server {
 	return &Server{
 		address:   address,
 		clients:   make(map[*Client]bool),
 		db:        db,
-		processor: command.NewProcessor(db),
+		processor: processor,
+		pubsub:    ps,
 		shutdown:  make(chan struct{}),
 	}
 }
 
+func (s *Server) Processor() *command.Processor {
+	return s.processor
+}
+
+func (s *Server) PubSub() *pubsub.PubSub {
+	return s.pubsub
+}
+
+// EnableAOF replays filename into the database and then appends every write
+// to it. Call it before Start.
+func (s *Server) EnableAOF(filename string) error {
+	aof, err := persistence.NewAOF(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open AOF %s: %w", filename, err)
+	}
+	if err := aof.Load(s.db, s.processor); err != nil {
+		aof.Close()
+		return fmt.Errorf("failed to load AOF %s: %w", filename, err)
+	}
+	s.processor.OnPropagate(func(cmd resp.Value) {
+		if err := aof.AppendCommand(cmd); err != nil {
+			log.Printf("AOF: Failed to append command: %v", err)
+		}
+	})
+	s.aof = aof
+	return nil
+}
+
 func (s *Server) Start() error {
 	listener, err := net.Listen("tcp", s.address)
 	if err != nil {
@@ -67,6 +112,7 @@ func (s *Server) Start() error {
 	s.listener = listener
 	log.Printf("Server listening on %s", s.address)
 
+	s.stopActiveExpire = s.processor.StartActiveExpire(command.ActiveExpireInterval)
 	go s.acceptConnections()
 	return nil
 }
@@ -86,7 +132,7 @@ func (s *Server) acceptConnections() {
 		}
 
 		log.Printf("New client connected: %s", conn.RemoteAddr())
-		client := NewClient(conn, s.processor)
+		client := NewClient(conn, s.processor, s.pubsub)
 		s.addClient(client)
 		go client.Handle()
 	}
@@ -97,6 +143,9 @@ func (s *Server) Stop() {
 	if s.listener != nil {
 		s.listener.Close()
 	}
+	if s.stopActiveExpire != nil {
+		s.stopActiveExpire()
+	}
 
 	s.mu.Lock()
 	for client := range s.clients {
@@ -105,6 +154,10 @@ func (s *Server) Stop() {
 	s.clients = make(map[*Client]bool)
 	s.mu.Unlock()
 
+	if s.aof != nil {
+		s.aof.Close()
+	}
+
 	log.Println("Server stopped.")
 }
 
@@ -0,0 +1,526 @@
+package store
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/resp"
+)
+
+func (s *Store) Get(key string) (string, bool, error) {
+	return s.bulk(s.Do("GET", key))
+}
+
+// Set stores a string value. A zero ttl keeps the key until it is deleted;
+// a positive ttl shorter than a millisecond is rounded up to one.
+func (s *Store) Set(key, value string, ttl time.Duration) error {
+	args := []string{"SET", key, value}
+	if ttl > 0 {
+		args = append(args, "PX", pxArg(ttl))
+	}
+	_, err := s.Do(args...)
+	return err
+}
+
+// SetNX stores value only if key does not exist, as SET key value NX PX ttl.
+// It reports whether the value was stored.
+func (s *Store) SetNX(key, value string, ttl time.Duration) (bool, error) {
+	args := []string{"SET", key, value, "NX"}
+	if ttl > 0 {
+		args = append(args, "PX", pxArg(ttl))
+	}
+	reply, err := s.Do(args...)
+	return err == nil && !reply.Null, err
+}
+
+// pxArg formats a positive ttl as the milliseconds of a PX option, which
+// must be at least 1.
+func pxArg(ttl time.Duration) string {
+	return strconv.FormatInt(max(ttl.Milliseconds(), 1), 10)
+}
+
+func (s *Store) MGet(keys ...string) ([]*string, error) {
+	reply, err := s.Do(append([]string{"MGET"}, keys...)...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]*string, len(reply.Array))
+	for i, v := range reply.Array {
+		if !v.Null {
+			str := string(v.Bulk)
+			result[i] = &str
+		}
+	}
+	return result, nil
+}
+
+func (s *Store) MSet(pairs map[string]string) error {
+	args := []string{"MSET"}
+	for key, value := range pairs {
+		args = append(args, key, value)
+	}
+	_, err := s.Do(args...)
+	return err
+}
+
+func (s *Store) Del(keys ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"DEL"}, keys...)...))
+}
+
+func (s *Store) Exists(keys ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"EXISTS"}, keys...)...))
+}
+
+func (s *Store) Type(key string) (string, error) {
+	reply, err := s.Do("TYPE", key)
+	return reply.Str, err
+}
+
+func (s *Store) Incr(key string) (int64, error) {
+	return s.integer64(s.Do("INCR", key))
+}
+
+func (s *Store) Decr(key string) (int64, error) {
+	return s.integer64(s.Do("DECR", key))
+}
+
+func (s *Store) IncrBy(key string, delta int64) (int64, error) {
+	return s.integer64(s.Do("INCRBY", key, strconv.FormatInt(delta, 10)))
+}
+
+func (s *Store) DecrBy(key string, delta int64) (int64, error) {
+	return s.integer64(s.Do("DECRBY", key, strconv.FormatInt(delta, 10)))
+}
+
+func (s *Store) IncrByFloat(key string, delta float64) (float64, error) {
+	str, _, err := s.bulk(s.Do("INCRBYFLOAT", key, strconv.FormatFloat(delta, 'g', -1, 64)))
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(str, 64)
+}
+
+func (s *Store) Append(key, value string) (int, error) {
+	return s.integer(s.Do("APPEND", key, value))
+}
+
+func (s *Store) StrLen(key string) (int, error) {
+	return s.integer(s.Do("STRLEN", key))
+}
+
+func (s *Store) GetRange(key string, start, end int) (string, error) {
+	str, _, err := s.bulk(s.Do("GETRANGE", key, strconv.Itoa(start), strconv.Itoa(end)))
+	return str, err
+}
+
+func (s *Store) SetRange(key string, offset int, value string) (int, error) {
+	return s.integer(s.Do("SETRANGE", key, strconv.Itoa(offset), value))
+}
+
+// SetBit sets or clears the bit at offset in the string at key and returns
+// the bit's previous value.
+func (s *Store) SetBit(key string, offset int64, value bool) (bool, error) {
+	bit := "0"
+	if value {
+		bit = "1"
+	}
+	old, err := s.integer(s.Do("SETBIT", key, strconv.FormatInt(offset, 10), bit))
+	return old == 1, err
+}
+
+func (s *Store) GetBit(key string, offset int64) (bool, error) {
+	bit, err := s.integer(s.Do("GETBIT", key, strconv.FormatInt(offset, 10)))
+	return bit == 1, err
+}
+
+func (s *Store) BitCount(key string) (int64, error) {
+	return s.integer64(s.Do("BITCOUNT", key))
+}
+
+func (s *Store) PFAdd(key string, elements ...string) (bool, error) {
+	changed, err := s.integer(s.Do(append([]string{"PFADD", key}, elements...)...))
+	return changed == 1, err
+}
+
+func (s *Store) PFCount(keys ...string) (int64, error) {
+	return s.integer64(s.Do(append([]string{"PFCOUNT"}, keys...)...))
+}
+
+// Evict removes key as a cache eviction, firing OnEvict hooks and "evicted"
+// keyspace notifications instead of a deletion.
+func (s *Store) Evict(key string) bool {
+	return s.processor.Evict(key)
+}
+
+func (s *Store) LPush(key string, elements ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"LPUSH", key}, elements...)...))
+}
+
+func (s *Store) RPush(key string, elements ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"RPUSH", key}, elements...)...))
+}
+
+func (s *Store) LPop(key string) (string, bool, error) {
+	return s.bulk(s.Do("LPOP", key))
+}
+
+func (s *Store) RPop(key string) (string, bool, error) {
+	return s.bulk(s.Do("RPOP", key))
+}
+
+func (s *Store) LLen(key string) (int, error) {
+	return s.integer(s.Do("LLEN", key))
+}
+
+func (s *Store) LRange(key string, start, stop int) ([]string, error) {
+	return s.strings(s.Do("LRANGE", key, strconv.Itoa(start), strconv.Itoa(stop)))
+}
+
+func (s *Store) LIndex(key string, index int) (string, bool, error) {
+	return s.bulk(s.Do("LINDEX", key, strconv.Itoa(index)))
+}
+
+func (s *Store) LRem(key string, count int, element string) (int, error) {
+	return s.integer(s.Do("LREM", key, strconv.Itoa(count), element))
+}
+
+func (s *Store) LTrim(key string, start, stop int) error {
+	_, err := s.Do("LTRIM", key, strconv.Itoa(start), strconv.Itoa(stop))
+	return err
+}
+
+func (s *Store) HSet(key string, fields map[string]string) (int, error) {
+	args := []string{"HSET", key}
+	for field, value := range fields {
+		args = append(args, field, value)
+	}
+	return s.integer(s.Do(args...))
+}
+
+func (s *Store) HGet(key, field string) (string, bool, error) {
+	return s.bulk(s.Do("HGET", key, field))
+}
+
+func (s *Store) HDel(key string, fields ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"HDEL", key}, fields...)...))
+}
+
+func (s *Store) HLen(key string) (int, error) {
+	return s.integer(s.Do("HLEN", key))
+}
+
+func (s *Store) HGetAll(key string) (map[string]string, error) {
+	reply, err := s.Do("HGETALL", key)
+	if err != nil {
+		return nil, err
+	}
+	result := make(map[string]string, len(reply.Array)/2)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		result[string(reply.Array[i].Bulk)] = string(reply.Array[i+1].Bulk)
+	}
+	return result, nil
+}
+
+func (s *Store) HExists(key, field string) (bool, error) {
+	exists, err := s.integer(s.Do("HEXISTS", key, field))
+	return exists == 1, err
+}
+
+func (s *Store) HKeys(key string) ([]string, error) {
+	return s.strings(s.Do("HKEYS", key))
+}
+
+func (s *Store) HIncrBy(key, field string, delta int64) (int64, error) {
+	return s.integer64(s.Do("HINCRBY", key, field, strconv.FormatInt(delta, 10)))
+}
+
+// HPExpire sets a ttl on fields of the hash at key, as HPEXPIRE, and returns
+// the per-field reply codes: -2 no such field, 1 set, 2 deleted.
+func (s *Store) HPExpire(key string, ttl time.Duration, fields ...string) ([]int64, error) {
+	args := []string{"HPEXPIRE", key, strconv.FormatInt(ttl.Milliseconds(), 10), "FIELDS", strconv.Itoa(len(fields))}
+	reply, err := s.Do(append(args, fields...)...)
+	if err != nil {
+		return nil, err
+	}
+	result := make([]int64, len(reply.Array))
+	for i, v := range reply.Array {
+		result[i] = v.Num
+	}
+	return result, nil
+}
+
+// HScan returns the fields and values, alternating, of one HSCAN step and the
+// cursor for the next; a returned cursor of 0 ends the iteration. An empty
+// match returns every field.
+func (s *Store) HScan(key string, cursor uint64, match string, count int) ([]string, uint64, error) {
+	args := []string{"HSCAN", key, strconv.FormatUint(cursor, 10)}
+	if match != "" {
+		args = append(args, "MATCH", match)
+	}
+	if count > 0 {
+		args = append(args, "COUNT", strconv.Itoa(count))
+	}
+	reply, err := s.Do(args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	next, _ := strconv.ParseUint(string(reply.Array[0].Bulk), 10, 64)
+	elements, err := s.strings(reply.Array[1], nil)
+	return elements, next, err
+}
+
+func (s *Store) SAdd(key string, members ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"SADD", key}, members...)...))
+}
+
+func (s *Store) SRem(key string, members ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"SREM", key}, members...)...))
+}
+
+func (s *Store) SIsMember(key, member string) (bool, error) {
+	n, err := s.integer(s.Do("SISMEMBER", key, member))
+	return n == 1, err
+}
+
+func (s *Store) SMembers(key string) ([]string, error) {
+	return s.strings(s.Do("SMEMBERS", key))
+}
+
+func (s *Store) SInter(keys ...string) ([]string, error) {
+	return s.strings(s.Do(append([]string{"SINTER"}, keys...)...))
+}
+
+func (s *Store) SUnion(keys ...string) ([]string, error) {
+	return s.strings(s.Do(append([]string{"SUNION"}, keys...)...))
+}
+
+func (s *Store) SCard(key string) (int, error) {
+	return s.integer(s.Do("SCARD", key))
+}
+
+func (s *Store) ZAdd(key string, members ...database.ZSetMember) (int, error) {
+	args := []string{"ZADD", key}
+	for _, m := range members {
+		args = append(args, strconv.FormatFloat(m.Score, 'g', -1, 64), m.Member)
+	}
+	return s.integer(s.Do(args...))
+}
+
+func (s *Store) ZScore(key, member string) (float64, bool, error) {
+	str, ok, err := s.bulk(s.Do("ZSCORE", key, member))
+	if !ok || err != nil {
+		return 0, ok, err
+	}
+	score, err := strconv.ParseFloat(str, 64)
+	return score, true, err
+}
+
+// GeoAdd stores member at the given position in the sorted set at key.
+func (s *Store) GeoAdd(key string, lon, lat float64, member string) (int, error) {
+	return s.integer(s.Do("GEOADD", key, strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64), member))
+}
+
+// GeoDist returns the distance in meters between two members, and false
+// when either is missing.
+func (s *Store) GeoDist(key, member1, member2 string) (float64, bool, error) {
+	str, ok, err := s.bulk(s.Do("GEODIST", key, member1, member2))
+	if !ok || err != nil {
+		return 0, ok, err
+	}
+	dist, err := strconv.ParseFloat(str, 64)
+	return dist, true, err
+}
+
+// GeoSearchRadius returns the members within radius meters of a position,
+// nearest first.
+func (s *Store) GeoSearchRadius(key string, lon, lat, radius float64) ([]string, error) {
+	return s.strings(s.Do("GEOSEARCH", key,
+		"FROMLONLAT", strconv.FormatFloat(lon, 'f', -1, 64), strconv.FormatFloat(lat, 'f', -1, 64),
+		"BYRADIUS", strconv.FormatFloat(radius, 'f', -1, 64), "m", "ASC"))
+}
+
+func (s *Store) ZRem(key string, members ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"ZREM", key}, members...)...))
+}
+
+func (s *Store) ZCard(key string) (int, error) {
+	return s.integer(s.Do("ZCARD", key))
+}
+
+// ZIncrBy adds delta to the score of member, creating it with a score of
+// delta if needed, and returns the new score.
+func (s *Store) ZIncrBy(key, member string, delta float64) (float64, error) {
+	reply, err := s.Do("ZINCRBY", key, strconv.FormatFloat(delta, 'g', -1, 64), member)
+	if err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(reply.Bulk), 64)
+}
+
+// ZUnionStore stores the union of the sorted sets (or sets) at keys in dst,
+// summing scores, and returns its size.
+func (s *Store) ZUnionStore(dst string, keys ...string) (int, error) {
+	args := append([]string{"ZUNIONSTORE", dst, strconv.Itoa(len(keys))}, keys...)
+	return s.integer(s.Do(args...))
+}
+
+// ZPopMin removes and returns up to count members with the lowest scores.
+func (s *Store) ZPopMin(key string, count int) ([]database.ZSetMember, error) {
+	return s.zsetMembers(s.Do("ZPOPMIN", key, strconv.Itoa(count)))
+}
+
+// ZRemRangeByScore removes the members scored between min and max inclusive.
+func (s *Store) ZRemRangeByScore(key string, min, max float64) (int, error) {
+	return s.integer(s.Do("ZREMRANGEBYSCORE", key,
+		strconv.FormatFloat(min, 'g', -1, 64), strconv.FormatFloat(max, 'g', -1, 64)))
+}
+
+// ZRangeByScore returns the members scored between min and max inclusive, in
+// ascending order. Use math.Inf for unbounded ranges.
+func (s *Store) ZRangeByScore(key string, min, max float64) ([]database.ZSetMember, error) {
+	return s.zsetMembers(s.Do("ZRANGEBYSCORE", key,
+		strconv.FormatFloat(min, 'g', -1, 64), strconv.FormatFloat(max, 'g', -1, 64), "WITHSCORES"))
+}
+
+// ZRange returns the members ranked start to stop inclusive in ascending
+// order; negative indexes count from the highest score.
+func (s *Store) ZRange(key string, start, stop int) ([]database.ZSetMember, error) {
+	return s.zsetMembers(s.Do("ZRANGE", key, strconv.Itoa(start), strconv.Itoa(stop), "WITHSCORES"))
+}
+
+// ZRank returns the 0-based rank of member in ascending order. ok is false
+// when the member or key does not exist.
+func (s *Store) ZRank(key, member string) (rank int, ok bool, err error) {
+	reply, err := s.Do("ZRANK", key, member)
+	if err != nil || reply.Null {
+		return 0, false, err
+	}
+	return int(reply.Num), true, nil
+}
+
+// Sort returns the sorted elements of the list, set or sorted set at key.
+// options are passed through, for example "BY", "w_*", "ALPHA" or
+// "LIMIT", "0", "10".
+func (s *Store) Sort(key string, options ...string) ([]string, error) {
+	return s.strings(s.Do(append([]string{"SORT", key}, options...)...))
+}
+
+// XAdd appends an entry with an automatic ID to the stream at key and
+// returns the ID. fields holds field, value pairs.
+func (s *Store) XAdd(key string, fields ...string) (string, error) {
+	value, _, err := s.bulk(s.Do(append([]string{"XADD", key, "*"}, fields...)...))
+	return value, err
+}
+
+// XRange returns the entries with IDs between start and end inclusive; "-"
+// and "+" stand for the first and last entries.
+func (s *Store) XRange(key, start, end string) ([]database.StreamEntry, error) {
+	return s.streamEntries(s.Do("XRANGE", key, start, end))
+}
+
+func (s *Store) XLen(key string) (int, error) {
+	return s.integer(s.Do("XLEN", key))
+}
+
+// XGroupCreate creates a consumer group that starts after id, "$" standing
+// for the last entry, and creates the stream if needed.
+func (s *Store) XGroupCreate(key, group, id string) error {
+	_, err := s.Do("XGROUP", "CREATE", key, group, id, "MKSTREAM")
+	return err
+}
+
+// XReadGroup delivers up to count entries of the stream at key that were
+// never delivered to group, all when count is 0, and adds them to the
+// pending entries of consumer.
+func (s *Store) XReadGroup(group, consumer, key string, count int) ([]database.StreamEntry, error) {
+	reply, err := s.Do("XREADGROUP", "GROUP", group, consumer, "COUNT", strconv.Itoa(count), "STREAMS", key, ">")
+	if err != nil || reply.Null {
+		return nil, err
+	}
+	return s.streamEntries(reply.Array[0].Array[1], nil)
+}
+
+func (s *Store) XAck(key, group string, ids ...string) (int, error) {
+	return s.integer(s.Do(append([]string{"XACK", key, group}, ids...)...))
+}
+
+// JSONSet sets the value at path in the JSON document at key to the JSON
+// text value. A new key must be set at the root, "$".
+func (s *Store) JSONSet(key, path, value string) error {
+	_, err := s.Do("JSON.SET", key, path, value)
+	return err
+}
+
+// JSONGet returns the serialized values at paths in the JSON document at
+// key, the whole document when no path is given, and false when the key
+// does not exist.
+func (s *Store) JSONGet(key string, paths ...string) (string, bool, error) {
+	return s.bulk(s.Do(append([]string{"JSON.GET", key}, paths...)...))
+}
+
+// JSONDel deletes the values at path in the JSON document at key and
+// returns how many it deleted.
+func (s *Store) JSONDel(key, path string) (int, error) {
+	return s.integer(s.Do("JSON.DEL", key, path))
+}
+
+func (s *Store) streamEntries(reply resp.Value, err error) ([]database.StreamEntry, error) {
+	if err != nil {
+		return nil, err
+	}
+	entries := make([]database.StreamEntry, len(reply.Array))
+	for i, v := range reply.Array {
+		id, _ := database.ParseStreamID(string(v.Array[0].Bulk), 0)
+		fields, _ := s.strings(v.Array[1], nil)
+		entries[i] = database.StreamEntry{ID: id, Fields: fields}
+	}
+	return entries, nil
+}
+
+func (s *Store) zsetMembers(reply resp.Value, err error) ([]database.ZSetMember, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]database.ZSetMember, 0, len(reply.Array)/2)
+	for i := 0; i+1 < len(reply.Array); i += 2 {
+		score, err := strconv.ParseFloat(string(reply.Array[i+1].Bulk), 64)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, database.ZSetMember{Member: string(reply.Array[i].Bulk), Score: score})
+	}
+	return result, nil
+}
+
+func (s *Store) bulk(reply resp.Value, err error) (string, bool, error) {
+	if err != nil || reply.Null {
+		return "", false, err
+	}
+	return string(reply.Bulk), true, nil
+}
+
+func (s *Store) integer64(reply resp.Value, err error) (int64, error) {
+	if err != nil {
+		return 0, err
+	}
+	return reply.Num, nil
+}
+
+func (s *Store) integer(reply resp.Value, err error) (int, error) {
+	if err != nil {
+		return 0, err
+	}
+	return int(reply.Num), nil
+}
+
+func (s *Store) strings(reply resp.Value, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	result := make([]string, len(reply.Array))
+	for i, v := range reply.Array {
+		result[i] = string(v.Bulk)
+	}
+	return result, nil
+}
@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/HORUSCRIME/goredis/database"
+)
+
+func TestTypedStrings(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	if _, ok, err := s.Get("k"); ok || err != nil {
+		t.Fatalf("Get of a missing key = %v, %v", ok, err)
+	}
+	if ok, _ := s.SetNX("k", "1", 0); !ok {
+		t.Fatal("SetNX of a new key did not store it")
+	}
+	if ok, _ := s.SetNX("k", "2", 0); ok {
+		t.Fatal("SetNX replaced an existing key")
+	}
+	if n, err := s.IncrBy("k", 41); n != 42 || err != nil {
+		t.Fatalf("IncrBy = %d, %v, want 42", n, err)
+	}
+	if f, err := s.IncrByFloat("k", 0.5); f != 42.5 || err != nil {
+		t.Fatalf("IncrByFloat = %v, %v, want 42.5", f, err)
+	}
+	if _, err := s.Incr("k"); err == nil {
+		t.Fatal("Incr of a float succeeded")
+	}
+
+	s.MSet(map[string]string{"a": "x", "b": "y"})
+	values, _ := s.MGet("a", "missing", "b")
+	if len(values) != 3 || *values[0] != "x" || values[1] != nil || *values[2] != "y" {
+		t.Fatalf("MGet = %v", values)
+	}
+	if n, _ := s.Del("a", "b", "missing"); n != 2 {
+		t.Fatalf("Del removed %d keys, want 2", n)
+	}
+}
+
+func TestTypedWrongType(t *testing.T) {
+	s := New()
+	defer s.Close()
+	s.LPush("l", "a")
+	if _, _, err := s.Get("l"); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("Get of a list = %v, want ErrWrongType", err)
+	}
+	if _, err := s.HSet("l", map[string]string{"f": "v"}); !errors.Is(err, ErrWrongType) {
+		t.Fatalf("HSet of a list = %v, want ErrWrongType", err)
+	}
+	if typ, _ := s.Type("l"); typ != "list" {
+		t.Fatalf("Type = %q, want list", typ)
+	}
+}
+
+func TestTypedCollections(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.RPush("l", "a", "b", "c")
+	if got, _ := s.LRange("l", 0, -1); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("LRange = %q", got)
+	}
+	if v, ok, _ := s.RPop("l"); v != "c" || !ok {
+		t.Fatalf("RPop = %q, %v", v, ok)
+	}
+
+	s.HSet("h", map[string]string{"a": "1", "b": "2"})
+	if all, _ := s.HGetAll("h"); len(all) != 2 || all["b"] != "2" {
+		t.Fatalf("HGetAll = %v", all)
+	}
+
+	s.ZAdd("z", database.ZSetMember{Member: "a", Score: 1}, database.ZSetMember{Member: "b", Score: 2.5})
+	members, err := s.ZRangeByScore("z", math.Inf(-1), math.Inf(1))
+	if err != nil || len(members) != 2 || members[1] != (database.ZSetMember{Member: "b", Score: 2.5}) {
+		t.Fatalf("ZRangeByScore over all scores = %v, %v", members, err)
+	}
+	if rank, ok, _ := s.ZRank("z", "b"); rank != 1 || !ok {
+		t.Fatalf("ZRank = %d, %v", rank, ok)
+	}
+	if _, ok, _ := s.ZRank("z", "missing"); ok {
+		t.Fatal("ZRank found a missing member")
+	}
+
+	s.JSONSet("j", "$", `{"a":[1,2]}`)
+	if doc, ok, _ := s.JSONGet("j", "$.a[1]"); doc != "[2]" || !ok {
+		t.Fatalf("JSONGet = %q, %v", doc, ok)
+	}
+}
+
+func TestHooks(t *testing.T) {
+	s := New()
+	defer s.Close()
+	var set, removed, deleted []string
+	s.OnSet(func(key string) { set = append(set, key) })
+	s.OnRemove(func(key string) { removed = append(removed, key) })
+	s.OnDelete(func(key string) { deleted = append(deleted, key) })
+
+	s.Set("a", "1", 0)
+	s.RPush("l", "x", "y")
+	s.LPop("l")
+	s.HSet("h", map[string]string{"f": "1"})
+	s.Do("HDEL", "h", "f")
+	s.Do("EXPIRE", "a", "100")
+	s.SAdd("s", "m", "n")
+	s.Do("SREM", "s", "m")
+	s.LPop("l")
+	s.Del("a")
+	if !slices.Equal(set, []string{"a", "l", "h", "s"}) {
+		t.Fatalf("OnSet saw %q", set)
+	}
+	if !slices.Equal(removed, []string{"l", "h", "s", "l"}) {
+		t.Fatalf("OnRemove saw %q", removed)
+	}
+	if !slices.Equal(deleted, []string{"h", "l", "a"}) {
+		t.Fatalf("OnDelete saw %q", deleted)
+	}
+}
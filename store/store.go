@@ -0,0 +1,189 @@
+// Package store embeds GoRedis in-process. A Store runs commands through the
+// same handlers the network server uses, so typed calls such as Get or LPush
+// behave exactly like their RESP counterparts, and the Store can also be
+// served over TCP with Listen.
+package store
+
+import (
+	"errors"
+	"strings"
+	"sync"
+
+	"github.com/HORUSCRIME/goredis/cdc"
+	"github.com/HORUSCRIME/goredis/command"
+	"github.com/HORUSCRIME/goredis/database"
+	"github.com/HORUSCRIME/goredis/pubsub"
+	"github.com/HORUSCRIME/goredis/resp"
+	"github.com/HORUSCRIME/goredis/server"
+)
+
+var ErrWrongType = errors.New("WRONGTYPE Operation against a key holding the wrong kind of value")
+
+type KeyFunc func(key string)
+
+// Store is an in-process database. Its hooks report which keys commands
+// change: OnSet for writes, OnRemove for commands that take fields, members
+// or elements out of a key, OnDelete for keys deleted by a command, OnExpire
+// and OnEvict for keys removed by expiration and eviction. Changes to a TTL
+// fire no hook. A command that removes a key's last element fires OnRemove
+// and then OnDelete, since the emptied key is deleted.
+//
+// Hooks run synchronously while the command that triggered them still holds
+// the store's write lock, so they must not call back into the Store, or they
+// deadlock; hand the key off to another goroutine instead.
+type Store struct {
+	db        *database.Database
+	pubsub    *pubsub.PubSub
+	notifier  *pubsub.KeyspaceNotifier
+	processor *command.Processor
+
+	stopActiveExpire func()
+
+	mu       sync.RWMutex
+	onSet    []KeyFunc
+	onRemove []KeyFunc
+	onDelete []KeyFunc
+	onExpire []KeyFunc
+	onEvict  []KeyFunc
+}
+
+// New creates an empty store. It reclaims expired keys and hash fields in
+// the background, firing OnExpire hooks, until Close is called.
+func New() *Store {
+	db := database.NewDatabase()
+	ps := pubsub.NewPubSub()
+	notifier := pubsub.NewKeyspaceNotifier(ps)
+	db.AddKeyspaceListener(notifier.Listener(db.Index()))
+
+	s := &Store{
+		db:        db,
+		pubsub:    ps,
+		notifier:  notifier,
+		processor: command.NewProcessor(db, notifier),
+	}
+	db.AddKeyspaceListener(s.dispatch)
+	s.stopActiveExpire = s.processor.StartActiveExpire(command.ActiveExpireInterval)
+	return s
+}
+
+// Close stops the store's background expiration. Servers started with
+// Listen must be stopped separately.
+func (s *Store) Close() {
+	s.stopActiveExpire()
+}
+
+func (s *Store) Processor() *command.Processor {
+	return s.processor
+}
+
+func (s *Store) Database() *database.Database {
+	return s.db
+}
+
+func (s *Store) PubSub() *pubsub.PubSub {
+	return s.pubsub
+}
+
+// CDC returns the change-data-capture feed of every write applied to the
+// store, whether it came from an in-process call or a network client.
+func (s *Store) CDC() *cdc.Feed {
+	return s.processor.CDC()
+}
+
+// Listen serves the store over RESP on address. Writes made through the
+// network are visible to in-process callers and fire the same hooks.
+func (s *Store) Listen(address string) (*server.Server, error) {
+	srv := server.NewServerWith(address, s.db, s.processor, s.pubsub)
+	if err := srv.Start(); err != nil {
+		return nil, err
+	}
+	return srv, nil
+}
+
+// OnSet registers fn to be called whenever a command writes to a key, other
+// than by removing from it.
+func (s *Store) OnSet(fn KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onSet = append(s.onSet, fn)
+}
+
+// OnRemove registers fn to be called whenever a command removes hash fields,
+// set or sorted set members, list elements, stream entries or JSON values
+// from a key, including hash fields that expire.
+func (s *Store) OnRemove(fn KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onRemove = append(s.onRemove, fn)
+}
+
+func (s *Store) OnDelete(fn KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onDelete = append(s.onDelete, fn)
+}
+
+func (s *Store) OnExpire(fn KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onExpire = append(s.onExpire, fn)
+}
+
+func (s *Store) OnEvict(fn KeyFunc) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.onEvict = append(s.onEvict, fn)
+}
+
+// removeEvents are the keyspace events of commands that take part of a
+// value out of a key, which fire OnRemove rather than OnSet.
+var removeEvents = map[string]bool{
+	"hdel": true, "hexpired": true,
+	"srem": true, "spop": true,
+	"lpop": true, "rpop": true, "lrem": true, "ltrim": true,
+	"zrem": true, "zpopmin": true, "zpopmax": true,
+	"zremrangebyrank": true, "zremrangebyscore": true, "zremrangebylex": true,
+	"xdel": true, "xtrim": true,
+	"json.del": true, "json.arrpop": true,
+}
+
+func (s *Store) dispatch(class int, event, key string) {
+	s.mu.RLock()
+	var hooks []KeyFunc
+	switch {
+	case event == "del":
+		hooks = s.onDelete
+	case event == "expired":
+		hooks = s.onExpire
+	case event == "evicted":
+		hooks = s.onEvict
+	case removeEvents[event]:
+		hooks = s.onRemove
+	case event == "new", event == "keymiss",
+		event == "expire", event == "persist", event == "hexpire", event == "hpersist":
+	default:
+		hooks = s.onSet
+	}
+	s.mu.RUnlock()
+
+	for _, fn := range hooks {
+		fn(key)
+	}
+}
+
+// Do runs an arbitrary command and returns its raw reply. Error replies are
+// returned as Go errors.
+func (s *Store) Do(args ...string) (resp.Value, error) {
+	cmd := make([]resp.Value, len(args))
+	for i, arg := range args {
+		cmd[i] = resp.NewBulkString([]byte(arg))
+	}
+	reply := s.processor.Process(resp.NewArray(cmd))
+	if reply.Type == resp.ErrorType {
+		if strings.HasPrefix(reply.Str, "WRONGTYPE") {
+			return reply, ErrWrongType
+		}
+		return reply, errors.New(reply.Str)
+	}
+	return reply, nil
+}
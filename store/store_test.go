@@ -0,0 +1,121 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", what)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestActiveExpireWithoutListen(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	expired := make(chan string, 1)
+	s.OnExpire(func(key string) { expired <- key })
+	if err := s.Set("k", "v", 20*time.Millisecond); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case key := <-expired:
+		if key != "k" {
+			t.Fatalf("OnExpire(%q), want k", key)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("OnExpire not called for a key that is never read")
+	}
+}
+
+func TestActiveExpireHashFields(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	if _, err := s.HSet("h", map[string]string{"a": "1", "b": "2"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.HPExpire("h", 20*time.Millisecond, "a"); err != nil {
+		t.Fatal(err)
+	}
+	// The expired field is propagated as an HDEL without the hash being read.
+	offset := s.CDC().Offset()
+	waitFor(t, "the expired field's HDEL", func() bool { return s.CDC().Offset() > offset })
+	if n, _ := s.HLen("h"); n != 1 {
+		t.Fatalf("HLen = %d after field a expired, want 1", n)
+	}
+}
+
+func TestCloseWithListenKeepsServerExpiring(t *testing.T) {
+	s := New()
+	srv, err := s.Listen("127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer srv.Stop()
+	s.Close()
+
+	expired := make(chan string, 1)
+	s.OnExpire(func(key string) { expired <- key })
+	s.Set("k", "v", 20*time.Millisecond)
+	select {
+	case <-expired:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the server's active expiry stopped with the store's")
+	}
+}
+
+func TestEvictPropagatesDel(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	var evicted []string
+	s.OnEvict(func(key string) { evicted = append(evicted, key) })
+	s.Set("k", "v", 0)
+	sub, err := s.CDC().Subscribe(s.CDC().Offset() + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	if !s.Evict("k") {
+		t.Fatal("Evict(k) = false, want true")
+	}
+	if s.Evict("k") {
+		t.Fatal("Evict of a missing key = true, want false")
+	}
+	if len(evicted) != 1 || evicted[0] != "k" {
+		t.Fatalf("OnEvict calls = %q, want [k]", evicted)
+	}
+	select {
+	case ev := <-sub.C:
+		if ev.Command != "DEL" || ev.Key != "k" {
+			t.Fatalf("propagated %s %s, want DEL k", ev.Command, ev.Key)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("the eviction was not propagated")
+	}
+}
+
+func TestSetSubMillisecondTTL(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	if err := s.Set("k", "v", 500*time.Microsecond); err != nil {
+		t.Fatalf("Set with a 500µs ttl: %v", err)
+	}
+	if ok, err := s.SetNX("n", "v", time.Nanosecond); !ok || err != nil {
+		t.Fatalf("SetNX with a 1ns ttl = %v, %v; want true, nil", ok, err)
+	}
+	waitFor(t, "k to expire", func() bool {
+		_, ok, _ := s.Get("k")
+		return !ok
+	})
+}